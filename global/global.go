@@ -3,7 +3,10 @@ package global
 import (
 	"github.com/go-pg/pg/v10"
 	"github.com/go-playground/validator/v10"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/mailer"
 	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/setting"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/storage"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/segment"
 )
 
 var (
@@ -13,5 +16,14 @@ var (
 	// 全局通用的数据库实例
 	DB *pg.DB
 
+	// 学习资料等文件的存储
+	Storage storage.Storage
+
+	// 邮件发送，用于找回密码等
+	Mailer mailer.Mailer
+
+	// 中文分词，用于全文检索
+	Segmenter *segment.Segmenter
+
 	Validator = validator.New()
 )
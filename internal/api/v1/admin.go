@@ -1,6 +1,8 @@
 package v1
 
 import (
+	"errors"
+	"github.com/go-pg/pg/v10"
 	"github.com/kataras/iris/v12"
 	"github.com/kataras/iris/v12/middleware/jwt"
 	"github.com/xuxusheng/time-frequency-be/internal/model"
@@ -10,30 +12,39 @@ import (
 	"github.com/xuxusheng/time-frequency-be/internal/utils"
 )
 
-// 管理员才能调用的接口
+// 用户管理接口，需要对应的权限才能调用
 type IAdmin interface {
 	CreateUser(c iris.Context) // 创建新用户
 
 	GetUser(c iris.Context)  // 查询单个用户详细信息
 	ListUser(c iris.Context) // 查询所有用户
 
-	UpdateUser(c iris.Context)  // 修改用户信息
-	ToggleAdmin(c iris.Context) // 切换用户是否为管理员
+	UpdateUser(c iris.Context)   // 修改用户信息
+	SetUserRoles(c iris.Context) // 设置用户的角色
 
 	DeleteUser(c iris.Context) // 删除用户
+
+	SignOutUser(c iris.Context) // 强制下线用户的所有登录会话
+	UnlockUser(c iris.Context)  // 解锁因登录失败次数过多被锁定的账号
+	UnlockIp(c iris.Context)    // 解锁因登录失败次数过多被锁定的 IP
+	ResetTotp(c iris.Context)   // 重置用户的两步验证
 }
 
 type Admin struct {
-	userSvc service.IUser
+	userSvc       service.IUser
+	roleSvc       service.IRole
+	sessionSvc    service.ISession
+	loginGuardSvc service.ILoginGuard
+	totpSvc       service.ITotp
 }
 
-func NewAdmin(userSvc service.IUser) *Admin {
-	return &Admin{userSvc: userSvc}
+func NewAdmin(userSvc service.IUser, roleSvc service.IRole, sessionSvc service.ISession, loginGuardSvc service.ILoginGuard, totpSvc service.ITotp) *Admin {
+	return &Admin{userSvc: userSvc, roleSvc: roleSvc, sessionSvc: sessionSvc, loginGuardSvc: loginGuardSvc, totpSvc: totpSvc}
 }
 
 // 创建新用户 godoc
 // @summary 创建新用户
-// @description 管理员创建新用户账号，可以指定用户角色和是否为管理员账户
+// @description 创建新用户账号并分配角色，只能分配自己拥有全部权限的角色
 // @accept json
 // @produce json
 // @tags admin
@@ -42,19 +53,17 @@ func NewAdmin(userSvc service.IUser) *Admin {
 // @param phone body string true "手机号"
 // @param email body string true "邮箱"
 // @param password body string true "密码"
-// @param role body string true "用户角色，student 学生或 teacher 老师"  Enums(student, teacher)
-// @param is_admin body bool true "是否是管理员"
+// @param roles body []string true "角色标识，例如 student、teacher"
 // @success 200 {object} swagger.Resp{data=model.User}
 // @router /api/v1/admin/create-user [post]
 func (a Admin) CreateUser(c iris.Context) {
 	p := struct {
-		Name     string `json:"name" validate:"required"`
-		NickName string `json:"nick_name" validate:"required"`
-		Phone    string `json:"phone" validate:"required"`
-		Email    string `json:"email" validate:"required"`
-		Password string `json:"password" validate:"required"`
-		Role     string `json:"role" validate:"required,oneof=student teacher"`
-		IsAdmin  bool   `json:"is_admin"`
+		Name     string   `json:"name" validate:"required"`
+		NickName string   `json:"nick_name" validate:"required"`
+		Phone    string   `json:"phone" validate:"required"`
+		Email    string   `json:"email" validate:"required"`
+		Password string   `json:"password" validate:"required"`
+		Roles    []string `json:"roles" validate:"required,min=1,dive,required"`
 	}{}
 	if ok := utils.BindAndValidate(c, &p); !ok {
 		return
@@ -64,6 +73,20 @@ func (a Admin) CreateUser(c iris.Context) {
 	resp := response.New(c)
 	claims := jwt.Get(c).(*model.JWTClaims)
 
+	err := a.roleSvc.CheckAssignable(ctx, claims.Uid, p.Roles)
+	if err != nil {
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+
+	roles := make([]*model.Role, 0, len(p.Roles))
+	for _, name := range p.Roles {
+		roles = append(roles, &model.Role{Name: name})
+	}
 	user := model.User{
 		CreatedById: claims.Uid,
 		Name:        p.Name,
@@ -71,10 +94,11 @@ func (a Admin) CreateUser(c iris.Context) {
 		Phone:       p.Phone,
 		Email:       p.Email,
 		Password:    p.Password,
-		Role:        p.Role,
-		IsAdmin:     p.IsAdmin,
+		Roles:       roles,
+		// 密码由管理员设置，用户首次登录后需要修改
+		MustChangePassword: true,
 	}
-	err := a.userSvc.Create(ctx, &user)
+	err = a.userSvc.Create(ctx, &user)
 	if err != nil {
 		resp.Error(cerror.ServerError.WithDebugs(err))
 		return
@@ -111,8 +135,7 @@ func (a Admin) GetUser(c iris.Context) {
 // @produce json
 // @tags admin
 // @param query body string false "模糊匹配用户名、昵称、手机号和邮箱"
-// @param role body string false "通过角色筛选老师或者学生"  Enums(student, teacher)
-// @param is_admin body int true "筛选是否是管理员，-1 不限、0 否、1 是" Enums(-1, 0, 1)
+// @param role body string false "通过角色标识筛选，例如 student、teacher"
 // @param pn body int true "pn"
 // @param ps body int true "ps"
 // @success 200 {object} swagger.Resp{data=swagger.DWithP{data=model.User}}
@@ -120,7 +143,7 @@ func (a Admin) GetUser(c iris.Context) {
 func (a Admin) ListUser(c iris.Context) {
 	p := struct {
 		Query string `json:"query"`
-		Role  string `json:"role" validate:"omitempty,oneof=student teacher"`
+		Role  string `json:"role"`
 		Pn    int    `json:"pn" validate:"required"`
 		Ps    int    `json:"ps" validate:"required"`
 	}{}
@@ -143,7 +166,7 @@ func (a Admin) ListUser(c iris.Context) {
 
 // 修改用户信息 godoc
 // @summary 修改用户信息
-// @description 修改某个用户的信息（此接口不允许修改用户是否为管理员）
+// @description 修改某个用户的信息（此接口不修改用户的角色），不能修改权限比自己高的用户
 // @accept json
 // @produce json
 // @tags admin
@@ -152,7 +175,6 @@ func (a Admin) ListUser(c iris.Context) {
 // @param nick_name body string true "用户昵称"
 // @param phone body string true "手机号"
 // @param email body string true "邮箱"
-// @param role body string true "用户角色" Enums(student, teacher)
 // @param password body string false "用户密码，留空则不修改"
 // @success 200 {object} swagger.Resp{data=model.User}
 // @router /api/v1/admin/update-user [post]
@@ -163,7 +185,6 @@ func (a Admin) UpdateUser(c iris.Context) {
 		NickName string `json:"nick_name" validate:"required"`
 		Phone    string `json:"phone" validate:"required"`
 		Email    string `json:"email" validate:"required"`
-		Role     string `json:"role" validate:"required,oneof=student teacher"`
 		Password string `json:"password"`
 	}{}
 	if ok := utils.BindAndValidate(c, &p); !ok {
@@ -172,6 +193,11 @@ func (a Admin) UpdateUser(c iris.Context) {
 
 	ctx := c.Request().Context()
 	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	if !a.checkManageable(c, claims.Uid, p.Id) {
+		return
+	}
 
 	user := model.User{
 		Id:       p.Id,
@@ -180,12 +206,13 @@ func (a Admin) UpdateUser(c iris.Context) {
 		Phone:    p.Phone,
 		Email:    p.Email,
 		Password: p.Password,
-		Role:     p.Role,
 	}
-	columns := []string{"name", "nick_name", "phone", "email", "role"}
+	columns := []string{"name", "nick_name", "phone", "email"}
 	// 如果参数中没有 password 或者 password 为空的话，就不修改用户密码
+	// 重置了密码的话，用户下次登录后需要自己再改一次
 	if user.Password != "" {
-		columns = append(columns, "password")
+		user.MustChangePassword = true
+		columns = append(columns, "password", "must_change_password")
 	}
 	err := a.userSvc.Update(ctx, &user, columns)
 	if err != nil {
@@ -195,20 +222,21 @@ func (a Admin) UpdateUser(c iris.Context) {
 	resp.Success(user)
 }
 
-// 修改账号管理员权限 godoc
-// @summary 修改账号管理员权限
-// @description 修改某个用户是否是管理员，不允许取消自己的管理员权限
+// 设置用户的角色 godoc
+// @summary 设置用户的角色
+// @description 用 roles 替换用户当前的角色，只能分配或收回自己拥有全部权限的角色，不能修改自己的角色
+// @description 角色变化后用户之前签发的 token 全部失效
 // @accept json
 // @produce json
 // @tags admin
 // @param id body int true "用户ID"
-// @param is_admin body bool false "是否管理员"
-// @success 200 {object} swagger.Resp
-// @router /api/v1/admin/toggle-admin [post]
-func (a Admin) ToggleAdmin(c iris.Context) {
+// @param roles body []string true "角色标识"
+// @success 200 {object} swagger.Resp{data=model.User}
+// @router /api/v1/admin/set-user-roles [post]
+func (a Admin) SetUserRoles(c iris.Context) {
 	p := struct {
-		Id      int  `json:"id" validate:"required"`
-		IsAdmin bool `json:"is_admin"`
+		Id    int      `json:"id" validate:"required"`
+		Roles []string `json:"roles" validate:"dive,required"`
 	}{}
 	if ok := utils.BindAndValidate(c, &p); !ok {
 		return
@@ -216,29 +244,27 @@ func (a Admin) ToggleAdmin(c iris.Context) {
 
 	ctx := c.Request().Context()
 	resp := response.New(c)
-
 	claims := jwt.Get(c).(*model.JWTClaims)
 
-	if claims.Uid == p.Id && !p.IsAdmin {
-		resp.Error(cerror.BadRequest.WithMsg("无法取消自己的管理员权限"))
-		return
-	}
-
-	user := model.User{
-		Id:      p.Id,
-		IsAdmin: p.IsAdmin,
-	}
-	err := a.userSvc.Update(ctx, &user, []string{"is_admin"})
+	user, err := a.roleSvc.SetUserRoles(ctx, claims.Uid, p.Id, p.Roles)
 	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("用户不存在"))
+			return
+		}
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
 		resp.Error(cerror.ServerError.WithDebugs(err))
 		return
 	}
-	resp.Success()
+	resp.Success(user)
 }
 
 // 删除账号 godoc
 // @summary 删除账号
-// @description 管理员删除某个账号
+// @description 删除某个账号，不能删除权限比自己高的用户，账号进入回收站，期间无法登录，可以由管理员恢复
 // @accept json
 // @produce json
 // @tags admin
@@ -262,6 +288,9 @@ func (a Admin) DeleteUser(c iris.Context) {
 		resp.Error(cerror.BadRequest.WithMsg("无法删除自己的账号"))
 		return
 	}
+	if !a.checkManageable(c, claims.Uid, p.Id) {
+		return
+	}
 
 	err := a.userSvc.Delete(ctx, p.Id)
 	if err != nil {
@@ -270,3 +299,150 @@ func (a Admin) DeleteUser(c iris.Context) {
 	}
 	resp.Success()
 }
+
+// 强制下线用户 godoc
+// @summary 强制下线用户
+// @description 作废某个用户所有的登录会话，已签发的 token 立即失效，用户需要重新登录
+// @accept json
+// @produce json
+// @tags admin
+// @param id body int true "用户ID"
+// @success 200 {object} swagger.Resp{data=int} "下线的会话数量"
+// @router /api/v1/admin/sign-out-user [post]
+func (a Admin) SignOutUser(c iris.Context) {
+	p := struct {
+		Id int `json:"id" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+
+	n, err := a.sessionSvc.RevokeAll(ctx, p.Id)
+	if err != nil {
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(n)
+}
+
+// 解锁账号 godoc
+// @summary 解锁账号
+// @description 账号连续登录失败次数过多会被锁定一段时间，管理员可以提前解锁，失败次数同时清零
+// @accept json
+// @produce json
+// @tags admin
+// @param id body int true "用户ID"
+// @success 200 {object} swagger.Resp
+// @router /api/v1/admin/unlock-user [post]
+func (a Admin) UnlockUser(c iris.Context) {
+	p := struct {
+		Id int `json:"id" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+
+	user, err := a.userSvc.Get(ctx, p.Id)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("用户不存在"))
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	err = a.loginGuardSvc.Unlock(ctx, user.Name)
+	if err != nil {
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success()
+}
+
+// 解锁 IP godoc
+// @summary 解锁 IP
+// @description 同一 IP 连续登录失败次数过多会被锁定一段时间，例如机房共用出口 IP 时，管理员可以提前解锁
+// @accept json
+// @produce json
+// @tags admin
+// @param ip body string true "IP"
+// @success 200 {object} swagger.Resp
+// @router /api/v1/admin/unlock-ip [post]
+func (a Admin) UnlockIp(c iris.Context) {
+	p := struct {
+		Ip string `json:"ip" validate:"required,ip"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+
+	err := a.loginGuardSvc.UnlockIp(ctx, p.Ip)
+	if err != nil {
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success()
+}
+
+// 重置两步验证 godoc
+// @summary 重置两步验证
+// @description 用户丢失手机又没有恢复码时，由管理员关闭其两步验证，恢复码同时作废
+// @description 管理员要求开启两步验证的用户，下次登录时需要重新设置
+// @accept json
+// @produce json
+// @tags admin
+// @param id body int true "用户ID"
+// @success 200 {object} swagger.Resp
+// @router /api/v1/admin/reset-totp [post]
+func (a Admin) ResetTotp(c iris.Context) {
+	p := struct {
+		Id int `json:"id" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	// 关闭两步验证会降低账号的安全性，不能用在权限比自己高的用户上
+	if !a.checkManageable(c, claims.Uid, p.Id) {
+		return
+	}
+	err := a.totpSvc.Reset(ctx, p.Id)
+	if err != nil {
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success()
+}
+
+// 不能操作权限比自己高的用户，不满足时直接返回错误响应
+func (a Admin) checkManageable(c iris.Context, operatorId, userId int) bool {
+	err := a.roleSvc.CheckManageable(c.Request().Context(), operatorId, userId)
+	if err == nil {
+		return true
+	}
+	resp := response.New(c)
+	if errors.Is(err, pg.ErrNoRows) {
+		resp.Error(cerror.NotFound.WithMsg("用户不存在"))
+		return false
+	}
+	if cerr, ok := err.(cerror.IError); ok {
+		resp.Error(cerr)
+		return false
+	}
+	resp.Error(cerror.ServerError.WithDebugs(err))
+	return false
+}
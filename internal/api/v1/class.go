@@ -0,0 +1,592 @@
+package v1
+
+import (
+	"errors"
+	"github.com/go-pg/pg/v10"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/middleware/jwt"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/response"
+	"github.com/xuxusheng/time-frequency-be/internal/service"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
+)
+
+// 班级管理接口，需要 class.manage 权限，指定班级的老师还需要 class.teacher 权限
+// 只能修改自己任教的班级、管理其中的成员和科目，拥有 student.manage_all 权限时不受限制
+type IClass interface {
+	Create(c iris.Context) // 创建班级
+
+	Get(c iris.Context)  // 查询单个班级
+	List(c iris.Context) // 查询班级列表
+
+	Update(c iris.Context) // 修改班级信息
+
+	Delete(c iris.Context) // 删除班级
+
+	ListMembers(c iris.Context)   // 查询班级成员
+	AddMembers(c iris.Context)    // 将学生加入班级
+	RemoveMembers(c iris.Context) // 将学生移出班级
+
+	ListSubjects(c iris.Context)   // 查询班级已选的科目
+	AddSubjects(c iris.Context)    // 为班级添加科目
+	RemoveSubjects(c iris.Context) // 为班级移除科目
+
+	ListTeachers(c iris.Context)   // 查询班级的老师
+	SetTeacher(c iris.Context)     // 指定班级的班主任或任课老师
+	RemoveTeachers(c iris.Context) // 移除班级的老师
+}
+
+type Class struct {
+	classSvc service.IClass
+}
+
+func NewClass(classSvc service.IClass) *Class {
+	return &Class{classSvc: classSvc}
+}
+
+// --- C ---
+
+// 创建班级 godoc
+// @summary 创建班级
+// @description 老师或管理员创建新班级
+// @accept json
+// @produce json
+// @tags class
+// @param name body string true "班级名称"
+// @param description body string false "班级描述"
+// @success 200 {object} swagger.Resp{data=model.Class}
+// @router /api/v1/teacher/class/create [post]
+func (cl *Class) Create(c iris.Context) {
+	p := struct {
+		Name        string `json:"name" validate:"required"`
+		Description string `json:"description"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	class, err := cl.classSvc.Create(ctx, claims.Uid, p.Name, p.Description)
+	if err != nil {
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(class)
+}
+
+// --- R ---
+
+// 查询单个班级 godoc
+// @summary 查询单个班级
+// @description 查询单个班级的详细信息
+// @accept json
+// @produce json
+// @tags class
+// @param id body int true "班级ID"
+// @success 200 {object} swagger.Resp{data=model.Class}
+// @router /api/v1/teacher/class/get [post]
+func (cl *Class) Get(c iris.Context) {
+	p := struct {
+		Id int `json:"id" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+
+	class, err := cl.classSvc.Get(ctx, p.Id)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("班级不存在"))
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(class)
+}
+
+// 查询班级列表 godoc
+// @summary 查询班级列表
+// @description 分页查询班级列表，支持按名称和描述模糊搜索
+// @accept json
+// @produce json
+// @tags class
+// @param query body string false "模糊匹配班级名称和描述"
+// @param pn body int true "pn"
+// @param ps body int true "ps"
+// @success 200 {object} swagger.Resp{data=swagger.DWithP{data=model.Class}}
+// @router /api/v1/teacher/class/list [post]
+func (cl *Class) List(c iris.Context) {
+	p := struct {
+		Query string `json:"query"`
+		Pn    int    `json:"pn"`
+		Ps    int    `json:"ps"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	page := model.NewPage(p.Pn, p.Ps)
+
+	classes, count, err := cl.classSvc.ListAndCount(ctx, page, p.Query)
+	if err != nil {
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.SuccessList(classes, page.WithTotal(count))
+}
+
+// 查询班级成员 godoc
+// @summary 查询班级成员
+// @description 分页查询某个班级中的学生
+// @description 老师只能操作自己任教的班级，拥有 student.manage_all 权限时不受限制
+// @accept json
+// @produce json
+// @tags class
+// @param id body int true "班级ID"
+// @param query body string false "模糊匹配用户名、昵称、手机号和邮箱"
+// @param pn body int true "pn"
+// @param ps body int true "ps"
+// @success 200 {object} swagger.Resp{data=swagger.DWithP{data=model.User}}
+// @router /api/v1/teacher/class/list-members [post]
+func (cl *Class) ListMembers(c iris.Context) {
+	p := struct {
+		Id    int    `json:"id" validate:"required"`
+		Query string `json:"query"`
+		Pn    int    `json:"pn"`
+		Ps    int    `json:"ps"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+	page := model.NewPage(p.Pn, p.Ps)
+
+	users, count, err := cl.classSvc.ListMembersAndCount(ctx, claims.Uid, p.Id, page, p.Query)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("班级不存在"))
+			return
+		}
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.SuccessList(users, page.WithTotal(count))
+}
+
+// --- U ---
+
+// 修改班级信息 godoc
+// @summary 修改班级信息
+// @description 修改班级名称和描述
+// @description 老师只能操作自己任教的班级，拥有 student.manage_all 权限时不受限制
+// @accept json
+// @produce json
+// @tags class
+// @param id body int true "班级ID"
+// @param name body string true "班级名称"
+// @param description body string false "班级描述"
+// @success 200 {object} swagger.Resp{data=model.Class}
+// @router /api/v1/teacher/class/update [post]
+func (cl *Class) Update(c iris.Context) {
+	p := struct {
+		Id          int    `json:"id" validate:"required"`
+		Name        string `json:"name" validate:"required"`
+		Description string `json:"description"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	class, err := cl.classSvc.Update(ctx, claims.Uid, p.Id, p.Name, p.Description)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("班级不存在"))
+			return
+		}
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(class)
+}
+
+// 将学生加入班级 godoc
+// @summary 将学生加入班级
+// @description 将一个或多个学生加入班级，学生原来所在的班级会被覆盖
+// @description 老师只能操作自己任教的班级，拥有 student.manage_all 权限时不受限制，已经在其他班级中的学生只能由那个班级的老师调整
+// @accept json
+// @produce json
+// @tags class
+// @param id body int true "班级ID"
+// @param user_ids body []int true "学生ID列表"
+// @success 200 {object} swagger.Resp
+// @router /api/v1/teacher/class/add-members [post]
+func (cl *Class) AddMembers(c iris.Context) {
+	p := struct {
+		Id      int   `json:"id" validate:"required"`
+		UserIds []int `json:"user_ids" validate:"required,min=1"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	err := cl.classSvc.AddMembers(ctx, claims.Uid, p.Id, p.UserIds)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("班级不存在"))
+			return
+		}
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success()
+}
+
+// 将学生移出班级 godoc
+// @summary 将学生移出班级
+// @description 将一个或多个学生移出班级，不在该班级中的学生会被忽略
+// @description 老师只能操作自己任教的班级，拥有 student.manage_all 权限时不受限制
+// @accept json
+// @produce json
+// @tags class
+// @param id body int true "班级ID"
+// @param user_ids body []int true "学生ID列表"
+// @success 200 {object} swagger.Resp
+// @router /api/v1/teacher/class/remove-members [post]
+func (cl *Class) RemoveMembers(c iris.Context) {
+	p := struct {
+		Id      int   `json:"id" validate:"required"`
+		UserIds []int `json:"user_ids" validate:"required,min=1"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	err := cl.classSvc.RemoveMembers(ctx, claims.Uid, p.Id, p.UserIds)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("班级不存在"))
+			return
+		}
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success()
+}
+
+// 查询班级已选的科目 godoc
+// @summary 查询班级已选的科目
+// @description 分页查询班级已选的科目，班级中的学生只能访问这些科目下的学习资料
+// @description 老师只能查询自己任教的班级，拥有 student.manage_all 权限时不受限制
+// @accept json
+// @produce json
+// @tags class
+// @param id body int true "班级ID"
+// @param pn body int true "pn"
+// @param ps body int true "ps"
+// @success 200 {object} swagger.Resp{data=swagger.DWithP{data=model.Subject}}
+// @router /api/v1/teacher/class/list-subjects [post]
+func (cl *Class) ListSubjects(c iris.Context) {
+	p := struct {
+		Id int `json:"id" validate:"required"`
+		Pn int `json:"pn"`
+		Ps int `json:"ps"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+	page := model.NewPage(p.Pn, p.Ps)
+
+	subjects, count, err := cl.classSvc.ListSubjectsAndCount(ctx, claims.Uid, p.Id, page)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("班级不存在"))
+			return
+		}
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.SuccessList(subjects, page.WithTotal(count))
+}
+
+// 为班级添加科目 godoc
+// @summary 为班级添加科目
+// @description 为班级添加一个或多个科目，已经选过的科目会被忽略
+// @description 老师只能操作自己任教的班级，拥有 student.manage_all 权限时不受限制
+// @accept json
+// @produce json
+// @tags class
+// @param id body int true "班级ID"
+// @param subject_ids body []int true "科目ID列表"
+// @success 200 {object} swagger.Resp
+// @router /api/v1/teacher/class/add-subjects [post]
+func (cl *Class) AddSubjects(c iris.Context) {
+	p := struct {
+		Id         int   `json:"id" validate:"required"`
+		SubjectIds []int `json:"subject_ids" validate:"required,min=1"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	err := cl.classSvc.AddSubjects(ctx, claims.Uid, p.Id, p.SubjectIds)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("班级不存在"))
+			return
+		}
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success()
+}
+
+// 为班级移除科目 godoc
+// @summary 为班级移除科目
+// @description 为班级移除一个或多个科目，班级没有选过的科目会被忽略
+// @description 老师只能操作自己任教的班级，拥有 student.manage_all 权限时不受限制
+// @accept json
+// @produce json
+// @tags class
+// @param id body int true "班级ID"
+// @param subject_ids body []int true "科目ID列表"
+// @success 200 {object} swagger.Resp
+// @router /api/v1/teacher/class/remove-subjects [post]
+func (cl *Class) RemoveSubjects(c iris.Context) {
+	p := struct {
+		Id         int   `json:"id" validate:"required"`
+		SubjectIds []int `json:"subject_ids" validate:"required,min=1"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	err := cl.classSvc.RemoveSubjects(ctx, claims.Uid, p.Id, p.SubjectIds)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("班级不存在"))
+			return
+		}
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success()
+}
+
+// --- D ---
+
+// 查询班级的老师 godoc
+// @summary 查询班级的老师
+// @description 查询班级的班主任和任课老师，班主任在前
+// @description 老师只能查询自己任教的班级，拥有 student.manage_all 权限时不受限制
+// @accept json
+// @produce json
+// @tags class
+// @param id body int true "班级ID"
+// @success 200 {object} swagger.Resp{data=[]model.ClassTeacher}
+// @router /api/v1/teacher/class/list-teachers [post]
+func (cl *Class) ListTeachers(c iris.Context) {
+	p := struct {
+		Id int `json:"id" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	teachers, err := cl.classSvc.ListTeachers(ctx, claims.Uid, p.Id)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("班级不存在"))
+			return
+		}
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(teachers)
+}
+
+// 指定班级的老师 godoc
+// @summary 指定班级的老师
+// @description 将用户指定为班级的班主任或任课老师，已经是班级的老师时修改身份，设为班主任时原来的班主任改为任课老师
+// @description 老师只能管理自己任教班级中的学生，需要 class.teacher 权限
+// @accept json
+// @produce json
+// @tags class
+// @param id body int true "班级ID"
+// @param user_id body int true "老师的用户ID"
+// @param type body string true "head 班主任，assistant 任课老师" Enums(head, assistant)
+// @success 200 {object} swagger.Resp
+// @router /api/v1/teacher/class/set-teacher [post]
+func (cl *Class) SetTeacher(c iris.Context) {
+	p := struct {
+		Id     int    `json:"id" validate:"required"`
+		UserId int    `json:"user_id" validate:"required"`
+		Type   string `json:"type" validate:"required,oneof=head assistant"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+
+	err := cl.classSvc.SetTeacher(ctx, p.Id, p.UserId, p.Type)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("班级不存在"))
+			return
+		}
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success()
+}
+
+// 移除班级的老师 godoc
+// @summary 移除班级的老师
+// @description 移除一个或多个班级的老师，不是班级老师的用户会被忽略，需要 class.teacher 权限
+// @accept json
+// @produce json
+// @tags class
+// @param id body int true "班级ID"
+// @param user_ids body []int true "老师的用户ID列表"
+// @success 200 {object} swagger.Resp
+// @router /api/v1/teacher/class/remove-teachers [post]
+func (cl *Class) RemoveTeachers(c iris.Context) {
+	p := struct {
+		Id      int   `json:"id" validate:"required"`
+		UserIds []int `json:"user_ids" validate:"required,min=1"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+
+	err := cl.classSvc.RemoveTeachers(ctx, p.Id, p.UserIds)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("班级不存在"))
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success()
+}
+
+// 删除班级 godoc
+// @summary 删除班级
+// @description 删除班级，班级进入回收站，可以由管理员恢复
+// @description 彻底删除时班级中的学生会被移出班级，班级已选的科目也会一并移除
+// @description 老师只能操作自己任教的班级，拥有 student.manage_all 权限时不受限制
+// @accept json
+// @produce json
+// @tags class
+// @param id body int true "班级ID"
+// @success 200 {object} swagger.Resp
+// @router /api/v1/teacher/class/delete [post]
+func (cl *Class) Delete(c iris.Context) {
+	p := struct {
+		Id int `json:"id" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	err := cl.classSvc.Delete(ctx, claims.Uid, p.Id)
+	if err != nil {
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success()
+}
@@ -0,0 +1,264 @@
+package v1
+
+import (
+	"errors"
+	"github.com/go-pg/pg/v10"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/middleware/jwt"
+	"github.com/xuxusheng/time-frequency-be/global"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/storage"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/response"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/sheet"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/signurl"
+	"github.com/xuxusheng/time-frequency-be/internal/service"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
+	"log"
+	"net/url"
+)
+
+// 导出用户名单相关接口，导出的条件和权限与对应的列表接口相同
+type IExport interface {
+	ExportUsers(c iris.Context)    // 导出所有用户，对应 /admin/list-user
+	ExportStudents(c iris.Context) // 导出可以管理的学生，对应 /teacher/list-student
+
+	ListColumns(c iris.Context) // 可以导出的列
+	GetJob(c iris.Context)      // 查询自己创建的后台导出任务
+	ListJobs(c iris.Context)    // 查询自己最近创建的后台导出任务
+	Download(c iris.Context)    // 通过签名地址下载后台导出的文件，不需要登录
+}
+
+type Export struct {
+	exportSvc service.IExport
+	// 数据不超过这么多行时直接在响应中返回文件，否则创建后台任务
+	syncMaxRows int
+}
+
+func NewExport(exportSvc service.IExport, syncMaxRows int) *Export {
+	return &Export{exportSvc: exportSvc, syncMaxRows: syncMaxRows}
+}
+
+// 导出所有用户 godoc
+// @summary 导出所有用户
+// @description 按照与 /api/v1/admin/list-user 相同的条件导出用户，表头为中文
+// @description 数据不多时直接返回文件；数据较多或者 async 为 true 时创建后台任务，返回 JSON 格式的任务，完成后通过任务中的 download_url 下载
+// @accept json
+// @produce octet-stream
+// @produce json
+// @tags export
+// @param query body string false "模糊匹配用户名、昵称、手机号和邮箱"
+// @param role body string false "通过角色标识筛选，例如 student、teacher"
+// @param format body string true "文件格式，csv 或 xlsx"
+// @param columns body []string false "导出的列，可选的列通过 /api/v1/export/list-columns 查询，不传时导出用户名、姓名、手机号、邮箱、班级"
+// @param async body bool false "是否在后台导出"
+// @success 200 {file} file
+// @success 200 {object} swagger.Resp{data=model.ExportJob}
+// @router /api/v1/admin/export-users [post]
+func (e *Export) ExportUsers(c iris.Context) {
+	p := struct {
+		Query   string   `json:"query"`
+		Role    string   `json:"role"`
+		Format  string   `json:"format" validate:"required"`
+		Columns []string `json:"columns"`
+		Async   bool     `json:"async"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	claims := jwt.Get(c).(*model.JWTClaims)
+	e.export(c, &model.ExportJob{
+		Type:        model.ExportTypeUser,
+		Format:      p.Format,
+		Columns:     p.Columns,
+		Query:       p.Query,
+		Role:        p.Role,
+		CreatedById: claims.Uid,
+	}, p.Async)
+}
+
+// 导出学生 godoc
+// @summary 导出学生
+// @description 按照与 /api/v1/teacher/list-student 相同的条件导出学生，只导出自己任教班级中的学生，拥有 student.manage_all 权限时不受限制
+// @description 数据不多时直接返回文件；数据较多或者 async 为 true 时创建后台任务，返回 JSON 格式的任务，完成后通过任务中的 download_url 下载
+// @accept json
+// @produce octet-stream
+// @produce json
+// @tags export
+// @param query body string false "模糊匹配用户名、昵称、手机号和邮箱"
+// @param format body string true "文件格式，csv 或 xlsx"
+// @param columns body []string false "导出的列，可选的列通过 /api/v1/export/list-columns 查询，不传时导出用户名、姓名、手机号、邮箱、班级"
+// @param async body bool false "是否在后台导出"
+// @success 200 {file} file
+// @success 200 {object} swagger.Resp{data=model.ExportJob}
+// @router /api/v1/teacher/export-students [post]
+func (e *Export) ExportStudents(c iris.Context) {
+	p := struct {
+		Query   string   `json:"query"`
+		Format  string   `json:"format" validate:"required"`
+		Columns []string `json:"columns"`
+		Async   bool     `json:"async"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	claims := jwt.Get(c).(*model.JWTClaims)
+	e.export(c, &model.ExportJob{
+		Type:        model.ExportTypeStudent,
+		Format:      p.Format,
+		Columns:     p.Columns,
+		Query:       p.Query,
+		CreatedById: claims.Uid,
+	}, p.Async)
+}
+
+// 查询可以导出的列 godoc
+// @summary 查询可以导出的列
+// @description 返回列的标识和中文表头，导出时按照 columns 中的顺序输出
+// @produce json
+// @tags export
+// @success 200 {object} swagger.Resp{data=[]service.ExportColumn}
+// @router /api/v1/export/list-columns [post]
+func (e *Export) ListColumns(c iris.Context) {
+	response.New(c).Success(e.exportSvc.Columns())
+}
+
+// 查询导出任务 godoc
+// @summary 查询导出任务
+// @description 查询自己创建的后台导出任务，status 为 done 时可以通过 download_url 下载，地址不需要携带 token，过期后重新查询即可获取新的地址
+// @accept json
+// @produce json
+// @tags export
+// @param id body int true "任务ID"
+// @success 200 {object} swagger.Resp{data=model.ExportJob}
+// @router /api/v1/export/get-job [post]
+func (e *Export) GetJob(c iris.Context) {
+	p := struct {
+		Id int `json:"id" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	job, err := e.exportSvc.GetJob(c.Request().Context(), claims.Uid, p.Id)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("导出任务不存在或已过期"))
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(job)
+}
+
+// 查询导出任务列表 godoc
+// @summary 查询导出任务列表
+// @description 查询自己最近创建的后台导出任务，最新的在前，已过期的任务会被删除
+// @produce json
+// @tags export
+// @success 200 {object} swagger.Resp{data=[]model.ExportJob}
+// @router /api/v1/export/list-jobs [post]
+func (e *Export) ListJobs(c iris.Context) {
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	jobs, err := e.exportSvc.ListJobs(c.Request().Context(), claims.Uid)
+	if err != nil {
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(jobs)
+}
+
+// 下载导出的文件 godoc
+// @summary 下载导出的文件
+// @description 使用导出任务 download_url 中的地址下载文件，不需要携带 token
+// @produce octet-stream
+// @tags export
+// @param id query int true "任务ID"
+// @param expires query int true "过期时间戳"
+// @param signature query string true "签名"
+// @success 200 {file} file
+// @router /api/v1/export/download [get]
+func (e *Export) Download(c iris.Context) {
+	resp := response.New(c)
+	id, err := c.URLParamInt("id")
+	if err != nil {
+		resp.Error(cerror.BadRequest.WithMsg("任务ID不合法"))
+		return
+	}
+	expires, _ := c.URLParamInt64("expires")
+	if !signurl.Verify(global.Setting.JWT.Secret, model.ExportResource(id), expires, c.URLParam("signature")) {
+		resp.Error(cerror.Forbidden.WithMsg("下载地址无效或已过期"))
+		return
+	}
+
+	obj, job, err := e.exportSvc.Open(c.Request().Context(), id)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) || errors.Is(err, storage.ErrNotExist) {
+			resp.Error(cerror.NotFound.WithMsg("导出任务不存在或已过期"))
+			return
+		}
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	defer obj.Close()
+
+	fileName := service.ExportFileName(job)
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Disposition", "attachment; filename*=UTF-8''"+url.PathEscape(fileName))
+	c.ContentType(sheet.ContentType("." + job.Format))
+	_ = c.CompressWriter(false)
+	c.ServeContent(obj, fileName, job.FinishedAt)
+}
+
+// 数据不多时直接写入响应，否则创建后台任务
+func (e *Export) export(c iris.Context, job *model.ExportJob, async bool) {
+	ctx := c.Request().Context()
+	resp := response.New(c)
+
+	err := e.exportSvc.Prepare(ctx, job)
+	if err == nil && !async {
+		var count int
+		count, err = e.exportSvc.Count(ctx, job)
+		async = count > e.syncMaxRows
+	}
+	if err != nil {
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+
+	if async {
+		err = e.exportSvc.CreateJob(ctx, job)
+		if err != nil {
+			resp.Error(cerror.ServerError.WithDebugs(err))
+			return
+		}
+		resp.Success(job)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Disposition", "attachment; filename*=UTF-8''"+url.PathEscape(service.ExportFileName(job)))
+	c.ContentType(sheet.ContentType("." + job.Format))
+	_ = c.CompressWriter(false)
+	// 边查询边写入，响应头已经发出，出错时只能中断
+	_, err = e.exportSvc.Write(ctx, job, c.ResponseWriter())
+	if err != nil {
+		log.Printf("导出用户名单失败：%v", err)
+	}
+}
@@ -0,0 +1,683 @@
+package v1
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-pg/pg/v10"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/middleware/jwt"
+	"github.com/xuxusheng/time-frequency-be/global"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/storage"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/response"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/signurl"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/thumbnail"
+	"github.com/xuxusheng/time-frequency-be/internal/service"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
+	"mime"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+)
+
+// 学习资料相关接口，查询接口所有登录用户都可以调用，上传需要 material.upload 权限，修改、删除需要 material.manage 权限
+// 查询和修改都只能操作有权访问的科目下的资料，拥有 material.read_all 权限时不受限制
+type ILearningMaterial interface {
+	Upload(c iris.Context) // 上传学习资料
+
+	Get(c iris.Context)  // 查询单个学习资料
+	List(c iris.Context) // 查询学习资料列表
+
+	Download(c iris.Context)       // 下载学习资料文件
+	DownloadUrl(c iris.Context)    // 生成带签名的下载地址
+	SignedDownload(c iris.Context) // 通过签名下载地址下载文件，不需要登录
+	Preview(c iris.Context)        // 获取预览图，使用资料中的 preview_url，不需要登录
+
+	Update(c iris.Context) // 修改学习资料信息
+
+	UploadVersion(c iris.Context) // 重新上传文件，生成新版本
+	ListVersions(c iris.Context)  // 查询历史版本
+	Rollback(c iris.Context)      // 回滚到历史版本
+	Reextract(c iris.Context)     // 重新提取文件正文
+
+	Delete(c iris.Context) // 删除学习资料
+}
+
+type LearningMaterial struct {
+	lmSvc      service.ILearningMaterial
+	subjectSvc service.ISubject
+	accessSvc  service.IAccess
+}
+
+func NewLearningMaterial(lmSvc service.ILearningMaterial, subjectSvc service.ISubject, accessSvc service.IAccess) *LearningMaterial {
+	return &LearningMaterial{lmSvc: lmSvc, subjectSvc: subjectSvc, accessSvc: accessSvc}
+}
+
+// --- C ---
+
+// 上传学习资料 godoc
+// @summary 上传学习资料
+// @description 以 multipart/form-data 形式上传文件并创建学习资料，服务端计算文件 md5，内容相同的文件只保存一份
+// @description 只能上传到有权访问的科目下，科目不存在时返回 400
+// @accept mpfd
+// @produce json
+// @tags learning-material
+// @param file formData file true "资料文件"
+// @param name formData string true "资料名称"
+// @param description formData string false "资料描述"
+// @param subject_id formData int true "所属科目ID"
+// @success 200 {object} swagger.Resp{data=model.LearningMaterial}
+// @router /api/v1/teacher/learning-material/upload [post]
+func (l *LearningMaterial) Upload(c iris.Context) {
+	// 限制请求体大小，超出后读取 body 时会直接报错
+	c.SetMaxRequestBodySize(global.Setting.App.UploadMaxSize << 20)
+
+	p := struct {
+		Name        string `form:"name" validate:"required"`
+		Description string `form:"description"`
+		SubjectId   int    `form:"subject_id" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	if ok := l.checkSubject(c, p.SubjectId); !ok {
+		return
+	}
+
+	file, header, err := c.FormFile("file")
+	if err != nil {
+		resp.Error(cerror.BadRequest.WithMsg("请选择要上传的文件").WithDebugs(err))
+		return
+	}
+	defer file.Close()
+
+	lm, err := l.lmSvc.Upload(ctx, claims.Uid, p.SubjectId, p.Name, p.Description, header.Filename, file)
+	if err != nil {
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(lm)
+}
+
+// --- R ---
+
+// 查询单个学习资料 godoc
+// @summary 查询单个学习资料
+// @description 查询单个学习资料的详细信息，只能查询有权访问的科目下的资料
+// @accept json
+// @produce json
+// @tags learning-material
+// @param id body int true "资料ID"
+// @success 200 {object} swagger.Resp{data=model.LearningMaterial}
+// @router /api/v1/learning-material/get [post]
+func (l *LearningMaterial) Get(c iris.Context) {
+	p := struct {
+		Id int `json:"id" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	lm, ok := l.getAccessible(c, p.Id)
+	if !ok {
+		return
+	}
+	response.New(c).Success(lm)
+}
+
+// 查询学习资料列表 godoc
+// @summary 查询学习资料列表
+// @description 分页查询学习资料，可以按科目筛选，支持按名称和描述模糊搜索
+// @description 学生只能查到所在班级已选科目下的资料，老师只能查到自己所教科目下的资料
+// @accept json
+// @produce json
+// @tags learning-material
+// @param subject_id body int false "所属科目ID，不传则不限"
+// @param query body string false "模糊匹配资料名称和描述"
+// @param pn body int true "pn"
+// @param ps body int true "ps"
+// @success 200 {object} swagger.Resp{data=swagger.DWithP{data=model.LearningMaterial}}
+// @router /api/v1/learning-material/list [post]
+func (l *LearningMaterial) List(c iris.Context) {
+	p := struct {
+		SubjectId int    `json:"subject_id"`
+		Query     string `json:"query"`
+		Pn        int    `json:"pn"`
+		Ps        int    `json:"ps"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+	page := model.NewPage(p.Pn, p.Ps)
+
+	subjectIds, err := l.accessSvc.SubjectIds(ctx, claims.Uid)
+	if err != nil {
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+
+	lms, count, err := l.lmSvc.ListAndCount(ctx, page, &model.LearningMaterialFilter{
+		SubjectId:  p.SubjectId,
+		Query:      p.Query,
+		SubjectIds: subjectIds,
+	})
+	if err != nil {
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.SuccessList(lms, page.WithTotal(count))
+}
+
+// 下载学习资料文件 godoc
+// @summary 下载学习资料文件
+// @description 下载学习资料文件，支持 Range 请求和 If-None-Match，ETag 为文件的 md5
+// @produce octet-stream
+// @tags learning-material
+// @param id query int true "资料ID"
+// @param attachment query bool false "是否以附件形式下载，默认在浏览器中直接打开"
+// @success 200 {file} file
+// @success 206 {file} file
+// @router /api/v1/learning-material/download [get]
+func (l *LearningMaterial) Download(c iris.Context) {
+	id, err := c.URLParamInt("id")
+	if err != nil {
+		response.New(c).Error(cerror.BadRequest.WithMsg("资料ID不合法"))
+		return
+	}
+	if _, ok := l.getAccessible(c, id); !ok {
+		return
+	}
+	l.serveFile(c, id)
+}
+
+// 生成带签名的下载地址 godoc
+// @summary 生成带签名的下载地址
+// @description 生成一个短期有效的下载地址，可以直接交给 video 标签等无法携带 token 的场景使用
+// @accept json
+// @produce json
+// @tags learning-material
+// @param id body int true "资料ID"
+// @success 200 {object} swagger.Resp{data=object{url=string,expires_at=string}}
+// @router /api/v1/learning-material/download-url [post]
+func (l *LearningMaterial) DownloadUrl(c iris.Context) {
+	p := struct {
+		Id int `json:"id" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	resp := response.New(c)
+
+	// 签名地址本身不再校验权限，只给有权访问的用户签发
+	if _, ok := l.getAccessible(c, p.Id); !ok {
+		return
+	}
+
+	expires := time.Now().Add(global.Setting.App.DownloadUrlExpire)
+	q := url.Values{}
+	q.Set("id", strconv.Itoa(p.Id))
+	q.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	q.Set("signature", signurl.Sign(global.Setting.JWT.Secret, downloadResource(p.Id), expires))
+	resp.Success(response.Map{
+		"url":        "/api/v1/learning-material/signed-download?" + q.Encode(),
+		"expires_at": expires,
+	})
+}
+
+// 通过签名地址下载学习资料文件 godoc
+// @summary 通过签名地址下载学习资料文件
+// @description 使用 download-url 接口生成的地址下载文件，不需要携带 token，同样支持 Range 请求
+// @produce octet-stream
+// @tags learning-material
+// @param id query int true "资料ID"
+// @param expires query int true "过期时间戳"
+// @param signature query string true "签名"
+// @success 200 {file} file
+// @success 206 {file} file
+// @router /api/v1/learning-material/signed-download [get]
+func (l *LearningMaterial) SignedDownload(c iris.Context) {
+	id, err := c.URLParamInt("id")
+	if err != nil {
+		response.New(c).Error(cerror.BadRequest.WithMsg("资料ID不合法"))
+		return
+	}
+	expires, _ := c.URLParamInt64("expires")
+	if !signurl.Verify(global.Setting.JWT.Secret, downloadResource(id), expires, c.URLParam("signature")) {
+		response.New(c).Error(cerror.Forbidden.WithMsg("下载地址无效或已过期"))
+		return
+	}
+	l.serveFile(c, id)
+}
+
+// 获取学习资料预览图 godoc
+// @summary 获取学习资料预览图
+// @description 使用资料 preview_url 字段中的地址获取预览图，不需要携带 token
+// @description 已生成预览图时返回 JPEG，还没有生成、生成失败或者类型不支持时返回按文件类型区分的 SVG 通用图标
+// @produce jpeg
+// @produce image/svg+xml
+// @tags learning-material
+// @param id query int true "资料ID"
+// @param expires query int true "过期时间戳"
+// @param signature query string true "签名"
+// @success 200 {file} file
+// @router /api/v1/learning-material/preview [get]
+func (l *LearningMaterial) Preview(c iris.Context) {
+	resp := response.New(c)
+	id, err := c.URLParamInt("id")
+	if err != nil {
+		resp.Error(cerror.BadRequest.WithMsg("资料ID不合法"))
+		return
+	}
+	expires, _ := c.URLParamInt64("expires")
+	if !signurl.Verify(global.Setting.JWT.Secret, model.PreviewResource(id), expires, c.URLParam("signature")) {
+		resp.Error(cerror.Forbidden.WithMsg("预览图地址无效或已过期"))
+		return
+	}
+
+	lm, obj, err := l.lmSvc.OpenPreview(c.Request().Context(), id)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("学习资料不存在"))
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+
+	// 地址在过期前不会变化，浏览器可以一直缓存到过期
+	if maxAge := expires - time.Now().Unix(); maxAge > 0 {
+		c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", maxAge))
+	}
+	if obj == nil {
+		c.Header("Content-Type", "image/svg+xml")
+		_, _ = c.Write(thumbnail.Icon(thumbnail.Kind(path.Ext(lm.FilePath))))
+		return
+	}
+	defer obj.Close()
+
+	c.Header("ETag", `"`+lm.Md5+`"`)
+	c.Header("Content-Type", "image/jpeg")
+	c.ServeContent(obj, "preview.jpg", lm.UpdatedAt)
+}
+
+// --- U ---
+
+// 修改学习资料信息 godoc
+// @summary 修改学习资料信息
+// @description 修改学习资料的名称和描述
+// @description 只能修改有权访问的科目下的资料
+// @accept json
+// @produce json
+// @tags learning-material
+// @param id body int true "资料ID"
+// @param name body string true "资料名称"
+// @param description body string false "资料描述"
+// @success 200 {object} swagger.Resp{data=model.LearningMaterial}
+// @router /api/v1/teacher/learning-material/update [post]
+func (l *LearningMaterial) Update(c iris.Context) {
+	p := struct {
+		Id          int    `json:"id" validate:"required"`
+		Name        string `json:"name" validate:"required"`
+		Description string `json:"description"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	if _, ok := l.getAccessible(c, p.Id); !ok {
+		return
+	}
+
+	lm, err := l.lmSvc.Update(ctx, p.Id, claims.Uid, p.Name, p.Description)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("学习资料不存在"))
+			return
+		}
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(lm)
+}
+
+// 上传学习资料新版本 godoc
+// @summary 上传学习资料新版本
+// @description 以 multipart/form-data 形式重新上传资料文件，生成一个新版本，旧版本保留在历史记录中
+// @description 只能修改有权访问的科目下的资料
+// @accept mpfd
+// @produce json
+// @tags learning-material
+// @param file formData file true "资料文件"
+// @param id formData int true "资料ID"
+// @param note formData string false "版本说明，例如本次修改了哪些内容"
+// @success 200 {object} swagger.Resp{data=model.LearningMaterial}
+// @router /api/v1/teacher/learning-material/upload-version [post]
+func (l *LearningMaterial) UploadVersion(c iris.Context) {
+	// 限制请求体大小，超出后读取 body 时会直接报错
+	c.SetMaxRequestBodySize(global.Setting.App.UploadMaxSize << 20)
+
+	p := struct {
+		Id   int    `form:"id" validate:"required"`
+		Note string `form:"note"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	if _, ok := l.getAccessible(c, p.Id); !ok {
+		return
+	}
+
+	file, header, err := c.FormFile("file")
+	if err != nil {
+		resp.Error(cerror.BadRequest.WithMsg("请选择要上传的文件").WithDebugs(err))
+		return
+	}
+	defer file.Close()
+
+	lm, err := l.lmSvc.UploadVersion(ctx, p.Id, claims.Uid, p.Note, header.Filename, file)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("学习资料不存在"))
+			return
+		}
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(lm)
+}
+
+// 查询学习资料历史版本 godoc
+// @summary 查询学习资料历史版本
+// @description 分页查询学习资料的历史版本，按版本号倒序排列，包含每个版本的上传人和版本说明
+// @accept json
+// @produce json
+// @tags learning-material
+// @param id body int true "资料ID"
+// @param pn body int true "pn"
+// @param ps body int true "ps"
+// @success 200 {object} swagger.Resp{data=swagger.DWithP{data=model.LearningMaterialVersion}}
+// @router /api/v1/learning-material/list-versions [post]
+func (l *LearningMaterial) ListVersions(c iris.Context) {
+	p := struct {
+		Id int `json:"id" validate:"required"`
+		Pn int `json:"pn"`
+		Ps int `json:"ps"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	page := model.NewPage(p.Pn, p.Ps)
+
+	if _, ok := l.getAccessible(c, p.Id); !ok {
+		return
+	}
+
+	versions, count, err := l.lmSvc.ListVersionsAndCount(ctx, p.Id, page)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("学习资料不存在"))
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.SuccessList(versions, page.WithTotal(count))
+}
+
+// 回滚学习资料 godoc
+// @summary 回滚学习资料
+// @description 将学习资料回滚到某个历史版本，回滚会生成一个内容与该历史版本相同的新版本
+// @description 只能修改有权访问的科目下的资料
+// @accept json
+// @produce json
+// @tags learning-material
+// @param id body int true "资料ID"
+// @param version_id body int true "要回滚到的版本ID"
+// @success 200 {object} swagger.Resp{data=model.LearningMaterial}
+// @router /api/v1/teacher/learning-material/rollback [post]
+func (l *LearningMaterial) Rollback(c iris.Context) {
+	p := struct {
+		Id        int `json:"id" validate:"required"`
+		VersionId int `json:"version_id" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	if _, ok := l.getAccessible(c, p.Id); !ok {
+		return
+	}
+
+	lm, err := l.lmSvc.Rollback(ctx, p.Id, claims.Uid, p.VersionId)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("学习资料不存在"))
+			return
+		}
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(lm)
+}
+
+// 重新提取学习资料正文 godoc
+// @summary 重新提取学习资料正文
+// @description 上传资料或新版本后，后台会自动提取 PDF、DOCX、PPTX 文件中的正文用于全文检索，提取状态见资料的 extract_status 字段
+// @description 提取失败时可以调用该接口重新提取，资料会回到 pending 状态等待后台处理
+// @description 只能修改有权访问的科目下的资料
+// @accept json
+// @produce json
+// @tags learning-material
+// @param id body int true "资料ID"
+// @success 200 {object} swagger.Resp{data=model.LearningMaterial}
+// @router /api/v1/teacher/learning-material/re-extract [post]
+func (l *LearningMaterial) Reextract(c iris.Context) {
+	p := struct {
+		Id int `json:"id" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+
+	if _, ok := l.getAccessible(c, p.Id); !ok {
+		return
+	}
+
+	lm, err := l.lmSvc.Reextract(ctx, p.Id)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("学习资料不存在"))
+			return
+		}
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(lm)
+}
+
+// --- D ---
+
+// 删除学习资料 godoc
+// @summary 删除学习资料
+// @description 删除学习资料，资料进入回收站，可以由管理员恢复
+// @description 彻底删除时文件没有被其他资料引用的话会一并删除
+// @description 只能删除有权访问的科目下的资料
+// @accept json
+// @produce json
+// @tags learning-material
+// @param id body int true "资料ID"
+// @success 200 {object} swagger.Resp
+// @router /api/v1/teacher/learning-material/delete [post]
+func (l *LearningMaterial) Delete(c iris.Context) {
+	p := struct {
+		Id int `json:"id" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+
+	if _, ok := l.getAccessible(c, p.Id); !ok {
+		return
+	}
+
+	err := l.lmSvc.Delete(ctx, p.Id)
+	if err != nil {
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success()
+}
+
+// 查询当前用户有权访问的学习资料，资料不存在或无权访问时直接返回错误
+func (l *LearningMaterial) getAccessible(c iris.Context, id int) (*model.LearningMaterial, bool) {
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	lm, err := l.lmSvc.Get(ctx, id)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("学习资料不存在"))
+			return nil, false
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return nil, false
+	}
+
+	ok, err := l.accessSvc.CanAccessSubject(ctx, claims.Uid, lm.SubjectId)
+	if err != nil {
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return nil, false
+	}
+	if !ok {
+		resp.Error(cerror.Forbidden.WithMsg("无权访问该学习资料"))
+		return nil, false
+	}
+	return lm, true
+}
+
+// 上传资料时科目需要存在，并且当前用户有权访问，科目不存在或无权访问时直接返回错误
+func (l *LearningMaterial) checkSubject(c iris.Context, subjectId int) bool {
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	_, err := l.subjectSvc.Get(ctx, subjectId)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.BadRequest.WithMsg("科目不存在"))
+			return false
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return false
+	}
+
+	ok, err := l.accessSvc.CanAccessSubject(ctx, claims.Uid, subjectId)
+	if err != nil {
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return false
+	}
+	if !ok {
+		resp.Error(cerror.Forbidden.WithMsg("无权在该科目下上传学习资料"))
+		return false
+	}
+	return true
+}
+
+func (l *LearningMaterial) serveFile(c iris.Context, id int) {
+	ctx := c.Request().Context()
+	resp := response.New(c)
+
+	lm, obj, err := l.lmSvc.Open(ctx, id)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) || errors.Is(err, storage.ErrNotExist) {
+			resp.Error(cerror.NotFound.WithMsg("学习资料不存在"))
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	defer obj.Close()
+
+	// 文件按内容寻址，内容不变 md5 就不变，直接作为 ETag
+	fileName := lm.Name + path.Ext(lm.FilePath)
+	disposition := "inline"
+	if attachment, _ := c.URLParamBool("attachment"); attachment {
+		disposition = "attachment"
+	}
+	c.Header("ETag", `"`+lm.Md5+`"`)
+	c.Header("Accept-Ranges", "bytes")
+	c.Header("Content-Disposition", fmt.Sprintf("%s; filename*=UTF-8''%s", disposition, url.PathEscape(fileName)))
+	c.Header("Content-Type", mimeType(lm.FilePath))
+
+	// 压缩后 Range 请求的偏移量就对不上了，下载时关闭压缩
+	_ = c.CompressWriter(false)
+	// 上传新版本或者回滚后文件会变化，使用修改时间，否则客户端用 If-Modified-Since 校验时会一直拿到旧文件
+	c.ServeContent(obj, fileName, lm.UpdatedAt)
+}
+
+func downloadResource(id int) string {
+	return "learning-material:" + strconv.Itoa(id)
+}
+
+func mimeType(filePath string) string {
+	t := mime.TypeByExtension(path.Ext(filePath))
+	if t == "" {
+		return "application/octet-stream"
+	}
+	return t
+}
@@ -0,0 +1,164 @@
+package v1
+
+import (
+	"crypto/subtle"
+	"github.com/kataras/iris/v12"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/response"
+	"github.com/xuxusheng/time-frequency-be/internal/service"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 保存 state 的 cookie，回调时与认证服务返回的对比，防止登录请求被伪造
+const oidcStateCookie = "oidc_state"
+
+// 单点登录相关接口，不需要登录
+type IOidc interface {
+	Login(c iris.Context)    // 跳转到认证服务登录
+	Callback(c iris.Context) // 认证服务登录后的回调
+	Token(c iris.Context)    // 使用回调中的 ticket 换取 token
+}
+
+type Oidc struct {
+	oidcSvc  service.IOidc
+	tokenSvc service.IToken
+	totpSvc  service.ITotp
+
+	frontendUrl string
+}
+
+// frontendUrl 为前端处理单点登录结果的页面地址，ticket 或 error 作为查询参数拼接在后面
+func NewOidc(oidcSvc service.IOidc, tokenSvc service.IToken, totpSvc service.ITotp, frontendUrl string) *Oidc {
+	return &Oidc{oidcSvc: oidcSvc, tokenSvc: tokenSvc, totpSvc: totpSvc, frontendUrl: frontendUrl}
+}
+
+// 单点登录 godoc
+// @summary 单点登录
+// @description 浏览器直接打开这个地址，跳转到认证服务登录，登录后认证服务回调 /api/v1/oidc/callback
+// @tags oidc
+// @success 302
+// @router /api/v1/oidc/login [get]
+func (o *Oidc) Login(c iris.Context) {
+	authUrl, state, err := o.oidcSvc.Start(c.Request().Context())
+	if err != nil {
+		response.New(c).Error(cerror.ServiceUnavailable.WithMsg("认证服务暂时不可用，请稍后再试").WithDebugs(err))
+		return
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/v1/oidc",
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		HttpOnly: true,
+		// 从认证服务跳转回来属于跨站的顶层导航，Lax 时会携带
+		SameSite: http.SameSiteLaxMode,
+	}, iris.CookieSecure)
+	c.Redirect(authUrl, iris.StatusFound)
+}
+
+// 单点登录回调 godoc
+// @summary 单点登录回调
+// @description 由认证服务跳转过来，校验后跳转到前端页面，成功时携带 ticket，失败时携带 error
+// @description 前端使用 ticket 调用 /api/v1/oidc/token 换取 token，ticket 一分钟内有效，只能使用一次
+// @tags oidc
+// @param state query string true "登录时生成的 state"
+// @param code query string false "授权码"
+// @param error query string false "认证服务返回的错误"
+// @success 302
+// @router /api/v1/oidc/callback [get]
+func (o *Oidc) Callback(c iris.Context) {
+	state := c.URLParam("state")
+	cookie := c.GetCookie(oidcStateCookie)
+	c.RemoveCookie(oidcStateCookie, iris.CookiePath("/api/v1/oidc"))
+
+	// 用户在认证服务中取消了授权等情况
+	if e := c.URLParam("error"); e != "" {
+		o.redirect(c, "error", "认证服务登录失败："+e)
+		return
+	}
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookie)) != 1 {
+		o.redirect(c, "error", "登录请求无效或已过期，请重新登录")
+		return
+	}
+
+	ticket, err := o.oidcSvc.Callback(c.Request().Context(), state, c.URLParam("code"))
+	if err != nil {
+		if cerr, ok := err.(cerror.IError); ok {
+			o.redirect(c, "error", cerr.Msg())
+			return
+		}
+		log.Printf("单点登录失败：%v", err)
+		o.redirect(c, "error", "单点登录失败，请稍后再试")
+		return
+	}
+	o.redirect(c, "ticket", ticket)
+}
+
+// 使用单点登录 ticket 换取 token godoc
+// @summary 使用单点登录 ticket 换取 token
+// @description 返回的数据与 /api/v1/login 相同，开启了两步验证时同样需要先完成第二步
+// @accept json
+// @produce json
+// @tags oidc
+// @param ticket body string true "回调时前端页面地址中的 ticket"
+// @param device body string false "设备名称，不传则根据 User-Agent 生成"
+// @success 200 {object} swagger.Resp
+// @router /api/v1/oidc/token [post]
+func (o *Oidc) Token(c iris.Context) {
+	p := struct {
+		Ticket string `json:"ticket" validate:"required"`
+		Device string `json:"device" validate:"max=50"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+
+	user, err := o.oidcSvc.Redeem(ctx, p.Ticket)
+	if err != nil {
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+
+	// 与密码登录一样，需要两步验证时先返回临时凭证
+	if user.TotpEnabled || o.totpSvc.Required(user) {
+		mfaToken, err := o.totpSvc.Challenge(user, p.Device)
+		if err != nil {
+			resp.Error(cerror.ServerError.WithDebugs(err))
+			return
+		}
+		resp.Success(iris.Map{
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+			"totp_enabled": user.TotpEnabled,
+		})
+		return
+	}
+
+	pair, err := o.tokenSvc.Issue(ctx, user, p.Device, c.RemoteAddr(), c.GetHeader("User-Agent"))
+	if err != nil {
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(loginResponse(pair, user))
+}
+
+// 跳转到前端页面，key 为 ticket 或 error
+func (o *Oidc) redirect(c iris.Context, key, value string) {
+	sep := "?"
+	if strings.Contains(o.frontendUrl, "?") {
+		sep = "&"
+	}
+	c.Redirect(o.frontendUrl+sep+key+"="+url.QueryEscape(value), iris.StatusFound)
+}
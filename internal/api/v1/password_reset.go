@@ -0,0 +1,84 @@
+package v1
+
+import (
+	"github.com/kataras/iris/v12"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/response"
+	"github.com/xuxusheng/time-frequency-be/internal/service"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
+)
+
+// 找回密码相关接口，不需要登录
+type IPasswordReset interface {
+	Forgot(c iris.Context) // 发送重置密码邮件
+	Reset(c iris.Context)  // 使用邮件中的链接设置新密码
+}
+
+type PasswordReset struct {
+	passwordResetSvc service.IPasswordReset
+}
+
+func NewPasswordReset(passwordResetSvc service.IPasswordReset) *PasswordReset {
+	return &PasswordReset{passwordResetSvc: passwordResetSvc}
+}
+
+// 发送重置密码邮件 godoc
+// @summary 发送重置密码邮件
+// @description 向邮箱发送重置密码的链接，链接只能使用一次，过期时间见配置项 App.PasswordResetExpire
+// @description 邮箱没有对应的用户时同样返回成功，同一个用户一分钟内只会发送一次
+// @accept json
+// @produce json
+// @tags password-reset
+// @param email body string true "用户绑定的邮箱"
+// @success 200 {object} swagger.Resp
+// @router /api/v1/forgot-password [post]
+func (p *PasswordReset) Forgot(c iris.Context) {
+	param := struct {
+		Email string `json:"email" validate:"required,email"`
+	}{}
+	if ok := utils.BindAndValidate(c, &param); !ok {
+		return
+	}
+
+	resp := response.New(c)
+
+	err := p.passwordResetSvc.Request(c.Request().Context(), param.Email)
+	if err != nil {
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success()
+}
+
+// 重置密码 godoc
+// @summary 重置密码
+// @description 使用邮件中链接携带的 token 设置新密码，成功后所有设备需要重新登录
+// @accept json
+// @produce json
+// @tags password-reset
+// @param token body string true "重置链接中的 token"
+// @param new_password body string true "新密码"
+// @success 200 {object} swagger.Resp
+// @router /api/v1/reset-password [post]
+func (p *PasswordReset) Reset(c iris.Context) {
+	param := struct {
+		Token       string `json:"token" validate:"required"`
+		NewPassword string `json:"new_password" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &param); !ok {
+		return
+	}
+
+	resp := response.New(c)
+
+	err := p.passwordResetSvc.Reset(c.Request().Context(), param.Token, param.NewPassword)
+	if err != nil {
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success()
+}
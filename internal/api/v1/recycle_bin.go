@@ -0,0 +1,139 @@
+package v1
+
+import (
+	"errors"
+	"github.com/go-pg/pg/v10"
+	"github.com/kataras/iris/v12"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/response"
+	"github.com/xuxusheng/time-frequency-be/internal/service"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
+)
+
+// 回收站接口，管理员才能调用
+type IRecycleBin interface {
+	List(c iris.Context)    // 查询回收站中的数据
+	Restore(c iris.Context) // 从回收站恢复
+	Purge(c iris.Context)   // 彻底删除
+}
+
+type RecycleBin struct {
+	recycleBinSvc service.IRecycleBin
+}
+
+func NewRecycleBin(recycleBinSvc service.IRecycleBin) *RecycleBin {
+	return &RecycleBin{recycleBinSvc: recycleBinSvc}
+}
+
+// 查询回收站 godoc
+// @summary 查询回收站
+// @description 查询已删除的用户、班级、科目和学习资料，按删除时间倒序
+// @description 配置了保留时长时 purge_at 为预计彻底删除的时间
+// @accept json
+// @produce json
+// @tags recycle-bin
+// @param type body string false "数据类型，不传则查询全部" Enums(user, class, subject, learning_material)
+// @param pn body int true "pn"
+// @param ps body int true "ps"
+// @success 200 {object} swagger.Resp{data=swagger.DWithP{data=model.RecycleBinItem}}
+// @router /api/v1/admin/recycle-bin/list [post]
+func (r *RecycleBin) List(c iris.Context) {
+	p := struct {
+		Type string `json:"type" validate:"omitempty,oneof=user class subject learning_material"`
+		Pn   int    `json:"pn"`
+		Ps   int    `json:"ps"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	page := model.NewPage(p.Pn, p.Ps)
+
+	items, count, err := r.recycleBinSvc.ListAndCount(ctx, page, p.Type)
+	if err != nil {
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.SuccessList(items, page.WithTotal(count))
+}
+
+// 从回收站恢复 godoc
+// @summary 从回收站恢复
+// @description 恢复已删除的数据，删除期间创建了同名的数据时无法恢复
+// @description 学习资料所属的科目也在回收站中时，需要先恢复科目
+// @accept json
+// @produce json
+// @tags recycle-bin
+// @param type body string true "数据类型" Enums(user, class, subject, learning_material)
+// @param id body int true "数据ID"
+// @success 200 {object} swagger.Resp
+// @router /api/v1/admin/recycle-bin/restore [post]
+func (r *RecycleBin) Restore(c iris.Context) {
+	p := struct {
+		Type string `json:"type" validate:"required,oneof=user class subject learning_material"`
+		Id   int    `json:"id" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+
+	err := r.recycleBinSvc.Restore(ctx, p.Type, p.Id)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("回收站中没有这条数据"))
+			return
+		}
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success()
+}
+
+// 彻底删除 godoc
+// @summary 彻底删除
+// @description 彻底删除回收站中的数据，无法恢复
+// @description 用户仍是其他数据的创建人、科目下还有学习资料（包括回收站中的）时不允许彻底删除
+// @accept json
+// @produce json
+// @tags recycle-bin
+// @param type body string true "数据类型" Enums(user, class, subject, learning_material)
+// @param id body int true "数据ID"
+// @success 200 {object} swagger.Resp
+// @router /api/v1/admin/recycle-bin/purge [post]
+func (r *RecycleBin) Purge(c iris.Context) {
+	p := struct {
+		Type string `json:"type" validate:"required,oneof=user class subject learning_material"`
+		Id   int    `json:"id" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+
+	err := r.recycleBinSvc.Purge(ctx, p.Type, p.Id)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("回收站中没有这条数据"))
+			return
+		}
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success()
+}
@@ -0,0 +1,194 @@
+package v1
+
+import (
+	"errors"
+	"github.com/go-pg/pg/v10"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/middleware/jwt"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/response"
+	"github.com/xuxusheng/time-frequency-be/internal/service"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
+)
+
+// 角色管理接口，查询需要 role.manage 或 role.assign 权限，增删改需要 role.manage 权限
+type IRole interface {
+	List(c iris.Context)        // 查询所有角色
+	Permissions(c iris.Context) // 查询所有可以分配给角色的权限
+
+	Create(c iris.Context) // 创建角色
+	Update(c iris.Context) // 修改角色
+	Delete(c iris.Context) // 删除角色
+}
+
+type Role struct {
+	roleSvc service.IRole
+}
+
+func NewRole(roleSvc service.IRole) *Role {
+	return &Role{roleSvc: roleSvc}
+}
+
+// 查询所有角色 godoc
+// @summary 查询所有角色
+// @description 查询所有角色及其权限，内置角色在前
+// @accept json
+// @produce json
+// @tags role
+// @success 200 {object} swagger.Resp{data=[]model.Role}
+// @router /api/v1/admin/role/list [post]
+func (r *Role) List(c iris.Context) {
+	ctx := c.Request().Context()
+	resp := response.New(c)
+
+	roles, err := r.roleSvc.List(ctx)
+	if err != nil {
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(roles)
+}
+
+// 查询所有权限 godoc
+// @summary 查询所有权限
+// @description 查询所有可以分配给角色的权限及其说明
+// @accept json
+// @produce json
+// @tags role
+// @success 200 {object} swagger.Resp{data=[]model.Permission}
+// @router /api/v1/admin/role/permissions [post]
+func (r *Role) Permissions(c iris.Context) {
+	response.New(c).Success(model.Permissions)
+}
+
+// 创建角色 godoc
+// @summary 创建角色
+// @description 创建自定义角色，例如助教、课程负责人，只能授予自己拥有的权限
+// @accept json
+// @produce json
+// @tags role
+// @param name body string true "角色标识，小写字母、数字和下划线，创建后不能修改，例如 teaching_assistant"
+// @param nick_name body string true "显示名称，例如 助教"
+// @param description body string false "说明"
+// @param permissions body []string true "权限，可选值见 /api/v1/admin/role/permissions"
+// @success 200 {object} swagger.Resp{data=model.Role}
+// @router /api/v1/admin/role/create [post]
+func (r *Role) Create(c iris.Context) {
+	p := struct {
+		Name        string   `json:"name" validate:"required"`
+		NickName    string   `json:"nick_name" validate:"required,max=50"`
+		Description string   `json:"description" validate:"max=200"`
+		Permissions []string `json:"permissions" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	role := model.Role{
+		Name:        p.Name,
+		NickName:    p.NickName,
+		Description: p.Description,
+		Permissions: p.Permissions,
+	}
+	err := r.roleSvc.Create(ctx, claims.Uid, &role)
+	if err != nil {
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(role)
+}
+
+// 修改角色 godoc
+// @summary 修改角色
+// @description 修改角色的显示名称、说明和权限，修改后拥有这个角色的用户立即生效
+// @description 角色标识不能修改，内置的管理员角色不能修改权限，只能修改自己拥有全部权限的角色
+// @accept json
+// @produce json
+// @tags role
+// @param id body int true "角色ID"
+// @param nick_name body string true "显示名称"
+// @param description body string false "说明"
+// @param permissions body []string true "权限"
+// @success 200 {object} swagger.Resp{data=model.Role}
+// @router /api/v1/admin/role/update [post]
+func (r *Role) Update(c iris.Context) {
+	p := struct {
+		Id          int      `json:"id" validate:"required"`
+		NickName    string   `json:"nick_name" validate:"required,max=50"`
+		Description string   `json:"description" validate:"max=200"`
+		Permissions []string `json:"permissions" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	role, err := r.roleSvc.Update(ctx, claims.Uid, &model.Role{
+		Id:          p.Id,
+		NickName:    p.NickName,
+		Description: p.Description,
+		Permissions: p.Permissions,
+	})
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("角色不存在"))
+			return
+		}
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(role)
+}
+
+// 删除角色 godoc
+// @summary 删除角色
+// @description 删除自定义角色，拥有这个角色的用户同时失去对应的权限，内置角色不能删除
+// @accept json
+// @produce json
+// @tags role
+// @param id body int true "角色ID"
+// @success 200 {object} swagger.Resp
+// @router /api/v1/admin/role/delete [post]
+func (r *Role) Delete(c iris.Context) {
+	p := struct {
+		Id int `json:"id" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	err := r.roleSvc.Delete(ctx, claims.Uid, p.Id)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("角色不存在"))
+			return
+		}
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success()
+}
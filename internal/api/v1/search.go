@@ -0,0 +1,61 @@
+package v1
+
+import (
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/middleware/jwt"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/response"
+	"github.com/xuxusheng/time-frequency-be/internal/service"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
+)
+
+// 全文检索接口，所有登录用户都可以调用
+type ISearch interface {
+	Search(c iris.Context) // 全文检索
+}
+
+type Search struct {
+	searchSvc service.ISearch
+}
+
+func NewSearch(searchSvc service.ISearch) *Search {
+	return &Search{searchSvc: searchSvc}
+}
+
+// 全文检索 godoc
+// @summary 全文检索
+// @description 对搜索词进行中文分词，在学习资料、科目和用户中检索，结果按相关度排序
+// @description 学习资料只返回有权访问的科目下的，学生搜索不到用户
+// @accept json
+// @produce json
+// @tags search
+// @param query body string true "搜索词"
+// @param types body []string false "要搜索的数据类型，可选 learning_material、subject、user，不传则搜索全部"
+// @param pn body int true "pn"
+// @param ps body int true "ps"
+// @success 200 {object} swagger.Resp{data=swagger.DWithP{data=model.SearchResult}}
+// @router /api/v1/search [post]
+func (s *Search) Search(c iris.Context) {
+	p := struct {
+		Query string   `json:"query" validate:"required"`
+		Types []string `json:"types" validate:"dive,oneof=learning_material subject user"`
+		Pn    int      `json:"pn"`
+		Ps    int      `json:"ps"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+	page := model.NewPage(p.Pn, p.Ps)
+
+	results, count, err := s.searchSvc.Search(ctx, claims.Uid, page, p.Query, p.Types)
+	if err != nil {
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.SuccessList(results, page.WithTotal(count))
+}
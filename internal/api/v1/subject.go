@@ -0,0 +1,213 @@
+package v1
+
+import (
+	"errors"
+	"github.com/go-pg/pg/v10"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/middleware/jwt"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/response"
+	"github.com/xuxusheng/time-frequency-be/internal/service"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
+)
+
+// 科目相关接口，查询接口所有登录用户都可以调用，增删改需要 subject.manage 权限
+type ISubject interface {
+	Create(c iris.Context) // 创建科目
+
+	Get(c iris.Context)  // 查询单个科目
+	List(c iris.Context) // 查询科目列表
+
+	Update(c iris.Context) // 修改科目信息
+
+	Delete(c iris.Context) // 删除科目
+}
+
+type Subject struct {
+	subjectSvc service.ISubject
+}
+
+func NewSubject(subjectSvc service.ISubject) *Subject {
+	return &Subject{subjectSvc: subjectSvc}
+}
+
+// --- C ---
+
+// 创建科目 godoc
+// @summary 创建科目
+// @description 老师或管理员创建新科目
+// @accept json
+// @produce json
+// @tags subject
+// @param name body string true "科目名称"
+// @param description body string false "科目描述"
+// @success 200 {object} swagger.Resp{data=model.Subject}
+// @router /api/v1/teacher/subject/create [post]
+func (s *Subject) Create(c iris.Context) {
+	p := struct {
+		Name        string `json:"name" validate:"required"`
+		Description string `json:"description"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	subject, err := s.subjectSvc.Create(ctx, claims.Uid, p.Name, p.Description)
+	if err != nil {
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(subject)
+}
+
+// --- R ---
+
+// 查询单个科目 godoc
+// @summary 查询单个科目
+// @description 查询单个科目的详细信息，包含科目下的学习资料数量
+// @accept json
+// @produce json
+// @tags subject
+// @param id body int true "科目ID"
+// @success 200 {object} swagger.Resp{data=model.Subject}
+// @router /api/v1/subject/get [post]
+func (s *Subject) Get(c iris.Context) {
+	p := struct {
+		Id int `json:"id" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+
+	subject, err := s.subjectSvc.Get(ctx, p.Id)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("科目不存在"))
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(subject)
+}
+
+// 查询科目列表 godoc
+// @summary 查询科目列表
+// @description 分页查询科目列表，支持按名称和描述模糊搜索，返回每个科目下的学习资料数量
+// @accept json
+// @produce json
+// @tags subject
+// @param query body string false "模糊匹配科目名称和描述"
+// @param pn body int true "pn"
+// @param ps body int true "ps"
+// @success 200 {object} swagger.Resp{data=swagger.DWithP{data=model.Subject}}
+// @router /api/v1/subject/list [post]
+func (s *Subject) List(c iris.Context) {
+	p := struct {
+		Query string `json:"query"`
+		Pn    int    `json:"pn"`
+		Ps    int    `json:"ps"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	page := model.NewPage(p.Pn, p.Ps)
+
+	subjects, count, err := s.subjectSvc.ListAndCount(ctx, page, p.Query)
+	if err != nil {
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.SuccessList(subjects, page.WithTotal(count))
+}
+
+// --- U ---
+
+// 修改科目信息 godoc
+// @summary 修改科目信息
+// @description 修改科目名称和描述
+// @accept json
+// @produce json
+// @tags subject
+// @param id body int true "科目ID"
+// @param name body string true "科目名称"
+// @param description body string false "科目描述"
+// @success 200 {object} swagger.Resp{data=model.Subject}
+// @router /api/v1/teacher/subject/update [post]
+func (s *Subject) Update(c iris.Context) {
+	p := struct {
+		Id          int    `json:"id" validate:"required"`
+		Name        string `json:"name" validate:"required"`
+		Description string `json:"description"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+
+	subject, err := s.subjectSvc.Update(ctx, p.Id, p.Name, p.Description)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("科目不存在"))
+			return
+		}
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(subject)
+}
+
+// --- D ---
+
+// 删除科目 godoc
+// @summary 删除科目
+// @description 删除科目，科目下还有学习资料时不允许删除，科目进入回收站，可以由管理员恢复
+// @accept json
+// @produce json
+// @tags subject
+// @param id body int true "科目ID"
+// @success 200 {object} swagger.Resp
+// @router /api/v1/teacher/subject/delete [post]
+func (s *Subject) Delete(c iris.Context) {
+	p := struct {
+		Id int `json:"id" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+
+	err := s.subjectSvc.Delete(ctx, p.Id)
+	if err != nil {
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success()
+}
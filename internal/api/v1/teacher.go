@@ -1,37 +1,48 @@
 package v1
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"github.com/go-pg/pg/v10"
 	"github.com/kataras/iris/v12"
 	"github.com/kataras/iris/v12/middleware/jwt"
+	"github.com/xuxusheng/time-frequency-be/global"
 	"github.com/xuxusheng/time-frequency-be/internal/model"
 	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
 	"github.com/xuxusheng/time-frequency-be/internal/pkg/response"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/sheet"
 	"github.com/xuxusheng/time-frequency-be/internal/service"
 	"github.com/xuxusheng/time-frequency-be/internal/utils"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
 )
 
-// 老师角色才能调用的接口
+// 学生管理接口，需要 student.manage 权限，只能管理自己任教班级中的学生，拥有 student.manage_all 权限时不受限制
 type ITeacher interface {
-	CreateStudent(c iris.Context) // 创建用户
+	CreateStudent(c iris.Context)  // 创建用户
+	ImportStudents(c iris.Context) // 从表格批量导入学生
 
 	ListStudent(c iris.Context) // 查询学生列表
 	IsNameExist(c iris.Context)
 	IsPhoneExist(c iris.Context)
 	IsEmailExist(c iris.Context)
 
-	UpdateUser(c iris.Context) // 修改用户信息，老师修改时，允许修改用户名和昵称
+	UpdateUser(c iris.Context) // 修改学生信息，老师修改时，不允许修改用户名
 
 	DeleteStudent(c iris.Context) // 删除用户
 }
 
 type Teacher struct {
-	userSvc service.IUser
+	userSvc    service.IUser
+	teacherSvc service.ITeacher
+	importSvc  service.IStudentImport
 }
 
-func NewTeacher(userSvc service.IUser) *Teacher {
-	return &Teacher{userSvc: userSvc}
+func NewTeacher(userSvc service.IUser, teacherSvc service.ITeacher, importSvc service.IStudentImport) *Teacher {
+	return &Teacher{userSvc: userSvc, teacherSvc: teacherSvc, importSvc: importSvc}
 }
 
 // --- C ---
@@ -42,6 +53,8 @@ func (t *Teacher) CreateStudent(c iris.Context) {
 		Phone    string `json:"phone" validate:"required"`
 		Email    string `json:"email" validate:"required"`
 		Password string `json:"password" validate:"required"`
+		// 学生所在的班级，只能是自己任教的班级
+		ClassId int `json:"class_id"`
 	}{}
 	ctx := c.Request().Context()
 	resp := response.New(c)
@@ -57,12 +70,16 @@ func (t *Teacher) CreateStudent(c iris.Context) {
 		NickName:    p.NickName,
 		Phone:       p.Phone,
 		Email:       p.Email,
-		Role:        model.UserRoleStudent,
-		IsAdmin:     false,
 		Password:    p.Password,
+		// 密码由老师设置，学生首次登录后需要修改
+		MustChangePassword: true,
 	}
-	err := t.userSvc.Create(ctx, &user)
+	err := t.teacherSvc.CreateStudent(ctx, claims.Uid, p.ClassId, &user)
 	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("班级不存在"))
+			return
+		}
 		if cerr, ok := err.(cerror.IError); ok {
 			resp.Error(cerr)
 			return
@@ -74,6 +91,106 @@ func (t *Teacher) CreateStudent(c iris.Context) {
 	resp.Success(user)
 }
 
+// 从表格批量导入学生 godoc
+// @summary 从表格批量导入学生
+// @description 上传 CSV（UTF-8 编码）或 XLSX 表格，第一行为表头，需要有用户名、姓名、手机号、邮箱列，班级列填写班级名称
+// @description 只能导入到自己任教的班级中，一次最多导入 500 名学生
+// @description dry_run 为 true 时只校验，返回每一行的错误；否则校验全部通过后在一个事务中创建，有任意一行不通过时都不创建，错误详情在 err_details 中
+// @description 导入成功时直接返回与上传格式相同的表格，包含每个学生的初始密码，只返回这一次，学生首次登录后需要修改密码
+// @accept mpfd
+// @produce json,octet-stream
+// @tags teacher
+// @param file formData file true "学生表格，.csv 或 .xlsx"
+// @param dry_run formData bool false "是否只校验"
+// @success 200 {object} swagger.Resp{data=service.StudentImportReport}
+// @router /api/v1/teacher/import-students [post]
+func (t *Teacher) ImportStudents(c iris.Context) {
+	c.SetMaxRequestBodySize(global.Setting.App.UploadMaxSize << 20)
+
+	p := struct {
+		DryRun bool `form:"dry_run"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	file, header, err := c.FormFile("file")
+	if err != nil {
+		resp.Error(cerror.BadRequest.WithMsg("请选择要导入的表格").WithDebugs(err))
+		return
+	}
+	defer file.Close()
+
+	ext := strings.ToLower(path.Ext(header.Filename))
+	if !sheet.Supported(ext) {
+		resp.Error(cerror.BadRequest.WithMsg("只支持 CSV 和 XLSX 格式的表格"))
+		return
+	}
+	// 表格中可能有空行，读取的行数多留一些
+	rows, err := sheet.Read(file, header.Size, ext, service.StudentImportMaxRows*2)
+	if err != nil {
+		if errors.Is(err, sheet.ErrTooManyRows) {
+			resp.Error(cerror.BadRequest.WithMsg(fmt.Sprintf("一次最多导入 %d 名学生", service.StudentImportMaxRows)))
+			return
+		}
+		resp.Error(cerror.BadRequest.WithMsg("表格读取失败：" + err.Error()))
+		return
+	}
+
+	if p.DryRun {
+		report, err := t.importSvc.Check(ctx, claims.Uid, rows)
+		if err != nil {
+			if cerr, ok := err.(cerror.IError); ok {
+				resp.Error(cerr)
+				return
+			}
+			resp.Error(cerror.ServerError.WithDebugs(err))
+			return
+		}
+		resp.Success(report)
+		return
+	}
+
+	report, err := t.importSvc.Import(ctx, claims.Uid, rows)
+	if err != nil {
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+
+	// 先写到内存中，出错时还能返回错误信息
+	buf := &bytes.Buffer{}
+	w, err := sheet.NewWriter(buf, ext)
+	if err == nil {
+		err = w.Write([]string{"行号", "用户名", "姓名", "班级", "初始密码"})
+	}
+	for _, r := range report.Rows {
+		if err != nil {
+			break
+		}
+		err = w.Write([]string{strconv.Itoa(r.Row), r.Name, r.NickName, r.Class, r.Password})
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		// 学生已经创建，只是表格生成失败，可以由老师重置密码
+		resp.Error(cerror.ServerError.WithMsg("学生已导入，但初始密码表格生成失败，请重置学生的密码").WithDebugs(err))
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Disposition", "attachment; filename*=UTF-8''"+url.PathEscape("学生初始密码"+ext))
+	c.ContentType(sheet.ContentType(ext))
+	_, _ = c.Write(buf.Bytes())
+}
+
 // --- R ---
 func (t *Teacher) ListStudent(c iris.Context) {
 	p := struct {
@@ -88,8 +205,9 @@ func (t *Teacher) ListStudent(c iris.Context) {
 	ctx := c.Request().Context()
 	resp := response.New(c)
 	page := model.NewPage(p.Pn, p.Ps)
+	claims := jwt.Get(c).(*model.JWTClaims)
 
-	users, count, err := t.userSvc.ListAndCount(ctx, page, p.Query, "student")
+	users, count, err := t.teacherSvc.ListStudentsAndCount(ctx, claims.Uid, page, p.Query)
 	if err != nil {
 		resp.Error(cerror.ServerError.WithDebugs(err))
 		return
@@ -177,19 +295,26 @@ func (t *Teacher) UpdateUser(c iris.Context) {
 
 	ctx := c.Request().Context()
 	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	if !t.checkStudent(c, claims.Uid, p.Id) {
+		return
+	}
+
 	columns := []string{"nick_name", "phone", "email"}
 
-	// Password 字段如果为空的话，就不修改
+	// Password 字段如果为空的话，就不修改，修改了的话用户下次登录后需要自己再改一次
 	if p.Password != "" {
-		columns = append(columns, "password")
+		columns = append(columns, "password", "must_change_password")
 	}
 
 	user := model.User{
-		Id:       p.Id,
-		NickName: p.NickName,
-		Phone:    p.Phone,
-		Email:    p.Email,
-		Password: p.Password,
+		Id:                 p.Id,
+		NickName:           p.NickName,
+		Phone:              p.Phone,
+		Email:              p.Email,
+		Password:           p.Password,
+		MustChangePassword: p.Password != "",
 	}
 	err := t.userSvc.Update(ctx, &user, columns)
 	if err != nil {
@@ -219,26 +344,36 @@ func (t *Teacher) DeleteStudent(c iris.Context) {
 		return
 	}
 
-	user, err := t.userSvc.Get(ctx, p.Id)
-	if err != nil {
-		if errors.Is(err, pg.ErrNoRows) {
-			resp.Error(cerror.NotFound.WithMsg("用户不存在"))
-			return
-		}
-		resp.Error(cerror.ServerError.WithDebugs(err))
-		return
-	}
+	claims := jwt.Get(c).(*model.JWTClaims)
 
-	// 验证被删除的用户是否是学生
-	if user.Role != "student" {
-		resp.Error(cerror.Forbidden.WithMsg("无权删除非学生账号，请联系管理员"))
+	// 验证被删除的用户是否是自己任教班级中的学生
+	if !t.checkStudent(c, claims.Uid, p.Id) {
 		return
 	}
 
-	err = t.userSvc.Delete(ctx, p.Id)
+	err := t.userSvc.Delete(ctx, p.Id)
 	if err != nil {
 		resp.Error(cerror.ServerError.WithDebugs(err))
 		return
 	}
 	resp.Success()
 }
+
+// 只能操作自己任教班级中的学生，不满足时直接返回错误响应
+func (t *Teacher) checkStudent(c iris.Context, teacherId, studentId int) bool {
+	_, err := t.teacherSvc.GetStudent(c.Request().Context(), teacherId, studentId)
+	if err == nil {
+		return true
+	}
+	resp := response.New(c)
+	if errors.Is(err, pg.ErrNoRows) {
+		resp.Error(cerror.NotFound.WithMsg("用户不存在"))
+		return false
+	}
+	if cerr, ok := err.(cerror.IError); ok {
+		resp.Error(cerr)
+		return false
+	}
+	resp.Error(cerror.ServerError.WithDebugs(err))
+	return false
+}
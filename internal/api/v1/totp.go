@@ -0,0 +1,352 @@
+package v1
+
+import (
+	"errors"
+	"github.com/go-pg/pg/v10"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/middleware/jwt"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/response"
+	"github.com/xuxusheng/time-frequency-be/internal/service"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
+)
+
+// 两步验证相关接口
+type ITotp interface {
+	// --- 登录第二步，使用登录接口返回的 mfa_token，不需要登录 ---
+	LoginVerify(c iris.Context) // 输入验证码或恢复码完成登录
+	LoginSetup(c iris.Context)  // 策略要求开启两步验证但还没有开启时，获取密钥
+	LoginEnable(c iris.Context) // 策略要求开启两步验证但还没有开启时，确认开启并完成登录
+
+	// --- 登录后管理自己的两步验证 ---
+	Setup(c iris.Context)         // 获取密钥
+	Enable(c iris.Context)        // 确认开启
+	Disable(c iris.Context)       // 关闭
+	RecoveryCodes(c iris.Context) // 重新生成恢复码
+}
+
+type Totp struct {
+	userSvc       service.IUser
+	tokenSvc      service.IToken
+	loginGuardSvc service.ILoginGuard
+	totpSvc       service.ITotp
+}
+
+func NewTotp(userSvc service.IUser, tokenSvc service.IToken, loginGuardSvc service.ILoginGuard, totpSvc service.ITotp) *Totp {
+	return &Totp{userSvc: userSvc, tokenSvc: tokenSvc, loginGuardSvc: loginGuardSvc, totpSvc: totpSvc}
+}
+
+// 两步验证登录 godoc
+// @summary 两步验证登录
+// @description 登录接口返回 mfa_required 时，输入验证器 App 中的验证码或者恢复码完成登录
+// @description 验证码错误同样计入登录失败次数
+// @accept json
+// @produce json
+// @tags totp
+// @param mfa_token body string true "登录接口返回的临时凭证，5 分钟内有效"
+// @param code body string true "6 位验证码或者恢复码"
+// @success 200 {object} swagger.Resp
+// @router /api/v1/login/totp [post]
+func (t *Totp) LoginVerify(c iris.Context) {
+	p := struct {
+		MfaToken string `json:"mfa_token" validate:"required"`
+		Code     string `json:"code" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	ip := c.RemoteAddr()
+
+	claims, user, ok := t.challengeUser(c, p.MfaToken)
+	if !ok {
+		return
+	}
+
+	err := t.totpSvc.Verify(ctx, user, p.Code)
+	if err != nil {
+		if cerr, ok := err.(cerror.IError); ok {
+			t.loginFailed(c, user.Name, cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+
+	err = t.loginGuardSvc.Succeed(ctx, user.Name)
+	if err != nil {
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	pair, err := t.tokenSvc.Issue(ctx, user, claims.Device, ip, c.GetHeader("User-Agent"))
+	if err != nil {
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(loginResponse(pair, user))
+}
+
+// 登录时获取两步验证密钥 godoc
+// @summary 登录时获取两步验证密钥
+// @description 登录接口返回 mfa_required 且 totp_enabled 为 false 时，说明管理员要求开启两步验证，需要先获取密钥
+// @accept json
+// @produce json
+// @tags totp
+// @param mfa_token body string true "登录接口返回的临时凭证"
+// @success 200 {object} swagger.Resp{data=model.TotpSetup}
+// @router /api/v1/login/totp/setup [post]
+func (t *Totp) LoginSetup(c iris.Context) {
+	p := struct {
+		MfaToken string `json:"mfa_token" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+
+	_, user, ok := t.challengeUser(c, p.MfaToken)
+	if !ok {
+		return
+	}
+
+	setup, err := t.totpSvc.Setup(ctx, user.Id)
+	if err != nil {
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(setup)
+}
+
+// 登录时开启两步验证 godoc
+// @summary 登录时开启两步验证
+// @description 输入验证器 App 中的验证码确认开启，同时完成登录，返回的恢复码只显示这一次
+// @accept json
+// @produce json
+// @tags totp
+// @param mfa_token body string true "登录接口返回的临时凭证"
+// @param code body string true "6 位验证码"
+// @success 200 {object} swagger.Resp
+// @router /api/v1/login/totp/enable [post]
+func (t *Totp) LoginEnable(c iris.Context) {
+	p := struct {
+		MfaToken string `json:"mfa_token" validate:"required"`
+		Code     string `json:"code" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	ip := c.RemoteAddr()
+
+	claims, user, ok := t.challengeUser(c, p.MfaToken)
+	if !ok {
+		return
+	}
+
+	codes, err := t.totpSvc.Enable(ctx, user.Id, p.Code)
+	if err != nil {
+		if cerr, ok := err.(cerror.IError); ok {
+			t.loginFailed(c, user.Name, cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+
+	err = t.loginGuardSvc.Succeed(ctx, user.Name)
+	if err != nil {
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	user.TotpEnabled = true
+	pair, err := t.tokenSvc.Issue(ctx, user, claims.Device, ip, c.GetHeader("User-Agent"))
+	if err != nil {
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	data := loginResponse(pair, user)
+	data["recovery_codes"] = codes
+	resp.Success(data)
+}
+
+// 获取两步验证密钥 godoc
+// @summary 获取两步验证密钥
+// @description 生成新的密钥，在验证器 App 中添加后调用开启接口确认，确认之前两步验证不会生效
+// @accept json
+// @produce json
+// @tags totp
+// @success 200 {object} swagger.Resp{data=model.TotpSetup}
+// @router /api/v1/user/totp/setup [post]
+func (t *Totp) Setup(c iris.Context) {
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	setup, err := t.totpSvc.Setup(ctx, claims.Uid)
+	if err != nil {
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(setup)
+}
+
+// 开启两步验证 godoc
+// @summary 开启两步验证
+// @description 输入验证器 App 中的验证码确认开启，返回的恢复码只显示这一次，请妥善保存
+// @accept json
+// @produce json
+// @tags totp
+// @param code body string true "6 位验证码"
+// @success 200 {object} swagger.Resp{data=[]string} "恢复码"
+// @router /api/v1/user/totp/enable [post]
+func (t *Totp) Enable(c iris.Context) {
+	p := struct {
+		Code string `json:"code" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	codes, err := t.totpSvc.Enable(ctx, claims.Uid, p.Code)
+	if err != nil {
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(codes)
+}
+
+// 关闭两步验证 godoc
+// @summary 关闭两步验证
+// @description 输入验证码或者恢复码后关闭，管理员要求开启两步验证的用户不能关闭
+// @accept json
+// @produce json
+// @tags totp
+// @param code body string true "6 位验证码或者恢复码"
+// @success 200 {object} swagger.Resp
+// @router /api/v1/user/totp/disable [post]
+func (t *Totp) Disable(c iris.Context) {
+	p := struct {
+		Code string `json:"code" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	err := t.totpSvc.Disable(ctx, claims.Uid, p.Code)
+	if err != nil {
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success()
+}
+
+// 重新生成恢复码 godoc
+// @summary 重新生成恢复码
+// @description 输入验证码后重新生成恢复码，原有的恢复码全部失效
+// @accept json
+// @produce json
+// @tags totp
+// @param code body string true "6 位验证码"
+// @success 200 {object} swagger.Resp{data=[]string} "恢复码"
+// @router /api/v1/user/totp/recovery-codes [post]
+func (t *Totp) RecoveryCodes(c iris.Context) {
+	p := struct {
+		Code string `json:"code" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	codes, err := t.totpSvc.RegenerateRecoveryCodes(ctx, claims.Uid, p.Code)
+	if err != nil {
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(codes)
+}
+
+// 解析临时凭证并查询用户，同时检查登录失败次数，失败时已经写入响应
+func (t *Totp) challengeUser(c iris.Context, mfaToken string) (*model.MfaClaims, *model.User, bool) {
+	ctx := c.Request().Context()
+	resp := response.New(c)
+
+	claims, err := t.totpSvc.ParseChallenge(mfaToken)
+	if err != nil {
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return nil, nil, false
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return nil, nil, false
+	}
+	user, err := t.userSvc.Get(ctx, claims.Uid)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.TokenInvalid.WithMsg("登录已过期，请重新输入密码"))
+			return nil, nil, false
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return nil, nil, false
+	}
+
+	err = t.loginGuardSvc.Check(ctx, user.Name, c.RemoteAddr())
+	if err != nil {
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return nil, nil, false
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return nil, nil, false
+	}
+	return claims, user, true
+}
+
+// 验证码错误时和密码错误一样记录失败次数
+func (t *Totp) loginFailed(c iris.Context, name string, cerr cerror.IError) {
+	resp := response.New(c)
+	err := t.loginGuardSvc.Fail(c.Request().Context(), name, c.RemoteAddr())
+	if err != nil {
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Error(cerr)
+}
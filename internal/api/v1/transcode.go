@@ -0,0 +1,202 @@
+package v1
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-pg/pg/v10"
+	"github.com/kataras/iris/v12"
+	"github.com/xuxusheng/time-frequency-be/global"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/storage"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/hls"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/response"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/signurl"
+	"github.com/xuxusheng/time-frequency-be/internal/service"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
+	"path"
+	"strconv"
+	"time"
+)
+
+// 视频转码相关接口，查询和播放的权限与下载学习资料一致
+type ITranscode interface {
+	GetJob(c iris.Context) // 查询资料当前版本的转码任务
+	HlsUrl(c iris.Context) // 生成带签名的 HLS 播放地址
+	Hls(c iris.Context)    // 通过签名播放地址获取播放列表和分片，不需要登录
+	Retry(c iris.Context)  // 重新执行失败的转码任务
+}
+
+type Transcode struct {
+	lm           *LearningMaterial
+	transcodeSvc service.ITranscode
+}
+
+// 权限校验复用学习资料接口的逻辑
+func NewTranscode(lm *LearningMaterial, transcodeSvc service.ITranscode) *Transcode {
+	return &Transcode{lm: lm, transcodeSvc: transcodeSvc}
+}
+
+// 查询转码任务 godoc
+// @summary 查询转码任务
+// @description 查询视频资料当前版本的转码任务，上传视频后由后台自动创建，status 为 done 后可以获取 HLS 播放地址
+// @accept json
+// @produce json
+// @tags learning-material
+// @param id body int true "资料ID"
+// @success 200 {object} swagger.Resp{data=model.TranscodeJob}
+// @router /api/v1/learning-material/get-transcode-job [post]
+func (t *Transcode) GetJob(c iris.Context) {
+	p := struct {
+		Id int `json:"id" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	resp := response.New(c)
+	if _, ok := t.lm.getAccessible(c, p.Id); !ok {
+		return
+	}
+
+	job, err := t.transcodeSvc.GetJob(c.Request().Context(), p.Id)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("该资料没有转码任务"))
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(job)
+}
+
+// 生成 HLS 播放地址 godoc
+// @summary 生成 HLS 播放地址
+// @description 生成一个短期有效的 HLS 主播放列表地址，可以直接交给播放器使用，播放列表中的分片地址为相对路径，共用同一个签名
+// @accept json
+// @produce json
+// @tags learning-material
+// @param id body int true "资料ID"
+// @success 200 {object} swagger.Resp{data=object{url=string,expires_at=string,renditions=[]string}}
+// @router /api/v1/learning-material/hls-url [post]
+func (t *Transcode) HlsUrl(c iris.Context) {
+	p := struct {
+		Id int `json:"id" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	resp := response.New(c)
+	if _, ok := t.lm.getAccessible(c, p.Id); !ok {
+		return
+	}
+
+	job, err := t.transcodeSvc.GetJob(c.Request().Context(), p.Id)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("该资料没有转码任务"))
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	if job.Status != model.TranscodeStatusDone {
+		resp.Error(cerror.BadRequest.WithMsg("视频还没有转码完成"))
+		return
+	}
+
+	// 签名放在路径中，播放列表里的相对地址会自动带上
+	expires := time.Now().Add(global.Setting.App.DownloadUrlExpire)
+	signature := signurl.Sign(global.Setting.JWT.Secret, hlsResource(p.Id), expires)
+	resp.Success(response.Map{
+		"url":        fmt.Sprintf("/api/v1/learning-material/hls/%d/%d/%s/%s", p.Id, expires.Unix(), signature, hls.MasterPlaylist),
+		"expires_at": expires,
+		"renditions": job.Renditions,
+	})
+}
+
+// 获取 HLS 文件 godoc
+// @summary 获取 HLS 文件
+// @description 使用 hls-url 接口生成的地址获取播放列表和分片，不需要携带 token，支持 Range 请求
+// @produce octet-stream
+// @tags learning-material
+// @param id path int true "资料ID"
+// @param expires path int true "过期时间戳"
+// @param signature path string true "签名"
+// @param file path string true "文件路径，例如 master.m3u8、720p/index.m3u8"
+// @success 200 {file} file
+// @router /api/v1/learning-material/hls/{id}/{expires}/{signature}/{file} [get]
+func (t *Transcode) Hls(c iris.Context) {
+	resp := response.New(c)
+	id, err := c.Params().GetInt("id")
+	if err != nil {
+		resp.Error(cerror.BadRequest.WithMsg("资料ID不合法"))
+		return
+	}
+	expires, _ := c.Params().GetInt64("expires")
+	if !signurl.Verify(global.Setting.JWT.Secret, hlsResource(id), expires, c.Params().Get("signature")) {
+		resp.Error(cerror.Forbidden.WithMsg("播放地址无效或已过期"))
+		return
+	}
+
+	name := c.Params().Get("file")
+	obj, err := t.transcodeSvc.Open(c.Request().Context(), id, name)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) || errors.Is(err, storage.ErrNotExist) {
+			resp.Error(cerror.NotFound.WithMsg("文件不存在"))
+			return
+		}
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	defer obj.Close()
+
+	c.Header("Content-Type", hls.ContentType(name))
+	c.Header("Accept-Ranges", "bytes")
+	_ = c.CompressWriter(false)
+	c.ServeContent(obj, path.Base(name), time.Time{})
+}
+
+// 重新转码 godoc
+// @summary 重新转码
+// @description 转码多次失败后任务会停止重试，排查问题后可以调用该接口重新执行
+// @accept json
+// @produce json
+// @tags learning-material
+// @param id body int true "资料ID"
+// @success 200 {object} swagger.Resp{data=model.TranscodeJob}
+// @router /api/v1/teacher/learning-material/retranscode [post]
+func (t *Transcode) Retry(c iris.Context) {
+	p := struct {
+		Id int `json:"id" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	resp := response.New(c)
+	job, err := t.transcodeSvc.Retry(c.Request().Context(), p.Id)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("该资料没有转码任务"))
+			return
+		}
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(job)
+}
+
+func hlsResource(id int) string {
+	return "learning-material-hls:" + strconv.Itoa(id)
+}
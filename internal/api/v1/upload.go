@@ -0,0 +1,287 @@
+package v1
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/go-pg/pg/v10"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/middleware/jwt"
+	"github.com/xuxusheng/time-frequency-be/global"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/response"
+	"github.com/xuxusheng/time-frequency-be/internal/service"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const tusVersion = "1.0.0"
+
+// 大文件断点续传接口，遵循 tus 1.0.0 协议（https://tus.io/protocols/resumable-upload.html）
+// 支持 creation、termination 扩展，可以直接使用 tus-js-client 等现成的客户端
+type IUpload interface {
+	Options(c iris.Context) // 查询服务端支持的协议版本和扩展
+
+	Create(c iris.Context) // 创建上传
+
+	Head(c iris.Context) // 查询上传进度
+
+	Patch(c iris.Context) // 上传分片
+
+	Delete(c iris.Context) // 取消上传
+}
+
+type Upload struct {
+	lm        *LearningMaterial
+	uploadSvc service.IUpload
+}
+
+// 创建上传时复用 lm 中的科目检查
+func NewUpload(lm *LearningMaterial, uploadSvc service.IUpload) *Upload {
+	return &Upload{lm: lm, uploadSvc: uploadSvc}
+}
+
+// 查询 tus 协议信息 godoc
+// @summary 查询 tus 协议信息
+// @description 返回服务端支持的 tus 版本、扩展和最大文件大小
+// @tags upload
+// @success 204
+// @router /api/v1/teacher/uploads [options]
+func (u *Upload) Options(c iris.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", "creation,termination")
+	c.Header("Tus-Max-Size", strconv.FormatInt(global.Setting.App.UploadMaxSize<<20, 10))
+	c.StopWithStatus(iris.StatusNoContent)
+}
+
+// --- C ---
+
+// 创建上传 godoc
+// @summary 创建上传
+// @description 创建一个断点续传任务，Upload-Metadata 中需要包含 name（资料名称）、subject_id（科目ID），可选 filename、description、md5，值均为 base64 编码
+// @description 创建成功后通过 Location 返回上传地址，上传完成后会自动创建学习资料
+// @description 只能上传到有权访问的科目下，科目不存在时返回 400
+// @tags upload
+// @param Tus-Resumable header string true "协议版本，固定为 1.0.0"
+// @param Upload-Length header int true "文件大小"
+// @param Upload-Metadata header string true "文件元数据"
+// @success 201
+// @router /api/v1/teacher/uploads [post]
+func (u *Upload) Create(c iris.Context) {
+	if ok := checkTusResumable(c); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		resp.Error(cerror.BadRequest.WithMsg("Upload-Length 不合法"))
+		return
+	}
+	if length > global.Setting.App.UploadMaxSize<<20 {
+		resp.Error(cerror.PayloadTooLarge.WithMsg("文件大小超出限制"))
+		return
+	}
+
+	meta, err := parseUploadMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		resp.Error(cerror.BadRequest.WithMsg("Upload-Metadata 不合法").WithDebugs(err))
+		return
+	}
+	if meta["name"] == "" {
+		resp.Error(cerror.BadRequest.WithMsg("资料名称不能为空"))
+		return
+	}
+	subjectId, err := strconv.Atoi(meta["subject_id"])
+	if err != nil || subjectId <= 0 {
+		resp.Error(cerror.BadRequest.WithMsg("科目ID不合法"))
+		return
+	}
+	if ok := u.lm.checkSubject(c, subjectId); !ok {
+		return
+	}
+
+	upload, err := u.uploadSvc.Create(ctx, claims.Uid, subjectId, length, meta["filename"], meta["name"], meta["description"], meta["md5"])
+	if err != nil {
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+
+	c.Header("Location", strings.TrimSuffix(c.Path(), "/")+"/"+upload.Id)
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.StopWithStatus(iris.StatusCreated)
+}
+
+// --- R ---
+
+// 查询上传进度 godoc
+// @summary 查询上传进度
+// @description 通过 Upload-Offset 返回已上传的字节数，上传完成后通过 Upload-Learning-Material-Id 返回创建的学习资料ID
+// @tags upload
+// @param Tus-Resumable header string true "协议版本，固定为 1.0.0"
+// @param id path string true "上传ID"
+// @success 200
+// @router /api/v1/teacher/uploads/{id} [head]
+func (u *Upload) Head(c iris.Context) {
+	if ok := checkTusResumable(c); !ok {
+		return
+	}
+
+	upload, ok := u.getUpload(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	setUploadHeaders(c, upload)
+	c.StopWithStatus(iris.StatusOK)
+}
+
+// --- U ---
+
+// 上传分片 godoc
+// @summary 上传分片
+// @description 从 Upload-Offset 处写入分片，Upload-Offset 必须和服务端记录的一致，否则返回 409
+// @description 所有分片上传完成后，服务端合并文件、校验 md5 并创建学习资料
+// @accept application/offset+octet-stream
+// @tags upload
+// @param Tus-Resumable header string true "协议版本，固定为 1.0.0"
+// @param Upload-Offset header int true "分片起始位置"
+// @param id path string true "上传ID"
+// @success 204
+// @router /api/v1/teacher/uploads/{id} [patch]
+func (u *Upload) Patch(c iris.Context) {
+	if ok := checkTusResumable(c); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+
+	if c.GetContentTypeRequested() != "application/offset+octet-stream" {
+		resp.Error(cerror.UnsupportedMedia.WithMsg("Content-Type 必须为 application/offset+octet-stream"))
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		resp.Error(cerror.BadRequest.WithMsg("Upload-Offset 不合法"))
+		return
+	}
+
+	upload, ok := u.getUpload(c)
+	if !ok {
+		return
+	}
+	upload, err = u.uploadSvc.WriteChunk(ctx, upload, offset, c.Request().Body)
+	if err != nil {
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+
+	setUploadHeaders(c, upload)
+	c.StopWithStatus(iris.StatusNoContent)
+}
+
+// --- D ---
+
+// 取消上传 godoc
+// @summary 取消上传
+// @description 取消上传并删除已上传的分片
+// @tags upload
+// @param Tus-Resumable header string true "协议版本，固定为 1.0.0"
+// @param id path string true "上传ID"
+// @success 204
+// @router /api/v1/teacher/uploads/{id} [delete]
+func (u *Upload) Delete(c iris.Context) {
+	if ok := checkTusResumable(c); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+
+	upload, ok := u.getUpload(c)
+	if !ok {
+		return
+	}
+
+	err := u.uploadSvc.Delete(ctx, upload)
+	if err != nil {
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	c.StopWithStatus(iris.StatusNoContent)
+}
+
+// 根据路径中的 id 查询当前用户的上传，查询失败时直接返回错误
+func (u *Upload) getUpload(c iris.Context) (*model.Upload, bool) {
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	upload, err := u.uploadSvc.Get(ctx, claims.Uid, c.Params().Get("id"))
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("上传不存在或已过期"))
+			return nil, false
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return nil, false
+	}
+	return upload, true
+}
+
+// 所有 tus 请求都需要带上 Tus-Resumable 头，响应中也要返回
+func checkTusResumable(c iris.Context) bool {
+	c.Header("Tus-Resumable", tusVersion)
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		response.New(c).Error(cerror.PreconditionFailed.WithMsg("不支持的 tus 协议版本"))
+		return false
+	}
+	return true
+}
+
+func setUploadHeaders(c iris.Context, upload *model.Upload) {
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if upload.LearningMaterialId != 0 {
+		c.Header("Upload-Learning-Material-Id", strconv.Itoa(upload.LearningMaterialId))
+	}
+}
+
+// 解析 Upload-Metadata，格式为逗号分隔的 key 和 base64 编码的 value，value 可以省略
+func parseUploadMetadata(header string) (map[string]string, error) {
+	meta := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, " ", 2)
+		if len(kv) == 1 {
+			meta[kv[0]] = ""
+			continue
+		}
+		v, err := base64.StdEncoding.DecodeString(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, err
+		}
+		meta[kv[0]] = string(v)
+	}
+	return meta, nil
+}
@@ -5,7 +5,6 @@ import (
 	"github.com/go-pg/pg/v10"
 	"github.com/kataras/iris/v12"
 	"github.com/kataras/iris/v12/middleware/jwt"
-	"github.com/xuxusheng/time-frequency-be/global"
 	"github.com/xuxusheng/time-frequency-be/internal/model"
 	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
 	"github.com/xuxusheng/time-frequency-be/internal/pkg/response"
@@ -22,14 +21,25 @@ type IUser interface {
 	UpdatePassword(c iris.Context)
 
 	Login(c iris.Context)
+	RefreshToken(c iris.Context) // 使用刷新 token 换取新的 token
+	Logout(c iris.Context)       // 作废刷新 token
+
+	Sessions(c iris.Context)      // 查询自己所有有效的登录会话
+	RevokeSession(c iris.Context) // 下线自己的某个登录会话
 }
 
 type User struct {
-	userSvc service.IUser
+	userSvc       service.IUser
+	authSvc       service.IAuth
+	tokenSvc      service.IToken
+	sessionSvc    service.ISession
+	loginGuardSvc service.ILoginGuard
+	totpSvc       service.ITotp
 }
 
-func NewUser(userSvc service.IUser) *User {
-	return &User{userSvc: userSvc}
+// authSvc 为登录时使用的认证方式，本地密码或者 LDAP
+func NewUser(userSvc service.IUser, authSvc service.IAuth, tokenSvc service.IToken, sessionSvc service.ISession, loginGuardSvc service.ILoginGuard, totpSvc service.ITotp) *User {
+	return &User{userSvc: userSvc, authSvc: authSvc, tokenSvc: tokenSvc, sessionSvc: sessionSvc, loginGuardSvc: loginGuardSvc, totpSvc: totpSvc}
 }
 
 // --- R ---
@@ -111,11 +121,51 @@ func (u *User) UpdatePassword(c iris.Context) {
 	resp.Success(user)
 }
 
+// 查询自己所有有效的登录会话，按最近使用时间倒序，current 标记当前请求所属的会话
+func (u *User) Sessions(c iris.Context) {
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	sessions, err := u.sessionSvc.List(ctx, claims.Uid, claims.Sid)
+	if err != nil {
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(sessions)
+}
+
+// 下线自己的某个登录会话，例如忘记在机房电脑上退出登录，也可以下线当前会话
+func (u *User) RevokeSession(c iris.Context) {
+	p := struct {
+		Id int `json:"id" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+	claims := jwt.Get(c).(*model.JWTClaims)
+
+	err := u.sessionSvc.Revoke(ctx, claims.Uid, p.Id)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			resp.Error(cerror.NotFound.WithMsg("会话不存在或已下线"))
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success()
+}
+
 // --- AUTH ---
 func (u User) Login(c iris.Context) {
 	p := struct {
 		Name     string `json:"name" validate:"required"`
 		Password string `json:"password" validate:"required"`
+		Device   string `json:"device" validate:"max=50"` // 设备名称，例如机房的电脑编号，不传则根据 User-Agent 生成
 	}{}
 	if ok := utils.BindAndValidate(c, &p); !ok {
 		return
@@ -124,38 +174,131 @@ func (u User) Login(c iris.Context) {
 	ctx := c.Request().Context()
 	resp := response.New(c)
 
-	svc := u.userSvc
+	ip := c.RemoteAddr()
 
-	user, err := svc.GetByName(ctx, p.Name)
+	// 连续失败次数过多时，在对比密码之前直接拒绝
+	err := u.loginGuardSvc.Check(ctx, p.Name, ip)
 	if err != nil {
-		if errors.Is(err, pg.ErrNoRows) {
-			resp.Error(cerror.BadRequest.WithMsg("用户名或密码错误"))
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
 			return
 		}
-		resp.Error(cerror.BadRequest.WithDebugs(err))
+		resp.Error(cerror.ServerError.WithDebugs(err))
 		return
 	}
 
-	// 用户存在，对比密码
-	err = utils.ComparePwd(user.Password, p.Password)
+	// 依次尝试本地密码和 LDAP
+	user, err := u.authSvc.Authenticate(ctx, p.Name, p.Password)
 	if err != nil {
-		resp.Error(cerror.BadRequest.WithMsg("用户名或密码错误"))
+		if errors.Is(err, service.ErrBadCredentials) {
+			u.loginFailed(c, p.Name, ip)
+			return
+		}
+		// LDAP 等认证方式出错时同样记录失败次数，否则在其不可用期间可以不受限制地尝试密码
+		if ferr := u.loginGuardSvc.Fail(ctx, p.Name, ip); ferr != nil {
+			resp.Error(cerror.ServerError.WithDebugs(ferr))
+			return
+		}
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+
+	// 开启了两步验证，或者按照策略必须开启时，先返回临时凭证，完成第二步之后才签发 token
+	// totp_enabled 为 false 时，客户端需要引导用户先设置两步验证
+	if user.TotpEnabled || u.totpSvc.Required(user) {
+		mfaToken, err := u.totpSvc.Challenge(user, p.Device)
+		if err != nil {
+			resp.Error(cerror.ServerError.WithDebugs(err))
+			return
+		}
+		resp.Success(iris.Map{
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+			"totp_enabled": user.TotpEnabled,
+		})
+		return
+	}
+
+	err = u.loginGuardSvc.Succeed(ctx, p.Name)
+	if err != nil {
+		resp.Error(cerror.ServerError.WithDebugs(err))
 		return
 	}
 
 	// 密码正确，生成 token 并返回
-	token, err := jwt.Sign(
-		jwt.HS256,
-		[]byte(global.Setting.JWT.Secret),
-		model.JWTClaims{Uid: user.Id},
-		jwt.MaxAge(global.Setting.JWT.Expire),
-	)
+	pair, err := u.tokenSvc.Issue(ctx, user, p.Device, ip, c.GetHeader("User-Agent"))
+	if err != nil {
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(loginResponse(pair, user))
+}
+
+// 登录成功后返回的数据
+func loginResponse(pair *model.TokenPair, user *model.User) iris.Map {
+	return iris.Map{
+		"token":         pair.Token,
+		"refresh_token": pair.RefreshToken,
+		"expires_in":    pair.ExpiresIn,
+		"user":          user,
+	}
+}
+
+// 用户名或密码错误时记录失败次数，用户名不存在时也一样记录和返回，避免泄露用户名是否存在
+func (u User) loginFailed(c iris.Context, name, ip string) {
+	resp := response.New(c)
+	err := u.loginGuardSvc.Fail(c.Request().Context(), name, ip)
+	if err != nil {
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Error(cerror.BadRequest.WithMsg("用户名或密码错误"))
+}
+
+// token 过期后使用刷新 token 换取新的，旧的刷新 token 随即作废，不需要登录
+func (u User) RefreshToken(c iris.Context) {
+	p := struct {
+		RefreshToken string `json:"refresh_token" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+
+	pair, err := u.tokenSvc.Refresh(ctx, p.RefreshToken)
+	if err != nil {
+		if cerr, ok := err.(cerror.IError); ok {
+			resp.Error(cerr)
+			return
+		}
+		resp.Error(cerror.ServerError.WithDebugs(err))
+		return
+	}
+	resp.Success(pair)
+}
+
+// 退出登录，作废这次登录签发的所有刷新 token，token 过期后也可以调用，所以不需要登录
+func (u User) Logout(c iris.Context) {
+	p := struct {
+		RefreshToken string `json:"refresh_token" validate:"required"`
+	}{}
+	if ok := utils.BindAndValidate(c, &p); !ok {
+		return
+	}
+
+	ctx := c.Request().Context()
+	resp := response.New(c)
+
+	err := u.tokenSvc.Revoke(ctx, p.RefreshToken)
 	if err != nil {
 		resp.Error(cerror.ServerError.WithDebugs(err))
 		return
 	}
-	resp.Success(iris.Map{
-		"token": string(token),
-		"user":  user,
-	})
+	resp.Success()
 }
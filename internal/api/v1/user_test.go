@@ -1,14 +1,21 @@
 package v1
 
 import (
+	"context"
+	"errors"
 	"github.com/go-pg/pg/v10"
 	"github.com/kataras/iris/v12/httptest"
+	"github.com/kataras/iris/v12/middleware/jwt"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
 	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
 	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/service"
 	"testing"
 	"time"
 )
 
+const testJWTSecret = "test-secret"
+
 // 准备用户数据
 func prepareUser(t *testing.T, db *pg.DB) []*model.User {
 	users, err := testdb.SeedUser(db)
@@ -18,73 +25,113 @@ func prepareUser(t *testing.T, db *pg.DB) []*model.User {
 	return users
 }
 
-func TestUser_Create(t *testing.T) {
+// 为用户签发测试用的 token
+func signToken(t *testing.T, user *model.User) string {
+	token, err := jwt.Sign(jwt.HS256, []byte(testJWTSecret), model.JWTClaims{Uid: user.Id, Ver: user.TokenVersion}, jwt.MaxAge(time.Hour))
+	if err != nil {
+		t.Fatalf("签发 token 失败：%v", err)
+	}
+	return string(token)
+}
+
+func TestAdmin_CreateUser(t *testing.T) {
 	// 准备数据
-	_ = prepareUser(t, db)
+	pUsers := prepareUser(t, db)
+	admin := pUsers[0]
+	if err := dao.NewUser(db).SetRoles(context.Background(), admin.Id, []string{model.RoleAdmin}); err != nil {
+		t.Fatalf("设置管理员角色失败：%v", err)
+	}
+	token := signToken(t, admin)
+
 	// 初始化 app 和 e，封装成公共函数
 	app := testdb.NewApp()
-	userController := NewUser(userSvc)
-	app.Post("/api/v1/users", userController.Create)
+	adminController := NewAdmin(userSvc, service.NewRole(dao.NewRole(db), userSvc), nil, nil, nil)
+	verifier := jwt.NewVerifier(jwt.HS256, testJWTSecret)
+	app.Post("/api/v1/admin/create-user", verifier.Verify(func() interface{} { return new(model.JWTClaims) }), adminController.CreateUser)
+
+	type createUserReq struct {
+		Name     string   `json:"name"`
+		NickName string   `json:"nick_name"`
+		Phone    string   `json:"phone"`
+		Email    string   `json:"email"`
+		Password string   `json:"password"`
+		Roles    []string `json:"roles"`
+	}
 
 	t.Run("正常创建", func(t *testing.T) {
-		e := httptest.New(t, app, httptest.URL("/api/v1/users"))
+		e := httptest.New(t, app, httptest.URL("/api/v1/admin/create-user"))
 		s := time.Now().String()
-		name := s + "name"
-		phone := s + "phone"
-		email := s + "email"
-		password := s + "password"
-		e.POST("").WithJSON(CreateUserReq{
-			Name:     name,
-			Phone:    phone,
-			Email:    email,
-			Password: password,
+		e.POST("").WithHeader("Authorization", "Bearer "+token).WithJSON(createUserReq{
+			Name:     s + "name",
+			NickName: s + "nick_name",
+			Phone:    s + "phone",
+			Email:    s + "email",
+			Password: s + "password",
+			Roles:    []string{model.RoleStudent},
 		}).Expect().Status(httptest.StatusOK)
 	})
 
 	t.Run("用户名、手机号、邮箱或密码为空", func(t *testing.T) {
-		e := httptest.New(t, app, httptest.URL("/api/v1/users"))
+		e := httptest.New(t, app, httptest.URL("/api/v1/admin/create-user"))
 		s := time.Now().String()
 		name := s + "name"
 		phone := s + "phone"
 		email := s + "email"
 		password := s + "password"
 
-		e.POST("").WithJSON(CreateUserReq{
+		e.POST("").WithHeader("Authorization", "Bearer "+token).WithJSON(createUserReq{
 			Name:     "",
+			NickName: name,
 			Phone:    phone,
 			Email:    email,
 			Password: password,
+			Roles:    []string{model.RoleStudent},
 		}).Expect().Status(httptest.StatusBadRequest)
 
-		e.POST("").WithJSON(CreateUserReq{
+		e.POST("").WithHeader("Authorization", "Bearer "+token).WithJSON(createUserReq{
 			Name:     name,
+			NickName: name,
 			Phone:    "",
 			Email:    email,
 			Password: password,
+			Roles:    []string{model.RoleStudent},
 		}).Expect().Status(httptest.StatusBadRequest)
 	})
 
+	t.Run("没有登录", func(t *testing.T) {
+		e := httptest.New(t, app, httptest.URL("/api/v1/admin/create-user"))
+		e.POST("").WithJSON(createUserReq{}).Expect().Status(httptest.StatusUnauthorized)
+	})
+
 	// 清空数据
 	_ = testdb.Truncate(db)
 }
 
-//func TestUser_Get(t *testing.T) {
-//	pUsers := prepareUser(t, db)
-//	app := testdb.NewApp()
-//	userController := NewUser(userSvc)
-//	app.Post("/api/v1/user/get", userController.Get)
-//
-//	t.Run("正常获取", func(t *testing.T) {
-//		e := httptest.New(t, app, httptest.URL("/api/v1/user/get"), httptest.Debug(true), httptest.LogLevel("debug"))
-//		for _, pUser := range pUsers {
-//
-//			e.POST("").WithJSON(UserGetReq{
-//				Id: pUser.Id,
-//			}).Expect().Status(httptest.StatusOK)
-//
-//		}
-//	})
-//
-//	// 清空数据
-//	_ = testdb.Truncate(db)
-//}
+// 认证方式不可用时返回的错误
+type brokenAuth struct{}
+
+func (brokenAuth) Authenticate(ctx context.Context, name, password string) (*model.User, error) {
+	return nil, errors.New("LDAP 服务连接失败")
+}
+
+func TestUser_Login(t *testing.T) {
+	guard := service.NewLoginGuard(dao.NewLoginFailure(db), service.LoginGuardOptions{
+		MaxFailures:  2,
+		LockDuration: time.Minute,
+		Window:       time.Hour,
+	})
+	app := testdb.NewApp()
+	userController := NewUser(userSvc, brokenAuth{}, nil, nil, guard, nil)
+	app.Post("/api/v1/login", userController.Login)
+
+	t.Run("认证方式出错时同样记录失败次数", func(t *testing.T) {
+		e := httptest.New(t, app, httptest.URL("/api/v1/login"))
+		login := map[string]string{"name": "ldap-user", "password": "password"}
+		for i := 0; i < 2; i++ {
+			e.POST("").WithJSON(login).Expect().Status(httptest.StatusInternalServerError)
+		}
+		e.POST("").WithJSON(login).Expect().Status(httptest.StatusTooManyRequests)
+	})
+
+	_ = testdb.Truncate(db)
+}
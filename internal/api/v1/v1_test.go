@@ -5,6 +5,7 @@ import (
 	"github.com/xuxusheng/time-frequency-be/internal/dao"
 	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
 	"github.com/xuxusheng/time-frequency-be/internal/service"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
 	"log"
 	"os"
 	"testing"
@@ -16,7 +17,7 @@ var userSvc *service.User
 func TestMain(m *testing.M) {
 	setup()
 
-	userSvc = service.NewUser(dao.NewUser(db))
+	userSvc = service.NewUser(dao.NewUser(db), utils.PwdPolicy{})
 
 	code := m.Run()
 
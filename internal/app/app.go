@@ -9,7 +9,12 @@ import (
 	"github.com/xuxusheng/time-frequency-be/internal/api/v1"
 	"github.com/xuxusheng/time-frequency-be/internal/dao"
 	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/middleware"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/setting"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/oidc"
 	"github.com/xuxusheng/time-frequency-be/internal/service"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
+	"strings"
 )
 
 func New() *iris.Application {
@@ -37,44 +42,281 @@ func New() *iris.Application {
 
 	apiV1 := app.Party("/api/v1")
 
-	userSvc := service.NewUser(dao.NewUser(global.DB))
-	user := v1.NewUser(userSvc)
-	teacher := v1.NewTeacher(userSvc)
-	admin := v1.NewAdmin(userSvc)
+	userSvc := service.NewUser(dao.NewUser(global.DB), utils.PwdPolicy{
+		MinLength:  global.Setting.App.PasswordMinLength,
+		MinClasses: global.Setting.App.PasswordMinClasses,
+	})
+	sessionSvc := service.NewSession(dao.NewSession(global.DB))
+	tokenSvc := service.NewToken(dao.NewRefreshToken(global.DB), dao.NewSession(global.DB), dao.NewUser(global.DB), global.Setting.JWT.Secret, global.Setting.JWT.Expire, global.Setting.JWT.RefreshExpire)
+	loginGuardSvc := service.NewLoginGuard(dao.NewLoginFailure(global.DB), service.LoginGuardOptions{
+		MaxFailures:   global.Setting.App.LoginMaxFailures,
+		IpMaxFailures: global.Setting.App.LoginIpMaxFailures,
+		LockDuration:  global.Setting.App.LoginLockDuration,
+		Window:        global.Setting.App.LoginFailureWindow,
+		Delay:         global.Setting.App.LoginDelay,
+	})
+	totpSvc := service.NewTotp(dao.NewUser(global.DB), dao.NewRecoveryCode(global.DB), global.Setting.App.TotpIssuer, global.Setting.JWT.Secret, service.TotpPolicy{
+		RequireAdmin:   global.Setting.App.TotpRequireAdmin,
+		RequireTeacher: global.Setting.App.TotpRequireTeacher,
+	})
+	// 先校验本地密码，开启 LDAP 后再尝试 LDAP
+	authProviders := []service.IAuthProvider{service.NewLocalAuth(dao.NewUser(global.DB))}
+	if global.Setting.Ldap != nil && global.Setting.Ldap.Enabled {
+		authProviders = append(authProviders, service.NewLdapAuth(dao.NewUser(global.DB), userSvc, ldapOptions(global.Setting.Ldap)))
+	}
+	user := v1.NewUser(userSvc, service.NewAuth(authProviders...), tokenSvc, sessionSvc, loginGuardSvc, totpSvc)
+	totp := v1.NewTotp(userSvc, tokenSvc, loginGuardSvc, totpSvc)
+	// 定时清理在 main 中启动的后台任务里执行
+	passwordReset := v1.NewPasswordReset(service.NewPasswordReset(dao.NewPasswordReset(global.DB), dao.NewUser(global.DB), userSvc, global.Mailer, global.Setting.App.PasswordResetUrl, global.Setting.App.PasswordResetExpire))
+	// 开启单点登录时才注册相关接口
+	var sso *v1.Oidc
+	if global.Setting.Oidc != nil && global.Setting.Oidc.Enabled {
+		sso = v1.NewOidc(service.NewOidc(dao.NewOidcLogin(global.DB), dao.NewUser(global.DB), userSvc, oidcClient(global.Setting.Oidc), oidcOptions(global.Setting.Oidc)),
+			tokenSvc, totpSvc, global.Setting.Oidc.FrontendUrl)
+	}
+	teacher := v1.NewTeacher(
+		userSvc,
+		service.NewTeacher(dao.NewUser(global.DB), dao.NewClass(global.DB), userSvc),
+		service.NewStudentImport(global.DB, dao.NewUser(global.DB), dao.NewClass(global.DB), userSvc.PwdPolicy),
+	)
+	roleSvc := service.NewRole(dao.NewRole(global.DB), userSvc)
+	admin := v1.NewAdmin(userSvc, roleSvc, sessionSvc, loginGuardSvc, totpSvc)
+	role := v1.NewRole(roleSvc)
+	classSvc := service.NewClass(dao.NewClass(global.DB), dao.NewUser(global.DB))
+	class := v1.NewClass(classSvc)
+	subjectSvc := service.NewSubject(dao.NewSubject(global.DB))
+	subject := v1.NewSubject(subjectSvc)
+	lmSvc := service.NewLearningMaterial(dao.NewLearningMaterial(global.DB), dao.NewLearningMaterialVersion(global.DB), global.Storage, global.Setting.Storage.TempPath)
+	// 定时清理在 main 中启动的后台任务里执行
+	recycleBin := v1.NewRecycleBin(service.NewRecycleBin(dao.NewRecycleBin(global.DB), dao.NewLearningMaterial(global.DB), userSvc, classSvc, subjectSvc, lmSvc, global.Setting.App.RecycleBinRetention))
+	accessSvc := service.NewAccess(dao.NewUser(global.DB), dao.NewSubject(global.DB))
+	lm := v1.NewLearningMaterial(lmSvc, subjectSvc, accessSvc)
+	// 接口只查询转码任务和读取转码结果，转码在 main 中启动的后台任务里执行
+	transcode := v1.NewTranscode(lm, service.NewTranscode(dao.NewTranscodeJob(global.DB), dao.NewLearningMaterial(global.DB), dao.NewLearningMaterialVersion(global.DB), global.Storage, "", "", nil))
+	search := v1.NewSearch(service.NewSearch(dao.NewSearch(global.DB), dao.NewUser(global.DB), accessSvc))
+	upload := v1.NewUpload(lm, service.NewUpload(dao.NewUpload(global.DB), lmSvc, global.Storage, global.Setting.Storage.TempPath))
+	// 数据较多时在 main 中启动的后台任务里导出
+	export := v1.NewExport(service.NewExport(dao.NewExportJob(global.DB), dao.NewUser(global.DB), global.Storage, global.Setting.Storage.TempPath, global.Setting.Export.Retention),
+		global.Setting.Export.SyncMaxRows)
 
 	// 登录
 	apiV1.Post("/login", user.Login)
-	// 校验登录状态中间件
-	apiV1.Use(middleware.IsLogin())
+	apiV1.Post("/login/totp", totp.LoginVerify)
+	apiV1.Post("/login/totp/setup", totp.LoginSetup)
+	apiV1.Post("/login/totp/enable", totp.LoginEnable)
+	apiV1.Post("/refresh-token", user.RefreshToken)
+	apiV1.Post("/logout", user.Logout)
+	if sso != nil {
+		apiV1.Get("/oidc/login", sso.Login)
+		apiV1.Get("/oidc/callback", sso.Callback)
+		apiV1.Post("/oidc/token", sso.Token)
+	}
+	// 找回密码
+	apiV1.Post("/forgot-password", passwordReset.Forgot)
+	apiV1.Post("/reset-password", passwordReset.Reset)
+	// 签名下载地址、预览图地址和播放地址自带鉴权信息，不需要登录
+	apiV1.Get("/learning-material/signed-download", lm.SignedDownload)
+	apiV1.Get("/learning-material/preview", lm.Preview)
+	apiV1.Get("/learning-material/hls/{id:int}/{expires:int64}/{signature:string}/{file:path}", transcode.Hls)
+	apiV1.Get("/export/download", export.Download)
+	// 校验登录状态中间件，会话失效或者 token 版本过期的同样视为未登录
+	apiV1.Use(middleware.IsLogin(), middleware.Session())
 
 	// 普通用户就可以调用的用户相关接口
 	{
 		apiV1.Post("/user/me", user.Me)
 		apiV1.Post("/user/update", user.Update)
 		apiV1.Post("/user/update-password", user.UpdatePassword)
+		apiV1.Post("/user/sessions", user.Sessions)
+		apiV1.Post("/user/revoke-session", user.RevokeSession)
+		apiV1.Post("/user/totp/setup", totp.Setup)
+		apiV1.Post("/user/totp/enable", totp.Enable)
+		apiV1.Post("/user/totp/disable", totp.Disable)
+		apiV1.Post("/user/totp/recovery-codes", totp.RecoveryCodes)
+	}
+
+	// 科目查询接口
+	{
+		apiV1.Post("/subject/get", subject.Get)
+		apiV1.Post("/subject/list", subject.List)
+	}
+
+	// 学习资料查询接口
+	{
+		apiV1.Post("/learning-material/get", lm.Get)
+		apiV1.Post("/learning-material/list", lm.List)
+		apiV1.Get("/learning-material/download", lm.Download)
+		apiV1.Post("/learning-material/download-url", lm.DownloadUrl)
+		apiV1.Post("/learning-material/list-versions", lm.ListVersions)
+		apiV1.Post("/learning-material/get-transcode-job", transcode.GetJob)
+		apiV1.Post("/learning-material/hls-url", transcode.HlsUrl)
+	}
+
+	// 全文检索
+	apiV1.Post("/search", search.Search)
+
+	// 导出任务查询接口，只能查询自己创建的任务
+	{
+		apiV1.Post("/export/list-columns", export.ListColumns)
+		apiV1.Post("/export/get-job", export.GetJob)
+		apiV1.Post("/export/list-jobs", export.ListJobs)
 	}
 
-	// 老师才允许调用的接口
+	// 老师相关的接口，按权限校验，内置的老师角色默认拥有这些权限，助教等自定义角色可以只分配其中一部分
 	{
 		teacherApi := apiV1.Party("/teacher")
-		// 检验是否为老师身份中间件
-		teacherApi.Use(middleware.IsTeacher())
-		teacherApi.Post("/create-student", teacher.CreateStudent)
-		teacherApi.Post("/list-student", teacher.ListStudent)
-		teacherApi.Post("/delete-student", teacher.DeleteStudent)
+		studentManage := middleware.RequirePermission(model.PermissionStudentManage)
+		teacherApi.Post("/create-student", studentManage, teacher.CreateStudent)
+		teacherApi.Post("/import-students", studentManage, teacher.ImportStudents)
+		teacherApi.Post("/list-student", studentManage, teacher.ListStudent)
+		teacherApi.Post("/export-students", studentManage, export.ExportStudents)
+		teacherApi.Post("/update-student", studentManage, teacher.UpdateUser)
+		teacherApi.Post("/delete-student", studentManage, teacher.DeleteStudent)
+
+		registerClass(teacherApi.Party("/class", middleware.RequirePermission(model.PermissionClassManage)), class)
+
+		subjectManage := middleware.RequirePermission(model.PermissionSubjectManage)
+		teacherApi.Post("/subject/create", subjectManage, subject.Create)
+		teacherApi.Post("/subject/update", subjectManage, subject.Update)
+		teacherApi.Post("/subject/delete", subjectManage, subject.Delete)
+
+		materialUpload := middleware.RequirePermission(model.PermissionMaterialUpload)
+		materialManage := middleware.RequirePermission(model.PermissionMaterialManage)
+		teacherApi.Post("/learning-material/upload", materialUpload, lm.Upload)
+		teacherApi.Post("/learning-material/update", materialManage, lm.Update)
+		teacherApi.Post("/learning-material/upload-version", materialUpload, lm.UploadVersion)
+		teacherApi.Post("/learning-material/rollback", materialManage, lm.Rollback)
+		teacherApi.Post("/learning-material/re-extract", materialManage, lm.Reextract)
+		teacherApi.Post("/learning-material/retranscode", materialManage, transcode.Retry)
+		teacherApi.Post("/learning-material/delete", materialManage, lm.Delete)
+
+		// 大文件断点续传（tus 协议）
+		uploads := teacherApi.Party("/uploads", materialUpload)
+		uploads.Options("", upload.Options)
+		uploads.Post("", upload.Create)
+		uploads.Head("/{id:string}", upload.Head)
+		uploads.Patch("/{id:string}", upload.Patch)
+		uploads.Delete("/{id:string}", upload.Delete)
 	}
 
-	// 管理员才允许调用的接口
+	// 管理相关的接口，按权限校验，内置的管理员角色拥有所有权限
 	{
 		adminApi := apiV1.Party("/admin")
-		adminApi.Use(middleware.IsAdmin())
-		adminApi.Post("/create-user", admin.CreateUser)
-		adminApi.Post("/get-user", admin.GetUser)
-		adminApi.Post("/list-user", admin.ListUser)
-		adminApi.Post("/update-user", admin.UpdateUser)
-		adminApi.Post("/toggle-admin", admin.ToggleAdmin)
-		adminApi.Post("/delete-user", admin.DeleteUser)
+		adminApi.Post("/create-user", middleware.RequirePermission(model.PermissionUserCreate), admin.CreateUser)
+		adminApi.Post("/get-user", middleware.RequirePermission(model.PermissionUserRead), admin.GetUser)
+		adminApi.Post("/list-user", middleware.RequirePermission(model.PermissionUserRead), admin.ListUser)
+		adminApi.Post("/export-users", middleware.RequirePermission(model.PermissionUserRead), export.ExportUsers)
+		adminApi.Post("/update-user", middleware.RequirePermission(model.PermissionUserUpdate), admin.UpdateUser)
+		adminApi.Post("/set-user-roles", middleware.RequirePermission(model.PermissionRoleAssign), admin.SetUserRoles)
+		adminApi.Post("/delete-user", middleware.RequirePermission(model.PermissionUserDelete), admin.DeleteUser)
+
+		userSecurity := middleware.RequirePermission(model.PermissionUserSecurity)
+		adminApi.Post("/sign-out-user", userSecurity, admin.SignOutUser)
+		adminApi.Post("/unlock-user", userSecurity, admin.UnlockUser)
+		adminApi.Post("/unlock-ip", userSecurity, admin.UnlockIp)
+		adminApi.Post("/reset-totp", userSecurity, admin.ResetTotp)
+
+		roleApi := adminApi.Party("/role")
+		roleApi.Post("/list", middleware.RequirePermission(model.PermissionRoleManage, model.PermissionRoleAssign), role.List)
+		roleApi.Post("/permissions", middleware.RequirePermission(model.PermissionRoleManage), role.Permissions)
+		roleApi.Post("/create", middleware.RequirePermission(model.PermissionRoleManage), role.Create)
+		roleApi.Post("/update", middleware.RequirePermission(model.PermissionRoleManage), role.Update)
+		roleApi.Post("/delete", middleware.RequirePermission(model.PermissionRoleManage), role.Delete)
+
+		recycleBinApi := adminApi.Party("/recycle-bin", middleware.RequirePermission(model.PermissionRecycleBin))
+		recycleBinApi.Post("/list", recycleBin.List)
+		recycleBinApi.Post("/restore", recycleBin.Restore)
+		recycleBinApi.Post("/purge", recycleBin.Purge)
+
+		registerClass(adminApi.Party("/class", middleware.RequirePermission(model.PermissionClassManage)), class)
 	}
 
 	return app
 }
+
+// 班级管理接口，/teacher/class 和 /admin/class 各自挂载一份，都需要 class.manage 权限
+func registerClass(p iris.Party, class *v1.Class) {
+	p.Post("/create", class.Create)
+	p.Post("/get", class.Get)
+	p.Post("/list", class.List)
+	p.Post("/update", class.Update)
+	p.Post("/delete", class.Delete)
+	p.Post("/list-members", class.ListMembers)
+	p.Post("/add-members", class.AddMembers)
+	p.Post("/remove-members", class.RemoveMembers)
+	p.Post("/list-subjects", class.ListSubjects)
+	p.Post("/add-subjects", class.AddSubjects)
+	p.Post("/remove-subjects", class.RemoveSubjects)
+	p.Post("/list-teachers", class.ListTeachers)
+	// 老师只能管理任教班级中的学生，不能自己指定任教的班级
+	p.Post("/set-teacher", middleware.RequirePermission(model.PermissionClassTeacher), class.SetTeacher)
+	p.Post("/remove-teachers", middleware.RequirePermission(model.PermissionClassTeacher), class.RemoveTeachers)
+}
+
+func ldapOptions(s *setting.Ldap) service.LdapOptions {
+	return service.LdapOptions{
+		Url:                s.Url,
+		StartTLS:           s.StartTLS,
+		InsecureSkipVerify: s.InsecureSkipVerify,
+		Timeout:            s.Timeout,
+		BindDN:             s.BindDN,
+		BindPassword:       s.BindPassword,
+		BaseDN:             s.BaseDN,
+		UserFilter:         s.UserFilter,
+		NameAttribute:      s.NameAttribute,
+		NickNameAttribute:  s.NickNameAttribute,
+		EmailAttribute:     s.EmailAttribute,
+		PhoneAttribute:     s.PhoneAttribute,
+		GroupAttribute:     s.GroupAttribute,
+		GroupBaseDN:        s.GroupBaseDN,
+		GroupFilter:        s.GroupFilter,
+		AdminGroups:        splitDNs(s.AdminGroups),
+		TeacherGroups:      splitDNs(s.TeacherGroups),
+		LinkExisting:       s.LinkExisting,
+	}
+}
+
+func oidcClient(s *setting.Oidc) *oidc.Client {
+	return oidc.New(oidc.Config{
+		Issuer:       s.Issuer,
+		ClientId:     s.ClientId,
+		ClientSecret: s.ClientSecret,
+		RedirectUrl:  s.RedirectUrl,
+		Scopes:       strings.Fields(s.Scopes),
+	})
+}
+
+func oidcOptions(s *setting.Oidc) service.OidcOptions {
+	return service.OidcOptions{
+		NameClaim:     s.NameClaim,
+		NickNameClaim: s.NickNameClaim,
+		EmailClaim:    s.EmailClaim,
+		PhoneClaim:    s.PhoneClaim,
+		RoleClaim:     s.RoleClaim,
+		AdminRoles:    splitList(s.AdminRoles),
+		TeacherRoles:  splitList(s.TeacherRoles),
+		AutoCreate:    s.AutoCreate,
+	}
+}
+
+// 多个值用逗号分隔
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// 多个 DN 用分号分隔，DN 本身包含逗号
+func splitDNs(s string) []string {
+	var dns []string
+	for _, dn := range strings.Split(s, ";") {
+		if dn = strings.TrimSpace(dn); dn != "" {
+			dns = append(dns, dn)
+		}
+	}
+	return dns
+}
@@ -2,6 +2,7 @@ package dao
 
 import (
 	"context"
+	"github.com/go-pg/pg/v10"
 	"github.com/go-pg/pg/v10/orm"
 	"github.com/xuxusheng/time-frequency-be/internal/model"
 	"time"
@@ -10,9 +11,35 @@ import (
 type IClass interface {
 	Create(ctx context.Context, createdById int, name, description string) (*model.Class, error)
 	Get(ctx context.Context, id int) (*model.Class, error)
+	GetByName(ctx context.Context, name string) (*model.Class, error)
+	ListAndCount(ctx context.Context, p *model.Page, query string) ([]*model.Class, int, error)
 	Update(ctx context.Context, id int, name, description string) (*model.Class, error)
-	Delete(ctx context.Context, id int) error
+	Delete(ctx context.Context, id int) error      // 移入回收站，成员和已选科目保留，以便恢复
+	ForceDelete(ctx context.Context, id int) error // 彻底删除，不论是否在回收站中
 	IsNameExist(ctx context.Context, name string, excludeId int) (bool, error)
+
+	// 班级成员相关，成员关系通过 user.class_id 维护
+	ListMembersAndCount(ctx context.Context, id int, p *model.Page, query string) ([]*model.User, int, error)
+	CountStudents(ctx context.Context, userIds []int) (int, error) // 统计 userIds 中学生账号的数量
+	// 统计 userIds 中已经在其他班级、并且 teacherId 不是那个班级老师的用户数量，不在任何班级中的用户不统计
+	CountMembersNotTaughtBy(ctx context.Context, userIds []int, teacherId int) (int, error)
+	AddMembers(ctx context.Context, id int, userIds []int) error
+	RemoveMembers(ctx context.Context, id int, userIds []int) error
+	ClearMembers(ctx context.Context, id int) error
+
+	ListSubjectsAndCount(ctx context.Context, id int, p *model.Page) ([]*model.Subject, int, error) // 查询班级已选的科目
+	CountSubjects(ctx context.Context, subjectIds []int) (int, error)                               // 统计存在的科目数量，用于校验科目 ID
+	AddSubjects(ctx context.Context, id int, subjectIds []int) error                                // 已经选过的科目会被忽略
+	RemoveSubjects(ctx context.Context, id int, subjectIds []int) error
+	ClearSubjects(ctx context.Context, id int) error
+
+	// 班级的老师相关
+	ListTeachers(ctx context.Context, id int) ([]*model.ClassTeacher, error) // 班主任在前
+	CountUsers(ctx context.Context, userIds []int) (int, error)              // 统计存在的用户数量，用于校验用户 ID
+	SetTeacher(ctx context.Context, id, userId int, typ string) error        // 已经是班级的老师时修改身份，设为班主任时原来的班主任改为任课老师
+	RemoveTeachers(ctx context.Context, id int, userIds []int) error
+	ClearTeachers(ctx context.Context, id int) error
+	IsTeacher(ctx context.Context, id, userId int) (bool, error) // 用户是否是班级的老师
 }
 
 func NewClass(db orm.DB) *Class {
@@ -47,6 +74,35 @@ func (c Class) Get(ctx context.Context, id int) (*model.Class, error) {
 	return &class, nil
 }
 
+func (c Class) GetByName(ctx context.Context, name string) (*model.Class, error) {
+	class := model.Class{}
+	err := c.db.ModelContext(ctx, &class).Where("name = ?", name).Select()
+	if err != nil {
+		return nil, err
+	}
+	return &class, nil
+}
+
+func (c Class) ListAndCount(ctx context.Context, p *model.Page, query string) ([]*model.Class, int, error) {
+	classes := []*model.Class{}
+	db := c.db.ModelContext(ctx, &classes).
+		Offset(p.Offset()).
+		Limit(p.Limit()).
+		Order("created_at DESC")
+	if query != "" {
+		db = db.WhereGroup(func(q *orm.Query) (*orm.Query, error) {
+			q = q.WhereOr("name LIKE ?", "%"+query+"%").
+				WhereOr("description LIKE ?", "%"+query+"%")
+			return q, nil
+		})
+	}
+	count, err := db.SelectAndCount()
+	if err != nil {
+		return nil, 0, err
+	}
+	return classes, count, nil
+}
+
 func (c Class) Update(ctx context.Context, id int, name, description string) (*model.Class, error) {
 	class := model.Class{Id: id, Name: name, Description: description, UpdatedAt: time.Now()}
 	_, err := c.db.
@@ -66,6 +122,11 @@ func (c Class) Delete(ctx context.Context, id int) error {
 	return err
 }
 
+func (c Class) ForceDelete(ctx context.Context, id int) error {
+	_, err := c.db.ModelContext(ctx, &model.Class{Id: id}).WherePK().AllWithDeleted().ForceDelete()
+	return err
+}
+
 func (c Class) IsNameExist(ctx context.Context, name string, excludeId int) (bool, error) {
 	db := c.db.ModelContext(ctx, &model.Class{})
 	if excludeId != 0 {
@@ -73,3 +134,175 @@ func (c Class) IsNameExist(ctx context.Context, name string, excludeId int) (boo
 	}
 	return db.Where("name = ?", name).Exists()
 }
+
+func (c Class) ListMembersAndCount(ctx context.Context, id int, p *model.Page, query string) ([]*model.User, int, error) {
+	users := []*model.User{}
+	db := c.db.ModelContext(ctx, &users).
+		Where("class_id = ?", id).
+		Offset(p.Offset()).
+		Limit(p.Limit()).
+		Order("created_at DESC")
+	if query != "" {
+		db = db.WhereGroup(func(q *orm.Query) (*orm.Query, error) {
+			q = q.WhereOr("name LIKE ?", "%"+query+"%").
+				WhereOr("nick_name LIKE ?", "%"+query+"%").
+				WhereOr("phone LIKE ?", "%"+query+"%").
+				WhereOr("email LIKE ?", "%"+query+"%")
+			return q, nil
+		})
+	}
+	count, err := db.SelectAndCount()
+	if err != nil {
+		return nil, 0, err
+	}
+	return users, count, nil
+}
+
+func (c Class) CountStudents(ctx context.Context, userIds []int) (int, error) {
+	return c.db.ModelContext(ctx, (*model.User)(nil)).
+		Where("id IN (?)", pg.In(userIds)).
+		Where(hasRoleCondition, model.RoleStudent).
+		Count()
+}
+
+func (c Class) CountMembersNotTaughtBy(ctx context.Context, userIds []int, teacherId int) (int, error) {
+	return c.db.ModelContext(ctx, (*model.User)(nil)).
+		Where("id IN (?)", pg.In(userIds)).
+		Where("class_id IS NOT NULL").
+		Where("class_id NOT IN (SELECT class_id FROM class_teacher WHERE user_id = ?)", teacherId).
+		Count()
+}
+
+func (c Class) AddMembers(ctx context.Context, id int, userIds []int) error {
+	_, err := c.db.ModelContext(ctx, (*model.User)(nil)).
+		Set("class_id = ?", id).
+		Set("updated_at = ?", time.Now()).
+		Where("id IN (?)", pg.In(userIds)).
+		Update()
+	return err
+}
+
+func (c Class) RemoveMembers(ctx context.Context, id int, userIds []int) error {
+	_, err := c.db.ModelContext(ctx, (*model.User)(nil)).
+		Set("class_id = NULL").
+		Set("updated_at = ?", time.Now()).
+		Where("class_id = ?", id).
+		Where("id IN (?)", pg.In(userIds)).
+		Update()
+	return err
+}
+
+// 回收站中的用户也要一并移出班级
+func (c Class) ClearMembers(ctx context.Context, id int) error {
+	_, err := c.db.ModelContext(ctx, (*model.User)(nil)).
+		AllWithDeleted().
+		Set("class_id = NULL").
+		Set("updated_at = ?", time.Now()).
+		Where("class_id = ?", id).
+		Update()
+	return err
+}
+
+func (c Class) ListSubjectsAndCount(ctx context.Context, id int, p *model.Page) ([]*model.Subject, int, error) {
+	subjects := []*model.Subject{}
+	count, err := c.db.ModelContext(ctx, &subjects).
+		Where("id IN (SELECT subject_id FROM class_subject WHERE class_id = ?)", id).
+		Offset(p.Offset()).
+		Limit(p.Limit()).
+		Order("created_at DESC").
+		SelectAndCount()
+	if err != nil {
+		return nil, 0, err
+	}
+	return subjects, count, nil
+}
+
+func (c Class) CountSubjects(ctx context.Context, subjectIds []int) (int, error) {
+	return c.db.ModelContext(ctx, (*model.Subject)(nil)).
+		Where("id IN (?)", pg.In(subjectIds)).
+		Count()
+}
+
+func (c Class) AddSubjects(ctx context.Context, id int, subjectIds []int) error {
+	css := make([]*model.ClassSubject, 0, len(subjectIds))
+	for _, subjectId := range subjectIds {
+		css = append(css, &model.ClassSubject{ClassId: id, SubjectId: subjectId, CreatedAt: time.Now()})
+	}
+	_, err := c.db.ModelContext(ctx, &css).OnConflict("DO NOTHING").Insert()
+	return err
+}
+
+func (c Class) RemoveSubjects(ctx context.Context, id int, subjectIds []int) error {
+	_, err := c.db.ModelContext(ctx, (*model.ClassSubject)(nil)).
+		Where("class_id = ?", id).
+		Where("subject_id IN (?)", pg.In(subjectIds)).
+		Delete()
+	return err
+}
+
+func (c Class) ClearSubjects(ctx context.Context, id int) error {
+	_, err := c.db.ModelContext(ctx, (*model.ClassSubject)(nil)).
+		Where("class_id = ?", id).
+		Delete()
+	return err
+}
+
+func (c Class) ListTeachers(ctx context.Context, id int) ([]*model.ClassTeacher, error) {
+	teachers := []*model.ClassTeacher{}
+	err := c.db.ModelContext(ctx, &teachers).
+		Relation("User").
+		Where("class_teacher.class_id = ?", id).
+		OrderExpr("class_teacher.type = ? DESC, class_teacher.created_at", model.ClassTeacherHead).
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return teachers, nil
+}
+
+func (c Class) CountUsers(ctx context.Context, userIds []int) (int, error) {
+	return c.db.ModelContext(ctx, (*model.User)(nil)).
+		Where("id IN (?)", pg.In(userIds)).
+		Count()
+}
+
+func (c Class) SetTeacher(ctx context.Context, id, userId int, typ string) error {
+	if typ == model.ClassTeacherHead {
+		_, err := c.db.ModelContext(ctx, (*model.ClassTeacher)(nil)).
+			Set("type = ?", model.ClassTeacherAssistant).
+			Where("class_id = ?", id).
+			Where("type = ?", model.ClassTeacherHead).
+			Where("user_id != ?", userId).
+			Update()
+		if err != nil {
+			return err
+		}
+	}
+	_, err := c.db.ModelContext(ctx, &model.ClassTeacher{ClassId: id, UserId: userId, Type: typ, CreatedAt: time.Now()}).
+		OnConflict("(class_id, user_id) DO UPDATE").
+		Set("type = EXCLUDED.type").
+		Insert()
+	return err
+}
+
+func (c Class) RemoveTeachers(ctx context.Context, id int, userIds []int) error {
+	_, err := c.db.ModelContext(ctx, (*model.ClassTeacher)(nil)).
+		Where("class_id = ?", id).
+		Where("user_id IN (?)", pg.In(userIds)).
+		Delete()
+	return err
+}
+
+func (c Class) ClearTeachers(ctx context.Context, id int) error {
+	_, err := c.db.ModelContext(ctx, (*model.ClassTeacher)(nil)).
+		Where("class_id = ?", id).
+		Delete()
+	return err
+}
+
+func (c Class) IsTeacher(ctx context.Context, id, userId int) (bool, error) {
+	return c.db.ModelContext(ctx, (*model.ClassTeacher)(nil)).
+		Where("class_id = ?", id).
+		Where("user_id = ?", userId).
+		Exists()
+}
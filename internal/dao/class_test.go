@@ -230,3 +230,161 @@ func TestClassDao_IsNameExist(t *testing.T) {
 
 	_ = testdb.Truncate(db)
 }
+
+func TestClassDao_ListAndCount(t *testing.T) {
+	pClasses, _ := prepareClass(t, db)
+	dao := NewClass(db)
+
+	t.Run("查询全部班级", func(t *testing.T) {
+		classes, count, err := dao.ListAndCount(context.Background(), model.NewPage(1, 100), "")
+		if assert.Nil(t, err) {
+			assert.Equal(t, len(pClasses), count)
+			assert.Len(t, classes, len(pClasses))
+		}
+	})
+
+	t.Run("分页查询", func(t *testing.T) {
+		classes, count, err := dao.ListAndCount(context.Background(), model.NewPage(2, 2), "")
+		if assert.Nil(t, err) {
+			assert.Equal(t, len(pClasses), count)
+			assert.Len(t, classes, 2)
+		}
+	})
+
+	t.Run("按名称搜索", func(t *testing.T) {
+		for _, pClass := range pClasses {
+			classes, count, err := dao.ListAndCount(context.Background(), model.NewPage(1, 100), pClass.Name)
+			if assert.Nil(t, err) {
+				assert.Equal(t, 1, count)
+				assert.Equal(t, pClass.Id, classes[0].Id)
+			}
+		}
+	})
+
+	_ = testdb.Truncate(db)
+}
+
+func TestClassDao_Members(t *testing.T) {
+	pClasses, pUsers := prepareClass(t, db)
+	dao := NewClass(db)
+
+	class := pClasses[0]
+	userIds := []int{pUsers[0].Id, pUsers[1].Id}
+
+	t.Run("统计学生数量", func(t *testing.T) {
+		count, err := dao.CountStudents(context.Background(), userIds)
+		if assert.Nil(t, err) {
+			assert.Equal(t, len(userIds), count)
+		}
+	})
+
+	t.Run("加入班级", func(t *testing.T) {
+		err := dao.AddMembers(context.Background(), class.Id, userIds)
+		if assert.Nil(t, err) {
+			users, count, err := dao.ListMembersAndCount(context.Background(), class.Id, model.NewPage(1, 100), "")
+			if assert.Nil(t, err) {
+				assert.Equal(t, len(userIds), count)
+				for _, user := range users {
+					assert.Equal(t, class.Id, user.ClassId)
+				}
+			}
+		}
+	})
+
+	t.Run("从其他班级移出时不生效", func(t *testing.T) {
+		err := dao.RemoveMembers(context.Background(), pClasses[1].Id, userIds)
+		if assert.Nil(t, err) {
+			_, count, err := dao.ListMembersAndCount(context.Background(), class.Id, model.NewPage(1, 100), "")
+			if assert.Nil(t, err) {
+				assert.Equal(t, len(userIds), count)
+			}
+		}
+	})
+
+	t.Run("移出班级", func(t *testing.T) {
+		err := dao.RemoveMembers(context.Background(), class.Id, userIds[:1])
+		if assert.Nil(t, err) {
+			users, count, err := dao.ListMembersAndCount(context.Background(), class.Id, model.NewPage(1, 100), "")
+			if assert.Nil(t, err) {
+				assert.Equal(t, 1, count)
+				assert.Equal(t, userIds[1], users[0].Id)
+			}
+		}
+	})
+
+	t.Run("清空班级成员", func(t *testing.T) {
+		err := dao.ClearMembers(context.Background(), class.Id)
+		if assert.Nil(t, err) {
+			_, count, err := dao.ListMembersAndCount(context.Background(), class.Id, model.NewPage(1, 100), "")
+			if assert.Nil(t, err) {
+				assert.Zero(t, count)
+			}
+		}
+	})
+
+	_ = testdb.Truncate(db)
+}
+
+func TestClassDao_Teachers(t *testing.T) {
+	pClasses, pUsers := prepareClass(t, db)
+	dao := NewClass(db)
+	ctx := context.Background()
+
+	class := pClasses[0]
+
+	t.Run("指定老师", func(t *testing.T) {
+		assert.Nil(t, dao.SetTeacher(ctx, class.Id, pUsers[0].Id, model.ClassTeacherHead))
+		assert.Nil(t, dao.SetTeacher(ctx, class.Id, pUsers[1].Id, model.ClassTeacherAssistant))
+		// 重复指定时修改身份
+		assert.Nil(t, dao.SetTeacher(ctx, class.Id, pUsers[1].Id, model.ClassTeacherAssistant))
+
+		teachers, err := dao.ListTeachers(ctx, class.Id)
+		if assert.Nil(t, err) && assert.Len(t, teachers, 2) {
+			assert.Equal(t, pUsers[0].Id, teachers[0].UserId)
+			assert.Equal(t, model.ClassTeacherHead, teachers[0].Type)
+			assert.Equal(t, pUsers[0].Name, teachers[0].User.Name)
+		}
+	})
+
+	t.Run("更换班主任时原来的班主任改为任课老师", func(t *testing.T) {
+		assert.Nil(t, dao.SetTeacher(ctx, class.Id, pUsers[1].Id, model.ClassTeacherHead))
+		teachers, err := dao.ListTeachers(ctx, class.Id)
+		if assert.Nil(t, err) && assert.Len(t, teachers, 2) {
+			assert.Equal(t, pUsers[1].Id, teachers[0].UserId)
+			assert.Equal(t, model.ClassTeacherHead, teachers[0].Type)
+			assert.Equal(t, model.ClassTeacherAssistant, teachers[1].Type)
+		}
+	})
+
+	t.Run("是否任教", func(t *testing.T) {
+		is, err := dao.IsTeacher(ctx, class.Id, pUsers[0].Id)
+		assert.Nil(t, err)
+		assert.True(t, is)
+		is, err = dao.IsTeacher(ctx, pClasses[1].Id, pUsers[0].Id)
+		assert.Nil(t, err)
+		assert.False(t, is)
+	})
+
+	t.Run("不在任教班级中的成员", func(t *testing.T) {
+		assert.Nil(t, dao.AddMembers(ctx, class.Id, []int{pUsers[3].Id}))
+		assert.Nil(t, dao.AddMembers(ctx, pClasses[1].Id, []int{pUsers[2].Id}))
+		// pUsers[1] 不在任何班级中，不统计
+		count, err := dao.CountMembersNotTaughtBy(ctx, []int{pUsers[1].Id, pUsers[2].Id, pUsers[3].Id}, pUsers[0].Id)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("移除老师", func(t *testing.T) {
+		assert.Nil(t, dao.RemoveTeachers(ctx, class.Id, []int{pUsers[0].Id}))
+		teachers, err := dao.ListTeachers(ctx, class.Id)
+		if assert.Nil(t, err) && assert.Len(t, teachers, 1) {
+			assert.Equal(t, pUsers[1].Id, teachers[0].UserId)
+		}
+		assert.Nil(t, dao.ClearTeachers(ctx, class.Id))
+		teachers, err = dao.ListTeachers(ctx, class.Id)
+		assert.Nil(t, err)
+		assert.Empty(t, teachers)
+	})
+
+	_ = testdb.Truncate(db)
+}
@@ -0,0 +1,139 @@
+package dao
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"time"
+)
+
+type IExportJob interface {
+	Create(ctx context.Context, job *model.ExportJob) error
+	Get(ctx context.Context, id int) (*model.ExportJob, error)
+	ListByUser(ctx context.Context, userId, limit int) ([]*model.ExportJob, error) // 用户创建的任务，最新的在前
+	// 领取一个等待执行或者租约已过期的任务，标记为执行中并把租约设置为 lease 之后，没有任务时返回 pg.ErrNoRows
+	Claim(ctx context.Context, lease time.Duration) (*model.ExportJob, error)
+	Heartbeat(ctx context.Context, id int, lease time.Duration) error // 续期
+	Finish(ctx context.Context, id, rows int, fileKey string, expiresAt time.Time) error
+	// 记录失败，retry 为 true 时回到等待执行状态，否则标记为失败，失败的任务同样在 expiresAt 之后删除
+	Fail(ctx context.Context, id int, errMsg string, retry bool, expiresAt time.Time) error
+	ListExpired(ctx context.Context, limit int) ([]*model.ExportJob, error) // 已经过了保留期限的任务
+	Delete(ctx context.Context, id int) error
+}
+
+func NewExportJob(db orm.DB) *ExportJob {
+	return &ExportJob{db: db}
+}
+
+type ExportJob struct {
+	db orm.DB
+}
+
+func (e ExportJob) Create(ctx context.Context, job *model.ExportJob) error {
+	job.Status = model.ExportStatusPending
+	job.CreatedAt = time.Now()
+	job.UpdatedAt = time.Now()
+	_, err := e.db.ModelContext(ctx, job).Returning("*").Insert()
+	return err
+}
+
+func (e ExportJob) Get(ctx context.Context, id int) (*model.ExportJob, error) {
+	job := model.ExportJob{Id: id}
+	err := e.db.ModelContext(ctx, &job).WherePK().Select()
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (e ExportJob) ListByUser(ctx context.Context, userId, limit int) ([]*model.ExportJob, error) {
+	jobs := []*model.ExportJob{}
+	err := e.db.ModelContext(ctx, &jobs).
+		Where("created_by_id = ?", userId).
+		Order("id DESC").
+		Limit(limit).
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (e ExportJob) Claim(ctx context.Context, lease time.Duration) (*model.ExportJob, error) {
+	job := model.ExportJob{}
+	// SKIP LOCKED 保证多个进程同时领取时不会拿到同一个任务
+	_, err := e.db.QueryOneContext(ctx, &job, `UPDATE export_job
+		SET status = ?, attempts = attempts + 1, started_at = now(), locked_until = now() + ? * interval '1 second', updated_at = now()
+		WHERE id = (
+			SELECT id FROM export_job
+			WHERE status = ? OR (status = ? AND locked_until < now())
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		model.ExportStatusRunning, int(lease.Seconds()), model.ExportStatusPending, model.ExportStatusRunning)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (e ExportJob) Heartbeat(ctx context.Context, id int, lease time.Duration) error {
+	_, err := e.db.ModelContext(ctx, (*model.ExportJob)(nil)).
+		Set("locked_until = now() + ? * interval '1 second'", int(lease.Seconds())).
+		Where("id = ?", id).
+		Where("status = ?", model.ExportStatusRunning).
+		Update()
+	return err
+}
+
+func (e ExportJob) Finish(ctx context.Context, id, rows int, fileKey string, expiresAt time.Time) error {
+	_, err := e.db.ModelContext(ctx, (*model.ExportJob)(nil)).
+		Set("status = ?", model.ExportStatusDone).
+		Set("error = ''").
+		Set("rows = ?", rows).
+		Set("file_key = ?", fileKey).
+		Set("finished_at = now()").
+		Set("expires_at = ?", expiresAt).
+		Set("locked_until = NULL").
+		Set("updated_at = now()").
+		Where("id = ?", id).
+		Update()
+	return err
+}
+
+func (e ExportJob) Fail(ctx context.Context, id int, errMsg string, retry bool, expiresAt time.Time) error {
+	status := model.ExportStatusFailed
+	if retry {
+		status = model.ExportStatusPending
+	}
+	_, err := e.db.ModelContext(ctx, (*model.ExportJob)(nil)).
+		Set("status = ?", status).
+		Set("error = ?", errMsg).
+		Set("expires_at = ?", expiresAt).
+		Set("locked_until = NULL").
+		Set("updated_at = now()").
+		Where("id = ?", id).
+		Update()
+	return err
+}
+
+func (e ExportJob) ListExpired(ctx context.Context, limit int) ([]*model.ExportJob, error) {
+	jobs := []*model.ExportJob{}
+	err := e.db.ModelContext(ctx, &jobs).
+		Where("expires_at < now()").
+		Where("status <> ?", model.ExportStatusRunning).
+		Order("id").
+		Limit(limit).
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (e ExportJob) Delete(ctx context.Context, id int) error {
+	_, err := e.db.ModelContext(ctx, &model.ExportJob{Id: id}).WherePK().Delete()
+	return err
+}
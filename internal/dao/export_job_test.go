@@ -0,0 +1,131 @@
+package dao
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"testing"
+	"time"
+)
+
+func TestExportJobDao(t *testing.T) {
+	users, err := testdb.SeedUser(db)
+	if err != nil {
+		t.Fatalf("准备用户数据失败：%v", err)
+	}
+	dao := NewExportJob(db)
+	ctx := context.Background()
+
+	job := &model.ExportJob{Type: model.ExportTypeUser, Format: "csv", Columns: []string{"name"}, CreatedById: users[0].Id}
+	if err := dao.Create(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("领取和租约", func(t *testing.T) {
+		at := assert.New(t)
+		claimed, err := dao.Claim(ctx, time.Minute)
+		if !at.Nil(err) {
+			return
+		}
+		at.Equal(job.Id, claimed.Id)
+		at.Equal(model.ExportStatusRunning, claimed.Status)
+		at.Equal(1, claimed.Attempts)
+
+		// 租约未过期，其他进程领取不到
+		_, err = dao.Claim(ctx, time.Minute)
+		at.Equal(pg.ErrNoRows, err)
+
+		// 模拟进程退出，租约过期后可以被重新领取
+		_, err = db.Exec("UPDATE export_job SET locked_until = now() - interval '1 second'")
+		at.Nil(err)
+		claimed, err = dao.Claim(ctx, time.Minute)
+		if at.Nil(err) {
+			at.Equal(2, claimed.Attempts)
+		}
+	})
+
+	t.Run("完成后生成下载地址", func(t *testing.T) {
+		at := assert.New(t)
+		at.Nil(dao.Finish(ctx, job.Id, 4, "exports/1.csv", time.Now().Add(time.Hour)))
+		got, err := dao.Get(ctx, job.Id)
+		if at.Nil(err) {
+			at.Equal(model.ExportStatusDone, got.Status)
+			at.Equal(4, got.Rows)
+			at.Equal("exports/1.csv", got.FileKey)
+		}
+
+		jobs, err := dao.ListByUser(ctx, users[0].Id, 10)
+		if at.Nil(err) {
+			at.Len(jobs, 1)
+		}
+		jobs, err = dao.ListByUser(ctx, users[1].Id, 10)
+		if at.Nil(err) {
+			at.Empty(jobs)
+		}
+	})
+
+	t.Run("删除过期的任务", func(t *testing.T) {
+		at := assert.New(t)
+		jobs, err := dao.ListExpired(ctx, 10)
+		at.Nil(err)
+		at.Empty(jobs)
+
+		at.Nil(dao.Fail(ctx, job.Id, "失败", false, time.Now().Add(-time.Second)))
+		jobs, err = dao.ListExpired(ctx, 10)
+		if at.Nil(err) && at.Len(jobs, 1) {
+			at.Equal(model.ExportStatusFailed, jobs[0].Status)
+			at.Nil(dao.Delete(ctx, jobs[0].Id))
+		}
+		_, err = dao.Get(ctx, job.Id)
+		at.Equal(pg.ErrNoRows, err)
+	})
+
+	_ = testdb.Truncate(db)
+}
+
+func TestUserDao_ListForExport(t *testing.T) {
+	classes, users := prepareClass(t, db)
+	dao := NewUser(db)
+	ctx := context.Background()
+
+	t.Run("分批获取", func(t *testing.T) {
+		at := assert.New(t)
+		var ids []int
+		afterId := 0
+		for {
+			batch, err := dao.ListForExport(ctx, "", "", 0, afterId, 3)
+			if !at.Nil(err) || len(batch) == 0 {
+				break
+			}
+			for _, u := range batch {
+				ids = append(ids, u.Id)
+				at.NotEmpty(u.Roles)
+			}
+			afterId = batch[len(batch)-1].Id
+		}
+		at.Len(ids, len(users))
+		count, err := dao.CountForExport(ctx, "", "", 0)
+		at.Nil(err)
+		at.Equal(len(users), count)
+	})
+
+	t.Run("只获取老师任教班级中的用户", func(t *testing.T) {
+		at := assert.New(t)
+		_, err := db.Model((*model.User)(nil)).Set("class_id = ?", classes[0].Id).Where("id = ?", users[1].Id).Update()
+		at.Nil(err)
+		at.Nil(NewClass(db).SetTeacher(ctx, classes[0].Id, users[0].Id, model.ClassTeacherHead))
+
+		batch, err := dao.ListForExport(ctx, "", model.RoleStudent, users[0].Id, 0, 10)
+		if at.Nil(err) && at.Len(batch, 1) {
+			at.Equal(users[1].Id, batch[0].Id)
+			at.Equal(classes[0].Name, batch[0].Class.Name)
+		}
+		count, err := dao.CountForExport(ctx, "", model.RoleStudent, users[0].Id)
+		at.Nil(err)
+		at.Equal(1, count)
+	})
+
+	_ = testdb.Truncate(db)
+}
@@ -2,17 +2,33 @@ package dao
 
 import (
 	"context"
+	"github.com/go-pg/pg/v10"
 	"github.com/go-pg/pg/v10/orm"
 	"github.com/xuxusheng/time-frequency-be/internal/model"
 	"time"
 )
 
 type ILearningMaterial interface {
+	// 创建资料，同时创建第一个版本
 	Create(ctx context.Context, createdById, subjectId int, name, description, md5, filePath string) (*model.LearningMaterial, error)
 	Get(ctx context.Context, id int) (*model.LearningMaterial, error)
+	GetDeleted(ctx context.Context, id int) (*model.LearningMaterial, error)   // 获取回收站中的资料
+	GetByMd5(ctx context.Context, md5 string) (*model.LearningMaterial, error) // 通过文件 md5 获取任意一条资料，用于文件去重
+	ListAndCount(ctx context.Context, p *model.Page, f *model.LearningMaterialFilter) ([]*model.LearningMaterial, int, error)
 	Update(ctx context.Context, id, updatedBy int, name, description string) (*model.LearningMaterial, error)
-	Delete(ctx context.Context, id int) error
+	// 追加一个版本，并把资料的当前版本切换过去
+	SetVersion(ctx context.Context, id, updatedBy, version int, note, md5, filePath string) (*model.LearningMaterial, error)
+	ListExtractPending(ctx context.Context, limit int) ([]*model.LearningMaterial, error) // 等待提取正文的资料，按创建顺序
+	// 保存正文提取结果，md5 与资料当前的文件不一致时说明提取期间切换了版本，不保存并返回 false
+	SetExtractResult(ctx context.Context, id int, md5, status, content, extractErr string) (bool, error)
+	ResetExtract(ctx context.Context, id int) (*model.LearningMaterial, error)            // 重新提取正文
+	ListPreviewPending(ctx context.Context, limit int) ([]*model.LearningMaterial, error) // 等待生成预览图的资料，按创建顺序
+	// 保存预览图生成结果，md5 与资料当前的文件不一致时不保存并返回 false
+	SetPreviewResult(ctx context.Context, id int, md5, status, previewPath string) (bool, error)
+	Delete(ctx context.Context, id int) error      // 移入回收站，版本和文件保留，以便恢复
+	ForceDelete(ctx context.Context, id int) error // 彻底删除，不论是否在回收站中
 	IsNameExist(ctx context.Context, name string, excludeId int) (bool, error)
+	IsFilePathUsed(ctx context.Context, filePath string, excludeId int) (bool, error) // 文件是否还被其他资料引用，包括回收站中的
 }
 
 func NewLearningMaterial(db orm.DB) *LearningMaterial {
@@ -27,6 +43,7 @@ func (l LearningMaterial) Create(ctx context.Context, createdById, subjectId int
 	lm := model.LearningMaterial{
 		Name:        name,
 		Description: description,
+		Version:     1,
 		Md5:         md5,
 		FilePath:    filePath,
 		SubjectId:   subjectId,
@@ -35,11 +52,18 @@ func (l LearningMaterial) Create(ctx context.Context, createdById, subjectId int
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
-	_, err := l.db.ModelContext(ctx, &lm).Returning("*").Insert()
+	err := runInTransaction(ctx, l.db, func(tx orm.DB) error {
+		_, err := tx.ModelContext(ctx, &lm).Returning("*").Insert()
+		if err != nil {
+			return err
+		}
+		_, err = NewLearningMaterialVersion(tx).Create(ctx, lm.Id, createdById, lm.Version, "", md5, filePath)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	return &lm, err
+	return &lm, nil
 }
 
 func (l LearningMaterial) Get(ctx context.Context, id int) (*model.LearningMaterial, error) {
@@ -51,6 +75,57 @@ func (l LearningMaterial) Get(ctx context.Context, id int) (*model.LearningMater
 	return &lm, err
 }
 
+func (l LearningMaterial) GetDeleted(ctx context.Context, id int) (*model.LearningMaterial, error) {
+	lm := model.LearningMaterial{Id: id}
+	err := l.db.ModelContext(ctx, &lm).WherePK().Deleted().Select()
+	if err != nil {
+		return nil, err
+	}
+	return &lm, err
+}
+
+func (l LearningMaterial) GetByMd5(ctx context.Context, md5 string) (*model.LearningMaterial, error) {
+	lm := model.LearningMaterial{}
+	err := l.db.ModelContext(ctx, &lm).Where("md5 = ?", md5).Order("id").Limit(1).Select()
+	if err != nil {
+		return nil, err
+	}
+	return &lm, err
+}
+
+func (l LearningMaterial) ListAndCount(ctx context.Context, p *model.Page, f *model.LearningMaterialFilter) ([]*model.LearningMaterial, int, error) {
+	lms := []*model.LearningMaterial{}
+	if f.SubjectIds != nil && len(f.SubjectIds) == 0 {
+		return lms, 0, nil
+	}
+	// 正文可能很长，列表中不需要
+	db := l.db.ModelContext(ctx, &lms).
+		ExcludeColumn("content").
+		Offset(p.Offset()).
+		Limit(p.Limit())
+	if f.SubjectId != 0 {
+		db = db.Where("subject_id = ?", f.SubjectId)
+	}
+	if f.SubjectIds != nil {
+		db = db.Where("subject_id IN (?)", pg.In(f.SubjectIds))
+	}
+	if f.Query != "" {
+		// 全文检索，按相关度排序
+		tsquery := model.SearchQuery(f.Query)
+		if tsquery == "" {
+			return lms, 0, nil
+		}
+		db = db.Where("search_vector @@ ?::tsquery", tsquery).
+			OrderExpr("ts_rank(search_vector, ?::tsquery) DESC", tsquery)
+	}
+	db = db.Order("created_at DESC")
+	count, err := db.SelectAndCount()
+	if err != nil {
+		return nil, 0, err
+	}
+	return lms, count, nil
+}
+
 func (l LearningMaterial) Update(ctx context.Context, id, updatedBy int, name, description string) (*model.LearningMaterial, error) {
 	lm := model.LearningMaterial{
 		Id:          id,
@@ -63,14 +138,143 @@ func (l LearningMaterial) Update(ctx context.Context, id, updatedBy int, name, d
 	if err != nil {
 		return nil, err
 	}
+	err = updateSearchVector(ctx, l.db, &lm)
+	if err != nil {
+		return nil, err
+	}
 	return &lm, err
 }
 
+// 文件变化后原来的正文和预览图已经失效，需要重新生成
+func (l LearningMaterial) SetVersion(ctx context.Context, id, updatedBy, version int, note, md5, filePath string) (*model.LearningMaterial, error) {
+	lm := model.LearningMaterial{
+		Id:            id,
+		Version:       version,
+		Md5:           md5,
+		FilePath:      filePath,
+		ExtractStatus: model.ExtractStatusPending,
+		PreviewStatus: model.PreviewStatusPending,
+		UpdatedById:   updatedBy,
+		UpdatedAt:     time.Now(),
+	}
+	err := runInTransaction(ctx, l.db, func(tx orm.DB) error {
+		_, err := NewLearningMaterialVersion(tx).Create(ctx, id, updatedBy, version, note, md5, filePath)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ModelContext(ctx, &lm).
+			Column("version", "md5", "file_path", "extract_status", "extract_error", "content", "preview_status", "preview_path", "updated_by_id", "updated_at").
+			WherePK().
+			Returning("*").
+			Update()
+		if err != nil {
+			return err
+		}
+		return updateSearchVector(ctx, tx, &lm)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &lm, nil
+}
+
+func (l LearningMaterial) ListExtractPending(ctx context.Context, limit int) ([]*model.LearningMaterial, error) {
+	lms := []*model.LearningMaterial{}
+	err := l.db.ModelContext(ctx, &lms).
+		ExcludeColumn("content").
+		Where("extract_status = ?", model.ExtractStatusPending).
+		Order("id").
+		Limit(limit).
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return lms, nil
+}
+
+func (l LearningMaterial) SetExtractResult(ctx context.Context, id int, md5, status, content, extractErr string) (bool, error) {
+	lm := model.LearningMaterial{
+		Id:            id,
+		ExtractStatus: status,
+		ExtractError:  extractErr,
+		Content:       content,
+	}
+	res, err := l.db.ModelContext(ctx, &lm).
+		Column("extract_status", "extract_error", "content").
+		WherePK().
+		Where("md5 = ?", md5).
+		Returning("*").
+		Update()
+	if err != nil {
+		return false, err
+	}
+	if res.RowsAffected() == 0 {
+		return false, nil
+	}
+	err = updateSearchVector(ctx, l.db, &lm)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (l LearningMaterial) ResetExtract(ctx context.Context, id int) (*model.LearningMaterial, error) {
+	lm := model.LearningMaterial{
+		Id:            id,
+		ExtractStatus: model.ExtractStatusPending,
+	}
+	_, err := l.db.ModelContext(ctx, &lm).
+		Column("extract_status", "extract_error").
+		WherePK().
+		Returning("*").
+		Update()
+	if err != nil {
+		return nil, err
+	}
+	return &lm, err
+}
+
+func (l LearningMaterial) ListPreviewPending(ctx context.Context, limit int) ([]*model.LearningMaterial, error) {
+	lms := []*model.LearningMaterial{}
+	err := l.db.ModelContext(ctx, &lms).
+		ExcludeColumn("content").
+		Where("preview_status = ?", model.PreviewStatusPending).
+		Order("id").
+		Limit(limit).
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return lms, nil
+}
+
+func (l LearningMaterial) SetPreviewResult(ctx context.Context, id int, md5, status, previewPath string) (bool, error) {
+	lm := model.LearningMaterial{
+		Id:            id,
+		PreviewStatus: status,
+		PreviewPath:   previewPath,
+	}
+	res, err := l.db.ModelContext(ctx, &lm).
+		Column("preview_status", "preview_path").
+		WherePK().
+		Where("md5 = ?", md5).
+		Update()
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
+
 func (l LearningMaterial) Delete(ctx context.Context, id int) error {
 	_, err := l.db.ModelContext(ctx, &model.LearningMaterial{Id: id}).WherePK().Delete()
 	return err
 }
 
+func (l LearningMaterial) ForceDelete(ctx context.Context, id int) error {
+	_, err := l.db.ModelContext(ctx, &model.LearningMaterial{Id: id}).WherePK().AllWithDeleted().ForceDelete()
+	return err
+}
+
 func (l LearningMaterial) IsNameExist(ctx context.Context, name string, excludeId int) (bool, error) {
 	db := l.db.ModelContext(ctx, &model.LearningMaterial{})
 	if excludeId != 0 {
@@ -78,3 +282,11 @@ func (l LearningMaterial) IsNameExist(ctx context.Context, name string, excludeI
 	}
 	return db.Where("name = ?", name).Exists()
 }
+
+func (l LearningMaterial) IsFilePathUsed(ctx context.Context, filePath string, excludeId int) (bool, error) {
+	db := l.db.ModelContext(ctx, &model.LearningMaterial{}).AllWithDeleted()
+	if excludeId != 0 {
+		db = db.Where("id != ?", excludeId)
+	}
+	return db.Where("file_path = ?", filePath).Exists()
+}
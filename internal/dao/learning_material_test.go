@@ -43,7 +43,7 @@ func TestLearningMaterialDao_Create(t *testing.T) {
 			md5 := s + "md5"
 			filePath := s + "filePath"
 			l, err := dao.Create(context.Background(), createdById, subjectId, pl.Name, description, md5, filePath)
-			assert.EqualError(t, err, "ERROR #23505 duplicate key value violates unique constraint \"learning_material_name_key\"")
+			assert.EqualError(t, err, "ERROR #23505 duplicate key value violates unique constraint \"learning_material_name_active_key\"")
 			assert.Nil(t, l)
 		}
 	})
@@ -82,6 +82,12 @@ func TestLearningMaterialDao_Create(t *testing.T) {
 				assert.Equal(t, subjectId, l.SubjectId)
 				assert.Equal(t, md5, l.Md5)
 				assert.Equal(t, filePath, l.FilePath)
+				// 同时创建第一个版本
+				v, err := NewLearningMaterialVersion(db).GetByMd5(context.Background(), md5)
+				if assert.Nil(t, err) {
+					assert.Equal(t, l.Id, v.LearningMaterialId)
+					assert.Equal(t, 1, v.Version)
+				}
 			}
 		}
 	})
@@ -89,6 +95,47 @@ func TestLearningMaterialDao_Create(t *testing.T) {
 	_ = testdb.Truncate(db)
 }
 
+func TestLearningMaterialDao_SetVersion(t *testing.T) {
+	_, pSubjects, pUsers := prepareLearningMaterial(t, db)
+	dao := NewLearningMaterial(db)
+	versionDao := NewLearningMaterialVersion(db)
+	ctx := context.Background()
+	s := time.Now().String()
+
+	lm, err := dao.Create(ctx, pUsers[0].Id, pSubjects[0].Id, s, "", s+"md5-1", s+"filePath-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("追加版本", func(t *testing.T) {
+		at := assert.New(t)
+		l, err := dao.SetVersion(ctx, lm.Id, pUsers[1].Id, 2, "第二版", s+"md5-2", s+"filePath-2")
+		if at.Nil(err) {
+			at.Equal(2, l.Version)
+			at.Equal(s+"md5-2", l.Md5)
+			at.Equal(pUsers[1].Id, l.UpdatedById)
+		}
+		vs, count, err := versionDao.ListAndCount(ctx, model.NewPage(1, 10), lm.Id)
+		if at.Nil(err) && at.Equal(2, count) {
+			at.Equal("第二版", vs[0].Note)
+			at.Equal(s+"filePath-2", vs[0].FilePath)
+		}
+	})
+
+	t.Run("版本号重复时不切换", func(t *testing.T) {
+		at := assert.New(t)
+		_, err := dao.SetVersion(ctx, lm.Id, pUsers[1].Id, 2, "", s+"md5-3", s+"filePath-3")
+		at.NotNil(err)
+		l, err := dao.Get(ctx, lm.Id)
+		if at.Nil(err) {
+			at.Equal(2, l.Version)
+			at.Equal(s+"md5-2", l.Md5)
+		}
+	})
+
+	_ = testdb.Truncate(db)
+}
+
 func TestLearningMaterialDao_Get(t *testing.T) {
 	pls, _, _ := prepareLearningMaterial(t, db)
 	dao := NewLearningMaterial(db)
@@ -198,3 +245,135 @@ func TestLearningMaterialDao_Delete(t *testing.T) {
 
 	_ = testdb.Truncate(db)
 }
+
+func TestLearningMaterialDao_GetByMd5(t *testing.T) {
+	pls, _, _ := prepareLearningMaterial(t, db)
+	dao := NewLearningMaterial(db)
+
+	t.Run("正常获取", func(t *testing.T) {
+		l, err := dao.GetByMd5(context.Background(), pls[0].Md5)
+		if assert.Nil(t, err) {
+			assert.Equal(t, pls[0].Md5, l.Md5)
+		}
+	})
+
+	t.Run("md5不存在", func(t *testing.T) {
+		l, err := dao.GetByMd5(context.Background(), time.Now().String())
+		assert.Equal(t, pg.ErrNoRows, err)
+		assert.Nil(t, l)
+	})
+
+	_ = testdb.Truncate(db)
+}
+
+func TestLearningMaterialDao_ListAndCount(t *testing.T) {
+	pls, pSubjects, _ := prepareLearningMaterial(t, db)
+	dao := NewLearningMaterial(db)
+
+	t.Run("查询全部资料", func(t *testing.T) {
+		ls, count, err := dao.ListAndCount(context.Background(), model.NewPage(1, 100), &model.LearningMaterialFilter{})
+		if assert.Nil(t, err) {
+			assert.Equal(t, len(pls), count)
+			assert.Len(t, ls, len(pls))
+		}
+	})
+
+	t.Run("按科目筛选", func(t *testing.T) {
+		for _, pSubject := range pSubjects {
+			expected := 0
+			for _, pl := range pls {
+				if pl.SubjectId == pSubject.Id {
+					expected++
+				}
+			}
+			ls, count, err := dao.ListAndCount(context.Background(), model.NewPage(1, 100), &model.LearningMaterialFilter{SubjectId: pSubject.Id})
+			if assert.Nil(t, err) {
+				assert.Equal(t, expected, count)
+				for _, l := range ls {
+					assert.Equal(t, pSubject.Id, l.SubjectId)
+				}
+			}
+		}
+	})
+
+	t.Run("按名称搜索", func(t *testing.T) {
+		for _, pl := range pls {
+			ls, count, err := dao.ListAndCount(context.Background(), model.NewPage(1, 100), &model.LearningMaterialFilter{Query: pl.Name})
+			if assert.Nil(t, err) {
+				assert.Equal(t, 1, count)
+				assert.Equal(t, pl.Id, ls[0].Id)
+			}
+		}
+	})
+
+	t.Run("按有权访问的科目筛选", func(t *testing.T) {
+		ls, count, err := dao.ListAndCount(context.Background(), model.NewPage(1, 100), &model.LearningMaterialFilter{SubjectIds: []int{}})
+		if assert.Nil(t, err) {
+			assert.Zero(t, count)
+			assert.Empty(t, ls)
+		}
+
+		subjectIds := []int{pls[0].SubjectId}
+		ls, _, err = dao.ListAndCount(context.Background(), model.NewPage(1, 100), &model.LearningMaterialFilter{SubjectIds: subjectIds})
+		if assert.Nil(t, err) && assert.NotEmpty(t, ls) {
+			for _, l := range ls {
+				assert.Equal(t, pls[0].SubjectId, l.SubjectId)
+			}
+		}
+	})
+
+	_ = testdb.Truncate(db)
+}
+
+func TestLearningMaterialDao_IsFilePathUsed(t *testing.T) {
+	pls, _, _ := prepareLearningMaterial(t, db)
+	dao := NewLearningMaterial(db)
+
+	t.Run("被其他资料引用", func(t *testing.T) {
+		is, err := dao.IsFilePathUsed(context.Background(), pls[0].FilePath, pls[0].Id)
+		if assert.Nil(t, err) {
+			assert.True(t, is)
+		}
+	})
+
+	t.Run("没有被引用", func(t *testing.T) {
+		is, err := dao.IsFilePathUsed(context.Background(), time.Now().String(), 0)
+		if assert.Nil(t, err) {
+			assert.False(t, is)
+		}
+	})
+
+	_ = testdb.Truncate(db)
+}
+
+func TestLearningMaterialDao_SetExtractResult(t *testing.T) {
+	pLearningMaterials, _, _ := prepareLearningMaterial(t, db)
+	dao := NewLearningMaterial(db)
+	ctx := context.Background()
+	pLm := pLearningMaterials[0]
+
+	t.Run("文件已经变化", func(t *testing.T) {
+		ok, err := dao.SetExtractResult(ctx, pLm.Id, pLm.Md5+"x", model.ExtractStatusDone, "正文", "")
+		assert.Nil(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("正常保存", func(t *testing.T) {
+		at := assert.New(t)
+		ok, err := dao.SetExtractResult(ctx, pLm.Id, pLm.Md5, model.ExtractStatusDone, "正文", "")
+		at.Nil(err)
+		at.True(ok)
+		lm, err := dao.Get(ctx, pLm.Id)
+		at.Nil(err)
+		at.Equal(model.ExtractStatusDone, lm.ExtractStatus)
+		at.Equal("正文", lm.Content)
+
+		lms, err := dao.ListExtractPending(ctx, len(pLearningMaterials))
+		at.Nil(err)
+		for _, v := range lms {
+			at.NotEqual(pLm.Id, v.Id)
+		}
+	})
+
+	_ = testdb.Truncate(db)
+}
@@ -0,0 +1,99 @@
+package dao
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"time"
+)
+
+type ILearningMaterialVersion interface {
+	Create(ctx context.Context, learningMaterialId, createdById, version int, note, md5, filePath string) (*model.LearningMaterialVersion, error)
+	Get(ctx context.Context, id int) (*model.LearningMaterialVersion, error)
+	GetByMd5(ctx context.Context, md5 string) (*model.LearningMaterialVersion, error) // 通过文件 md5 获取任意一个版本，用于文件去重
+	ListAndCount(ctx context.Context, p *model.Page, learningMaterialId int) ([]*model.LearningMaterialVersion, int, error)
+	ListFilePaths(ctx context.Context, learningMaterialId int) ([]string, error) // 资料所有版本用到的文件，已去重
+	DeleteByLearningMaterialId(ctx context.Context, learningMaterialId int) error
+	IsFilePathUsed(ctx context.Context, filePath string) (bool, error) // 文件是否还被某个版本引用
+}
+
+func NewLearningMaterialVersion(db orm.DB) *LearningMaterialVersion {
+	return &LearningMaterialVersion{db: db}
+}
+
+type LearningMaterialVersion struct {
+	db orm.DB
+}
+
+func (l LearningMaterialVersion) Create(ctx context.Context, learningMaterialId, createdById, version int, note, md5, filePath string) (*model.LearningMaterialVersion, error) {
+	v := model.LearningMaterialVersion{
+		Version:            version,
+		Note:               note,
+		Md5:                md5,
+		FilePath:           filePath,
+		LearningMaterialId: learningMaterialId,
+		CreatedById:        createdById,
+		CreatedAt:          time.Now(),
+	}
+	_, err := l.db.ModelContext(ctx, &v).Returning("*").Insert()
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (l LearningMaterialVersion) Get(ctx context.Context, id int) (*model.LearningMaterialVersion, error) {
+	v := model.LearningMaterialVersion{Id: id}
+	err := l.db.ModelContext(ctx, &v).WherePK().Select()
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (l LearningMaterialVersion) GetByMd5(ctx context.Context, md5 string) (*model.LearningMaterialVersion, error) {
+	v := model.LearningMaterialVersion{}
+	err := l.db.ModelContext(ctx, &v).Where("md5 = ?", md5).Order("id").Limit(1).Select()
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (l LearningMaterialVersion) ListAndCount(ctx context.Context, p *model.Page, learningMaterialId int) ([]*model.LearningMaterialVersion, int, error) {
+	vs := []*model.LearningMaterialVersion{}
+	count, err := l.db.ModelContext(ctx, &vs).
+		Relation("CreatedBy").
+		Where("learning_material_version.learning_material_id = ?", learningMaterialId).
+		Offset(p.Offset()).
+		Limit(p.Limit()).
+		Order("version DESC").
+		SelectAndCount()
+	if err != nil {
+		return nil, 0, err
+	}
+	return vs, count, nil
+}
+
+func (l LearningMaterialVersion) ListFilePaths(ctx context.Context, learningMaterialId int) ([]string, error) {
+	var filePaths []string
+	err := l.db.ModelContext(ctx, (*model.LearningMaterialVersion)(nil)).
+		ColumnExpr("DISTINCT file_path").
+		Where("learning_material_id = ?", learningMaterialId).
+		Select(&filePaths)
+	if err != nil {
+		return nil, err
+	}
+	return filePaths, nil
+}
+
+func (l LearningMaterialVersion) DeleteByLearningMaterialId(ctx context.Context, learningMaterialId int) error {
+	_, err := l.db.ModelContext(ctx, (*model.LearningMaterialVersion)(nil)).
+		Where("learning_material_id = ?", learningMaterialId).
+		Delete()
+	return err
+}
+
+func (l LearningMaterialVersion) IsFilePathUsed(ctx context.Context, filePath string) (bool, error) {
+	return l.db.ModelContext(ctx, (*model.LearningMaterialVersion)(nil)).Where("file_path = ?", filePath).Exists()
+}
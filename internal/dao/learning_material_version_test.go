@@ -0,0 +1,72 @@
+package dao
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"testing"
+	"time"
+)
+
+func TestLearningMaterialVersionDao(t *testing.T) {
+	pls, _, pUsers := prepareLearningMaterial(t, db)
+	dao := NewLearningMaterialVersion(db)
+	ctx := context.Background()
+
+	lmId := pls[0].Id
+	s := time.Now().String()
+
+	t.Run("创建版本", func(t *testing.T) {
+		for i := 1; i <= 3; i++ {
+			v, err := dao.Create(ctx, lmId, pUsers[0].Id, i, s, s+"md5", s+"filePath")
+			if assert.Nil(t, err) {
+				assert.Equal(t, i, v.Version)
+				assert.Equal(t, lmId, v.LearningMaterialId)
+			}
+		}
+	})
+
+	t.Run("版本号重复", func(t *testing.T) {
+		_, err := dao.Create(ctx, lmId, pUsers[0].Id, 1, s, s+"md5", s+"filePath")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("查询版本列表", func(t *testing.T) {
+		vs, count, err := dao.ListAndCount(ctx, model.NewPage(1, 2), lmId)
+		if assert.Nil(t, err) {
+			assert.Equal(t, 3, count)
+			assert.Len(t, vs, 2)
+			assert.Equal(t, 3, vs[0].Version)
+			assert.Equal(t, pUsers[0].Id, vs[0].CreatedBy.Id)
+		}
+	})
+
+	t.Run("文件引用", func(t *testing.T) {
+		filePaths, err := dao.ListFilePaths(ctx, lmId)
+		if assert.Nil(t, err) {
+			assert.Equal(t, []string{s + "filePath"}, filePaths)
+		}
+		is, err := dao.IsFilePathUsed(ctx, s+"filePath")
+		assert.Nil(t, err)
+		assert.True(t, is)
+
+		v, err := dao.GetByMd5(ctx, s+"md5")
+		if assert.Nil(t, err) {
+			assert.Equal(t, s+"filePath", v.FilePath)
+		}
+	})
+
+	t.Run("删除资料的所有版本", func(t *testing.T) {
+		err := dao.DeleteByLearningMaterialId(ctx, lmId)
+		assert.Nil(t, err)
+		is, err := dao.IsFilePathUsed(ctx, s+"filePath")
+		assert.Nil(t, err)
+		assert.False(t, is)
+		_, err = dao.GetByMd5(ctx, s+"md5")
+		assert.Equal(t, pg.ErrNoRows, err)
+	})
+
+	_ = testdb.Truncate(db)
+}
@@ -0,0 +1,79 @@
+package dao
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"time"
+)
+
+type ILoginFailure interface {
+	Get(ctx context.Context, key string) (*model.LoginFailure, error)
+	// 失败次数加一，距离上次失败超过 window 或者上次的锁定已经结束时重新计数
+	Incr(ctx context.Context, key string, window time.Duration) (*model.LoginFailure, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	// 删除记录，用于登录成功后清零和管理员解锁，记录不存在时忽略
+	Delete(ctx context.Context, key string) error
+	// 删除最近一次失败早于 before 且没有处于锁定中的记录，返回删除的数量
+	DeleteStale(ctx context.Context, before time.Time) (int, error)
+}
+
+func NewLoginFailure(db orm.DB) *LoginFailure {
+	return &LoginFailure{db: db}
+}
+
+type LoginFailure struct {
+	db orm.DB
+}
+
+func (l LoginFailure) Get(ctx context.Context, key string) (*model.LoginFailure, error) {
+	f := model.LoginFailure{}
+	err := l.db.ModelContext(ctx, &f).Where("key = ?", key).Select()
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func (l LoginFailure) Incr(ctx context.Context, key string, window time.Duration) (*model.LoginFailure, error) {
+	now := time.Now()
+	f := model.LoginFailure{Key: key, Count: 1, LastFailedAt: now}
+	// 并发失败时依赖 ON CONFLICT 保证计数准确
+	_, err := l.db.ModelContext(ctx, &f).
+		OnConflict("(key) DO UPDATE").
+		Set(`count = CASE WHEN login_failure.last_failed_at < ? OR login_failure.locked_until < ? THEN 1 ELSE login_failure.count + 1 END`, now.Add(-window), now).
+		Set(`locked_until = CASE WHEN login_failure.locked_until < ? THEN NULL ELSE login_failure.locked_until END`, now).
+		Set("last_failed_at = EXCLUDED.last_failed_at").
+		Returning("*").
+		Insert()
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func (l LoginFailure) Lock(ctx context.Context, key string, until time.Time) error {
+	_, err := l.db.ModelContext(ctx, (*model.LoginFailure)(nil)).
+		Set("locked_until = ?", until).
+		Where("key = ?", key).
+		Update()
+	return err
+}
+
+func (l LoginFailure) Delete(ctx context.Context, key string) error {
+	_, err := l.db.ModelContext(ctx, (*model.LoginFailure)(nil)).
+		Where("key = ?", key).
+		Delete()
+	return err
+}
+
+func (l LoginFailure) DeleteStale(ctx context.Context, before time.Time) (int, error) {
+	res, err := l.db.ModelContext(ctx, (*model.LoginFailure)(nil)).
+		Where("last_failed_at < ?", before).
+		Where("locked_until IS NULL OR locked_until < ?", time.Now()).
+		Delete()
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
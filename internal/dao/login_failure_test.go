@@ -0,0 +1,68 @@
+package dao
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"testing"
+	"time"
+)
+
+func TestLoginFailureDao(t *testing.T) {
+	dao := NewLoginFailure(db)
+	ctx := context.Background()
+	key := "account:张三"
+
+	t.Run("计数", func(t *testing.T) {
+		at := assert.New(t)
+		for i := 1; i <= 3; i++ {
+			f, err := dao.Incr(ctx, key, time.Hour)
+			if at.Nil(err) {
+				at.Equal(i, f.Count)
+			}
+		}
+		// 超过统计窗口后重新计数
+		f, err := dao.Incr(ctx, key, 0)
+		if at.Nil(err) {
+			at.Equal(1, f.Count)
+		}
+	})
+
+	t.Run("锁定结束后重新计数", func(t *testing.T) {
+		at := assert.New(t)
+		at.Nil(dao.Lock(ctx, key, time.Now().Add(time.Hour)))
+		f, err := dao.Incr(ctx, key, time.Hour)
+		if at.Nil(err) {
+			at.Equal(2, f.Count)
+			at.False(f.LockedUntil.IsZero())
+		}
+
+		at.Nil(dao.Lock(ctx, key, time.Now().Add(-time.Second)))
+		f, err = dao.Incr(ctx, key, time.Hour)
+		if at.Nil(err) {
+			at.Equal(1, f.Count)
+			at.True(f.LockedUntil.IsZero())
+		}
+	})
+
+	t.Run("删除", func(t *testing.T) {
+		at := assert.New(t)
+		_, err := dao.Incr(ctx, "ip:127.0.0.1", time.Hour)
+		at.Nil(err)
+		at.Nil(dao.Lock(ctx, "ip:127.0.0.1", time.Now().Add(time.Hour)))
+
+		// 锁定中的不删除
+		n, err := dao.DeleteStale(ctx, time.Now().Add(time.Minute))
+		at.Nil(err)
+		at.Equal(1, n)
+		_, err = dao.Get(ctx, key)
+		at.Equal(pg.ErrNoRows, err)
+
+		at.Nil(dao.Delete(ctx, "ip:127.0.0.1"))
+		_, err = dao.Get(ctx, "ip:127.0.0.1")
+		at.Equal(pg.ErrNoRows, err)
+	})
+
+	_ = testdb.Truncate(db)
+}
@@ -0,0 +1,54 @@
+package dao
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"time"
+)
+
+type IOidcLogin interface {
+	Create(ctx context.Context, l *model.OidcLogin) error
+	// 取出并删除未过期的 state 或 ticket，不存在或已过期时返回 pg.ErrNoRows，同一个只有一次能取到
+	Consume(ctx context.Context, typ, hash string) (*model.OidcLogin, error)
+	// 删除过期时间早于 before 的数据，返回删除的数量
+	DeleteExpired(ctx context.Context, before time.Time) (int, error)
+}
+
+func NewOidcLogin(db orm.DB) *OidcLogin {
+	return &OidcLogin{db: db}
+}
+
+type OidcLogin struct {
+	db orm.DB
+}
+
+func (o OidcLogin) Create(ctx context.Context, l *model.OidcLogin) error {
+	l.CreatedAt = time.Now()
+	_, err := o.db.ModelContext(ctx, l).Returning("*").Insert()
+	return err
+}
+
+func (o OidcLogin) Consume(ctx context.Context, typ, hash string) (*model.OidcLogin, error) {
+	l := model.OidcLogin{}
+	_, err := o.db.ModelContext(ctx, &l).
+		Where("type = ?", typ).
+		Where("token_hash = ?", hash).
+		Where("expires_at > ?", time.Now()).
+		Returning("*").
+		Delete()
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (o OidcLogin) DeleteExpired(ctx context.Context, before time.Time) (int, error) {
+	res, err := o.db.ModelContext(ctx, (*model.OidcLogin)(nil)).
+		Where("expires_at < ?", before).
+		Delete()
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
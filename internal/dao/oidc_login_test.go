@@ -0,0 +1,61 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"testing"
+	"time"
+)
+
+func TestOidcLoginDao(t *testing.T) {
+	dao := NewOidcLogin(db)
+	ctx := context.Background()
+
+	var ls []*model.OidcLogin
+	for i, expiresAt := range []time.Time{time.Now().Add(-time.Hour), time.Now().Add(time.Hour)} {
+		l := model.OidcLogin{
+			Type:         model.OidcLoginTypeState,
+			TokenHash:    fmt.Sprintf("hash-%d", i),
+			Nonce:        "nonce",
+			CodeVerifier: "verifier",
+			ExpiresAt:    expiresAt,
+		}
+		if err := dao.Create(ctx, &l); err != nil {
+			t.Fatal(err)
+		}
+		ls = append(ls, &l)
+	}
+
+	t.Run("取出", func(t *testing.T) {
+		at := assert.New(t)
+		// 类型不一致
+		_, err := dao.Consume(ctx, model.OidcLoginTypeTicket, ls[1].TokenHash)
+		at.True(errors.Is(err, pg.ErrNoRows))
+		// 已过期
+		_, err = dao.Consume(ctx, model.OidcLoginTypeState, ls[0].TokenHash)
+		at.True(errors.Is(err, pg.ErrNoRows))
+
+		l, err := dao.Consume(ctx, model.OidcLoginTypeState, ls[1].TokenHash)
+		if at.Nil(err) {
+			at.Equal(ls[1].Id, l.Id)
+			at.Equal("verifier", l.CodeVerifier)
+		}
+		// 只能取出一次
+		_, err = dao.Consume(ctx, model.OidcLoginTypeState, ls[1].TokenHash)
+		at.True(errors.Is(err, pg.ErrNoRows))
+	})
+
+	t.Run("删除过期的", func(t *testing.T) {
+		at := assert.New(t)
+		n, err := dao.DeleteExpired(ctx, time.Now())
+		at.Nil(err)
+		at.Equal(1, n)
+	})
+
+	_ = testdb.Truncate(db)
+}
@@ -0,0 +1,99 @@
+package dao
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"time"
+)
+
+type IPasswordReset interface {
+	Create(ctx context.Context, pr *model.PasswordReset) error
+	GetByHash(ctx context.Context, hash string) (*model.PasswordReset, error)
+	// 用户最近一次申请的 token
+	GetLatest(ctx context.Context, userId int) (*model.PasswordReset, error)
+	// 标记为已使用，已经用过或者已经过期时返回 false，用于判断并发使用时谁先拿到
+	Use(ctx context.Context, id int) (bool, error)
+	// 取消已使用的标记，使用后修改密码失败时恢复，链接可以继续使用
+	Release(ctx context.Context, id int) error
+	// 用户所有还没使用的 token 标记为已使用
+	UseByUser(ctx context.Context, userId int) error
+	// 删除过期时间早于 before 的 token，返回删除的数量
+	DeleteExpired(ctx context.Context, before time.Time) (int, error)
+}
+
+func NewPasswordReset(db orm.DB) *PasswordReset {
+	return &PasswordReset{db: db}
+}
+
+type PasswordReset struct {
+	db orm.DB
+}
+
+func (p PasswordReset) Create(ctx context.Context, pr *model.PasswordReset) error {
+	pr.CreatedAt = time.Now()
+	_, err := p.db.ModelContext(ctx, pr).Returning("*").Insert()
+	return err
+}
+
+func (p PasswordReset) GetByHash(ctx context.Context, hash string) (*model.PasswordReset, error) {
+	pr := model.PasswordReset{}
+	err := p.db.ModelContext(ctx, &pr).Where("token_hash = ?", hash).Select()
+	if err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+func (p PasswordReset) GetLatest(ctx context.Context, userId int) (*model.PasswordReset, error) {
+	pr := model.PasswordReset{}
+	err := p.db.ModelContext(ctx, &pr).
+		Where("user_id = ?", userId).
+		Order("id DESC").
+		Limit(1).
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+func (p PasswordReset) Use(ctx context.Context, id int) (bool, error) {
+	res, err := p.db.ModelContext(ctx, (*model.PasswordReset)(nil)).
+		Set("used_at = ?", time.Now()).
+		Where("id = ?", id).
+		Where("used_at IS NULL").
+		Where("expires_at > now()").
+		Update()
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+func (p PasswordReset) Release(ctx context.Context, id int) error {
+	_, err := p.db.ModelContext(ctx, (*model.PasswordReset)(nil)).
+		Set("used_at = NULL").
+		Where("id = ?", id).
+		Update()
+	return err
+}
+
+func (p PasswordReset) UseByUser(ctx context.Context, userId int) error {
+	_, err := p.db.ModelContext(ctx, (*model.PasswordReset)(nil)).
+		Set("used_at = ?", time.Now()).
+		Where("user_id = ?", userId).
+		Where("used_at IS NULL").
+		Update()
+	return err
+}
+
+func (p PasswordReset) DeleteExpired(ctx context.Context, before time.Time) (int, error) {
+	res, err := p.db.ModelContext(ctx, (*model.PasswordReset)(nil)).
+		Where("expires_at < ?", before).
+		Delete()
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
@@ -0,0 +1,85 @@
+package dao
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"testing"
+	"time"
+)
+
+func TestPasswordResetDao(t *testing.T) {
+	pUsers, err := testdb.SeedUser(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dao := NewPasswordReset(db)
+	ctx := context.Background()
+
+	var prs []*model.PasswordReset
+	for _, expiresAt := range []time.Time{time.Now().Add(-time.Hour), time.Now().Add(time.Hour)} {
+		pr := model.PasswordReset{
+			TokenHash: time.Now().String(),
+			ExpiresAt: expiresAt,
+			UserId:    pUsers[0].Id,
+		}
+		if err := dao.Create(ctx, &pr); err != nil {
+			t.Fatal(err)
+		}
+		prs = append(prs, &pr)
+	}
+
+	t.Run("最近一次申请", func(t *testing.T) {
+		at := assert.New(t)
+		pr, err := dao.GetLatest(ctx, pUsers[0].Id)
+		if at.Nil(err) {
+			at.Equal(prs[1].Id, pr.Id)
+		}
+	})
+
+	t.Run("使用", func(t *testing.T) {
+		at := assert.New(t)
+		ok, err := dao.Use(ctx, prs[1].Id)
+		at.Nil(err)
+		at.True(ok)
+		// 重复使用
+		ok, err = dao.Use(ctx, prs[1].Id)
+		at.Nil(err)
+		at.False(ok)
+
+		pr, err := dao.GetByHash(ctx, prs[1].TokenHash)
+		if at.Nil(err) {
+			at.False(pr.UsedAt.IsZero())
+		}
+
+		// 恢复后可以再次使用
+		at.Nil(dao.Release(ctx, prs[1].Id))
+		ok, err = dao.Use(ctx, prs[1].Id)
+		at.Nil(err)
+		at.True(ok)
+
+		// 已经过期
+		ok, err = dao.Use(ctx, prs[0].Id)
+		at.Nil(err)
+		at.False(ok)
+	})
+
+	t.Run("作废用户所有的", func(t *testing.T) {
+		at := assert.New(t)
+		at.Nil(dao.UseByUser(ctx, pUsers[0].Id))
+		pr, err := dao.GetByHash(ctx, prs[0].TokenHash)
+		if at.Nil(err) {
+			at.False(pr.UsedAt.IsZero())
+		}
+	})
+
+	t.Run("删除过期的", func(t *testing.T) {
+		at := assert.New(t)
+		n, err := dao.DeleteExpired(ctx, time.Now())
+		at.Nil(err)
+		at.Equal(1, n)
+	})
+
+	_ = testdb.Truncate(db)
+}
@@ -0,0 +1,67 @@
+package dao
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"time"
+)
+
+type IRecoveryCode interface {
+	// 删除用户原有的恢复码，换成新的
+	Replace(ctx context.Context, userId int, hashes []string) error
+	// 使用一个恢复码，不存在或者已经用过时返回 false
+	Use(ctx context.Context, userId int, hash string) (bool, error)
+	// 还没有使用的恢复码数量
+	CountUnused(ctx context.Context, userId int) (int, error)
+	DeleteByUser(ctx context.Context, userId int) error
+}
+
+func NewRecoveryCode(db orm.DB) *RecoveryCode {
+	return &RecoveryCode{db: db}
+}
+
+type RecoveryCode struct {
+	db orm.DB
+}
+
+func (r RecoveryCode) Replace(ctx context.Context, userId int, hashes []string) error {
+	codes := make([]*model.RecoveryCode, 0, len(hashes))
+	for _, hash := range hashes {
+		codes = append(codes, &model.RecoveryCode{CodeHash: hash, UserId: userId, CreatedAt: time.Now()})
+	}
+	err := r.DeleteByUser(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	_, err = r.db.ModelContext(ctx, &codes).Insert()
+	return err
+}
+
+func (r RecoveryCode) Use(ctx context.Context, userId int, hash string) (bool, error) {
+	res, err := r.db.ModelContext(ctx, (*model.RecoveryCode)(nil)).
+		Set("used_at = ?", time.Now()).
+		Where("user_id = ?", userId).
+		Where("code_hash = ?", hash).
+		Where("used_at IS NULL").
+		Update()
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+func (r RecoveryCode) CountUnused(ctx context.Context, userId int) (int, error) {
+	return r.db.ModelContext(ctx, (*model.RecoveryCode)(nil)).
+		Where("user_id = ?", userId).
+		Where("used_at IS NULL").
+		Count()
+}
+
+func (r RecoveryCode) DeleteByUser(ctx context.Context, userId int) error {
+	_, err := r.db.ModelContext(ctx, (*model.RecoveryCode)(nil)).Where("user_id = ?", userId).Delete()
+	return err
+}
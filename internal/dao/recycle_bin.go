@@ -0,0 +1,126 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"strings"
+	"time"
+)
+
+// 回收站中的数据统一通过 deleted_at 列标记，彻底删除需要处理关联数据，由各自的 dao 完成
+type IRecycleBin interface {
+	// 查询回收站中的数据，typ 为空时查询全部类型，按删除时间倒序
+	ListAndCount(ctx context.Context, p *model.Page, typ string) ([]*model.RecycleBinItem, int, error)
+	// 某一类型中删除时间早于 before 且 ID 大于 afterId 的数据，按 ID 正序，用于定时彻底删除
+	ListDeletedBefore(ctx context.Context, typ string, before time.Time, afterId, limit int) ([]*model.RecycleBinItem, error)
+	// 获取回收站中的单条数据，不在回收站中时返回 pg.ErrNoRows
+	Get(ctx context.Context, typ string, id int) (*model.RecycleBinItem, error)
+	// 从回收站恢复，不在回收站中时返回 pg.ErrNoRows
+	Restore(ctx context.Context, typ string, id int) error
+}
+
+// 各类型数据所在的表
+var recycleBinTables = map[string]string{
+	model.RecycleBinTypeUser:             `"user"`,
+	model.RecycleBinTypeClass:            "class",
+	model.RecycleBinTypeSubject:          "subject",
+	model.RecycleBinTypeLearningMaterial: "learning_material",
+}
+
+// 与 recycleBinTables 对应，保证查询全部类型时的顺序固定
+var recycleBinTypes = []string{
+	model.RecycleBinTypeUser,
+	model.RecycleBinTypeClass,
+	model.RecycleBinTypeSubject,
+	model.RecycleBinTypeLearningMaterial,
+}
+
+func NewRecycleBin(db orm.DB) *RecycleBin {
+	return &RecycleBin{db: db}
+}
+
+type RecycleBin struct {
+	db orm.DB
+}
+
+func (r RecycleBin) ListAndCount(ctx context.Context, p *model.Page, typ string) ([]*model.RecycleBinItem, int, error) {
+	items := []*model.RecycleBinItem{}
+	union, params := recycleBinUnion(typ)
+	if union == "" {
+		return items, 0, nil
+	}
+
+	var count int
+	_, err := r.db.QueryOneContext(ctx, pg.Scan(&count), fmt.Sprintf("SELECT count(*) FROM (%s) AS r", union), params...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	params = append(params, p.Limit(), p.Offset())
+	_, err = r.db.QueryContext(ctx, &items, fmt.Sprintf("SELECT * FROM (%s) AS r ORDER BY deleted_at DESC, type, id LIMIT ? OFFSET ?", union), params...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return items, count, nil
+}
+
+func (r RecycleBin) ListDeletedBefore(ctx context.Context, typ string, before time.Time, afterId, limit int) ([]*model.RecycleBinItem, error) {
+	items := []*model.RecycleBinItem{}
+	table, ok := recycleBinTables[typ]
+	if !ok {
+		return items, nil
+	}
+	_, err := r.db.QueryContext(ctx, &items, fmt.Sprintf(`SELECT ? AS type, id, name, deleted_at FROM %s
+		WHERE deleted_at < ? AND id > ? ORDER BY id LIMIT ?`, table), typ, before, afterId, limit)
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r RecycleBin) Get(ctx context.Context, typ string, id int) (*model.RecycleBinItem, error) {
+	table, ok := recycleBinTables[typ]
+	if !ok {
+		return nil, pg.ErrNoRows
+	}
+	item := model.RecycleBinItem{}
+	_, err := r.db.QueryOneContext(ctx, &item, fmt.Sprintf(`SELECT ? AS type, id, name, deleted_at FROM %s
+		WHERE id = ? AND deleted_at IS NOT NULL`, table), typ, id)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (r RecycleBin) Restore(ctx context.Context, typ string, id int) error {
+	table, ok := recycleBinTables[typ]
+	if !ok {
+		return pg.ErrNoRows
+	}
+	res, err := r.db.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET deleted_at = NULL, updated_at = ?
+		WHERE id = ? AND deleted_at IS NOT NULL`, table), time.Now(), id)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return pg.ErrNoRows
+	}
+	return nil
+}
+
+// 拼接各类型回收站数据的查询，typ 为空时包含全部类型，不支持的类型返回空字符串
+func recycleBinUnion(typ string) (string, []interface{}) {
+	var parts []string
+	var params []interface{}
+	for _, t := range recycleBinTypes {
+		if typ != "" && typ != t {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("SELECT ? AS type, id, name, deleted_at FROM %s WHERE deleted_at IS NOT NULL", recycleBinTables[t]))
+		params = append(params, t)
+	}
+	return strings.Join(parts, " UNION ALL "), params
+}
@@ -0,0 +1,110 @@
+package dao
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"testing"
+	"time"
+)
+
+func TestRecycleBinDao(t *testing.T) {
+	pls, _, pUsers := prepareLearningMaterial(t, db)
+	lmDao := NewLearningMaterial(db)
+	subjectDao := NewSubject(db)
+	userDao := NewUser(db)
+	dao := NewRecycleBin(db)
+	ctx := context.Background()
+
+	subject, err := subjectDao.Create(ctx, pUsers[0].Id, time.Now().String(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lm := pls[0]
+	user := pUsers[len(pUsers)-1]
+	for _, err := range []error{
+		lmDao.Delete(ctx, lm.Id),
+		subjectDao.Delete(ctx, subject.Id),
+		userDao.Delete(ctx, user.Id),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("删除后查询不到", func(t *testing.T) {
+		at := assert.New(t)
+		_, err := lmDao.Get(ctx, lm.Id)
+		at.Equal(pg.ErrNoRows, err)
+		_, err = userDao.GetByName(ctx, user.Name)
+		at.Equal(pg.ErrNoRows, err)
+		is, err := subjectDao.IsNameExist(ctx, subject.Name, 0)
+		at.Nil(err)
+		at.False(is)
+	})
+
+	t.Run("查询回收站", func(t *testing.T) {
+		at := assert.New(t)
+		items, count, err := dao.ListAndCount(ctx, model.NewPage(1, 10), "")
+		if at.Nil(err) {
+			at.Equal(3, count)
+			at.Len(items, 3)
+		}
+		items, count, err = dao.ListAndCount(ctx, model.NewPage(1, 10), model.RecycleBinTypeLearningMaterial)
+		if at.Nil(err) && at.Len(items, 1) {
+			at.Equal(1, count)
+			at.Equal(lm.Id, items[0].Id)
+			at.Equal(lm.Name, items[0].Name)
+			at.False(items[0].DeletedAt.IsZero())
+		}
+	})
+
+	t.Run("查询到期的数据", func(t *testing.T) {
+		at := assert.New(t)
+		items, err := dao.ListDeletedBefore(ctx, model.RecycleBinTypeUser, time.Now().Add(time.Minute), 0, 10)
+		if at.Nil(err) && at.Len(items, 1) {
+			at.Equal(user.Id, items[0].Id)
+		}
+		items, err = dao.ListDeletedBefore(ctx, model.RecycleBinTypeUser, time.Now().Add(time.Minute), user.Id, 10)
+		at.Nil(err)
+		at.Empty(items)
+		items, err = dao.ListDeletedBefore(ctx, model.RecycleBinTypeUser, time.Now().Add(-time.Hour), 0, 10)
+		at.Nil(err)
+		at.Empty(items)
+	})
+
+	t.Run("恢复", func(t *testing.T) {
+		at := assert.New(t)
+		at.Nil(dao.Restore(ctx, model.RecycleBinTypeLearningMaterial, lm.Id))
+		_, err := lmDao.Get(ctx, lm.Id)
+		at.Nil(err)
+		_, err = dao.Get(ctx, model.RecycleBinTypeLearningMaterial, lm.Id)
+		at.Equal(pg.ErrNoRows, err)
+		// 不在回收站中
+		at.Equal(pg.ErrNoRows, dao.Restore(ctx, model.RecycleBinTypeLearningMaterial, lm.Id))
+	})
+
+	t.Run("删除后可以创建同名数据，此时无法恢复", func(t *testing.T) {
+		at := assert.New(t)
+		other, err := subjectDao.Create(ctx, pUsers[0].Id, subject.Name, "")
+		if !at.Nil(err) {
+			return
+		}
+		err = dao.Restore(ctx, model.RecycleBinTypeSubject, subject.Id)
+		at.EqualError(err, "ERROR #23505 duplicate key value violates unique constraint \"subject_name_active_key\"")
+
+		at.Nil(subjectDao.Delete(ctx, other.Id))
+		at.Nil(dao.Restore(ctx, model.RecycleBinTypeSubject, subject.Id))
+	})
+
+	t.Run("彻底删除", func(t *testing.T) {
+		at := assert.New(t)
+		at.Nil(userDao.ForceDelete(ctx, user.Id))
+		_, err := dao.Get(ctx, model.RecycleBinTypeUser, user.Id)
+		at.Equal(pg.ErrNoRows, err)
+	})
+
+	_ = testdb.Truncate(db)
+}
@@ -0,0 +1,62 @@
+package dao
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"time"
+)
+
+type IRefreshToken interface {
+	Create(ctx context.Context, rt *model.RefreshToken) error
+	GetByHash(ctx context.Context, hash string) (*model.RefreshToken, error)
+	// 作废单个 token，已经作废过时返回 false，用于判断并发刷新时谁先拿到
+	Revoke(ctx context.Context, id int) (bool, error)
+	// 删除过期时间早于 before 的 token，返回删除的数量
+	DeleteExpired(ctx context.Context, before time.Time) (int, error)
+}
+
+func NewRefreshToken(db orm.DB) *RefreshToken {
+	return &RefreshToken{db: db}
+}
+
+type RefreshToken struct {
+	db orm.DB
+}
+
+func (r RefreshToken) Create(ctx context.Context, rt *model.RefreshToken) error {
+	rt.CreatedAt = time.Now()
+	_, err := r.db.ModelContext(ctx, rt).Returning("*").Insert()
+	return err
+}
+
+func (r RefreshToken) GetByHash(ctx context.Context, hash string) (*model.RefreshToken, error) {
+	rt := model.RefreshToken{}
+	err := r.db.ModelContext(ctx, &rt).Where("token_hash = ?", hash).Select()
+	if err != nil {
+		return nil, err
+	}
+	return &rt, nil
+}
+
+func (r RefreshToken) Revoke(ctx context.Context, id int) (bool, error) {
+	res, err := r.db.ModelContext(ctx, (*model.RefreshToken)(nil)).
+		Set("revoked_at = ?", time.Now()).
+		Where("id = ?", id).
+		Where("revoked_at IS NULL").
+		Update()
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+func (r RefreshToken) DeleteExpired(ctx context.Context, before time.Time) (int, error) {
+	res, err := r.db.ModelContext(ctx, (*model.RefreshToken)(nil)).
+		Where("expires_at < ?", before).
+		Delete()
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
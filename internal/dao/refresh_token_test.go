@@ -0,0 +1,64 @@
+package dao
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"testing"
+	"time"
+)
+
+func TestRefreshTokenDao(t *testing.T) {
+	pUsers, err := testdb.SeedUser(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dao := NewRefreshToken(db)
+	ctx := context.Background()
+
+	var rts []*model.RefreshToken
+	for _, expiresAt := range []time.Time{time.Now().Add(time.Hour), time.Now().Add(-time.Hour)} {
+		rt := model.RefreshToken{
+			TokenHash: time.Now().String(),
+			ExpiresAt: expiresAt,
+			UserId:    pUsers[0].Id,
+		}
+		if err := dao.Create(ctx, &rt); err != nil {
+			t.Fatal(err)
+		}
+		rts = append(rts, &rt)
+	}
+
+	t.Run("作废", func(t *testing.T) {
+		at := assert.New(t)
+		ok, err := dao.Revoke(ctx, rts[0].Id)
+		at.Nil(err)
+		at.True(ok)
+		// 重复作废
+		ok, err = dao.Revoke(ctx, rts[0].Id)
+		at.Nil(err)
+		at.False(ok)
+
+		rt, err := dao.GetByHash(ctx, rts[0].TokenHash)
+		if at.Nil(err) {
+			at.False(rt.RevokedAt.IsZero())
+		}
+	})
+
+	t.Run("删除过期的", func(t *testing.T) {
+		at := assert.New(t)
+		n, err := dao.DeleteExpired(ctx, time.Now())
+		at.Nil(err)
+		at.Equal(1, n)
+	})
+
+	t.Run("token 版本加一", func(t *testing.T) {
+		at := assert.New(t)
+		ver, err := NewUser(db).IncrTokenVersion(ctx, pUsers[0].Id)
+		at.Nil(err)
+		at.Equal(pUsers[0].TokenVersion+1, ver)
+	})
+
+	_ = testdb.Truncate(db)
+}
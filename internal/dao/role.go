@@ -0,0 +1,116 @@
+package dao
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"time"
+)
+
+type IRole interface {
+	List(ctx context.Context) ([]*model.Role, error) // 所有角色，内置角色在前
+	Get(ctx context.Context, id int) (*model.Role, error)
+	GetByName(ctx context.Context, name string) (*model.Role, error)
+	ListByNames(ctx context.Context, names []string) ([]*model.Role, error)
+	Create(ctx context.Context, role *model.Role) error
+	Update(ctx context.Context, role *model.Role, columns []string) error
+	Delete(ctx context.Context, id int) error // 同时移除所有用户的这个角色，内置角色不会被删除
+	IsNameExist(ctx context.Context, name string) (bool, error)
+
+	ListPermissionsByUser(ctx context.Context, userId int) ([]string, error) // 用户所有角色权限的并集
+}
+
+func NewRole(db orm.DB) *Role {
+	return &Role{db: db}
+}
+
+type Role struct {
+	db orm.DB
+}
+
+func (r Role) List(ctx context.Context) ([]*model.Role, error) {
+	roles := []*model.Role{}
+	err := r.db.ModelContext(ctx, &roles).Order("builtin DESC", "id").Select()
+	if err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (r Role) Get(ctx context.Context, id int) (*model.Role, error) {
+	role := model.Role{Id: id}
+	err := r.db.ModelContext(ctx, &role).WherePK().Select()
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r Role) GetByName(ctx context.Context, name string) (*model.Role, error) {
+	role := model.Role{}
+	err := r.db.ModelContext(ctx, &role).Where("name = ?", name).Select()
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r Role) ListByNames(ctx context.Context, names []string) ([]*model.Role, error) {
+	roles := []*model.Role{}
+	if len(names) == 0 {
+		return roles, nil
+	}
+	err := r.db.ModelContext(ctx, &roles).Where("name IN (?)", pg.In(names)).Order("id").Select()
+	if err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (r Role) Create(ctx context.Context, role *model.Role) error {
+	role.CreatedAt = time.Now()
+	role.UpdatedAt = time.Now()
+	_, err := r.db.ModelContext(ctx, role).Returning("*").Insert()
+	return err
+}
+
+func (r Role) Update(ctx context.Context, role *model.Role, columns []string) error {
+	role.UpdatedAt = time.Now()
+	columns = append(columns, "updated_at")
+	_, err := r.db.ModelContext(ctx, role).
+		Column(columns...).
+		WherePK().
+		Returning("*").
+		Update()
+	return err
+}
+
+func (r Role) Delete(ctx context.Context, id int) error {
+	res, err := r.db.ExecContext(ctx, `WITH removed AS (
+		DELETE FROM user_role WHERE role_id = (SELECT id FROM role WHERE id = ?0 AND NOT builtin)
+	)
+	DELETE FROM role WHERE id = ?0 AND NOT builtin`, id)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return pg.ErrNoRows
+	}
+	return nil
+}
+
+func (r Role) IsNameExist(ctx context.Context, name string) (bool, error) {
+	return r.db.ModelContext(ctx, (*model.Role)(nil)).Where("name = ?", name).Exists()
+}
+
+func (r Role) ListPermissionsByUser(ctx context.Context, userId int) ([]string, error) {
+	var permissions []string
+	_, err := r.db.QueryContext(ctx, &permissions, `SELECT DISTINCT unnest(r.permissions)
+		FROM role r JOIN user_role ur ON ur.role_id = r.id
+		WHERE ur.user_id = ?`, userId)
+	if err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
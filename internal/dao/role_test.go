@@ -0,0 +1,97 @@
+package dao
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"testing"
+)
+
+func TestRoleDao(t *testing.T) {
+	pUsers, err := testdb.SeedUser(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dao := NewRole(db)
+	userDao := NewUser(db)
+	ctx := context.Background()
+
+	assistant := model.Role{
+		Name:        "teaching_assistant",
+		NickName:    "助教",
+		Permissions: []string{model.PermissionMaterialUpload, model.PermissionUserSearch},
+	}
+	if err := dao.Create(ctx, &assistant); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("内置角色", func(t *testing.T) {
+		at := assert.New(t)
+		roles, err := dao.List(ctx)
+		if at.Nil(err) && at.Len(roles, len(model.BuiltinRoles)+1) {
+			at.True(roles[0].Builtin)
+			at.Equal(assistant.Name, roles[len(roles)-1].Name)
+		}
+		admin, err := dao.GetByName(ctx, model.RoleAdmin)
+		if at.Nil(err) {
+			at.True(admin.Can(model.PermissionRoleManage))
+			// 内置角色不能删除
+			at.Equal(pg.ErrNoRows, dao.Delete(ctx, admin.Id))
+		}
+	})
+
+	t.Run("分配角色", func(t *testing.T) {
+		at := assert.New(t)
+		userId := pUsers[0].Id
+		at.Nil(userDao.SetRoles(ctx, userId, []string{model.RoleTeacher, assistant.Name, "unknown"}))
+		user, err := userDao.Get(ctx, userId)
+		if at.Nil(err) {
+			at.ElementsMatch([]string{model.RoleTeacher, assistant.Name}, user.RoleNames())
+		}
+		permissions, err := dao.ListPermissionsByUser(ctx, userId)
+		if at.Nil(err) {
+			// 两个角色都有 user.search，只返回一次
+			at.Len(permissions, len(model.BuiltinRoles[1].Permissions))
+			at.Contains(permissions, model.PermissionMaterialUpload)
+		}
+
+		users, count, err := userDao.ListAndCount(ctx, model.NewPage(1, 10), "", assistant.Name)
+		if at.Nil(err) && at.Equal(1, count) {
+			at.Equal(userId, users[0].Id)
+		}
+
+		at.Nil(userDao.SetRoles(ctx, userId, []string{assistant.Name}))
+		user, err = userDao.Get(ctx, userId)
+		if at.Nil(err) {
+			at.Equal([]string{assistant.Name}, user.RoleNames())
+		}
+	})
+
+	t.Run("修改权限", func(t *testing.T) {
+		at := assert.New(t)
+		role := model.Role{Id: assistant.Id, Permissions: []string{model.PermissionUserSearch}}
+		if at.Nil(dao.Update(ctx, &role, []string{"permissions"})) {
+			at.Equal(assistant.Name, role.Name)
+		}
+		permissions, err := dao.ListPermissionsByUser(ctx, pUsers[0].Id)
+		if at.Nil(err) {
+			at.Equal([]string{model.PermissionUserSearch}, permissions)
+		}
+	})
+
+	t.Run("删除角色时移除用户的角色", func(t *testing.T) {
+		at := assert.New(t)
+		at.Nil(dao.Delete(ctx, assistant.Id))
+		user, err := userDao.Get(ctx, pUsers[0].Id)
+		if at.Nil(err) {
+			at.Empty(user.Roles)
+		}
+		is, err := dao.IsNameExist(ctx, assistant.Name)
+		at.Nil(err)
+		at.False(is)
+	})
+
+	_ = testdb.Truncate(db)
+}
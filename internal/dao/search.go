@@ -0,0 +1,91 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"strings"
+)
+
+type ISearch interface {
+	// 在学习资料、科目、用户中全文检索，结果按相关度排序
+	SearchAndCount(ctx context.Context, p *model.Page, f *model.SearchFilter) ([]*model.SearchResult, int, error)
+}
+
+func NewSearch(db orm.DB) *Search {
+	return &Search{db: db}
+}
+
+type Search struct {
+	db orm.DB
+}
+
+func (s Search) SearchAndCount(ctx context.Context, p *model.Page, f *model.SearchFilter) ([]*model.SearchResult, int, error) {
+	results := []*model.SearchResult{}
+	tsquery := model.SearchQuery(f.Query)
+	if tsquery == "" {
+		return results, 0, nil
+	}
+
+	var parts []string
+	var params []interface{}
+	if searchType(f.Types, model.SearchTypeLearningMaterial) && (f.SubjectIds == nil || len(f.SubjectIds) > 0) {
+		part := `SELECT ? AS type, id, name AS title, description, ts_rank(search_vector, ?::tsquery) AS rank
+			FROM learning_material WHERE deleted_at IS NULL AND search_vector @@ ?::tsquery`
+		params = append(params, model.SearchTypeLearningMaterial, tsquery, tsquery)
+		if f.SubjectIds != nil {
+			part += " AND subject_id IN (?)"
+			params = append(params, pg.In(f.SubjectIds))
+		}
+		parts = append(parts, part)
+	}
+	if searchType(f.Types, model.SearchTypeSubject) {
+		parts = append(parts, `SELECT ? AS type, id, name AS title, description, ts_rank(search_vector, ?::tsquery) AS rank
+			FROM subject WHERE deleted_at IS NULL AND search_vector @@ ?::tsquery`)
+		params = append(params, model.SearchTypeSubject, tsquery, tsquery)
+	}
+	if searchType(f.Types, model.SearchTypeUser) {
+		parts = append(parts, `SELECT ? AS type, id, name AS title, nick_name AS description, ts_rank(search_vector, ?::tsquery) AS rank
+			FROM "user" WHERE deleted_at IS NULL AND search_vector @@ ?::tsquery`)
+		params = append(params, model.SearchTypeUser, tsquery, tsquery)
+	}
+	if len(parts) == 0 {
+		return results, 0, nil
+	}
+
+	union := strings.Join(parts, " UNION ALL ")
+
+	var count int
+	_, err := s.db.QueryOneContext(ctx, pg.Scan(&count), fmt.Sprintf("SELECT count(*) FROM (%s) AS r", union), params...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	params = append(params, p.Limit(), p.Offset())
+	_, err = s.db.QueryContext(ctx, &results, fmt.Sprintf("SELECT * FROM (%s) AS r ORDER BY rank DESC, type, id LIMIT ? OFFSET ?", union), params...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return results, count, nil
+}
+
+func searchType(types []string, t string) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, v := range types {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// 重新生成全文检索字段并保存，m 中需要包含参与检索的全部字段
+func updateSearchVector(ctx context.Context, db orm.DB, m model.Searchable) error {
+	m.RefreshSearchVector()
+	_, err := db.ModelContext(ctx, m).Column("search_vector").WherePK().Update()
+	return err
+}
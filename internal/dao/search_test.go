@@ -0,0 +1,79 @@
+package dao
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"testing"
+)
+
+func TestSearchDao_SearchAndCount(t *testing.T) {
+	_, pSubjects, pUsers := prepareLearningMaterial(t, db)
+	lmDao := NewLearningMaterial(db)
+	dao := NewSearch(db)
+	ctx := context.Background()
+
+	createdById := pUsers[0].Id
+	subjectId := pSubjects[0].Id
+	lm1, err := lmDao.Create(ctx, createdById, subjectId, "原子钟工作原理", "介绍铯原子钟", "md5-search-1", "search/1.pdf")
+	assert.Nil(t, err)
+	lm2, err := lmDao.Create(ctx, createdById, pSubjects[1].Id, "阿伦方差", "频率稳定度分析中的原子钟指标", "md5-search-2", "search/2.pdf")
+	assert.Nil(t, err)
+
+	t.Run("搜索词为空", func(t *testing.T) {
+		results, count, err := dao.SearchAndCount(ctx, model.NewPage(1, 10), &model.SearchFilter{Query: "  "})
+		assert.Nil(t, err)
+		assert.Zero(t, count)
+		assert.Empty(t, results)
+	})
+
+	t.Run("标题命中排在描述命中之前", func(t *testing.T) {
+		at := assert.New(t)
+		results, count, err := dao.SearchAndCount(ctx, model.NewPage(1, 10), &model.SearchFilter{
+			Query: "原子钟",
+			Types: []string{model.SearchTypeLearningMaterial},
+		})
+		at.Nil(err)
+		at.Equal(2, count)
+		at.Len(results, 2)
+		at.Equal(lm1.Id, results[0].Id)
+		at.Equal(lm2.Id, results[1].Id)
+		at.Equal(model.SearchTypeLearningMaterial, results[0].Type)
+	})
+
+	t.Run("按科目过滤", func(t *testing.T) {
+		at := assert.New(t)
+		results, count, err := dao.SearchAndCount(ctx, model.NewPage(1, 10), &model.SearchFilter{
+			Query:      "原子钟",
+			SubjectIds: []int{subjectId},
+		})
+		at.Nil(err)
+		at.Equal(1, count)
+		at.Equal(lm1.Id, results[0].Id)
+
+		results, count, err = dao.SearchAndCount(ctx, model.NewPage(1, 10), &model.SearchFilter{
+			Query:      "原子钟",
+			Types:      []string{model.SearchTypeLearningMaterial},
+			SubjectIds: []int{},
+		})
+		at.Nil(err)
+		at.Zero(count)
+		at.Empty(results)
+	})
+
+	t.Run("修改后重新索引", func(t *testing.T) {
+		at := assert.New(t)
+		_, err := lmDao.Update(ctx, lm2.Id, createdById, "频率稳定度", "")
+		at.Nil(err)
+		results, count, err := dao.SearchAndCount(ctx, model.NewPage(1, 10), &model.SearchFilter{
+			Query: "原子钟",
+			Types: []string{model.SearchTypeLearningMaterial},
+		})
+		at.Nil(err)
+		at.Equal(1, count)
+		at.Equal(lm1.Id, results[0].Id)
+	})
+
+	_ = testdb.Truncate(db)
+}
@@ -0,0 +1,118 @@
+package dao
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"time"
+)
+
+type ISession interface {
+	Create(ctx context.Context, session *model.Session) error
+	// 获取有效的会话，已作废或已过期时返回 pg.ErrNoRows
+	GetActive(ctx context.Context, id int) (*model.Session, error)
+	// 用户所有有效的会话，按最近使用时间倒序
+	ListActive(ctx context.Context, userId int) ([]*model.Session, error)
+	// 刷新 token 后延长会话的过期时间
+	Renew(ctx context.Context, id int, expiresAt time.Time) error
+	// 更新最近使用时间，距离上次更新不足 interval 时不更新，避免每个请求都写数据库
+	Touch(ctx context.Context, id int, interval time.Duration) error
+	Revoke(ctx context.Context, id int) error
+	// 作废用户所有的会话，返回作废的数量
+	RevokeByUser(ctx context.Context, userId int) (int, error)
+	// 删除过期时间早于 before 的会话，返回删除的数量
+	DeleteExpired(ctx context.Context, before time.Time) (int, error)
+}
+
+func NewSession(db orm.DB) *Session {
+	return &Session{db: db}
+}
+
+type Session struct {
+	db orm.DB
+}
+
+func (s Session) Create(ctx context.Context, session *model.Session) error {
+	session.CreatedAt = time.Now()
+	session.LastSeenAt = session.CreatedAt
+	_, err := s.db.ModelContext(ctx, session).Returning("*").Insert()
+	return err
+}
+
+func (s Session) GetActive(ctx context.Context, id int) (*model.Session, error) {
+	session := model.Session{Id: id}
+	err := s.db.ModelContext(ctx, &session).
+		WherePK().
+		Where("revoked_at IS NULL").
+		Where("expires_at > ?", time.Now()).
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (s Session) ListActive(ctx context.Context, userId int) ([]*model.Session, error) {
+	sessions := []*model.Session{}
+	err := s.db.ModelContext(ctx, &sessions).
+		Where("user_id = ?", userId).
+		Where("revoked_at IS NULL").
+		Where("expires_at > ?", time.Now()).
+		Order("last_seen_at DESC").
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (s Session) Renew(ctx context.Context, id int, expiresAt time.Time) error {
+	_, err := s.db.ModelContext(ctx, (*model.Session)(nil)).
+		Set("expires_at = ?", expiresAt).
+		Set("last_seen_at = ?", time.Now()).
+		Where("id = ?", id).
+		Update()
+	return err
+}
+
+func (s Session) Touch(ctx context.Context, id int, interval time.Duration) error {
+	now := time.Now()
+	_, err := s.db.ModelContext(ctx, (*model.Session)(nil)).
+		Set("last_seen_at = ?", now).
+		Where("id = ?", id).
+		Where("last_seen_at < ?", now.Add(-interval)).
+		Update()
+	return err
+}
+
+func (s Session) Revoke(ctx context.Context, id int) error {
+	_, err := s.db.ModelContext(ctx, (*model.Session)(nil)).
+		Set("revoked_at = ?", time.Now()).
+		Where("id = ?", id).
+		Where("revoked_at IS NULL").
+		Update()
+	return err
+}
+
+func (s Session) RevokeByUser(ctx context.Context, userId int) (int, error) {
+	res, err := s.db.ModelContext(ctx, (*model.Session)(nil)).
+		Set("revoked_at = ?", time.Now()).
+		Where("user_id = ?", userId).
+		Where("revoked_at IS NULL").
+		Where("expires_at > ?", time.Now()).
+		Update()
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+func (s Session) DeleteExpired(ctx context.Context, before time.Time) (int, error) {
+	res, err := s.db.ModelContext(ctx, (*model.Session)(nil)).
+		Where("expires_at < ?", before).
+		Delete()
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
@@ -0,0 +1,90 @@
+package dao
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"testing"
+	"time"
+)
+
+func TestSessionDao(t *testing.T) {
+	pUsers, err := testdb.SeedUser(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dao := NewSession(db)
+	ctx := context.Background()
+	userId := pUsers[0].Id
+
+	var sessions []*model.Session
+	for _, expiresAt := range []time.Time{time.Now().Add(time.Hour), time.Now().Add(time.Hour), time.Now().Add(-time.Hour)} {
+		session := model.Session{
+			Device:    "Windows · Chrome",
+			Ip:        "127.0.0.1",
+			ExpiresAt: expiresAt,
+			UserId:    userId,
+		}
+		if err := dao.Create(ctx, &session); err != nil {
+			t.Fatal(err)
+		}
+		sessions = append(sessions, &session)
+	}
+
+	t.Run("查询有效的会话", func(t *testing.T) {
+		at := assert.New(t)
+		_, err := dao.GetActive(ctx, sessions[0].Id)
+		at.Nil(err)
+		// 已过期
+		_, err = dao.GetActive(ctx, sessions[2].Id)
+		at.Equal(pg.ErrNoRows, err)
+
+		at.Nil(dao.Renew(ctx, sessions[1].Id, time.Now().Add(2*time.Hour)))
+		list, err := dao.ListActive(ctx, userId)
+		if at.Nil(err) && at.Len(list, 2) {
+			// 最近使用的在前
+			at.Equal(sessions[1].Id, list[0].Id)
+		}
+	})
+
+	t.Run("更新最近使用时间", func(t *testing.T) {
+		at := assert.New(t)
+		at.Nil(dao.Touch(ctx, sessions[0].Id, time.Hour))
+		session, err := dao.GetActive(ctx, sessions[0].Id)
+		if at.Nil(err) {
+			// 距离上次更新不足 interval，不更新
+			at.True(session.LastSeenAt.Equal(sessions[0].LastSeenAt))
+		}
+		at.Nil(dao.Touch(ctx, sessions[0].Id, 0))
+		session, err = dao.GetActive(ctx, sessions[0].Id)
+		if at.Nil(err) {
+			at.True(session.LastSeenAt.After(sessions[0].LastSeenAt))
+		}
+	})
+
+	t.Run("作废", func(t *testing.T) {
+		at := assert.New(t)
+		at.Nil(dao.Revoke(ctx, sessions[0].Id))
+		_, err := dao.GetActive(ctx, sessions[0].Id)
+		at.Equal(pg.ErrNoRows, err)
+
+		// 已作废和已过期的不计入
+		n, err := dao.RevokeByUser(ctx, userId)
+		at.Nil(err)
+		at.Equal(1, n)
+		list, err := dao.ListActive(ctx, userId)
+		at.Nil(err)
+		at.Empty(list)
+	})
+
+	t.Run("删除过期的", func(t *testing.T) {
+		at := assert.New(t)
+		n, err := dao.DeleteExpired(ctx, time.Now())
+		at.Nil(err)
+		at.Equal(1, n)
+	})
+
+	_ = testdb.Truncate(db)
+}
@@ -2,6 +2,7 @@ package dao
 
 import (
 	"context"
+	"github.com/go-pg/pg/v10"
 	"github.com/go-pg/pg/v10/orm"
 	"github.com/xuxusheng/time-frequency-be/internal/model"
 
@@ -11,9 +12,17 @@ import (
 type ISubject interface {
 	Create(ctx context.Context, createdById int, name, description string) (*model.Subject, error)
 	Get(ctx context.Context, id int) (*model.Subject, error)
+	ListAndCount(ctx context.Context, p *model.Page, query string) ([]*model.Subject, int, error)
+	CountLearningMaterials(ctx context.Context, ids []int) (map[int]int, error) // 统计各科目下的学习资料数量，key 为科目 ID
 	Update(ctx context.Context, id int, name, description string) (*model.Subject, error)
-	Delete(ctx context.Context, id int) error
+	Delete(ctx context.Context, id int) error      // 移入回收站
+	ForceDelete(ctx context.Context, id int) error // 彻底删除，不论是否在回收站中
 	IsNameExist(ctx context.Context, name string, excludeId int) (bool, error)
+
+	ListIdsByClass(ctx context.Context, classId int) ([]int, error)    // 班级已选科目的 ID
+	ListIdsTaughtBy(ctx context.Context, teacherId int) ([]int, error) // 老师所教科目的 ID，包括自己创建的科目和任教班级已选的科目
+	ClearClasses(ctx context.Context, id int) error                    // 删除科目与班级的关联
+	HasLearningMaterials(ctx context.Context, id int) (bool, error)    // 科目下是否还有资料，包括回收站中的
 }
 
 func NewSubject(db orm.DB) *Subject {
@@ -48,6 +57,52 @@ func (s Subject) Get(ctx context.Context, id int) (*model.Subject, error) {
 	return &subject, err
 }
 
+func (s Subject) ListAndCount(ctx context.Context, p *model.Page, query string) ([]*model.Subject, int, error) {
+	subjects := []*model.Subject{}
+	db := s.db.ModelContext(ctx, &subjects).
+		Offset(p.Offset()).
+		Limit(p.Limit())
+	if query != "" {
+		// 全文检索，按相关度排序
+		tsquery := model.SearchQuery(query)
+		if tsquery == "" {
+			return subjects, 0, nil
+		}
+		db = db.Where("search_vector @@ ?::tsquery", tsquery).
+			OrderExpr("ts_rank(search_vector, ?::tsquery) DESC", tsquery)
+	}
+	db = db.Order("created_at DESC")
+	count, err := db.SelectAndCount()
+	if err != nil {
+		return nil, 0, err
+	}
+	return subjects, count, nil
+}
+
+func (s Subject) CountLearningMaterials(ctx context.Context, ids []int) (map[int]int, error) {
+	counts := make(map[int]int, len(ids))
+	if len(ids) == 0 {
+		return counts, nil
+	}
+	var rows []struct {
+		SubjectId int
+		Count     int
+	}
+	err := s.db.ModelContext(ctx, (*model.LearningMaterial)(nil)).
+		Column("subject_id").
+		ColumnExpr("count(*) AS count").
+		Where("subject_id IN (?)", pg.In(ids)).
+		Group("subject_id").
+		Select(&rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.SubjectId] = row.Count
+	}
+	return counts, nil
+}
+
 func (s Subject) Update(ctx context.Context, id int, name, description string) (*model.Subject, error) {
 	subject := model.Subject{
 		Id: id, Name: name, Description: description, UpdatedAt: time.Now(),
@@ -56,6 +111,10 @@ func (s Subject) Update(ctx context.Context, id int, name, description string) (
 	if err != nil {
 		return nil, err
 	}
+	err = updateSearchVector(ctx, s.db, &subject)
+	if err != nil {
+		return nil, err
+	}
 	return &subject, err
 }
 
@@ -64,6 +123,11 @@ func (s Subject) Delete(ctx context.Context, id int) error {
 	return err
 }
 
+func (s Subject) ForceDelete(ctx context.Context, id int) error {
+	_, err := s.db.ModelContext(ctx, &model.Subject{Id: id}).WherePK().AllWithDeleted().ForceDelete()
+	return err
+}
+
 func (s Subject) IsNameExist(ctx context.Context, name string, excludeId int) (bool, error) {
 	db := s.db.ModelContext(ctx, &model.Subject{})
 	if excludeId != 0 {
@@ -71,3 +135,50 @@ func (s Subject) IsNameExist(ctx context.Context, name string, excludeId int) (b
 	}
 	return db.Where("name = ?", name).Exists()
 }
+
+func (s Subject) ListIdsByClass(ctx context.Context, classId int) ([]int, error) {
+	ids := []int{}
+	err := s.db.ModelContext(ctx, (*model.ClassSubject)(nil)).
+		Column("subject_id").
+		Where("class_id = ?", classId).
+		// 班级或科目在回收站中时，关联虽然保留但不生效
+		Where("class_id IN (SELECT id FROM class WHERE deleted_at IS NULL)").
+		Where("subject_id IN (SELECT id FROM subject WHERE deleted_at IS NULL)").
+		Select(&ids)
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// 老师自己创建的科目，以及老师任教的班级所选的科目，都算作老师所教的科目
+func (s Subject) ListIdsTaughtBy(ctx context.Context, teacherId int) ([]int, error) {
+	ids := []int{}
+	_, err := s.db.QueryContext(ctx, &ids, `
+		SELECT id FROM subject WHERE created_by_id = ?0 AND deleted_at IS NULL
+		UNION
+		SELECT cs.subject_id FROM class_subject AS cs
+		JOIN class AS c ON c.id = cs.class_id AND c.deleted_at IS NULL
+		JOIN subject AS s ON s.id = cs.subject_id AND s.deleted_at IS NULL
+		JOIN class_teacher AS ct ON ct.class_id = c.id
+		WHERE ct.user_id = ?0
+	`, teacherId)
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (s Subject) ClearClasses(ctx context.Context, id int) error {
+	_, err := s.db.ModelContext(ctx, (*model.ClassSubject)(nil)).
+		Where("subject_id = ?", id).
+		Delete()
+	return err
+}
+
+func (s Subject) HasLearningMaterials(ctx context.Context, id int) (bool, error) {
+	return s.db.ModelContext(ctx, (*model.LearningMaterial)(nil)).
+		AllWithDeleted().
+		Where("subject_id = ?", id).
+		Exists()
+}
@@ -160,3 +160,69 @@ func TestSubjectDao_Delete(t *testing.T) {
 
 	_ = testdb.Truncate(db)
 }
+
+func TestSubjectDao_ListAndCount(t *testing.T) {
+	pSubjects, _ := prepareSubject(t, db)
+	dao := NewSubject(db)
+
+	t.Run("查询全部科目", func(t *testing.T) {
+		subjects, count, err := dao.ListAndCount(context.Background(), model.NewPage(1, 100), "")
+		if assert.Nil(t, err) {
+			assert.Equal(t, len(pSubjects), count)
+			assert.Len(t, subjects, len(pSubjects))
+		}
+	})
+
+	t.Run("按名称搜索", func(t *testing.T) {
+		for _, pSubject := range pSubjects {
+			subjects, count, err := dao.ListAndCount(context.Background(), model.NewPage(1, 100), pSubject.Name)
+			if assert.Nil(t, err) {
+				assert.Equal(t, 1, count)
+				assert.Equal(t, pSubject.Id, subjects[0].Id)
+			}
+		}
+	})
+
+	t.Run("搜索不存在的科目", func(t *testing.T) {
+		subjects, count, err := dao.ListAndCount(context.Background(), model.NewPage(1, 100), time.Now().String())
+		if assert.Nil(t, err) {
+			assert.Zero(t, count)
+			assert.Empty(t, subjects)
+		}
+	})
+
+	_ = testdb.Truncate(db)
+}
+
+func TestSubjectDao_CountLearningMaterials(t *testing.T) {
+	pls, pSubjects, _ := prepareLearningMaterial(t, db)
+	dao := NewSubject(db)
+
+	expected := map[int]int{}
+	for _, pl := range pls {
+		expected[pl.SubjectId]++
+	}
+
+	ids := make([]int, 0, len(pSubjects))
+	for _, pSubject := range pSubjects {
+		ids = append(ids, pSubject.Id)
+	}
+
+	t.Run("正常统计", func(t *testing.T) {
+		counts, err := dao.CountLearningMaterials(context.Background(), ids)
+		if assert.Nil(t, err) {
+			for _, id := range ids {
+				assert.Equal(t, expected[id], counts[id])
+			}
+		}
+	})
+
+	t.Run("ID列表为空", func(t *testing.T) {
+		counts, err := dao.CountLearningMaterials(context.Background(), nil)
+		if assert.Nil(t, err) {
+			assert.Empty(t, counts)
+		}
+	})
+
+	_ = testdb.Truncate(db)
+}
@@ -0,0 +1,19 @@
+package dao
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// 在事务中执行需要多条语句的写操作
+// db 已经是事务时直接在其中执行，go-pg 的 Tx.RunInTransaction 会提前提交外层事务，不能嵌套使用
+func runInTransaction(ctx context.Context, db orm.DB, fn func(tx orm.DB) error) error {
+	d, ok := db.(*pg.DB)
+	if !ok {
+		return fn(db)
+	}
+	return d.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		return fn(tx)
+	})
+}
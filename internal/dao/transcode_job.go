@@ -0,0 +1,184 @@
+package dao
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"time"
+)
+
+type ITranscodeJob interface {
+	// 为当前文件是视频、还没有转码任务的资料创建任务，exts 为视频的扩展名，返回创建的数量
+	CreateMissing(ctx context.Context, exts []string) (int, error)
+	Get(ctx context.Context, id int) (*model.TranscodeJob, error)
+	GetByLearningMaterial(ctx context.Context, learningMaterialId int, md5 string) (*model.TranscodeJob, error)
+	GetDoneByMd5(ctx context.Context, md5 string) (*model.TranscodeJob, error) // 任意一个内容相同且已完成的任务，用于复用转码结果
+	// 领取一个等待执行或者租约已过期的任务，标记为执行中并把租约设置为 lease 之后，没有任务时返回 pg.ErrNoRows
+	Claim(ctx context.Context, lease time.Duration) (*model.TranscodeJob, error)
+	Heartbeat(ctx context.Context, id int, lease time.Duration) error // 续期
+	Finish(ctx context.Context, id int, renditions, files []string) error
+	// 记录失败，retry 为 true 时回到等待执行状态，否则标记为失败
+	Fail(ctx context.Context, id int, errMsg string, retry bool) error
+	Reset(ctx context.Context, id int) (*model.TranscodeJob, error)             // 重新执行失败的任务，清空已执行次数
+	ListOrphaned(ctx context.Context, limit int) ([]*model.TranscodeJob, error) // 资料已经被删除的任务
+	Delete(ctx context.Context, id int) error
+	IsMd5Used(ctx context.Context, md5 string, excludeId int) (bool, error) // 是否还有其他任务使用同一份转码结果
+}
+
+func NewTranscodeJob(db orm.DB) *TranscodeJob {
+	return &TranscodeJob{db: db}
+}
+
+type TranscodeJob struct {
+	db orm.DB
+}
+
+func (t TranscodeJob) CreateMissing(ctx context.Context, exts []string) (int, error) {
+	if len(exts) == 0 {
+		return 0, nil
+	}
+	res, err := t.db.ExecContext(ctx, `INSERT INTO transcode_job (learning_material_id, md5, status, created_at, updated_at)
+		SELECT id, md5, ?, now(), now() FROM learning_material
+		WHERE deleted_at IS NULL AND lower(substring(file_path FROM '\.[^./]*$')) IN (?)
+		ON CONFLICT (learning_material_id, md5) DO NOTHING`, model.TranscodeStatusPending, pg.In(exts))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+func (t TranscodeJob) Get(ctx context.Context, id int) (*model.TranscodeJob, error) {
+	job := model.TranscodeJob{Id: id}
+	err := t.db.ModelContext(ctx, &job).WherePK().Select()
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (t TranscodeJob) GetByLearningMaterial(ctx context.Context, learningMaterialId int, md5 string) (*model.TranscodeJob, error) {
+	job := model.TranscodeJob{}
+	err := t.db.ModelContext(ctx, &job).
+		Where("learning_material_id = ?", learningMaterialId).
+		Where("md5 = ?", md5).
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (t TranscodeJob) GetDoneByMd5(ctx context.Context, md5 string) (*model.TranscodeJob, error) {
+	job := model.TranscodeJob{}
+	err := t.db.ModelContext(ctx, &job).
+		Where("md5 = ?", md5).
+		Where("status = ?", model.TranscodeStatusDone).
+		Order("id").
+		Limit(1).
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (t TranscodeJob) Claim(ctx context.Context, lease time.Duration) (*model.TranscodeJob, error) {
+	job := model.TranscodeJob{}
+	// SKIP LOCKED 保证多个进程同时领取时不会拿到同一个任务
+	_, err := t.db.QueryOneContext(ctx, &job, `UPDATE transcode_job
+		SET status = ?, attempts = attempts + 1, started_at = now(), locked_until = now() + ? * interval '1 second', updated_at = now()
+		WHERE id = (
+			SELECT id FROM transcode_job
+			WHERE status = ? OR (status = ? AND locked_until < now())
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		model.TranscodeStatusRunning, int(lease.Seconds()), model.TranscodeStatusPending, model.TranscodeStatusRunning)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (t TranscodeJob) Heartbeat(ctx context.Context, id int, lease time.Duration) error {
+	_, err := t.db.ModelContext(ctx, (*model.TranscodeJob)(nil)).
+		Set("locked_until = now() + ? * interval '1 second'", int(lease.Seconds())).
+		Where("id = ?", id).
+		Where("status = ?", model.TranscodeStatusRunning).
+		Update()
+	return err
+}
+
+func (t TranscodeJob) Finish(ctx context.Context, id int, renditions, files []string) error {
+	_, err := t.db.ModelContext(ctx, (*model.TranscodeJob)(nil)).
+		Set("status = ?", model.TranscodeStatusDone).
+		Set("error = ''").
+		Set("renditions = ?", pg.Array(renditions)).
+		Set("files = ?", pg.Array(files)).
+		Set("finished_at = now()").
+		Set("locked_until = NULL").
+		Set("updated_at = now()").
+		Where("id = ?", id).
+		Update()
+	return err
+}
+
+func (t TranscodeJob) Fail(ctx context.Context, id int, errMsg string, retry bool) error {
+	status := model.TranscodeStatusFailed
+	if retry {
+		status = model.TranscodeStatusPending
+	}
+	_, err := t.db.ModelContext(ctx, (*model.TranscodeJob)(nil)).
+		Set("status = ?", status).
+		Set("error = ?", errMsg).
+		Set("locked_until = NULL").
+		Set("updated_at = now()").
+		Where("id = ?", id).
+		Update()
+	return err
+}
+
+func (t TranscodeJob) Reset(ctx context.Context, id int) (*model.TranscodeJob, error) {
+	job := model.TranscodeJob{}
+	_, err := t.db.ModelContext(ctx, &job).
+		Set("status = ?", model.TranscodeStatusPending).
+		Set("attempts = 0").
+		Set("error = ''").
+		Set("updated_at = now()").
+		Where("id = ?", id).
+		Returning("*").
+		Update()
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (t TranscodeJob) ListOrphaned(ctx context.Context, limit int) ([]*model.TranscodeJob, error) {
+	jobs := []*model.TranscodeJob{}
+	err := t.db.ModelContext(ctx, &jobs).
+		Where("NOT EXISTS (SELECT 1 FROM learning_material AS lm WHERE lm.id = transcode_job.learning_material_id)").
+		Where("status <> ?", model.TranscodeStatusRunning).
+		Order("id").
+		Limit(limit).
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (t TranscodeJob) Delete(ctx context.Context, id int) error {
+	_, err := t.db.ModelContext(ctx, &model.TranscodeJob{Id: id}).WherePK().Delete()
+	return err
+}
+
+func (t TranscodeJob) IsMd5Used(ctx context.Context, md5 string, excludeId int) (bool, error) {
+	return t.db.ModelContext(ctx, (*model.TranscodeJob)(nil)).
+		Where("md5 = ?", md5).
+		Where("id <> ?", excludeId).
+		Exists()
+}
@@ -0,0 +1,112 @@
+package dao
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"testing"
+	"time"
+)
+
+func TestTranscodeJobDao(t *testing.T) {
+	_, pSubjects, pUsers := prepareLearningMaterial(t, db)
+	lmDao := NewLearningMaterial(db)
+	dao := NewTranscodeJob(db)
+	ctx := context.Background()
+
+	createdById := pUsers[0].Id
+	subjectId := pSubjects[0].Id
+	video, err := lmDao.Create(ctx, createdById, subjectId, time.Now().String(), "", "md5-video", "mv/md5-video.MP4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = lmDao.Create(ctx, createdById, subjectId, time.Now().String(), "", "md5-pdf", "mp/md5-pdf.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exts := []string{".mp4", ".mov"}
+
+	t.Run("只为视频创建任务", func(t *testing.T) {
+		at := assert.New(t)
+		n, err := dao.CreateMissing(ctx, exts)
+		at.Nil(err)
+		at.Equal(1, n)
+		// 重复执行不会重复创建
+		n, err = dao.CreateMissing(ctx, exts)
+		at.Nil(err)
+		at.Zero(n)
+
+		job, err := dao.GetByLearningMaterial(ctx, video.Id, video.Md5)
+		at.Nil(err)
+		at.Equal(model.TranscodeStatusPending, job.Status)
+	})
+
+	t.Run("领取和租约", func(t *testing.T) {
+		at := assert.New(t)
+		job, err := dao.Claim(ctx, time.Minute)
+		if !at.Nil(err) {
+			return
+		}
+		at.Equal(video.Id, job.LearningMaterialId)
+		at.Equal(model.TranscodeStatusRunning, job.Status)
+		at.Equal(1, job.Attempts)
+
+		// 租约未过期，其他进程领取不到
+		_, err = dao.Claim(ctx, time.Minute)
+		at.Equal(pg.ErrNoRows, err)
+
+		// 模拟进程退出，租约过期后可以被重新领取
+		_, err = db.ExecContext(ctx, "UPDATE transcode_job SET locked_until = now() - interval '1 second' WHERE id = ?", job.Id)
+		at.Nil(err)
+		job, err = dao.Claim(ctx, time.Minute)
+		at.Nil(err)
+		at.Equal(2, job.Attempts)
+
+		at.Nil(dao.Fail(ctx, job.Id, "出错了", false))
+		job, err = dao.Get(ctx, job.Id)
+		at.Nil(err)
+		at.Equal(model.TranscodeStatusFailed, job.Status)
+		at.Equal("出错了", job.Error)
+		_, err = dao.Claim(ctx, time.Minute)
+		at.Equal(pg.ErrNoRows, err)
+
+		job, err = dao.Reset(ctx, job.Id)
+		at.Nil(err)
+		at.Equal(model.TranscodeStatusPending, job.Status)
+		at.Zero(job.Attempts)
+
+		job, err = dao.Claim(ctx, time.Minute)
+		at.Nil(err)
+		at.Nil(dao.Finish(ctx, job.Id, []string{"360p"}, []string{"hls/md5-video/master.m3u8"}))
+		job, err = dao.GetDoneByMd5(ctx, video.Md5)
+		at.Nil(err)
+		at.Equal([]string{"360p"}, job.Renditions)
+		at.Equal([]string{"hls/md5-video/master.m3u8"}, job.Files)
+	})
+
+	t.Run("资料彻底删除后成为孤儿任务", func(t *testing.T) {
+		at := assert.New(t)
+		jobs, err := dao.ListOrphaned(ctx, 10)
+		at.Nil(err)
+		at.Empty(jobs)
+
+		// 在回收站中时还可能恢复，任务保留
+		at.Nil(lmDao.Delete(ctx, video.Id))
+		jobs, err = dao.ListOrphaned(ctx, 10)
+		at.Nil(err)
+		at.Empty(jobs)
+
+		at.Nil(lmDao.ForceDelete(ctx, video.Id))
+		jobs, err = dao.ListOrphaned(ctx, 10)
+		at.Nil(err)
+		if at.Len(jobs, 1) {
+			used, err := dao.IsMd5Used(ctx, jobs[0].Md5, jobs[0].Id)
+			at.Nil(err)
+			at.False(used)
+		}
+	})
+
+	_ = testdb.Truncate(db)
+}
@@ -0,0 +1,79 @@
+package dao
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"time"
+)
+
+type IUpload interface {
+	Create(ctx context.Context, upload *model.Upload) error
+	Get(ctx context.Context, id string) (*model.Upload, error)
+	// 追加一个分片，只有当前 offset 与传入的 offset 一致时才会更新，返回是否更新成功
+	AppendPart(ctx context.Context, id string, offset, size int64, key string) (bool, error)
+	SetLearningMaterialId(ctx context.Context, id string, learningMaterialId int) error
+	Delete(ctx context.Context, id string) error
+	ListExpired(ctx context.Context, before time.Time) ([]*model.Upload, error)
+}
+
+func NewUpload(db orm.DB) *Upload {
+	return &Upload{db: db}
+}
+
+type Upload struct {
+	db orm.DB
+}
+
+func (u Upload) Create(ctx context.Context, upload *model.Upload) error {
+	upload.CreatedAt = time.Now()
+	upload.UpdatedAt = time.Now()
+	_, err := u.db.ModelContext(ctx, upload).Returning("*").Insert()
+	return err
+}
+
+func (u Upload) Get(ctx context.Context, id string) (*model.Upload, error) {
+	upload := model.Upload{Id: id}
+	err := u.db.ModelContext(ctx, &upload).WherePK().Select()
+	if err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+func (u Upload) AppendPart(ctx context.Context, id string, offset, size int64, key string) (bool, error) {
+	res, err := u.db.ModelContext(ctx, (*model.Upload)(nil)).
+		Set("upload_offset = upload_offset + ?", size).
+		Set("parts = array_append(parts, ?)", key).
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", id).
+		Where("upload_offset = ?", offset).
+		Update()
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() == 1, nil
+}
+
+func (u Upload) SetLearningMaterialId(ctx context.Context, id string, learningMaterialId int) error {
+	_, err := u.db.ModelContext(ctx, (*model.Upload)(nil)).
+		Set("learning_material_id = ?", learningMaterialId).
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", id).
+		Update()
+	return err
+}
+
+func (u Upload) Delete(ctx context.Context, id string) error {
+	_, err := u.db.ModelContext(ctx, &model.Upload{Id: id}).WherePK().Delete()
+	return err
+}
+
+func (u Upload) ListExpired(ctx context.Context, before time.Time) ([]*model.Upload, error) {
+	uploads := []*model.Upload{}
+	err := u.db.ModelContext(ctx, &uploads).Where("expires_at < ?", before).Select()
+	if err != nil {
+		return nil, err
+	}
+	return uploads, nil
+}
@@ -2,11 +2,15 @@ package dao
 
 import (
 	"context"
+	"github.com/go-pg/pg/v10"
 	"github.com/go-pg/pg/v10/orm"
 	"github.com/xuxusheng/time-frequency-be/internal/model"
 	"time"
 )
 
+// 用户拥有某个角色，在用户表的查询中使用
+const hasRoleCondition = `EXISTS (SELECT 1 FROM user_role ur JOIN role r ON r.id = ur.role_id WHERE ur.user_id = "user".id AND r.name = ?)`
+
 type IUser interface {
 	// 创建用户
 	Create(ctx context.Context, user *model.User) error
@@ -14,12 +18,33 @@ type IUser interface {
 	Get(ctx context.Context, id int) (*model.User, error)
 	// 通过 Name 获取用户
 	GetByName(ctx context.Context, name string) (*model.User, error)
-	// 获取多个用户
+	// 通过 Email 获取用户
+	GetByEmail(ctx context.Context, email string) (*model.User, error)
+	// 通过单点登录账号的 sub 获取用户
+	GetByOidcSubject(ctx context.Context, subject string) (*model.User, error)
+	// 获取多个用户，role 不为空时只返回拥有这个角色的用户
 	ListAndCount(ctx context.Context, p *model.Page, query, role string) ([]*model.User, int, error)
+	// 获取老师任教班级中拥有某个角色的用户
+	ListAndCountByTeacher(ctx context.Context, p *model.Page, query, role string, teacherId int) ([]*model.User, int, error)
+	// 按 id 顺序分批获取用户，用于导出，条件与 ListAndCount 相同，teacherId 不为 0 时只获取老师任教班级中的用户
+	// afterId 为上一批最后一个用户的 id，第一批传 0
+	ListForExport(ctx context.Context, query, role string, teacherId, afterId, limit int) ([]*model.User, error)
+	// 符合导出条件的用户数量
+	CountForExport(ctx context.Context, query, role string, teacherId int) (int, error)
+	// 设置用户的角色，不在 names 中的角色会被移除，names 为空时移除所有角色
+	SetRoles(ctx context.Context, id int, names []string) error
 	// 更新用户信息
 	Update(ctx context.Context, user *model.User, columns []string) error
-	// 删除用户
+	// token 版本加一，返回新的版本，之前签发的 token 全部失效
+	IncrTokenVersion(ctx context.Context, id int) (int, error)
+	// 记录使用了某个周期的两步验证码，这个周期已经用过时返回 false
+	UseTotpStep(ctx context.Context, id int, step int64) (bool, error)
+	// 删除用户，移入回收站
 	Delete(ctx context.Context, id int) error
+	// 彻底删除用户，不论是否在回收站中
+	ForceDelete(ctx context.Context, id int) error
+	// 用户是否还被其他数据引用，例如作为创建人，被引用时不能彻底删除
+	IsReferenced(ctx context.Context, id int) (bool, error)
 	// 用户名是否存在
 	IsNameExist(ctx context.Context, name string, excludeId int) (bool, error)
 	// 手机号是否存在
@@ -41,16 +66,29 @@ type User struct {
 func (u *User) Create(ctx context.Context, user *model.User) error {
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
-	_, err := u.db.ModelContext(ctx, user).Returning("*").Insert()
-	if err != nil {
-		return err
-	}
-	return nil
+	// 分配角色失败时不留下没有角色的用户
+	return runInTransaction(ctx, u.db, func(tx orm.DB) error {
+		_, err := tx.ModelContext(ctx, user).Returning("*").Insert()
+		if err != nil {
+			return err
+		}
+		// 创建时可以通过 Roles 中的角色标识同时分配角色
+		if len(user.Roles) == 0 {
+			return nil
+		}
+		names := user.RoleNames()
+		err = NewUser(tx).SetRoles(ctx, user.Id, names)
+		if err != nil {
+			return err
+		}
+		user.Roles = nil
+		return tx.ModelContext(ctx, &user.Roles).Where("name IN (?)", pg.In(names)).Order("id").Select()
+	})
 }
 
 func (u *User) Get(ctx context.Context, id int) (*model.User, error) {
 	user := model.User{Id: id}
-	err := u.db.ModelContext(ctx, &user).WherePK().Relation("CreatedBy").Select()
+	err := u.db.ModelContext(ctx, &user).WherePK().Relation("CreatedBy").Relation("Roles").Select()
 	if err != nil {
 		return nil, err
 	}
@@ -59,36 +97,108 @@ func (u *User) Get(ctx context.Context, id int) (*model.User, error) {
 
 func (u *User) GetByName(ctx context.Context, name string) (*model.User, error) {
 	user := model.User{}
-	err := u.db.ModelContext(ctx, &user).Where("name = ?", name).Select()
+	err := u.db.ModelContext(ctx, &user).Where("name = ?", name).Relation("Roles").Select()
 	if err != nil {
 		return nil, err
 	}
 	return &user, err
 }
 
+func (u *User) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	user := model.User{}
+	err := u.db.ModelContext(ctx, &user).Where("email = ?", email).Relation("Roles").Select()
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (u *User) GetByOidcSubject(ctx context.Context, subject string) (*model.User, error) {
+	user := model.User{}
+	err := u.db.ModelContext(ctx, &user).Where("oidc_subject = ?", subject).Relation("Roles").Select()
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 func (u *User) ListAndCount(ctx context.Context, p *model.Page, query, role string) ([]*model.User, int, error) {
+	return u.listAndCount(ctx, p, query, role, 0)
+}
+
+func (u *User) ListAndCountByTeacher(ctx context.Context, p *model.Page, query, role string, teacherId int) ([]*model.User, int, error) {
+	return u.listAndCount(ctx, p, query, role, teacherId)
+}
+
+// teacherId 不为 0 时只查询这个老师任教班级中的用户
+func (u *User) listAndCount(ctx context.Context, p *model.Page, query, role string, teacherId int) ([]*model.User, int, error) {
 	users := []*model.User{}
-	db := u.db.ModelContext(ctx, &users).
+	db, ok := filterUsers(u.db.ModelContext(ctx, &users), query, role, teacherId)
+	if !ok {
+		return users, 0, nil
+	}
+	if query != "" {
+		// 按相关度排序
+		db = db.OrderExpr("ts_rank(search_vector, ?::tsquery) DESC", model.SearchQuery(query))
+	}
+	count, err := db.
+		Relation("Roles").
+		Order("created_at DESC").
 		Offset(p.Offset()).
 		Limit(p.Limit()).
-		WhereGroup(func(q *orm.Query) (*orm.Query, error) {
-			q = q.WhereOr("name LIKE ?", "%"+query+"%").
-				WhereOr("nick_name LIKE ?", "%"+query+"%").
-				WhereOr("phone LIKE ?", "%"+query+"%").
-				WhereOr("email LIKE ?", "%"+query+"%").
-				Order("created_at DESC")
-			return q, nil
-		})
-	if role != "" {
-		db = db.Where("role = ?", role)
-	}
-	count, err := db.SelectAndCount()
+		SelectAndCount()
 	if err != nil {
 		return nil, 0, err
 	}
 	return users, count, err
 }
 
+func (u *User) ListForExport(ctx context.Context, query, role string, teacherId, afterId, limit int) ([]*model.User, error) {
+	users := []*model.User{}
+	db, ok := filterUsers(u.db.ModelContext(ctx, &users), query, role, teacherId)
+	if !ok {
+		return users, nil
+	}
+	err := db.
+		Relation("Roles").
+		Relation("Class").
+		Where(`"user".id > ?`, afterId).
+		Order("user.id").
+		Limit(limit).
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (u *User) CountForExport(ctx context.Context, query, role string, teacherId int) (int, error) {
+	db, ok := filterUsers(u.db.ModelContext(ctx, (*model.User)(nil)), query, role, teacherId)
+	if !ok {
+		return 0, nil
+	}
+	return db.Count()
+}
+
+// 列表和导出共用的查询条件，全文检索用户名、昵称、手机号和邮箱
+// query 分词后为空时返回 false，此时没有符合条件的用户
+func filterUsers(db *orm.Query, query, role string, teacherId int) (*orm.Query, bool) {
+	if query != "" {
+		tsquery := model.SearchQuery(query)
+		if tsquery == "" {
+			return db, false
+		}
+		db = db.Where("search_vector @@ ?::tsquery", tsquery)
+	}
+	if role != "" {
+		db = db.Where(hasRoleCondition, role)
+	}
+	if teacherId != 0 {
+		db = db.Where(`"user".class_id IN (SELECT class_id FROM class_teacher WHERE user_id = ?)`, teacherId)
+	}
+	return db, true
+}
+
 func (u *User) Update(ctx context.Context, user *model.User, columns []string) error {
 	user.UpdatedAt = time.Now()
 	columns = append(columns, "updated_at")
@@ -101,14 +211,91 @@ func (u *User) Update(ctx context.Context, user *model.User, columns []string) e
 	if err != nil {
 		return err
 	}
+	// 修改了参与全文检索的字段时，重新生成 search_vector，此时 user 中已经是完整数据
+	for _, column := range columns {
+		switch column {
+		case "name", "nick_name", "phone", "email":
+			return updateSearchVector(ctx, u.db, user)
+		}
+	}
 	return nil
 }
 
+func (u *User) IncrTokenVersion(ctx context.Context, id int) (int, error) {
+	user := model.User{Id: id}
+	_, err := u.db.ModelContext(ctx, &user).
+		Set("token_version = token_version + 1").
+		WherePK().
+		Returning("token_version").
+		Update()
+	if err != nil {
+		return 0, err
+	}
+	return user.TokenVersion, nil
+}
+
+func (u *User) SetRoles(ctx context.Context, id int, names []string) error {
+	// IN 中不能为空
+	if len(names) == 0 {
+		_, err := u.db.ModelContext(ctx, (*model.UserRole)(nil)).Where("user_id = ?", id).Delete()
+		return err
+	}
+	// 一条语句完成移除和新增，不存在的角色标识会被忽略
+	_, err := u.db.ExecContext(ctx, `WITH removed AS (
+		DELETE FROM user_role WHERE user_id = ?0 AND role_id NOT IN (SELECT id FROM role WHERE name IN (?1))
+	)
+	INSERT INTO user_role (user_id, role_id, created_at)
+	SELECT ?0, id, now() FROM role WHERE name IN (?1)
+	ON CONFLICT DO NOTHING`, id, pg.In(names))
+	return err
+}
+
+func (u *User) UseTotpStep(ctx context.Context, id int, step int64) (bool, error) {
+	res, err := u.db.ModelContext(ctx, (*model.User)(nil)).
+		Set("totp_last_step = ?", step).
+		Where("id = ?", id).
+		Where("totp_last_step < ?", step).
+		Update()
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
+
 func (u *User) Delete(ctx context.Context, id int) error {
 	_, err := u.db.ModelContext(ctx, &model.User{Id: id}).WherePK().Delete()
 	return err
 }
 
+func (u *User) ForceDelete(ctx context.Context, id int) error {
+	_, err := u.db.ModelContext(ctx, &model.User{Id: id}).WherePK().AllWithDeleted().ForceDelete()
+	if err != nil {
+		return err
+	}
+	_, err = u.db.ModelContext(ctx, (*model.UserRole)(nil)).Where("user_id = ?", id).Delete()
+	if err != nil {
+		return err
+	}
+	_, err = u.db.ModelContext(ctx, (*model.ClassTeacher)(nil)).Where("user_id = ?", id).Delete()
+	return err
+}
+
+// 回收站中的数据同样算作引用，它们还可能被恢复
+func (u *User) IsReferenced(ctx context.Context, id int) (bool, error) {
+	var is bool
+	_, err := u.db.QueryOneContext(ctx, pg.Scan(&is), `SELECT
+		EXISTS (SELECT 1 FROM "user" WHERE created_by_id = ?0 AND id != ?0) OR
+		EXISTS (SELECT 1 FROM class WHERE created_by_id = ?0) OR
+		EXISTS (SELECT 1 FROM subject WHERE created_by_id = ?0) OR
+		EXISTS (SELECT 1 FROM learning_material WHERE created_by_id = ?0 OR updated_by_id = ?0) OR
+		EXISTS (SELECT 1 FROM learning_material_version WHERE created_by_id = ?0) OR
+		EXISTS (SELECT 1 FROM upload WHERE created_by_id = ?0)`, id)
+	if err != nil {
+		return false, err
+	}
+	return is, nil
+}
+
 func (u *User) IsNameExist(ctx context.Context, name string, excludeId int) (bool, error) {
 	db := u.db.ModelContext(ctx, &model.User{})
 	if excludeId != 0 {
@@ -2,11 +2,13 @@ package dao
 
 import (
 	"context"
+	"errors"
 	"github.com/go-pg/pg/v10"
 	"github.com/stretchr/testify/assert"
 	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
 	"github.com/xuxusheng/time-frequency-be/internal/model"
 	"math/rand"
+	"strings"
 	"testing"
 	"time"
 )
@@ -20,6 +22,21 @@ func prepareUser(t *testing.T, db *pg.DB) []*model.User {
 	return users
 }
 
+// 执行到分配角色的语句时返回错误
+type failSetRoles struct{}
+
+func (failSetRoles) BeforeQuery(ctx context.Context, e *pg.QueryEvent) (context.Context, error) {
+	q, err := e.UnformattedQuery()
+	if err == nil && strings.Contains(string(q), "INSERT INTO user_role") {
+		return ctx, errors.New("分配角色失败")
+	}
+	return ctx, nil
+}
+
+func (failSetRoles) AfterQuery(context.Context, *pg.QueryEvent) error {
+	return nil
+}
+
 func TestUser_Create(t *testing.T) {
 	pUsers := prepareUser(t, db)
 	dao := NewUser(db)
@@ -28,31 +45,71 @@ func TestUser_Create(t *testing.T) {
 		at := assert.New(t)
 		for i := 0; i < 10; i++ {
 			s := time.Now().String()
-			user, err := dao.Create(context.Background(), 1, s, s, s, s)
+			user := &model.User{CreatedById: pUsers[0].Id, Name: s, NickName: s, Phone: s, Email: s, Password: s}
+			err := dao.Create(context.Background(), user)
 			if at.Nil(err) {
 				at.NotZero(user.Id)
 				at.Equal(s, user.Name)
 				at.Equal(s, user.Phone)
 				at.Equal(s, user.Email)
-				at.NotNil(s, user.UpdatedAt)
-				at.NotNil(s, user.CreatedAt)
+				at.NotZero(user.UpdatedAt)
+				at.NotZero(user.CreatedAt)
 			}
 		}
 	})
 
+	t.Run("同时分配角色", func(t *testing.T) {
+		at := assert.New(t)
+		s := time.Now().String()
+		user := &model.User{Name: s, NickName: s, Phone: s, Email: s, Password: s, Roles: []*model.Role{{Name: model.RoleTeacher}}}
+		if at.Nil(dao.Create(context.Background(), user)) {
+			at.Equal([]string{model.RoleTeacher}, user.RoleNames())
+			at.NotZero(user.Roles[0].Id)
+		}
+	})
+
+	t.Run("分配角色失败时不创建用户", func(t *testing.T) {
+		at := assert.New(t)
+		// 复制出的连接上的 hook 不影响其他测试
+		failDb := db.WithContext(context.Background())
+		failDb.AddQueryHook(failSetRoles{})
+		s := time.Now().String()
+		err := NewUser(failDb).Create(context.Background(), &model.User{Name: s, NickName: s, Phone: s, Email: s, Password: s, Roles: []*model.Role{{Name: model.RoleTeacher}}})
+		at.NotNil(err)
+		_, err = dao.GetByName(context.Background(), s)
+		at.True(errors.Is(err, pg.ErrNoRows))
+	})
+
+	t.Run("在外层事务中创建", func(t *testing.T) {
+		at := assert.New(t)
+		s := time.Now().String()
+		rollback := errors.New("回滚")
+		err := db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+			err := NewUser(tx).Create(context.Background(), &model.User{Name: s, NickName: s, Phone: s, Email: s, Password: s, Roles: []*model.Role{{Name: model.RoleTeacher}}})
+			if err != nil {
+				return err
+			}
+			return rollback
+		})
+		at.Equal(rollback, err)
+		// 不会提前提交外层事务
+		_, err = dao.GetByName(context.Background(), s)
+		at.True(errors.Is(err, pg.ErrNoRows))
+	})
+
 	t.Run("用户名、手机号或邮箱重复", func(t *testing.T) {
 		for _, pUser := range pUsers {
 			s := time.Now().String()
 			t.Run("用户名重复", func(t *testing.T) {
-				_, err := dao.Create(context.Background(), 1, pUser.Name, s, s, s)
+				err := dao.Create(context.Background(), &model.User{Name: pUser.Name, NickName: s, Phone: s, Email: s, Password: s})
 				assert.NotNil(t, err)
 			})
 			t.Run("手机号重复", func(t *testing.T) {
-				_, err := dao.Create(context.Background(), 1, s, pUser.Phone, s, s)
+				err := dao.Create(context.Background(), &model.User{Name: s, NickName: s, Phone: pUser.Phone, Email: s, Password: s})
 				assert.NotNil(t, err)
 			})
 			t.Run("邮箱重复", func(t *testing.T) {
-				_, err := dao.Create(context.Background(), 1, s, s, pUser.Email, s)
+				err := dao.Create(context.Background(), &model.User{Name: s, NickName: s, Phone: s, Email: pUser.Email, Password: s})
 				assert.NotNil(t, err)
 			})
 
@@ -95,6 +152,9 @@ func TestUser_Get(t *testing.T) {
 func TestUser_Update(t *testing.T) {
 	pUsers := prepareUser(t, db)
 	dao := NewUser(db)
+	update := func(id int, name, phone, email string) error {
+		return dao.Update(context.Background(), &model.User{Id: id, Name: name, Phone: phone, Email: email}, []string{"name", "phone", "email"})
+	}
 
 	t.Run("用户名、手机号或邮箱重复", func(t *testing.T) {
 		for i := 0; i < len(pUsers)-1; i++ {
@@ -102,16 +162,13 @@ func TestUser_Update(t *testing.T) {
 			nextUser := pUsers[i+1]
 			s := time.Now().String()
 			// 用户名重复
-			user, err := dao.Update(context.Background(), currentUser.Id, nextUser.Name, s, s)
-			assert.Nil(t, user)
+			err := update(currentUser.Id, nextUser.Name, s, s)
 			assert.NotNil(t, err)
 			// 手机号重复
-			user, err = dao.Update(context.Background(), currentUser.Id, s, nextUser.Phone, s)
-			assert.Nil(t, user)
+			err = update(currentUser.Id, s, nextUser.Phone, s)
 			assert.NotNil(t, err)
 			// 邮箱重复
-			user, err = dao.Update(context.Background(), currentUser.Id, s, s, nextUser.Email)
-			assert.Nil(t, user)
+			err = update(currentUser.Id, s, s, nextUser.Email)
 			assert.NotNil(t, err)
 		}
 	})
@@ -120,16 +177,13 @@ func TestUser_Update(t *testing.T) {
 		for _, pUser := range pUsers {
 			s := time.Now().String()
 			// 用户名为空
-			user, err := dao.Update(context.Background(), pUser.Id, "", s, s)
-			assert.Nil(t, user)
+			err := update(pUser.Id, "", s, s)
 			assert.NotNil(t, err)
 			// 手机号为空
-			user, err = dao.Update(context.Background(), pUser.Id, s, "", s)
-			assert.Nil(t, user)
+			err = update(pUser.Id, s, "", s)
 			assert.NotNil(t, err)
 			// 邮箱为空
-			user, err = dao.Update(context.Background(), pUser.Id, s, s, "")
-			assert.Nil(t, user)
+			err = update(pUser.Id, s, s, "")
 			assert.NotNil(t, err)
 		}
 	})
@@ -137,9 +191,8 @@ func TestUser_Update(t *testing.T) {
 	t.Run("修改一个不存在的用户", func(t *testing.T) {
 		for i := 0; i < 10; i++ {
 			s := time.Now().String()
-			user, err := dao.Update(context.Background(), rand.Intn(100)*10000, s, s, s)
+			err := update(rand.Intn(100)*10000, s, s, s)
 			assert.Equal(t, pg.ErrNoRows, err)
-			assert.Nil(t, user)
 		}
 	})
 
@@ -151,7 +204,8 @@ func TestUser_Update(t *testing.T) {
 			name := s + "name"
 			phone := s + "phone"
 			email := s + "email"
-			user, err := dao.Update(context.Background(), pUser.Id, name, phone, email)
+			user := &model.User{Id: pUser.Id, Name: name, Phone: phone, Email: email}
+			err := dao.Update(context.Background(), user, []string{"name", "phone", "email"})
 			if assert.Nil(t, err) {
 				assert.Equal(t, name, user.Name)
 				assert.Equal(t, phone, user.Phone)
@@ -0,0 +1,26 @@
+package database
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10"
+)
+
+// 数据表是否还不存在，建表前调用，用来判断是否是第一次创建
+func isTableMissing(ctx context.Context, db *pg.DB, table string) (bool, error) {
+	var missing bool
+	_, err := db.QueryOneContext(ctx, pg.Scan(&missing), `SELECT to_regclass(?) IS NULL`, table)
+	return missing, err
+}
+
+// 每个班级最多一个班主任
+// 之前老师任教的班级就是自己创建的班级，第一次创建关联表时把已有班级的创建人设为班主任，之后由管理员调整
+func setupClassTeachers(ctx context.Context, db *pg.DB, seed bool) error {
+	_, err := db.ExecContext(ctx, `CREATE UNIQUE INDEX IF NOT EXISTS class_teacher_head_key ON class_teacher (class_id) WHERE type = 'head'`)
+	if err != nil || !seed {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `INSERT INTO class_teacher (class_id, user_id, type, created_at)
+		SELECT id, created_by_id, 'head', now() FROM class
+		ON CONFLICT DO NOTHING`)
+	return err
+}
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-pg/pg/v10"
+)
+
+// 数据表创建时使用 IfNotExists，之后新增的列需要在这里补上
+var columns = []struct {
+	table      string
+	definition string
+}{
+	// 资料版本，已有资料为版本 1，对应的版本记录由 setupVersions 补上
+	{table: "learning_material", definition: "version integer NOT NULL DEFAULT 1"},
+	// 资料正文提取，已有资料默认为等待提取状态，启动后由后台任务补齐正文
+	{table: "learning_material", definition: "extract_status text NOT NULL DEFAULT 'pending'"},
+	{table: "learning_material", definition: "extract_error text NOT NULL DEFAULT ''"},
+	{table: "learning_material", definition: "content text NOT NULL DEFAULT ''"},
+	// 资料预览图，同样由后台任务补齐
+	{table: "learning_material", definition: "preview_status text NOT NULL DEFAULT 'pending'"},
+	{table: "learning_material", definition: "preview_path text NOT NULL DEFAULT ''"},
+	// 软删除，不为空时表示数据在回收站中
+	{table: `"user"`, definition: "deleted_at timestamptz"},
+	{table: "class", definition: "deleted_at timestamptz"},
+	{table: "subject", definition: "deleted_at timestamptz"},
+	{table: "learning_material", definition: "deleted_at timestamptz"},
+	// token 版本，用于让已签发的 token 失效
+	{table: `"user"`, definition: "token_version integer NOT NULL DEFAULT 0"},
+	// 两步验证
+	{table: `"user"`, definition: "totp_secret text NOT NULL DEFAULT ''"},
+	{table: `"user"`, definition: "totp_enabled boolean NOT NULL DEFAULT false"},
+	{table: `"user"`, definition: "totp_last_step bigint NOT NULL DEFAULT 0"},
+	// 强制修改密码
+	{table: `"user"`, definition: "must_change_password boolean NOT NULL DEFAULT false"},
+	// 登录方式
+	{table: `"user"`, definition: "auth_source text NOT NULL DEFAULT 'local'"},
+	// 单点登录
+	{table: `"user"`, definition: "oidc_subject text NOT NULL DEFAULT ''"},
+}
+
+func setupColumns(ctx context.Context, db *pg.DB) error {
+	for _, c := range columns {
+		_, err := db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s", c.table, c.definition))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
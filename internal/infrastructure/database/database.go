@@ -32,9 +32,29 @@ func New(setting *setting.Setting) (*pg.DB, error) {
 
 	schemas := []interface{}{
 		(*model.User)(nil),
+		(*model.Role)(nil),
+		(*model.UserRole)(nil),
 		(*model.Class)(nil),
+		(*model.ClassSubject)(nil),
+		(*model.ClassTeacher)(nil),
 		(*model.Subject)(nil),
 		(*model.LearningMaterial)(nil),
+		(*model.LearningMaterialVersion)(nil),
+		(*model.Upload)(nil),
+		(*model.TranscodeJob)(nil),
+		(*model.ExportJob)(nil),
+		(*model.RefreshToken)(nil),
+		(*model.Session)(nil),
+		(*model.LoginFailure)(nil),
+		(*model.RecoveryCode)(nil),
+		(*model.PasswordReset)(nil),
+		(*model.OidcLogin)(nil),
+	}
+
+	// 班级的老师关联表第一次创建时需要初始化
+	seedClassTeachers, err := isTableMissing(ctx, db, "class_teacher")
+	if err != nil {
+		return nil, errors.Wrap(err, "查询数据表失败")
 	}
 
 	for _, schema := range schemas {
@@ -47,10 +67,41 @@ func New(setting *setting.Setting) (*pg.DB, error) {
 		}
 	}
 
-	err := seedAdmin(ctx, db)
+	// 初始化管理员和全文检索都需要查询完整的数据，要先补上新增的列
+	err = setupColumns(ctx, db)
+	if err != nil {
+		return nil, errors.Wrap(err, "补充数据表字段失败")
+	}
+
+	err = setupVersions(ctx, db)
+	if err != nil {
+		return nil, errors.Wrap(err, "补充资料版本记录失败")
+	}
+
+	err = setupUnique(ctx, db)
+	if err != nil {
+		return nil, errors.Wrap(err, "初始化唯一索引失败")
+	}
+
+	err = setupRoles(ctx, db)
+	if err != nil {
+		return nil, errors.Wrap(err, "初始化角色失败")
+	}
+
+	err = setupClassTeachers(ctx, db, seedClassTeachers)
+	if err != nil {
+		return nil, errors.Wrap(err, "初始化班级老师失败")
+	}
+
+	err = seedAdmin(ctx, db)
 	if err != nil {
 		return nil, errors.Wrap(err, "初始化管理员账户失败")
 	}
 
+	err = setupSearch(ctx, db)
+	if err != nil {
+		return nil, errors.Wrap(err, "初始化全文检索失败")
+	}
+
 	return db, nil
 }
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"time"
+)
+
+// 创建内置角色，已经存在的不修改，管理员调整过的权限保持不变
+// 之前用户表中的 role 和 is_admin 两列换成了角色，第一次升级时按照这两列分配角色，之后删除
+func setupRoles(ctx context.Context, db *pg.DB) error {
+	for _, r := range model.BuiltinRoles {
+		role := *r
+		role.CreatedAt = time.Now()
+		role.UpdatedAt = time.Now()
+		_, err := db.ModelContext(ctx, &role).OnConflict("(name) DO NOTHING").Insert()
+		if err != nil {
+			return err
+		}
+	}
+
+	var legacy bool
+	_, err := db.QueryOneContext(ctx, pg.Scan(&legacy), `SELECT EXISTS (
+		SELECT 1 FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'user' AND column_name = 'is_admin'
+	)`)
+	if err != nil || !legacy {
+		return err
+	}
+	// 之前的管理员同时也是老师，两个角色都保留；中途失败时重新执行不会重复分配
+	for _, stmt := range []string{
+		`INSERT INTO user_role (user_id, role_id, created_at)
+		SELECT u.id, r.id, now() FROM "user" u JOIN role r ON r.name = 'admin' WHERE u.is_admin
+		ON CONFLICT DO NOTHING`,
+		`INSERT INTO user_role (user_id, role_id, created_at)
+		SELECT u.id, r.id, now() FROM "user" u JOIN role r ON r.name = u.role
+		ON CONFLICT DO NOTHING`,
+		`ALTER TABLE "user" DROP COLUMN IF EXISTS role, DROP COLUMN IF EXISTS is_admin`,
+	} {
+		_, err = db.ExecContext(ctx, stmt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
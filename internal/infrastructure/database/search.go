@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-pg/pg/v10"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+)
+
+// 全文检索相关的初始化，补上 search_vector 列和索引，并为已有数据生成分词结果
+func setupSearch(ctx context.Context, db *pg.DB) error {
+	tables := []struct {
+		name  string
+		index string
+	}{
+		{name: "learning_material", index: "learning_material_search_vector_idx"},
+		{name: "subject", index: "subject_search_vector_idx"},
+		{name: `"user"`, index: "user_search_vector_idx"},
+	}
+	for _, t := range tables {
+		// 加入全文检索之前创建的数据表中没有 search_vector 列
+		_, err := db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS search_vector tsvector", t.name))
+		if err != nil {
+			return err
+		}
+		_, err = db.ExecContext(ctx, fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s USING GIN (search_vector)", t.index, t.name))
+		if err != nil {
+			return err
+		}
+	}
+
+	var lms []*model.LearningMaterial
+	err := db.ModelContext(ctx, &lms).AllWithDeleted().Where("search_vector IS NULL").Select()
+	if err != nil {
+		return err
+	}
+	var subjects []*model.Subject
+	err = db.ModelContext(ctx, &subjects).AllWithDeleted().Where("search_vector IS NULL").Select()
+	if err != nil {
+		return err
+	}
+	var users []*model.User
+	err = db.ModelContext(ctx, &users).AllWithDeleted().Where("search_vector IS NULL").Select()
+	if err != nil {
+		return err
+	}
+
+	var ms []model.Searchable
+	for _, lm := range lms {
+		ms = append(ms, lm)
+	}
+	for _, subject := range subjects {
+		ms = append(ms, subject)
+	}
+	for _, user := range users {
+		ms = append(ms, user)
+	}
+	for _, m := range ms {
+		m.RefreshSearchVector()
+		_, err = db.ModelContext(ctx, m).AllWithDeleted().Column("search_vector").WherePK().Update()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,15 +2,16 @@ package database
 
 import (
 	"context"
+	"errors"
 	"github.com/go-pg/pg/v10"
 	"github.com/xuxusheng/time-frequency-be/internal/model"
 	"github.com/xuxusheng/time-frequency-be/internal/utils"
 	"time"
 )
 
-// 如果数据库中没有用户的话，初始化一个 admin 用户
+// 如果数据库中没有用户的话，初始化一个 admin 用户，回收站中的用户也算
 func seedAdmin(ctx context.Context, db *pg.DB) error {
-	is, err := db.ModelContext(ctx, &model.User{}).Exists()
+	is, err := db.ModelContext(ctx, &model.User{}).AllWithDeleted().Exists()
 	if err != nil {
 		return err
 	}
@@ -20,20 +21,37 @@ func seedAdmin(ctx context.Context, db *pg.DB) error {
 			return err
 		}
 
-		_, err = db.ModelContext(ctx, &model.User{
-			Name:      "admin",
-			NickName:  "管理员",
-			Phone:     "12345678901",
-			Email:     "admin@admin.com",
-			Role:      "teacher",
-			IsAdmin:   true,
-			Password:  hash,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		}).Insert()
+		admin := model.User{
+			Name:     "admin",
+			NickName: "管理员",
+			Phone:    "12345678901",
+			Email:    "admin@admin.com",
+			Password: hash,
+			// 默认密码所有人都知道，首次登录后必须修改
+			MustChangePassword: true,
+			CreatedAt:          time.Now(),
+			UpdatedAt:          time.Now(),
+		}
+		_, err = db.ModelContext(ctx, &admin).Returning("*").Insert()
 		if err != nil {
 			return err
 		}
+		_, err = db.ExecContext(ctx, `INSERT INTO user_role (user_id, role_id, created_at) SELECT ?, id, now() FROM role WHERE name = ?`, admin.Id, model.RoleAdmin)
+		return err
+	}
+
+	// 之前初始化的 admin 还在使用默认密码时，同样要求修改
+	admin := model.User{}
+	err = db.ModelContext(ctx, &admin).Where("name = ?", "admin").Where("must_change_password = false").Select()
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	if utils.ComparePwd(admin.Password, "admin") != nil {
+		return nil
 	}
-	return nil
+	_, err = db.ModelContext(ctx, &admin).Set("must_change_password = true").WherePK().Update()
+	return err
 }
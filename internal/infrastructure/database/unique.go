@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-pg/pg/v10"
+	"strings"
+)
+
+// 加入回收站后，名称等字段只需要在未删除的数据中唯一，否则删除后无法再创建同名数据。
+// 早期建表时生成的唯一约束需要先去掉，换成只作用于未删除数据的部分唯一索引
+// LDAP 自动创建的用户可能没有手机号和邮箱，这两个字段允许多个用户为空，没有关联单点登录的用户 oidc_subject 也为空
+var uniques = []struct {
+	table      string
+	column     string
+	allowEmpty bool
+}{
+	{table: `"user"`, column: "name"},
+	{table: `"user"`, column: "phone", allowEmpty: true},
+	{table: `"user"`, column: "email", allowEmpty: true},
+	{table: `"user"`, column: "oidc_subject", allowEmpty: true},
+	{table: "class", column: "name"},
+	{table: "subject", column: "name"},
+	{table: "learning_material", column: "name"},
+}
+
+func setupUnique(ctx context.Context, db *pg.DB) error {
+	for _, u := range uniques {
+		name := fmt.Sprintf("%s_%s", strings.Trim(u.table, `"`), u.column)
+		_, err := db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s_key", u.table, name))
+		if err != nil {
+			return err
+		}
+		if !u.allowEmpty {
+			_, err = db.ExecContext(ctx, fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS %s_active_key ON %s (%s) WHERE deleted_at IS NULL", name, u.table, u.column))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		// 之前创建的索引不允许多个空值，换成新的
+		_, err = db.ExecContext(ctx, fmt.Sprintf("DROP INDEX IF EXISTS %s_active_key", name))
+		if err != nil {
+			return err
+		}
+		_, err = db.ExecContext(ctx, fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS %s_active_nonempty_key ON %s (%s) WHERE deleted_at IS NULL AND %s <> ''", name, u.table, u.column, u.column))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package database
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10"
+)
+
+// 资料的第一个版本在创建资料时一并写入，支持多版本之前上传的资料没有版本记录
+// 把这些资料当前的文件补为版本 1，之后才能查看历史和回滚，文件去重和引用计数也依赖版本记录
+func setupVersions(ctx context.Context, db *pg.DB) error {
+	_, err := db.ExecContext(ctx, `INSERT INTO learning_material_version (version, note, md5, file_path, learning_material_id, created_by_id, created_at)
+		SELECT lm.version, '', lm.md5, lm.file_path, lm.id, lm.created_by_id, lm.created_at FROM learning_material AS lm
+		WHERE NOT EXISTS (SELECT 1 FROM learning_material_version AS v WHERE v.learning_material_id = lm.id)`)
+	return err
+}
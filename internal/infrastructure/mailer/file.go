@@ -0,0 +1,47 @@
+package mailer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const fileFrom = "时频学习平台 <noreply@localhost>"
+
+// 不真正发送，每封邮件写入 dir 下的一个 .eml 文件，dir 为空时打印到日志
+func NewFile(dir string) (*File, error) {
+	if dir != "" {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &File{Dir: dir}, nil
+}
+
+type File struct {
+	Dir string
+}
+
+func (f File) Send(ctx context.Context, msg *Message) error {
+	now := time.Now()
+	content := build(fileFrom, msg, now)
+	if f.Dir == "" {
+		log.Printf("邮件发送给 %s，标题：%s\n%s", msg.To, msg.Subject, msg.Body)
+		return nil
+	}
+
+	b := make([]byte, 4)
+	_, err := rand.Read(b)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", now.Format("20060102150405"), hex.EncodeToString(b))
+	return ioutil.WriteFile(filepath.Join(f.Dir, name), content, 0644)
+}
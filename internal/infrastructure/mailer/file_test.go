@@ -0,0 +1,66 @@
+package mailer
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mails")
+	if err != nil {
+		t.Fatalf("创建临时目录失败：%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := NewFile(filepath.Join(dir, "sub"))
+	if err != nil {
+		t.Fatalf("初始化失败：%v", err)
+	}
+	at := assert.New(t)
+
+	body := strings.Repeat("请打开下面的链接重置密码。", 10)
+	err = f.Send(context.Background(), &Message{To: "test@example.com", Subject: "重置密码", Body: body})
+	if !at.Nil(err) {
+		return
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "sub", "*.eml"))
+	if !at.Nil(err) || !at.Len(files, 1) {
+		return
+	}
+	content, err := ioutil.ReadFile(files[0])
+	if !at.Nil(err) {
+		return
+	}
+
+	// 生成的邮件可以被正常解析
+	m, err := mail.ReadMessage(strings.NewReader(string(content)))
+	if !at.Nil(err) {
+		return
+	}
+	at.Equal("test@example.com", m.Header.Get("To"))
+	subject, err := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	at.Nil(err)
+	at.Equal("重置密码", subject)
+	from, err := m.Header.AddressList("From")
+	if at.Nil(err) && at.Len(from, 1) {
+		at.Equal("时频学习平台", from[0].Name)
+	}
+
+	raw, err := ioutil.ReadAll(m.Body)
+	at.Nil(err)
+	for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\r\n") {
+		at.LessOrEqual(len(line), 76)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(raw), "\r\n", ""))
+	at.Nil(err)
+	at.Equal(body, string(decoded))
+}
@@ -0,0 +1,67 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/setting"
+	"mime"
+	"net/mail"
+	"time"
+)
+
+const (
+	TypeSMTP = "smtp" // 通过 SMTP 服务器发送
+	TypeFile = "file" // 不真正发送，写入文件或者日志，用于本地开发和离线测试
+)
+
+// 邮件发送接口
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// 纯文本邮件
+type Message struct {
+	To      string // 收件人邮箱
+	Subject string
+	Body    string
+}
+
+// 根据配置项初始化邮件发送
+func New(s *setting.Mail) (Mailer, error) {
+	switch s.Type {
+	case TypeFile, "":
+		return NewFile(s.FilePath)
+	case TypeSMTP:
+		return NewSMTP(s.Host, s.Port, s.Username, s.Password, s.From), nil
+	default:
+		return nil, fmt.Errorf("不支持的邮件发送类型：%s", s.Type)
+	}
+}
+
+// 生成 RFC 5322 格式的邮件内容，标题和正文都使用 UTF-8
+func build(from string, msg *Message, date time.Time) []byte {
+	buf := bytes.Buffer{}
+	// 发件人名称可能包含中文，需要编码
+	if addr, err := mail.ParseAddress(from); err == nil {
+		from = addr.String()
+	}
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n")
+	buf.WriteString("\r\n")
+
+	// base64 每行不超过 76 个字符
+	body := base64.StdEncoding.EncodeToString([]byte(msg.Body))
+	for len(body) > 76 {
+		buf.WriteString(body[:76] + "\r\n")
+		body = body[76:]
+	}
+	buf.WriteString(body + "\r\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,22 @@
+package mailer
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/setting"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	at := assert.New(t)
+	_, err := New(&setting.Mail{Type: "pigeon"})
+	at.NotNil(err)
+
+	m, err := New(&setting.Mail{})
+	if at.Nil(err) {
+		at.IsType(&File{}, m)
+	}
+	m, err = New(&setting.Mail{Type: TypeSMTP, Host: "localhost", Port: 25})
+	if at.Nil(err) {
+		at.IsType(&SMTP{}, m)
+	}
+}
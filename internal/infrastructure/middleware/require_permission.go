@@ -10,25 +10,32 @@ import (
 	"github.com/xuxusheng/time-frequency-be/internal/pkg/response"
 )
 
-func IsAdmin() iris.Handler {
+// 放在 IsLogin 之后，当前用户拥有 permissions 中的任意一个权限时才允许访问
+// 权限每次都从数据库中查询，修改角色的权限后立即生效
+func RequirePermission(permissions ...string) iris.Handler {
 	return func(c iris.Context) {
 		ctx := c.Request().Context()
 		resp := response.New(c)
 
 		claims := jwt.Get(c).(*model.JWTClaims)
 
-		// 验证当前用户是否为管理员
-		d := dao.NewUser(global.DB)
-
-		user, err := d.Get(ctx, claims.Uid)
+		owned, err := dao.NewRole(global.DB).ListPermissionsByUser(ctx, claims.Uid)
 		if err != nil {
 			resp.Error(cerror.ServerError.WithDebugs(err))
 			return
 		}
-		if !user.IsAdmin {
-			resp.Error(cerror.Forbidden.WithMsg("非管理员无权访问"))
-			return
+		for _, o := range owned {
+			if o == model.PermissionAll {
+				c.Next()
+				return
+			}
+			for _, p := range permissions {
+				if o == p {
+					c.Next()
+					return
+				}
+			}
 		}
-		c.Next()
+		resp.Error(cerror.Forbidden.WithMsg("没有权限访问"))
 	}
 }
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/go-pg/pg/v10"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/middleware/jwt"
+	"github.com/xuxusheng/time-frequency-be/global"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/response"
+	"time"
+)
+
+// 最近使用时间的更新间隔
+const sessionTouchInterval = time.Minute
+
+// 需要修改密码时仍然允许访问的接口
+var passwordChangeRoutes = map[string]bool{
+	"/api/v1/user/update-password": true,
+}
+
+// 放在 IsLogin 之后，校验 token 所属的会话仍然有效，并且 token 的版本与用户当前的版本一致
+// 退出登录、被强制下线、修改密码、角色变化或者用户被删除后，之前签发的 token 立即失效，不用等到过期
+// 用户需要修改密码时，IsLogin 校验 token 通过后在这里拦截，只允许调用修改密码接口
+func Session() iris.Handler {
+	return func(c iris.Context) {
+		ctx := c.Request().Context()
+		resp := response.New(c)
+
+		claims := jwt.Get(c).(*model.JWTClaims)
+
+		sessionDao := dao.NewSession(global.DB)
+		_, err := sessionDao.GetActive(ctx, claims.Sid)
+		if err != nil {
+			if errors.Is(err, pg.ErrNoRows) {
+				resp.Error(cerror.TokenInvalid.WithMsg("登录状态已失效，请重新登录"))
+				return
+			}
+			resp.Error(cerror.ServerError.WithDebugs(err))
+			return
+		}
+
+		user, err := dao.NewUser(global.DB).Get(ctx, claims.Uid)
+		if err != nil {
+			if errors.Is(err, pg.ErrNoRows) {
+				resp.Error(cerror.TokenInvalid)
+				return
+			}
+			resp.Error(cerror.ServerError.WithDebugs(err))
+			return
+		}
+		if user.TokenVersion != claims.Ver {
+			resp.Error(cerror.TokenInvalid.WithMsg("登录状态已失效，请重新登录"))
+			return
+		}
+		if user.MustChangePassword && !passwordChangeRoutes[c.GetCurrentRoute().Path()] {
+			resp.Error(cerror.PasswordChangeRequired)
+			return
+		}
+
+		err = sessionDao.Touch(ctx, claims.Sid, sessionTouchInterval)
+		if err != nil {
+			resp.Error(cerror.ServerError.WithDebugs(err))
+			return
+		}
+		c.Next()
+	}
+}
@@ -10,14 +10,41 @@ type Server struct {
 }
 
 type App struct {
-	DefaultPs int // 默认每页查询记录条数
-	MaxPs     int // 每页最多查询记录条数
+	DefaultPs         int           // 默认每页查询记录条数
+	MaxPs             int           // 每页最多查询记录条数
+	UploadMaxSize     int64         `env:"UPLOAD_MAX_SIZE"`     // 上传文件大小上限，单位 MB
+	DownloadUrlExpire time.Duration `env:"DOWNLOAD_URL_EXPIRE"` // 签名下载地址的有效期
+	// 回收站中数据的保留时长，超过后由后台任务彻底删除，为 0 时不自动删除
+	RecycleBinRetention time.Duration `env:"RECYCLE_BIN_RETENTION"`
+
+	// 登录失败保护，同一账号或同一 IP 连续失败达到上限后锁定一段时间，上限为 0 时不锁定
+	// 机房的学生共用出口 IP，IP 的上限要比账号的大得多
+	LoginMaxFailures   int           `env:"LOGIN_MAX_FAILURES"`    // 同一账号连续失败的上限
+	LoginIpMaxFailures int           `env:"LOGIN_IP_MAX_FAILURES"` // 同一 IP 连续失败的上限
+	LoginLockDuration  time.Duration `env:"LOGIN_LOCK_DURATION"`   // 达到上限后锁定的时长
+	LoginFailureWindow time.Duration `env:"LOGIN_FAILURE_WINDOW"`  // 距离上次失败超过这个时长后重新计数
+	LoginDelay         time.Duration `env:"LOGIN_DELAY"`           // 账号失败后需要等待的时长，每多失败一次翻倍，为 0 时不等待
+
+	// 两步验证，用户可以自行开启，也可以要求管理员或者老师必须开启，未开启的用户登录时需要先完成设置
+	TotpIssuer         string `env:"TOTP_ISSUER"`          // 验证器 App 中显示的名称
+	TotpRequireAdmin   bool   `env:"TOTP_REQUIRE_ADMIN"`   // 管理员是否必须开启
+	TotpRequireTeacher bool   `env:"TOTP_REQUIRE_TEACHER"` // 老师是否必须开启
+
+	// 密码强度要求，为 0 时不限制
+	PasswordMinLength  int `env:"PASSWORD_MIN_LENGTH"`  // 最短长度
+	PasswordMinClasses int `env:"PASSWORD_MIN_CLASSES"` // 至少包含大写字母、小写字母、数字和符号中的几种
+
+	// 忘记密码时通过邮件发送重置链接
+	PasswordResetUrl    string        `env:"PASSWORD_RESET_URL"`    // 前端重置密码页面的地址，token 作为查询参数拼接在后面
+	PasswordResetExpire time.Duration `env:"PASSWORD_RESET_EXPIRE"` // 重置链接的有效期
 }
 
 type JWT struct {
 	Secret string        `env:"JWT_SECRET"` // JWT 密钥
 	Issuer string        // 签发人
-	Expire time.Duration `env:"JWT_EXPIRE"` // Token 过期时间
+	Expire time.Duration `env:"JWT_EXPIRE"` // Token 过期时间，过期后通过刷新 token 换取新的
+	// 刷新 token 的过期时间，每次刷新都会签发新的刷新 token 并重新计算
+	RefreshExpire time.Duration `env:"JWT_REFRESH_EXPIRE"`
 }
 
 type DB struct {
@@ -26,3 +53,114 @@ type DB struct {
 	User     string `env:"DB_USER"`     // 用户名
 	Password string `env:"DB_PASSWORD"` // 密码
 }
+
+type Storage struct {
+	Type      string `env:"STORAGE_TYPE"`       // 存储类型 local 或 s3，多副本部署时必须使用 s3
+	LocalPath string `env:"STORAGE_LOCAL_PATH"` // local 类型的文件保存目录
+	TempPath  string `env:"STORAGE_TEMP_PATH"`  // 上传过程中临时文件的存放目录，为空时使用系统临时目录
+	Endpoint  string `env:"STORAGE_ENDPOINT"`   // s3 服务地址，例如 localhost:9000
+	AccessKey string `env:"STORAGE_ACCESS_KEY"` // s3 Access Key
+	SecretKey string `env:"STORAGE_SECRET_KEY"` // s3 Secret Key
+	Bucket    string `env:"STORAGE_BUCKET"`     // s3 Bucket 名称，不存在时自动创建
+	Region    string `env:"STORAGE_REGION"`     // s3 区域
+	UseSSL    bool   `env:"STORAGE_USE_SSL"`    // 是否使用 https 连接 s3
+}
+
+type Search struct {
+	DictPath        string        `env:"SEARCH_DICT_PATH"`        // 中文分词词典路径，多个用逗号分隔，为空时使用 gse 自带词典，仅适用于本地开发
+	ExtractInterval time.Duration `env:"SEARCH_EXTRACT_INTERVAL"` // 后台提取资料正文的轮询间隔
+	ExtractMaxSize  int64         `env:"SEARCH_EXTRACT_MAX_SIZE"` // 提取正文的文件大小上限，单位 MB，超出的文件不提取
+}
+
+type Preview struct {
+	Width        int           `env:"PREVIEW_WIDTH"`         // 预览图宽度，单位像素
+	Interval     time.Duration `env:"PREVIEW_INTERVAL"`      // 后台生成预览图的轮询间隔
+	FfmpegPath   string        `env:"PREVIEW_FFMPEG_PATH"`   // ffmpeg 路径，为空时视频不生成封面
+	PdftoppmPath string        `env:"PREVIEW_PDFTOPPM_PATH"` // poppler pdftoppm 路径，为空时 PDF 不生成预览图
+}
+
+type Transcode struct {
+	FfmpegPath string               `env:"TRANSCODE_FFMPEG_PATH"` // ffmpeg 路径，为空时不转码，视频只能直接下载播放
+	Interval   time.Duration        `env:"TRANSCODE_INTERVAL"`    // 后台领取转码任务的轮询间隔
+	Renditions []TranscodeRendition // 转码生成的清晰度，为空时使用默认的 360p、720p、1080p
+}
+
+type TranscodeRendition struct {
+	Name         string // 名称，例如 720p
+	Height       int    // 视频高度
+	VideoBitrate int    // 视频码率，单位 kbps
+	AudioBitrate int    // 音频码率，单位 kbps
+}
+
+// 导出用户名单，数据较多时在后台生成文件，完成后通过签名地址下载
+type Export struct {
+	SyncMaxRows int           `env:"EXPORT_SYNC_MAX_ROWS"` // 直接下载的最大行数，超出时转为后台任务
+	Interval    time.Duration `env:"EXPORT_INTERVAL"`      // 后台领取导出任务的轮询间隔
+	Retention   time.Duration `env:"EXPORT_RETENTION"`     // 导出文件的保留时长，超过后连同任务一起删除
+}
+
+type Mail struct {
+	Type     string `env:"MAIL_TYPE"`      // 发送方式 smtp 或 file，file 不真正发送，只写入文件或日志
+	FilePath string `env:"MAIL_FILE_PATH"` // file 方式的邮件保存目录，为空时打印到日志
+	Host     string `env:"MAIL_HOST"`      // SMTP 服务器地址
+	Port     int    `env:"MAIL_PORT"`      // SMTP 端口，465 使用 TLS，其他端口支持时使用 STARTTLS
+	Username string `env:"MAIL_USERNAME"`  // SMTP 用户名，为空时不认证
+	Password string `env:"MAIL_PASSWORD"`  // SMTP 密码
+	From     string `env:"MAIL_FROM"`      // 发件人，例如 时频学习平台 <noreply@example.com>
+}
+
+// LDAP 登录，开启后本地账号和 LDAP 账号都可以登录，LDAP 账号第一次登录时自动创建对应的用户
+type Ldap struct {
+	Enabled            bool          `env:"LDAP_ENABLED"`
+	Url                string        `env:"LDAP_URL"`                  // 服务器地址，例如 ldap://localhost:389 或 ldaps://ldap.example.com
+	StartTLS           bool          `env:"LDAP_START_TLS"`            // ldap:// 连接是否升级为 TLS
+	InsecureSkipVerify bool          `env:"LDAP_INSECURE_SKIP_VERIFY"` // 不校验服务器证书，仅用于测试
+	Timeout            time.Duration `env:"LDAP_TIMEOUT"`              // 连接和每次请求的超时时间
+	BindDN             string        `env:"LDAP_BIND_DN"`              // 查询用户使用的服务账号，为空时匿名查询
+	BindPassword       string        `env:"LDAP_BIND_PASSWORD"`        // 服务账号的密码
+	BaseDN             string        `env:"LDAP_BASE_DN"`              // 查询用户的起始位置
+	UserFilter         string        `env:"LDAP_USER_FILTER"`          // 查询用户的条件，%s 替换为转义后的用户名，例如 (uid=%s)，AD 使用 (sAMAccountName=%s)
+
+	// 用户属性，为空的属性不同步
+	NameAttribute     string `env:"LDAP_NAME_ATTRIBUTE"`      // 用户名，与 UserFilter 中使用的属性一致
+	NickNameAttribute string `env:"LDAP_NICK_NAME_ATTRIBUTE"` // 显示名称
+	EmailAttribute    string `env:"LDAP_EMAIL_ATTRIBUTE"`     // 邮箱
+	PhoneAttribute    string `env:"LDAP_PHONE_ATTRIBUTE"`     // 手机号
+
+	// 用户所属的组，两种方式可以同时使用：读取用户的 GroupAttribute 属性（AD 和开启了 memberOf 的 OpenLDAP），
+	// 或者在 GroupBaseDN 下按 GroupFilter 查询，%s 替换为转义后的用户 DN，例如 (member=%s)
+	GroupAttribute string `env:"LDAP_GROUP_ATTRIBUTE"`
+	GroupBaseDN    string `env:"LDAP_GROUP_BASE_DN"`
+	GroupFilter    string `env:"LDAP_GROUP_FILTER"`
+	// 组的 DN，多个用分号分隔，每次登录时按所属的组同步内置角色（管理员、老师），不在这些组中的是学生
+	AdminGroups   string `env:"LDAP_ADMIN_GROUPS"`   // 管理员
+	TeacherGroups string `env:"LDAP_TEACHER_GROUPS"` // 老师
+
+	// 第一次登录时，存在同名的本地账号是否关联到 LDAP 账号，关联后只能使用 LDAP 密码登录
+	// 不关联时 LDAP 账号无法登录，需要管理员先处理同名的本地账号
+	LinkExisting bool `env:"LDAP_LINK_EXISTING"`
+}
+
+// OpenID Connect 单点登录，使用授权码 + PKCE 方式，开启后可以通过 Keycloak 等认证服务登录
+type Oidc struct {
+	Enabled      bool   `env:"OIDC_ENABLED"`
+	Issuer       string `env:"OIDC_ISSUER"`        // 认证服务地址，需要与 ID token 中的 iss 完全一致，例如 https://keycloak.example.com/realms/school
+	ClientId     string `env:"OIDC_CLIENT_ID"`     // 在认证服务中登记的客户端 ID
+	ClientSecret string `env:"OIDC_CLIENT_SECRET"` // 公开客户端为空
+	RedirectUrl  string `env:"OIDC_REDIRECT_URL"`  // 本系统的回调地址，需要在认证服务中登记，例如 https://example.com/api/v1/oidc/callback
+	Scopes       string `env:"OIDC_SCOPES"`        // 多个用空格分隔，为空时使用 openid profile email
+	FrontendUrl  string `env:"OIDC_FRONTEND_URL"`  // 前端处理登录结果的页面地址，ticket 或 error 作为查询参数拼接在后面
+
+	// ID token 中的声明名称，可以用 . 访问嵌套的字段，为空的不同步
+	NameClaim     string `env:"OIDC_NAME_CLAIM"`      // 用户名，只在创建用户时使用，为空时使用 sub
+	NickNameClaim string `env:"OIDC_NICK_NAME_CLAIM"` // 显示名称
+	EmailClaim    string `env:"OIDC_EMAIL_CLAIM"`     // 邮箱，email_verified 为 true 时用于关联已有的用户
+	PhoneClaim    string `env:"OIDC_PHONE_CLAIM"`     // 手机号
+	RoleClaim     string `env:"OIDC_ROLE_CLAIM"`      // 角色或者组，例如 Keycloak 的 realm_access.roles
+	// 角色名称，多个用逗号分隔，每次登录时按照拥有的角色同步单点登录创建的用户的内置角色（管理员、老师），没有这些角色的是学生
+	AdminRoles   string `env:"OIDC_ADMIN_ROLES"`   // 管理员
+	TeacherRoles string `env:"OIDC_TEACHER_ROLES"` // 老师
+
+	// 找不到对应的用户时自动创建，关闭时只能关联管理员事先创建、邮箱一致的账号
+	AutoCreate bool `env:"OIDC_AUTO_CREATE"`
+}
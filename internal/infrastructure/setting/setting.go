@@ -9,10 +9,18 @@ import (
 type Setting struct {
 	vp *viper.Viper
 
-	Server *Server
-	App    *App
-	JWT    *JWT
-	DB     *DB
+	Server    *Server
+	App       *App
+	JWT       *JWT
+	DB        *DB
+	Storage   *Storage
+	Search    *Search
+	Preview   *Preview
+	Transcode *Transcode
+	Export    *Export
+	Mail      *Mail
+	Ldap      *Ldap
+	Oidc      *Oidc
 }
 
 func New(configPath ...string) (*Setting, error) {
@@ -68,6 +76,46 @@ func (s *Setting) Init() error {
 		return err
 	}
 
+	err = vp.UnmarshalKey("Storage", &s.Storage)
+	if err != nil {
+		return err
+	}
+
+	err = vp.UnmarshalKey("Search", &s.Search)
+	if err != nil {
+		return err
+	}
+
+	err = vp.UnmarshalKey("Preview", &s.Preview)
+	if err != nil {
+		return err
+	}
+
+	err = vp.UnmarshalKey("Transcode", &s.Transcode)
+	if err != nil {
+		return err
+	}
+
+	err = vp.UnmarshalKey("Export", &s.Export)
+	if err != nil {
+		return err
+	}
+
+	err = vp.UnmarshalKey("Mail", &s.Mail)
+	if err != nil {
+		return err
+	}
+
+	err = vp.UnmarshalKey("Ldap", &s.Ldap)
+	if err != nil {
+		return err
+	}
+
+	err = vp.UnmarshalKey("Oidc", &s.Oidc)
+	if err != nil {
+		return err
+	}
+
 	// 读取系统环境变量
 	err = FillEnv(s.Server)
 	if err != nil {
@@ -85,6 +133,38 @@ func (s *Setting) Init() error {
 	if err != nil {
 		return err
 	}
+	err = FillEnv(s.Storage)
+	if err != nil {
+		return err
+	}
+	err = FillEnv(s.Search)
+	if err != nil {
+		return err
+	}
+	err = FillEnv(s.Preview)
+	if err != nil {
+		return err
+	}
+	err = FillEnv(s.Transcode)
+	if err != nil {
+		return err
+	}
+	err = FillEnv(s.Export)
+	if err != nil {
+		return err
+	}
+	err = FillEnv(s.Mail)
+	if err != nil {
+		return err
+	}
+	err = FillEnv(s.Ldap)
+	if err != nil {
+		return err
+	}
+	err = FillEnv(s.Oidc)
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
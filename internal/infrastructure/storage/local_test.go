@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocal(t *testing.T) {
+	root, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatalf("创建临时目录失败：%v", err)
+	}
+	defer os.RemoveAll(root)
+
+	s, err := NewLocal(root)
+	if err != nil {
+		t.Fatalf("初始化本地存储失败：%v", err)
+	}
+
+	testStorage(t, s)
+
+	t.Run("不允许跳出根目录", func(t *testing.T) {
+		err := s.Put(context.Background(), "../../outside.txt", strings.NewReader("x"), 1, "")
+		if assert.Nil(t, err) {
+			_, err = os.Stat(filepath.Join(root, "outside.txt"))
+			assert.Nil(t, err)
+		}
+	})
+
+	t.Run("key 不合法", func(t *testing.T) {
+		for _, key := range []string{"", "/", "dir/"} {
+			err := s.Put(context.Background(), key, strings.NewReader("x"), 1, "")
+			assert.Equal(t, ErrInvalidKey, err)
+		}
+	})
+
+	t.Run("不支持签名链接", func(t *testing.T) {
+		_, err := s.Presign(context.Background(), "a.txt", time.Minute)
+		assert.Equal(t, ErrPresignNotSupported, err)
+	})
+}
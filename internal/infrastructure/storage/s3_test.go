@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 需要一个 S3 兼容的服务，可以使用 docker-compose.yml 中的 MinIO：
+// STORAGE_TEST_S3_ENDPOINT=localhost:9000 go test ./internal/infrastructure/storage/
+func TestS3(t *testing.T) {
+	endpoint := os.Getenv("STORAGE_TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("未设置 STORAGE_TEST_S3_ENDPOINT，跳过 S3 存储测试")
+	}
+
+	s, err := NewS3(context.Background(), endpoint, "minioadmin", "minioadmin", "storage-test", "", false)
+	if err != nil {
+		t.Fatalf("初始化 S3 存储失败：%v", err)
+	}
+
+	testStorage(t, s)
+
+	t.Run("生成签名链接", func(t *testing.T) {
+		key := "presign.txt"
+		err := s.Put(context.Background(), key, strings.NewReader("x"), 1, "text/plain")
+		if assert.Nil(t, err) {
+			u, err := s.Presign(context.Background(), key, time.Minute)
+			if assert.Nil(t, err) {
+				assert.Contains(t, u, "X-Amz-Signature")
+			}
+			_ = s.Delete(context.Background(), key)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/setting"
+	"io"
+	"time"
+)
+
+const (
+	TypeLocal = "local" // 本地文件系统
+	TypeS3    = "s3"    // S3 兼容的对象存储，例如 MinIO
+)
+
+var (
+	ErrNotExist            = errors.New("文件不存在")
+	ErrPresignNotSupported = errors.New("当前存储不支持生成签名链接")
+	ErrInvalidKey          = errors.New("文件路径不合法")
+)
+
+// 文件存储接口，key 为使用 / 分隔的相对路径
+type Storage interface {
+	// 写入文件，size 未知时传 -1
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// 读取文件，返回的 Object 支持 Seek，可以直接用于处理 Range 请求
+	Get(ctx context.Context, key string) (Object, error)
+	// 删除文件，文件不存在时不报错
+	Delete(ctx context.Context, key string) error
+	// 查询文件信息，文件不存在时返回 ErrNotExist
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// 生成有时效的下载链接，不支持时返回 ErrPresignNotSupported
+	Presign(ctx context.Context, key string, expire time.Duration) (string, error)
+}
+
+type Object interface {
+	io.Reader
+	io.Seeker
+	io.Closer
+}
+
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+}
+
+// 根据配置项初始化存储
+func New(s *setting.Storage) (Storage, error) {
+	switch s.Type {
+	case TypeLocal, "":
+		return NewLocal(s.LocalPath)
+	case TypeS3:
+		return NewS3(context.Background(), s.Endpoint, s.AccessKey, s.SecretKey, s.Bucket, s.Region, s.UseSSL)
+	default:
+		return nil, fmt.Errorf("不支持的存储类型：%s", s.Type)
+	}
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 各个存储实现通用的测试用例
+func testStorage(t *testing.T, s Storage) {
+	ctx := context.Background()
+	content := time.Now().String()
+	key := "ab/" + content[:10] + ".txt"
+
+	t.Run("写入文件", func(t *testing.T) {
+		err := s.Put(ctx, key, strings.NewReader(content), int64(len(content)), "text/plain")
+		assert.Nil(t, err)
+	})
+
+	t.Run("查询文件信息", func(t *testing.T) {
+		info, err := s.Stat(ctx, key)
+		if assert.Nil(t, err) {
+			assert.Equal(t, int64(len(content)), info.Size)
+			assert.Contains(t, info.ContentType, "text/plain")
+		}
+	})
+
+	t.Run("读取文件", func(t *testing.T) {
+		obj, err := s.Get(ctx, key)
+		if assert.Nil(t, err) {
+			defer obj.Close()
+			b, err := ioutil.ReadAll(obj)
+			if assert.Nil(t, err) {
+				assert.Equal(t, content, string(b))
+			}
+		}
+	})
+
+	t.Run("从指定位置读取", func(t *testing.T) {
+		obj, err := s.Get(ctx, key)
+		if assert.Nil(t, err) {
+			defer obj.Close()
+			_, err = obj.Seek(5, 0)
+			if assert.Nil(t, err) {
+				b, err := ioutil.ReadAll(obj)
+				if assert.Nil(t, err) {
+					assert.Equal(t, content[5:], string(b))
+				}
+			}
+		}
+	})
+
+	t.Run("删除文件", func(t *testing.T) {
+		err := s.Delete(ctx, key)
+		if assert.Nil(t, err) {
+			_, err = s.Stat(ctx, key)
+			assert.Equal(t, ErrNotExist, err)
+			_, err = s.Get(ctx, key)
+			assert.Equal(t, ErrNotExist, err)
+		}
+	})
+
+	t.Run("删除不存在的文件", func(t *testing.T) {
+		err := s.Delete(ctx, key)
+		assert.Nil(t, err)
+	})
+}
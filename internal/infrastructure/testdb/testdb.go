@@ -2,8 +2,10 @@ package testdb
 
 import (
 	"github.com/go-pg/pg/v10"
+	"github.com/xuxusheng/time-frequency-be/global"
 	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/database"
 	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/setting"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/segment"
 )
 
 func New() (*pg.DB, error) {
@@ -17,7 +19,23 @@ func New() (*pg.DB, error) {
 		Server: &setting.Server{
 			Mode: "test",
 		},
+		App: &setting.App{
+			DefaultPs: 10,
+			MaxPs:     200,
+		},
+	}
+	// model.NewPage 等依赖全局配置项
+	global.Setting = &s
+
+	// 写入数据时需要分词生成全文检索字段
+	if global.Segmenter == nil {
+		seg, err := segment.New("")
+		if err != nil {
+			return nil, err
+		}
+		global.Segmenter = seg
 	}
+
 	db, err := database.New(&s)
 	if err != nil {
 		return nil, err
@@ -31,13 +49,18 @@ func New() (*pg.DB, error) {
 }
 
 func Truncate(db *pg.DB) error {
-	stmt := `TRUNCATE TABLE "user", class, subject, learning_material`
+	stmt := `TRUNCATE TABLE "user", user_role, class, class_subject, class_teacher, subject, learning_material, learning_material_version, upload, transcode_job, export_job, refresh_token, session, login_failure, recovery_code, password_reset, oidc_login`
 	_, err := db.Exec(stmt)
+	if err != nil {
+		return err
+	}
+	// 内置角色在建表时创建，只删除测试中新增的
+	_, err = db.Exec(`DELETE FROM role WHERE NOT builtin`)
 	return err
 }
 
 func Drop(db *pg.DB) error {
-	stmt := `DROP TABLE "user", class, subject, learning_material`
+	stmt := `DROP TABLE "user", role, user_role, class, class_subject, class_teacher, subject, learning_material, learning_material_version, upload, transcode_job, export_job, refresh_token, session, login_failure, recovery_code, password_reset, oidc_login`
 	_, err := db.Exec(stmt)
 	return err
 }
@@ -25,8 +25,13 @@ func SeedUser(db *pg.DB) ([]*model.User, error) {
 		if err != nil {
 			return nil, err
 		}
-		// 把 createdBy 取出来，和 dao 中的方法保持一致
-		err = db.Model(user).WherePK().Relation("CreatedBy").Select()
+		// 默认都是学生
+		_, err = db.Exec(`INSERT INTO user_role (user_id, role_id) SELECT ?, id FROM role WHERE name = ?`, user.Id, model.RoleStudent)
+		if err != nil {
+			return nil, err
+		}
+		// 把 createdBy 和角色取出来，和 dao 中的方法保持一致
+		err = db.Model(user).WherePK().Relation("CreatedBy").Relation("Roles").Select()
 		if err != nil {
 			return nil, err
 		}
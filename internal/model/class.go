@@ -8,7 +8,7 @@ type Class struct {
 	tableName struct{} `pg:"class"`
 
 	// --- 业务字段 ---
-	Name        string `json:"name" pg:",unique,notnull"`                     // 班级名称
+	Name        string `json:"name" pg:",notnull"`                            // 班级名称
 	Description string `json:"description" pg:",use_zero,notnull,default:''"` // 班级描述
 
 	// --- 关联字段 ---
@@ -20,4 +20,5 @@ type Class struct {
 	Id        int       `json:"id"`
 	CreatedAt time.Time `json:"created_at" pg:",notnull,default:now()"`
 	UpdatedAt time.Time `json:"updated_at" pg:",notnull,default:now()"`
+	DeletedAt time.Time `json:"-" pg:",soft_delete"` // 删除时间，不为空时表示在回收站中
 }
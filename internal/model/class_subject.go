@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// 班级选修的科目，班级中的学生只能看到已选科目下的学习资料
+type ClassSubject struct {
+	// --- 表名 ---
+	tableName struct{} `pg:"class_subject"`
+
+	// --- 关联字段 ---
+	ClassId   int      `json:"class_id" pg:",pk"`
+	Class     *Class   `json:"-" pg:"rel:has-one"`
+	SubjectId int      `json:"subject_id" pg:",pk"`
+	Subject   *Subject `json:"-" pg:"rel:has-one"`
+
+	// --- 通用字段 ---
+	CreatedAt time.Time `json:"created_at" pg:",notnull,default:now()"`
+}
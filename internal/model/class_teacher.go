@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// 老师在班级中的身份
+const (
+	ClassTeacherHead      string = "head"      // 班主任，每个班级最多一个
+	ClassTeacherAssistant string = "assistant" // 任课老师或助理老师
+)
+
+// 班级的老师，老师只能管理自己任教班级中的学生
+type ClassTeacher struct {
+	// --- 表名 ---
+	tableName struct{} `pg:"class_teacher"`
+
+	// --- 业务字段 ---
+	Type string `json:"type" pg:",notnull"` // head 班主任，assistant 任课老师
+
+	// --- 关联字段 ---
+	ClassId int    `json:"class_id" pg:",pk"`
+	Class   *Class `json:"-" pg:"rel:has-one"`
+	UserId  int    `json:"user_id" pg:",pk"`
+	User    *User  `json:"user,omitempty" pg:"rel:has-one"`
+
+	// --- 通用字段 ---
+	CreatedAt time.Time `json:"created_at" pg:",notnull,default:now()"`
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10"
+	"github.com/xuxusheng/time-frequency-be/global"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/signurl"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// 后台导出任务，数据较多时在后台生成文件并保存到存储中，完成后通过签名地址下载
+type ExportJob struct {
+	// --- 表名 ---
+	tableName struct{} `pg:"export_job"`
+
+	// --- 业务字段 ---
+	Type    string   `json:"type" pg:",notnull"`                      // 导出的数据，user 所有用户或 student 可以管理的学生
+	Format  string   `json:"format" pg:",notnull"`                    // 文件格式，csv 或 xlsx
+	Columns []string `json:"columns" pg:",array,notnull"`             // 导出的列
+	Query   string   `json:"query" pg:",use_zero,notnull,default:''"` // 与查询列表时相同的检索条件
+	Role    string   `json:"role" pg:",use_zero,notnull,default:''"`  // 只导出拥有这个角色的用户，为空时不限制
+
+	Status   string `json:"status" pg:",notnull,default:'pending'"`    // 任务状态
+	Error    string `json:"error" pg:",use_zero,notnull,default:''"`   // 最近一次失败的原因
+	Attempts int    `json:"attempts" pg:",use_zero,notnull,default:0"` // 已经执行的次数，包括进程中途退出的
+	Rows     int    `json:"rows" pg:",use_zero,notnull,default:0"`     // 导出的行数，不包括表头
+	FileKey  string `json:"-" pg:",use_zero,notnull,default:''"`       // 生成的文件在存储中的 key
+
+	StartedAt  time.Time `json:"started_at"`  // 最近一次开始执行的时间
+	FinishedAt time.Time `json:"finished_at"` // 完成时间
+	ExpiresAt  time.Time `json:"expires_at"`  // 文件的保留期限，过期后连同任务一起删除
+
+	// 执行中的任务会定时续期，进程退出后租约过期，其他进程或者重启后的进程会重新执行
+	LockedUntil time.Time `json:"-"`
+
+	DownloadUrl string `json:"download_url" pg:"-"` // 完成后的下载地址，不需要携带 token
+
+	// --- 关联字段 ---
+	CreatedById int `json:"-" pg:",notnull"` // 创建人，只有创建人可以查看任务
+
+	// --- 通用字段 ---
+	Id        int       `json:"id"`
+	CreatedAt time.Time `json:"created_at" pg:",notnull,default:now()"`
+	UpdatedAt time.Time `json:"updated_at" pg:",notnull,default:now()"`
+}
+
+// 导出的数据
+const (
+	ExportTypeUser    = "user"    // 所有用户，对应管理员的用户列表
+	ExportTypeStudent = "student" // 可以管理的学生，对应老师的学生列表
+)
+
+// 导出任务状态
+const (
+	ExportStatusPending = "pending" // 等待执行
+	ExportStatusRunning = "running" // 执行中
+	ExportStatusDone    = "done"    // 已完成，可以下载
+	ExportStatusFailed  = "failed"  // 多次重试后仍然失败
+)
+
+var _ pg.AfterScanHook = (*ExportJob)(nil)
+
+// 查询出已完成的任务后生成下载地址
+func (e *ExportJob) AfterScan(ctx context.Context) error {
+	if e.Status == ExportStatusDone {
+		e.DownloadUrl = ExportDownloadUrl(e.Id)
+	}
+	return nil
+}
+
+// 导出文件签名使用的资源名
+func ExportResource(id int) string {
+	return "export:" + strconv.Itoa(id)
+}
+
+// 生成带签名的导出文件下载地址，有效期与学习资料的下载地址相同
+func ExportDownloadUrl(id int) string {
+	if id == 0 || global.Setting == nil || global.Setting.JWT == nil || global.Setting.App == nil {
+		return ""
+	}
+	expires := time.Now().Add(global.Setting.App.DownloadUrlExpire)
+	q := url.Values{}
+	q.Set("id", strconv.Itoa(id))
+	q.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	q.Set("signature", signurl.Sign(global.Setting.JWT.Secret, ExportResource(id), expires))
+	return "/api/v1/export/download?" + q.Encode()
+}
@@ -2,4 +2,12 @@ package model
 
 type JWTClaims struct {
 	Uid int `json:"uid"` // 用户ID
+	Ver int `json:"ver"` // 签发时用户的 token 版本，与用户当前的版本不一致时 token 失效
+	Sid int `json:"sid"` // 所属的登录会话，会话作废后 token 失效
+}
+
+// 密码校验通过、还需要两步验证时签发的临时凭证，只能用于完成登录
+type MfaClaims struct {
+	Uid    int    `json:"uid"`    // 用户ID
+	Device string `json:"device"` // 第一步登录时传入的设备名称
 }
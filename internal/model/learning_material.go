@@ -8,11 +8,24 @@ type LearningMaterial struct {
 	tableName struct{} `pg:"learning_material"`
 
 	// --- 业务字段 ---
-	Name        string `json:"name" pg:",unique,notnull"`                     // 资料名称
+	Name        string `json:"name" pg:",notnull"`                            // 资料名称
 	Description string `json:"description" pg:",use_zero,notnull,default:''"` // 资料描述
+	Version     int    `json:"version" pg:",notnull,default:1"`               // 当前版本号，Md5 和 FilePath 与当前版本一致
 	Md5         string `json:"-" pg:",notnull"`
 	FilePath    string `json:"-" pg:",notnull"` // 文件存放的路径
 
+	// 从文件中提取正文，用于全文检索，由后台任务异步完成
+	ExtractStatus string `json:"extract_status" pg:",notnull,default:'pending'"`  // 正文提取状态
+	ExtractError  string `json:"extract_error" pg:",use_zero,notnull,default:''"` // 提取失败的原因
+	Content       string `json:"-" pg:",use_zero,notnull,default:''"`             // 提取出的正文
+
+	// 预览图，同样由后台任务异步生成，没有预览图时 PreviewUrl 返回通用图标
+	PreviewStatus string `json:"preview_status" pg:",notnull,default:'pending'"` // 预览图生成状态
+	PreviewPath   string `json:"-" pg:",use_zero,notnull,default:''"`            // 预览图在存储中的 key
+	PreviewUrl    string `json:"preview_url" pg:"-"`                             // 预览图地址，带签名，查询时生成
+
+	SearchVector string `json:"-" pg:"type:tsvector"` // 全文检索使用的分词结果
+
 	// --- 关联字段 ---
 	SubjectId int      `json:"-"`
 	Subject   *Subject `json:"-" pg:"rel:has-one"` // 资料所属的科目
@@ -23,8 +36,36 @@ type LearningMaterial struct {
 	UpdatedById int   `json:"-" pg:",notnull"`    // 资料的更新人 ID
 	UpdatedBy   *User `json:"-" pg:"rel:has-one"` // 资料的更新人
 
+	Versions []*LearningMaterialVersion `json:"-" pg:"rel:has-many"` // 资料的历史版本
+
 	// --- 通用字段 ---
 	Id        int       `json:"id"`
 	CreatedAt time.Time `json:"created_at" pg:",notnull,default:now()"`
 	UpdatedAt time.Time `json:"updated_at" pg:",notnull,default:now()"`
+	DeletedAt time.Time `json:"-" pg:",soft_delete"` // 删除时间，不为空时表示在回收站中
+}
+
+// 正文提取状态
+const (
+	ExtractStatusPending     = "pending"     // 等待提取，新建资料或上传新版本后进入该状态
+	ExtractStatusDone        = "done"        // 提取完成
+	ExtractStatusFailed      = "failed"      // 提取失败，原因见 ExtractError
+	ExtractStatusUnsupported = "unsupported" // 文件类型不支持提取，例如视频
+)
+
+// 预览图生成状态
+const (
+	PreviewStatusPending     = "pending"     // 等待生成，新建资料或上传新版本后进入该状态
+	PreviewStatusDone        = "done"        // 已生成
+	PreviewStatusFailed      = "failed"      // 生成失败，使用通用图标
+	PreviewStatusUnsupported = "unsupported" // 文件类型不支持或者没有配置所需的外部程序，使用通用图标
+)
+
+// 学习资料的查询条件
+type LearningMaterialFilter struct {
+	SubjectId int    // 所属科目，为 0 时不限
+	Query     string // 模糊匹配资料名称和描述
+
+	// 用户有权访问的科目，为 nil 时不限制，为空切片时查询不到任何资料
+	SubjectIds []int
 }
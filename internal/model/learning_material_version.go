@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// 学习资料的历史版本，每次重新上传文件都会生成一个新版本
+type LearningMaterialVersion struct {
+	// --- 表名 ---
+	tableName struct{} `pg:"learning_material_version"`
+
+	// --- 业务字段 ---
+	Version  int    `json:"version" pg:",notnull,unique:material_version"` // 版本号，从 1 开始递增
+	Note     string `json:"note" pg:",use_zero,notnull,default:''"`        // 版本说明，告诉学生这个版本改了什么
+	Md5      string `json:"md5" pg:",notnull"`
+	FilePath string `json:"-" pg:",notnull"` // 文件存放的路径
+
+	// --- 关联字段 ---
+	LearningMaterialId int               `json:"learning_material_id" pg:",notnull,unique:material_version"`
+	LearningMaterial   *LearningMaterial `json:"-" pg:"rel:has-one"` // 版本所属的资料
+
+	CreatedById int   `json:"-" pg:",notnull"`
+	CreatedBy   *User `json:"created_by" pg:"rel:has-one"` // 版本的上传人
+
+	// --- 通用字段 ---
+	Id        int       `json:"id"`
+	CreatedAt time.Time `json:"created_at" pg:",notnull,default:now()"`
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// 登录失败记录，账号和 IP 分别计数，登录成功或者管理员解锁后删除
+type LoginFailure struct {
+	// --- 表名 ---
+	tableName struct{} `pg:"login_failure"`
+
+	// --- 业务字段 ---
+	Key          string    `json:"key" pg:",notnull,unique"`                   // account:<用户名> 或 ip:<IP>
+	Count        int       `json:"count" pg:",use_zero,notnull,default:0"`     // 统计窗口内连续失败的次数
+	LastFailedAt time.Time `json:"last_failed_at" pg:",notnull,default:now()"` // 最近一次失败的时间
+	LockedUntil  time.Time `json:"locked_until"`                               // 锁定到什么时候，为空时没有锁定
+
+	// --- 通用字段 ---
+	Id int `json:"id"`
+}
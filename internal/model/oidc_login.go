@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// 单点登录过程中的临时数据，只保存 token 的 hash，只能使用一次
+const (
+	OidcLoginTypeState  string = "state"  // 跳转到认证服务前生成，回调时用 state 找回 nonce 和 code_verifier
+	OidcLoginTypeTicket string = "ticket" // 回调成功后生成，前端用它换取登录 token
+)
+
+// 单点登录的 state 和 ticket
+type OidcLogin struct {
+	// --- 表名 ---
+	tableName struct{} `pg:"oidc_login"`
+
+	// --- 业务字段 ---
+	Type         string    `json:"-" pg:",notnull"`        // state 或 ticket
+	TokenHash    string    `json:"-" pg:",notnull,unique"` // state 或 ticket 的 sha256
+	Nonce        string    `json:"-" pg:",use_zero,notnull,default:''"`
+	CodeVerifier string    `json:"-" pg:",use_zero,notnull,default:''"`
+	ExpiresAt    time.Time `json:"-" pg:",notnull"` // 过期时间
+
+	// --- 关联字段 ---
+	UserId int `json:"-" pg:",use_zero,notnull,default:0"` // ticket 对应的用户
+
+	// --- 通用字段 ---
+	Id        int       `json:"id"`
+	CreatedAt time.Time `json:"created_at" pg:",notnull,default:now()"`
+}
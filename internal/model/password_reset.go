@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// 找回密码时发送到邮箱的重置 token，只保存 hash，只能使用一次
+type PasswordReset struct {
+	// --- 表名 ---
+	tableName struct{} `pg:"password_reset"`
+
+	// --- 业务字段 ---
+	TokenHash string    `json:"-" pg:",notnull,unique"` // token 的 sha256
+	ExpiresAt time.Time `json:"-" pg:",notnull"`        // 过期时间
+	UsedAt    time.Time `json:"-"`                      // 使用时间，重新申请后之前未使用的也会标记为已使用
+
+	// --- 关联字段 ---
+	UserId int `json:"-" pg:",notnull"`
+
+	// --- 通用字段 ---
+	Id        int       `json:"id"`
+	CreatedAt time.Time `json:"created_at" pg:",notnull,default:now()"`
+}
@@ -0,0 +1,60 @@
+package model
+
+// 权限，角色由若干权限组成，接口通过 middleware.RequirePermission 校验
+const (
+	PermissionAll = "*" // 所有权限，只用于内置的管理员角色
+
+	PermissionStudentManage   = "student.manage"     // 创建、查询、修改、删除自己任教班级中的学生账号
+	PermissionStudentAll      = "student.manage_all" // 与 student.manage 一起使用，管理所有学生，不限于自己任教的班级
+	PermissionClassManage     = "class.manage"       // 管理班级和班级成员
+	PermissionClassTeacher    = "class.teacher"      // 指定班级的班主任和任课老师
+	PermissionSubjectManage   = "subject.manage"     // 创建、修改、删除科目
+	PermissionMaterialUpload  = "material.upload"    // 上传学习资料和新版本
+	PermissionMaterialManage  = "material.manage"    // 修改、回滚、删除学习资料，重新提取正文和转码
+	PermissionMaterialReadAll = "material.read_all"  // 查看所有科目的学习资料，没有时只能查看自己所教或者所在班级已选的科目
+	PermissionUserSearch      = "user.search"        // 全文检索用户
+	PermissionUserRead        = "user.read"          // 查看所有用户
+	PermissionUserCreate      = "user.create"        // 创建任意角色的用户
+	PermissionUserUpdate      = "user.update"        // 修改用户信息和密码
+	PermissionUserDelete      = "user.delete"        // 删除用户
+	PermissionUserSecurity    = "user.security"      // 强制下线、解锁账号和 IP、重置两步验证
+	PermissionRoleManage      = "role.manage"        // 创建、修改、删除角色
+	PermissionRoleAssign      = "role.assign"        // 为用户分配角色，只能分配或者收回自己拥有全部权限的角色
+	PermissionRecycleBin      = "recycle_bin.manage" // 查看、恢复、彻底删除回收站中的数据
+)
+
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// 所有可以分配给角色的权限，不包括 PermissionAll
+var Permissions = []*Permission{
+	{Name: PermissionStudentManage, Description: "管理任教班级中的学生账号"},
+	{Name: PermissionStudentAll, Description: "管理所有学生账号"},
+	{Name: PermissionClassManage, Description: "管理班级和班级成员"},
+	{Name: PermissionClassTeacher, Description: "指定班级的老师"},
+	{Name: PermissionSubjectManage, Description: "管理科目"},
+	{Name: PermissionMaterialUpload, Description: "上传学习资料"},
+	{Name: PermissionMaterialManage, Description: "管理学习资料"},
+	{Name: PermissionMaterialReadAll, Description: "查看所有科目的学习资料"},
+	{Name: PermissionUserSearch, Description: "搜索用户"},
+	{Name: PermissionUserRead, Description: "查看所有用户"},
+	{Name: PermissionUserCreate, Description: "创建用户"},
+	{Name: PermissionUserUpdate, Description: "修改用户信息"},
+	{Name: PermissionUserDelete, Description: "删除用户"},
+	{Name: PermissionUserSecurity, Description: "管理用户的登录安全"},
+	{Name: PermissionRoleManage, Description: "管理角色"},
+	{Name: PermissionRoleAssign, Description: "为用户分配角色"},
+	{Name: PermissionRecycleBin, Description: "管理回收站"},
+}
+
+// 是否是可以分配给角色的权限
+func IsPermission(name string) bool {
+	for _, p := range Permissions {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
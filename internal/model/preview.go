@@ -0,0 +1,44 @@
+package model
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10"
+	"github.com/xuxusheng/time-frequency-be/global"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/signurl"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var _ pg.AfterScanHook = (*LearningMaterial)(nil)
+
+// 查询出资料后生成预览图地址
+func (l *LearningMaterial) AfterScan(ctx context.Context) error {
+	l.PreviewUrl = PreviewUrl(l.Id, l.Version)
+	return nil
+}
+
+// 预览图签名使用的资源名
+func PreviewResource(id int) string {
+	return "learning-material-preview:" + strconv.Itoa(id)
+}
+
+// 生成带签名的预览图地址，<img> 标签无法携带 Token，所以和下载地址一样使用签名鉴权
+// 过期时间按有效期对齐，同一时间段内生成的地址相同，便于浏览器缓存；v 为资料版本，上传新版本后地址随之变化
+func PreviewUrl(id, version int) string {
+	if id == 0 || global.Setting == nil || global.Setting.JWT == nil || global.Setting.App == nil {
+		return ""
+	}
+	window := global.Setting.App.DownloadUrlExpire
+	if window <= 0 {
+		window = 10 * time.Minute
+	}
+	expires := time.Now().Truncate(window).Add(2 * window)
+
+	q := url.Values{}
+	q.Set("id", strconv.Itoa(id))
+	q.Set("v", strconv.Itoa(version))
+	q.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	q.Set("signature", signurl.Sign(global.Setting.JWT.Secret, PreviewResource(id), expires))
+	return "/api/v1/learning-material/preview?" + q.Encode()
+}
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// 两步验证的恢复码，手机丢失时代替验证码使用，每个只能用一次，只保存 hash
+type RecoveryCode struct {
+	// --- 表名 ---
+	tableName struct{} `pg:"recovery_code"`
+
+	// --- 业务字段 ---
+	CodeHash string    `json:"-" pg:",notnull"` // 恢复码的 sha256
+	UsedAt   time.Time `json:"-"`               // 使用时间，为空时还没有使用
+
+	// --- 关联字段 ---
+	UserId int `json:"-" pg:",notnull"`
+
+	// --- 通用字段 ---
+	Id        int       `json:"id"`
+	CreatedAt time.Time `json:"created_at" pg:",notnull,default:now()"`
+}
+
+// 开始设置两步验证时返回的密钥
+type TotpSetup struct {
+	Secret string `json:"secret"` // 密钥，无法扫码时在验证器 App 中手动输入
+	Uri    string `json:"uri"`    // otpauth 地址，前端转换成二维码
+}
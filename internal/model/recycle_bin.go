@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// 回收站中数据的类型
+const (
+	RecycleBinTypeUser             = "user"
+	RecycleBinTypeClass            = "class"
+	RecycleBinTypeSubject          = "subject"
+	RecycleBinTypeLearningMaterial = "learning_material"
+)
+
+// 回收站中的数据，不同类型的数据统一成一种结构，按删除时间倒序排列
+type RecycleBinItem struct {
+	Type      string    `json:"type"` // 数据类型，user、class、subject 或 learning_material
+	Id        int       `json:"id"`
+	Name      string    `json:"name"` // 用户名、班级名称、科目名称或资料名称
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at" pg:"-"` // 预计彻底删除的时间，没有配置保留时长时为零值
+}
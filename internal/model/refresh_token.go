@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// 刷新 token，只保存 hash，每次刷新都会作废旧的并签发新的
+// 已作废的 token 被再次使用时，说明可能已经泄露，所属的会话一起作废
+type RefreshToken struct {
+	// --- 表名 ---
+	tableName struct{} `pg:"refresh_token"`
+
+	// --- 业务字段 ---
+	TokenHash    string    `json:"-" pg:",notnull,unique"`   // token 的 sha256
+	TokenVersion int       `json:"-" pg:",use_zero,notnull"` // 签发时用户的 token 版本，不一致时不允许刷新
+	ExpiresAt    time.Time `json:"expires_at" pg:",notnull"` // 过期时间
+	RevokedAt    time.Time `json:"-"`                        // 作废时间，刷新或退出登录后作废
+
+	// --- 关联字段 ---
+	UserId    int `json:"-" pg:",notnull"`
+	SessionId int `json:"-" pg:",notnull"` // 所属的登录会话
+
+	// --- 通用字段 ---
+	Id        int       `json:"id"`
+	CreatedAt time.Time `json:"created_at" pg:",notnull,default:now()"`
+}
+
+// 登录或者刷新后返回给客户端的 token
+type TokenPair struct {
+	Token        string `json:"token"`         // 访问接口使用的 JWT
+	RefreshToken string `json:"refresh_token"` // 用于换取新的 token
+	ExpiresIn    int    `json:"expires_in"`    // token 的有效期，单位秒
+}
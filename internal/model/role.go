@@ -0,0 +1,62 @@
+package model
+
+import "time"
+
+// 内置角色，启动时自动创建，不能删除，内置的管理员角色也不能修改权限
+const (
+	RoleAdmin   string = "admin"
+	RoleTeacher string = "teacher"
+	RoleStudent string = "student"
+)
+
+// 内置角色及其默认权限，老师和学生的权限之后可以由管理员调整
+var BuiltinRoles = []*Role{
+	{Name: RoleAdmin, NickName: "管理员", Description: "拥有所有权限", Permissions: []string{PermissionAll}, Builtin: true},
+	{Name: RoleTeacher, NickName: "老师", Description: "管理学生、班级、科目和学习资料", Permissions: []string{
+		PermissionStudentManage,
+		PermissionClassManage,
+		PermissionSubjectManage,
+		PermissionMaterialUpload,
+		PermissionMaterialManage,
+		PermissionUserSearch,
+	}, Builtin: true},
+	{Name: RoleStudent, NickName: "学生", Description: "查看所在班级已选科目的学习资料", Permissions: []string{}, Builtin: true},
+}
+
+// 角色，由若干权限组成，一个用户可以有多个角色，拥有的权限为所有角色权限的并集
+type Role struct {
+	// --- 表名 ---
+	tableName struct{} `pg:"role"`
+
+	// --- 业务字段 ---
+	Name        string   `json:"name" pg:",notnull,unique"` // 角色标识，例如 teaching_assistant，创建后不能修改
+	NickName    string   `json:"nick_name" pg:",notnull"`   // 显示名称，例如 助教
+	Description string   `json:"description" pg:",use_zero,notnull,default:''"`
+	Permissions []string `json:"permissions" pg:",array,notnull,default:'{}'"`
+	Builtin     bool     `json:"builtin" pg:",use_zero,notnull,default:false"`
+
+	// --- 通用字段 ---
+	Id        int       `json:"id"`
+	CreatedAt time.Time `json:"created_at" pg:",notnull,default:now()"`
+	UpdatedAt time.Time `json:"updated_at" pg:",notnull,default:now()"`
+}
+
+// 角色是否拥有某个权限
+func (r *Role) Can(permission string) bool {
+	for _, p := range r.Permissions {
+		if p == PermissionAll || p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// 是否是内置角色的标识
+func IsBuiltinRole(name string) bool {
+	for _, r := range BuiltinRoles {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package model
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10"
+	"github.com/xuxusheng/time-frequency-be/global"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/segment"
+)
+
+// 全文检索结果的类型
+const (
+	SearchTypeLearningMaterial = "learning_material"
+	SearchTypeSubject          = "subject"
+	SearchTypeUser             = "user"
+)
+
+// 支持全文检索的数据，数据表中有一个 tsvector 类型的 search_vector 列
+// 插入时通过 BeforeInsert 钩子自动生成，更新时需要 dao 在拿到完整数据后调用 RefreshSearchVector 重新生成
+type Searchable interface {
+	RefreshSearchVector()
+}
+
+// 全文检索的结果，不同类型的数据统一成一种结构，按相关度排序
+type SearchResult struct {
+	Type        string  `json:"type"` // 数据类型，learning_material、subject 或 user
+	Id          int     `json:"id"`
+	Title       string  `json:"title"`       // 资料名称、科目名称或用户名
+	Description string  `json:"description"` // 资料描述、科目描述或用户昵称
+	Rank        float32 `json:"rank"`        // 相关度，越大越相关
+}
+
+// 全文检索的条件
+type SearchFilter struct {
+	Query string   // 搜索词
+	Types []string // 要搜索的数据类型，为空时搜索全部
+
+	// 有权访问的科目，为 nil 时不限制，用于过滤学习资料
+	SubjectIds []int
+}
+
+// 将搜索词转换为 tsquery，分词器没有初始化或者没有有效的词时返回空字符串
+func SearchQuery(query string) string {
+	if global.Segmenter == nil {
+		return ""
+	}
+	return global.Segmenter.TSQuery(query)
+}
+
+func searchVector(fields ...segment.Field) string {
+	if global.Segmenter == nil {
+		return ""
+	}
+	return global.Segmenter.TSVector(fields...)
+}
+
+var (
+	_ pg.BeforeInsertHook = (*LearningMaterial)(nil)
+	_ pg.BeforeInsertHook = (*Subject)(nil)
+	_ pg.BeforeInsertHook = (*User)(nil)
+)
+
+func (l *LearningMaterial) BeforeInsert(ctx context.Context) (context.Context, error) {
+	l.RefreshSearchVector()
+	return ctx, nil
+}
+
+// 名称的权重高于描述，文件正文的权重最低
+func (l *LearningMaterial) RefreshSearchVector() {
+	l.SearchVector = searchVector(
+		segment.Field{Text: l.Name, Weight: segment.WeightA},
+		segment.Field{Text: l.Description, Weight: segment.WeightB},
+		segment.Field{Text: l.Content, Weight: segment.WeightD},
+	)
+}
+
+func (s *Subject) BeforeInsert(ctx context.Context) (context.Context, error) {
+	s.RefreshSearchVector()
+	return ctx, nil
+}
+
+func (s *Subject) RefreshSearchVector() {
+	s.SearchVector = searchVector(
+		segment.Field{Text: s.Name, Weight: segment.WeightA},
+		segment.Field{Text: s.Description, Weight: segment.WeightB},
+	)
+}
+
+func (u *User) BeforeInsert(ctx context.Context) (context.Context, error) {
+	u.RefreshSearchVector()
+	return ctx, nil
+}
+
+// 用户名和昵称的权重高于手机号和邮箱
+func (u *User) RefreshSearchVector() {
+	u.SearchVector = searchVector(
+		segment.Field{Text: u.Name, Weight: segment.WeightA},
+		segment.Field{Text: u.NickName, Weight: segment.WeightA},
+		segment.Field{Text: u.Phone, Weight: segment.WeightB},
+		segment.Field{Text: u.Email, Weight: segment.WeightB},
+	)
+}
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// 登录会话，每次登录创建一个，之后刷新得到的 token 都属于同一个会话
+// 会话作废后，属于它的 token 和刷新 token 立即失效
+type Session struct {
+	// --- 表名 ---
+	tableName struct{} `pg:"session"`
+
+	// --- 业务字段 ---
+	Device     string    `json:"device" pg:",use_zero,notnull,default:''"`     // 设备名称，登录时可以指定，否则根据 UserAgent 生成
+	Ip         string    `json:"ip" pg:",use_zero,notnull,default:''"`         // 登录时的 IP
+	UserAgent  string    `json:"user_agent" pg:",use_zero,notnull,default:''"` // 登录时的 UserAgent
+	LastSeenAt time.Time `json:"last_seen_at" pg:",notnull,default:now()"`     // 最近一次使用的时间
+	ExpiresAt  time.Time `json:"expires_at" pg:",notnull"`                     // 与最新的刷新 token 同时过期
+	RevokedAt  time.Time `json:"-"`                                            // 作废时间，退出登录或者被强制下线后作废
+	Current    bool      `json:"current" pg:"-"`                               // 是否为当前请求所属的会话，查询时填充
+
+	// --- 关联字段 ---
+	UserId int `json:"-" pg:",notnull"`
+
+	// --- 通用字段 ---
+	Id        int       `json:"id"`
+	CreatedAt time.Time `json:"created_at" pg:",notnull,default:now()"` // 登录时间
+}
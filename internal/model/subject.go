@@ -8,16 +8,20 @@ type Subject struct {
 	tableName struct{} `pg:"subject"`
 
 	// --- 业务字段 ---
-	Name        string `json:"name" pg:",unique,notnull"`                     // 科目名称
+	Name        string `json:"name" pg:",notnull"`                            // 科目名称
 	Description string `json:"description" pg:",use_zero,notnull,default:''"` // 科目描述
 
+	SearchVector string `json:"-" pg:"type:tsvector"` // 全文检索使用的分词结果
+
 	// --- 关联字段
-	LearningMaterials []*LearningMaterial `json:"-" pg:"rel:has-many"` // 科目下包含的所有学习资料
-	CreatedById       int                 `json:"-" pg:",notnull"`     // 创建人ID
-	CreatedBy         *User               `json:"-" pg:"rel:has-one"`  // 创建人
+	LearningMaterials     []*LearningMaterial `json:"-" pg:"rel:has-many"`            // 科目下包含的所有学习资料
+	LearningMaterialCount int                 `json:"learning_material_count" pg:"-"` // 科目下学习资料的数量，查询时填充
+	CreatedById           int                 `json:"-" pg:",notnull"`                // 创建人ID
+	CreatedBy             *User               `json:"-" pg:"rel:has-one"`             // 创建人
 
 	// --- 通用字段 ---
 	Id        int       `json:"id"`
 	CreatedAt time.Time `json:"created_at" pg:",notnull,default:now()"`
 	UpdatedAt time.Time `json:"updated_at" pg:",notnull,default:now()"`
+	DeletedAt time.Time `json:"-" pg:",soft_delete"` // 删除时间，不为空时表示在回收站中
 }
@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+// 视频转码任务，将视频资料转码为多码率的 HLS
+// 每个资料的每个文件版本（md5）对应一个任务，回滚到旧版本时可以直接复用之前的转码结果
+type TranscodeJob struct {
+	// --- 表名 ---
+	tableName struct{} `pg:"transcode_job"`
+
+	// --- 业务字段 ---
+	Md5        string    `json:"md5" pg:",notnull,unique:material_md5"`     // 转码的源文件 md5，转码结果按 md5 存放，内容相同的视频共用
+	Status     string    `json:"status" pg:",notnull,default:'pending'"`    // 任务状态
+	Error      string    `json:"error" pg:",use_zero,notnull,default:''"`   // 最近一次失败的原因
+	Attempts   int       `json:"attempts" pg:",use_zero,notnull,default:0"` // 已经执行的次数，包括进程中途退出的
+	Renditions []string  `json:"renditions" pg:",array"`                    // 已生成的清晰度
+	Files      []string  `json:"-" pg:",array"`                             // 生成的所有文件在存储中的 key
+	StartedAt  time.Time `json:"started_at"`                                // 最近一次开始执行的时间
+	FinishedAt time.Time `json:"finished_at"`                               // 完成时间
+
+	// 执行中的任务会定时续期，进程退出后租约过期，其他进程或者重启后的进程会重新执行
+	LockedUntil time.Time `json:"-"`
+
+	// --- 关联字段 ---
+	LearningMaterialId int `json:"learning_material_id" pg:",notnull,unique:material_md5"`
+
+	// --- 通用字段 ---
+	Id        int       `json:"id"`
+	CreatedAt time.Time `json:"created_at" pg:",notnull,default:now()"`
+	UpdatedAt time.Time `json:"updated_at" pg:",notnull,default:now()"`
+}
+
+// 转码任务状态
+const (
+	TranscodeStatusPending = "pending" // 等待执行
+	TranscodeStatusRunning = "running" // 执行中
+	TranscodeStatusDone    = "done"    // 已完成，可以播放
+	TranscodeStatusFailed  = "failed"  // 多次重试后仍然失败
+)
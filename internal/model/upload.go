@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+// 分片上传任务，遵循 tus 协议，上传完成后创建学习资料
+type Upload struct {
+	// --- 表名 ---
+	tableName struct{} `pg:"upload"`
+
+	// --- 业务字段 ---
+	Length int64    `json:"length" pg:",notnull"`                                 // 文件总大小
+	Offset int64    `json:"offset" pg:"upload_offset,use_zero,notnull,default:0"` // 已接收的字节数，offset 是 SQL 关键字，换个列名
+	Parts  []string `json:"-" pg:",array"`                                        // 已上传的分片在 storage 中的 key，按 offset 顺序排列
+
+	FileName    string `json:"file_name" pg:",use_zero,notnull,default:''"`   // 原始文件名
+	Name        string `json:"name" pg:",notnull"`                            // 资料名称
+	Description string `json:"description" pg:",use_zero,notnull,default:''"` // 资料描述
+	Md5         string `json:"md5" pg:",use_zero,notnull,default:''"`         // 客户端提供的文件 md5，上传完成后用来校验，为空则不校验
+
+	ExpiresAt time.Time `json:"expires_at" pg:",notnull"` // 过期时间，过期后未完成的上传会被清理
+
+	// --- 关联字段 ---
+	SubjectId int `json:"subject_id" pg:",notnull"` // 资料所属的科目
+
+	LearningMaterialId int `json:"learning_material_id"` // 上传完成后创建的学习资料
+
+	CreatedById int   `json:"-" pg:",notnull"`
+	CreatedBy   *User `json:"-" pg:"rel:has-one"`
+
+	// --- 通用字段 ---
+	Id        string    `json:"id" pg:",pk"` // 随机生成，作为上传地址的一部分
+	CreatedAt time.Time `json:"created_at" pg:",notnull,default:now()"`
+	UpdatedAt time.Time `json:"updated_at" pg:",notnull,default:now()"`
+}
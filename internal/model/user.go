@@ -2,9 +2,11 @@ package model
 
 import "time"
 
+// 用户的登录方式
 const (
-	UserRoleStudent string = "student"
-	UserRoleTeacher string = "teacher"
+	UserAuthSourceLocal string = "local" // 使用本地保存的密码
+	UserAuthSourceLdap  string = "ldap"  // 使用 LDAP 中的密码，本地密码为随机值，不能修改或者重置
+	UserAuthSourceOidc  string = "oidc"  // 通过 OpenID Connect 单点登录，本地密码为随机值，不能修改或者重置
 )
 
 // 用户表
@@ -13,15 +15,32 @@ type User struct {
 	tableName struct{} `pg:"user"`
 
 	// --- 业务字段 ---
-	Name     string `json:"name" pg:",unique,notnull"` // 用户名
+	Name     string `json:"name" pg:",notnull"` // 用户名
 	NickName string `json:"nick_name" pg:",notnull"`
-	Phone    string `json:"phone" pg:",unique,notnull"`           // 手机号
-	Email    string `json:"email" pg:",unique,notnull"`           // 邮箱
-	Role     string `json:"role" pg:",notnull,default:'student'"` // 用户角色，teacher 老师，student 学生
-	IsAdmin  bool   `json:"is_admin" pg:",use_zero,notnull,default:false"`
+	Phone    string `json:"phone" pg:",notnull"` // 手机号
+	Email    string `json:"email" pg:",notnull"` // 邮箱
 	Password string `json:"-" pg:",notnull"`
+	// 登录方式，local、ldap 或 oidc
+	AuthSource string `json:"auth_source" pg:",notnull,default:'local'"`
+	// 单点登录账号在认证服务中的唯一标识（ID token 中的 sub），关联后通过它找到用户
+	OidcSubject string `json:"-" pg:",use_zero,notnull,default:''"`
+
+	// 密码由他人设置（初始化的 admin、老师或管理员创建、管理员重置）时为 true，修改密码之前只能调用修改密码接口
+	MustChangePassword bool `json:"must_change_password" pg:",use_zero,notnull,default:false"`
+
+	// 修改密码或者角色变化时加一，之前签发的 token 全部失效
+	TokenVersion int `json:"-" pg:",use_zero,notnull,default:0"`
+
+	// 两步验证，开启前 TotpSecret 为待确认的密钥，输入一次正确的验证码后才开启
+	TotpSecret   string `json:"-" pg:",use_zero,notnull,default:''"`
+	TotpEnabled  bool   `json:"totp_enabled" pg:",use_zero,notnull,default:false"`
+	TotpLastStep int64  `json:"-" pg:",use_zero,notnull,default:0"` // 最近一次使用的验证码周期，同一个验证码只能用一次
+
+	SearchVector string `json:"-" pg:"type:tsvector"` // 全文检索使用的分词结果
 
 	// --- 关联字段 ---
+	Roles []*Role `json:"roles" pg:"many2many:user_role"` // 用户拥有的角色，决定了用户的权限
+
 	ClassId int    `json:"-"`
 	Class   *Class `json:"-" pg:"rel:has-one"` // 用户所属的班级
 
@@ -34,4 +53,34 @@ type User struct {
 	Id        int       `json:"id"`
 	CreatedAt time.Time `json:"created_at" pg:",notnull,default:now()"`
 	UpdatedAt time.Time `json:"updated_at" pg:",notnull,default:now()"`
+	DeletedAt time.Time `json:"-" pg:",soft_delete"` // 删除时间，不为空时表示在回收站中
+}
+
+// 是否拥有某个角色，需要先查询出 Roles
+func (u *User) HasRole(name string) bool {
+	for _, r := range u.Roles {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// 是否拥有某个权限，需要先查询出 Roles
+func (u *User) Can(permission string) bool {
+	for _, r := range u.Roles {
+		if r.Can(permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// 所有角色的标识
+func (u *User) RoleNames() []string {
+	names := make([]string, 0, len(u.Roles))
+	for _, r := range u.Roles {
+		names = append(names, r.Name)
+	}
+	return names
 }
@@ -0,0 +1,24 @@
+package model
+
+import (
+	"github.com/go-pg/pg/v10/orm"
+	"time"
+)
+
+func init() {
+	// 多对多关联需要先注册中间表
+	orm.RegisterTable((*UserRole)(nil))
+}
+
+// 用户拥有的角色
+type UserRole struct {
+	// --- 表名 ---
+	tableName struct{} `pg:"user_role"`
+
+	// --- 关联字段 ---
+	UserId int `json:"user_id" pg:",pk"`
+	RoleId int `json:"role_id" pg:",pk"`
+
+	// --- 通用字段 ---
+	CreatedAt time.Time `json:"created_at" pg:",notnull,default:now()"`
+}
@@ -5,20 +5,23 @@ import (
 	"log"
 	"net/http"
 	"strings"
+	"time"
 )
 
 // 自定义 Code Error 类型接口
 type IError interface {
-	Error() string     // 返回格式化后的错误信息字符串，用于实现 go 原生的 Error 接口
-	Code() int         // 返回错误码
-	Msg() string       // 返回错误信息
-	Details() []string // 返回错误详情
-	Debugs() []string  // 返回错误 Debug 信息
-	StatusCode() int   // 返回 HTTP 状态码
-
-	WithMsg(msg string) *Error            // 设置错误信息
-	WithDetails(details ...string) *Error // 设置错误详情
-	WithDebugs(debugs ...error) *Error    // 设置错误 Debug 信息
+	Error() string             // 返回格式化后的错误信息字符串，用于实现 go 原生的 Error 接口
+	Code() int                 // 返回错误码
+	Msg() string               // 返回错误信息
+	Details() []string         // 返回错误详情
+	Debugs() []string          // 返回错误 Debug 信息
+	StatusCode() int           // 返回 HTTP 状态码
+	RetryAfter() time.Duration // 返回需要等待多久之后才能重试，为 0 时不需要等待
+
+	WithMsg(msg string) *Error             // 设置错误信息
+	WithDetails(details ...string) *Error  // 设置错误详情
+	WithDebugs(debugs ...error) *Error     // 设置错误 Debug 信息
+	WithRetryAfter(d time.Duration) *Error // 设置需要等待多久之后才能重试
 
 	ToResponse() map[string]interface{} // 将错误类型整理成接口返回需要的形式
 
@@ -29,10 +32,11 @@ type IError interface {
 // 封装一个带 【错误码】、【错误概述】、【错误详情】、【错误Debug信息】的错误类型，供接口返回使用
 type Error struct {
 	code       int
-	msg        string   // 错误概述
-	details    []string // 错误详情
-	debugs     []string // 错误 Debug 信息
-	statusCode int      // HTTP 状态码
+	msg        string        // 错误概述
+	details    []string      // 错误详情
+	debugs     []string      // 错误 Debug 信息
+	statusCode int           // HTTP 状态码
+	retryAfter time.Duration // 需要等待多久之后才能重试，返回时写入 Retry-After 响应头
 }
 
 // 用来存储所有已定义的错误，防止 errCode 重复
@@ -104,6 +108,10 @@ func (e *Error) StatusCode() int {
 	return http.StatusInternalServerError
 }
 
+func (e *Error) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
 func (e *Error) WithMsg(msg string) *Error {
 	n := e.clone()
 	n.msg = msg
@@ -128,6 +136,12 @@ func (e *Error) WithDebugs(debugs ...error) *Error {
 	return n
 }
 
+func (e *Error) WithRetryAfter(d time.Duration) *Error {
+	n := e.clone()
+	n.retryAfter = d
+	return n
+}
+
 func (e *Error) ToResponse() map[string]interface{} {
 	d := map[string]interface{}{
 		"err_code":    e.Code(),
@@ -9,6 +9,10 @@ var (
 	Unauthorized       = New(1000_0401, "验证失败", http.StatusUnauthorized)
 	Forbidden          = New(1000_0403, "禁止访问", http.StatusForbidden)
 	NotFound           = New(1000_0404, "资源不存在", http.StatusNotFound)
+	Conflict           = New(1000_0409, "资源状态冲突", http.StatusConflict)
+	PreconditionFailed = New(1000_0412, "请求前置条件不满足", http.StatusPreconditionFailed)
+	PayloadTooLarge    = New(1000_0413, "请求内容过大", http.StatusRequestEntityTooLarge)
+	UnsupportedMedia   = New(1000_0415, "不支持的请求内容类型", http.StatusUnsupportedMediaType)
 	TooManyRequest     = New(1000_0429, "请求过多", http.StatusTooManyRequests)
 	ServerError        = New(1000_0500, "服务器内部错误", http.StatusInternalServerError)
 	ServiceUnavailable = New(1000_0503, "服务暂时不可用", http.StatusServiceUnavailable)
@@ -21,5 +25,6 @@ var (
 	// --- 其他业务相关错误 ---
 
 	// 用户相关
-	Login = New(3000_0001, "用户不存在或密码错误", http.StatusUnauthorized)
+	Login                  = New(3000_0001, "用户不存在或密码错误", http.StatusUnauthorized)
+	PasswordChangeRequired = New(3000_0002, "请先修改密码", http.StatusForbidden)
 )
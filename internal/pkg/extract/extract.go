@@ -0,0 +1,75 @@
+package extract
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 提取出的文本长度上限（字符数），超出部分直接丢弃
+const MaxLength = 200000
+
+var ErrUnsupported = errors.New("不支持提取该类型文件的文本")
+
+type extractor func(r io.ReaderAt, size int64) (string, error)
+
+var extractors = map[string]extractor{
+	".pdf":  pdfText,
+	".docx": docxText,
+	".pptx": pptxText,
+}
+
+// 是否支持提取该扩展名的文件，扩展名需要带上 .
+func Supported(ext string) bool {
+	_, ok := extractors[strings.ToLower(ext)]
+	return ok
+}
+
+// 按扩展名提取文件中的文本，不支持的类型返回 ErrUnsupported
+func Text(r io.ReaderAt, size int64, ext string) (text string, err error) {
+	fn, ok := extractors[strings.ToLower(ext)]
+	if !ok {
+		return "", ErrUnsupported
+	}
+	// 解析器遇到损坏的文件时可能会 panic
+	defer func() {
+		if e := recover(); e != nil {
+			text, err = "", fmt.Errorf("文件解析失败：%v", e)
+		}
+	}()
+	text, err = fn(r, size)
+	if err != nil {
+		return "", err
+	}
+	return normalize(text), nil
+}
+
+// 合并连续的空白字符，去掉控制字符，并截断到 MaxLength
+func normalize(text string) string {
+	var b strings.Builder
+	n := 0
+	space := false
+	for _, r := range text {
+		if n >= MaxLength {
+			break
+		}
+		if r == utf8.RuneError || (unicode.IsControl(r) && !unicode.IsSpace(r)) {
+			continue
+		}
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+			n++
+		}
+		space = false
+		b.WriteRune(r)
+		n++
+	}
+	return b.String()
+}
@@ -0,0 +1,117 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// 生成只包含指定文件的 zip 压缩包
+func zipFile(t *testing.T, files map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// 生成只有一页、一行文字的 PDF
+func pdfFile(text string) []byte {
+	stream := fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text)
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+func TestSupported(t *testing.T) {
+	at := assert.New(t)
+	at.True(Supported(".pdf"))
+	at.True(Supported(".DOCX"))
+	at.True(Supported(".pptx"))
+	at.False(Supported(".doc"))
+	at.False(Supported(".mp4"))
+	at.False(Supported(""))
+}
+
+func TestText(t *testing.T) {
+	t.Run("不支持的类型", func(t *testing.T) {
+		_, err := Text(bytes.NewReader(nil), 0, ".mp4")
+		assert.Equal(t, ErrUnsupported, err)
+	})
+
+	t.Run("DOCX", func(t *testing.T) {
+		b := zipFile(t, map[string]string{
+			"word/document.xml": `<?xml version="1.0"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:r><w:t>原子钟</w:t></w:r><w:r><w:t>工作原理</w:t></w:r></w:p>
+<w:p><w:r><w:t xml:space="preserve">阿伦  方差</w:t></w:r></w:p>
+</w:body></w:document>`,
+		})
+		text, err := Text(bytes.NewReader(b), int64(len(b)), ".docx")
+		assert.Nil(t, err)
+		assert.Equal(t, "原子钟工作原理 阿伦 方差", text)
+	})
+
+	t.Run("PPTX 按页码排序", func(t *testing.T) {
+		slide := `<p:sld xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main" xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main"><p:cSld><p:spTree><p:sp><p:txBody><a:p><a:r><a:t>%s</a:t></a:r></a:p></p:txBody></p:sp></p:spTree></p:cSld></p:sld>`
+		b := zipFile(t, map[string]string{
+			"ppt/slides/slide10.xml": fmt.Sprintf(slide, "第十页"),
+			"ppt/slides/slide2.xml":  fmt.Sprintf(slide, "第二页"),
+			"ppt/slides/slide1.xml":  fmt.Sprintf(slide, "第一页"),
+		})
+		text, err := Text(bytes.NewReader(b), int64(len(b)), ".pptx")
+		assert.Nil(t, err)
+		assert.Equal(t, "第一页 第二页 第十页", text)
+	})
+
+	t.Run("PDF", func(t *testing.T) {
+		b := pdfFile("Time Frequency")
+		text, err := Text(bytes.NewReader(b), int64(len(b)), ".pdf")
+		assert.Nil(t, err)
+		assert.Contains(t, text, "Time")
+		assert.Contains(t, text, "Frequency")
+	})
+
+	t.Run("损坏的文件", func(t *testing.T) {
+		for _, ext := range []string{".pdf", ".docx", ".pptx"} {
+			b := []byte("not a valid file")
+			text, err := Text(bytes.NewReader(b), int64(len(b)), ext)
+			assert.NotNil(t, err)
+			assert.Empty(t, text)
+		}
+	})
+}
+
+func TestNormalize(t *testing.T) {
+	assert.Equal(t, "a b c", normalize("  a\n\n b\t\x00c  "))
+	long := bytes.Repeat([]byte("字"), MaxLength+10)
+	assert.Equal(t, MaxLength, len([]rune(normalize(string(long)))))
+}
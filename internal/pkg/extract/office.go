@@ -0,0 +1,113 @@
+package extract
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 单个 XML 文件解压后的大小上限，防止压缩炸弹
+const maxXMLSize = 64 << 20
+
+var slideRegexp = regexp.MustCompile(`^ppt/slides/slide(\d+)\.xml$`)
+
+// DOCX 的正文在 word/document.xml 中，文字在 <w:t> 中，段落为 <w:p>
+func docxText(r io.ReaderAt, size int64) (string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return "", err
+	}
+	for _, f := range zr.File {
+		if f.Name == "word/document.xml" {
+			var b strings.Builder
+			err = xmlText(f, "t", "p", &b)
+			if err != nil {
+				return "", err
+			}
+			return b.String(), nil
+		}
+	}
+	return "", errors.New("不是有效的 DOCX 文件")
+}
+
+// PPTX 每页幻灯片是一个 ppt/slides/slideN.xml，文字在 <a:t> 中，段落为 <a:p>
+func pptxText(r io.ReaderAt, size int64) (string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return "", err
+	}
+	type slide struct {
+		n int
+		f *zip.File
+	}
+	var slides []slide
+	for _, f := range zr.File {
+		m := slideRegexp.FindStringSubmatch(f.Name)
+		if m == nil {
+			continue
+		}
+		n, _ := strconv.Atoi(m[1])
+		slides = append(slides, slide{n: n, f: f})
+	}
+	if len(slides) == 0 {
+		return "", errors.New("不是有效的 PPTX 文件")
+	}
+	// 按页码排序，zip 中的顺序不可靠
+	sort.Slice(slides, func(i, j int) bool { return slides[i].n < slides[j].n })
+
+	var b strings.Builder
+	for _, s := range slides {
+		err = xmlText(s.f, "t", "p", &b)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
+
+// 读取 XML 中所有名为 textTag 的元素内容，每个 paraTag 元素结束时换行，忽略命名空间前缀
+func xmlText(f *zip.File, textTag, paraTag string, b *strings.Builder) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	d := xml.NewDecoder(io.LimitReader(rc, maxXMLSize))
+	inText := false
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local == textTag {
+				inText = true
+			}
+		case xml.EndElement:
+			if t.Name.Local == textTag {
+				inText = false
+			}
+			if t.Name.Local == paraTag {
+				b.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				b.Write(t)
+			}
+		}
+		if b.Len() > MaxLength*4 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package extract
+
+import (
+	"github.com/ledongthuc/pdf"
+	"io"
+	"io/ioutil"
+)
+
+func pdfText(r io.ReaderAt, size int64) (string, error) {
+	reader, err := pdf.NewReader(r, size)
+	if err != nil {
+		return "", err
+	}
+	text, err := reader.GetPlainText()
+	if err != nil {
+		return "", err
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(text, MaxLength*4))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
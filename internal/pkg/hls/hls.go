@@ -0,0 +1,127 @@
+package hls
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 主播放列表的文件名
+const MasterPlaylist = "master.m3u8"
+
+// 每个分片的时长，单位秒
+const segmentTime = 6
+
+// 一种清晰度
+type Rendition struct {
+	Name         string // 名称，同时作为子目录名，例如 720p
+	Height       int    // 视频高度，宽度按比例缩放，原视频更小时不放大
+	VideoBitrate int    // 视频码率，单位 kbps
+	AudioBitrate int    // 音频码率，单位 kbps
+}
+
+// 没有配置清晰度时使用的默认值
+var DefaultRenditions = []Rendition{
+	{Name: "360p", Height: 360, VideoBitrate: 800, AudioBitrate: 96},
+	{Name: "720p", Height: 720, VideoBitrate: 2500, AudioBitrate: 128},
+	{Name: "1080p", Height: 1080, VideoBitrate: 5000, AudioBitrate: 128},
+}
+
+// 将 input 转码为多个清晰度的 HLS，写入 outDir，成功后返回生成的所有文件相对 outDir 的路径
+func Transcode(ctx context.Context, ffmpeg, input, outDir string, renditions []Rendition) ([]string, error) {
+	if len(renditions) == 0 {
+		return nil, errors.New("没有指定清晰度")
+	}
+	for _, r := range renditions {
+		dir := filepath.Join(outDir, r.Name)
+		err := os.MkdirAll(dir, os.ModePerm)
+		if err != nil {
+			return nil, err
+		}
+		cmd := exec.CommandContext(ctx, ffmpeg, args(input, dir, r)...)
+		stderr := &bytes.Buffer{}
+		cmd.Stderr = stderr
+		err = cmd.Run()
+		if err != nil {
+			msg := strings.TrimSpace(stderr.String())
+			if len(msg) > 500 {
+				msg = msg[len(msg)-500:]
+			}
+			return nil, fmt.Errorf("转码 %s 失败：%v %s", r.Name, err, msg)
+		}
+	}
+
+	err := ioutil.WriteFile(filepath.Join(outDir, MasterPlaylist), Master(renditions), 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	err = filepath.Walk(outDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(outDir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// 单个清晰度的 ffmpeg 参数，关键帧间隔与分片时长对齐，保证各清晰度可以在分片边界无缝切换
+func args(input, dir string, r Rendition) []string {
+	return []string{
+		"-v", "error", "-y",
+		"-i", input,
+		"-map", "0:v:0", "-map", "0:a:0?",
+		"-vf", fmt.Sprintf("scale=-2:'min(%d,ih)'", r.Height),
+		"-c:v", "libx264", "-preset", "veryfast", "-profile:v", "main",
+		"-b:v", fmt.Sprintf("%dk", r.VideoBitrate),
+		"-maxrate", fmt.Sprintf("%dk", r.VideoBitrate*107/100),
+		"-bufsize", fmt.Sprintf("%dk", r.VideoBitrate*3/2),
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", segmentTime),
+		"-sc_threshold", "0",
+		"-c:a", "aac", "-ac", "2", "-b:a", fmt.Sprintf("%dk", r.AudioBitrate),
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(segmentTime),
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(dir, "seg_%03d.ts"),
+		filepath.Join(dir, "index.m3u8"),
+	}
+}
+
+// 生成主播放列表，BANDWIDTH 为视频和音频码率之和
+func Master(renditions []Rendition) []byte {
+	b := &bytes.Buffer{}
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	for _, r := range renditions {
+		fmt.Fprintf(b, "#EXT-X-STREAM-INF:BANDWIDTH=%d,NAME=\"%s\"\n", (r.VideoBitrate+r.AudioBitrate)*1000, r.Name)
+		fmt.Fprintf(b, "%s/index.m3u8\n", r.Name)
+	}
+	return b.Bytes()
+}
+
+// 根据文件名返回 Content-Type
+func ContentType(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".m3u8":
+		return "application/vnd.apple.mpegurl"
+	case ".ts":
+		return "video/mp2t"
+	default:
+		return "application/octet-stream"
+	}
+}
@@ -0,0 +1,48 @@
+package hls
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMaster(t *testing.T) {
+	m := string(Master(DefaultRenditions))
+	assert.True(t, strings.HasPrefix(m, "#EXTM3U\n"))
+	assert.Contains(t, m, "#EXT-X-STREAM-INF:BANDWIDTH=896000,NAME=\"360p\"\n360p/index.m3u8\n")
+	assert.Contains(t, m, "1080p/index.m3u8")
+}
+
+func TestContentType(t *testing.T) {
+	assert.Equal(t, "application/vnd.apple.mpegurl", ContentType("master.m3u8"))
+	assert.Equal(t, "video/mp2t", ContentType("720p/seg_001.ts"))
+	assert.Equal(t, "application/octet-stream", ContentType("a.txt"))
+}
+
+func TestArgs(t *testing.T) {
+	a := strings.Join(args("in.mp4", "out/720p", Rendition{Name: "720p", Height: 720, VideoBitrate: 2500, AudioBitrate: 128}), " ")
+	assert.Contains(t, a, "-i in.mp4")
+	assert.Contains(t, a, "scale=-2:'min(720,ih)'")
+	assert.Contains(t, a, "-b:v 2500k")
+	assert.Contains(t, a, "-hls_playlist_type vod")
+	assert.Contains(t, a, filepath.Join("out/720p", "index.m3u8"))
+}
+
+func TestTranscode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = Transcode(context.Background(), "ffmpeg", "in.mp4", dir, nil)
+	assert.NotNil(t, err)
+
+	// ffmpeg 不存在
+	_, err = Transcode(context.Background(), filepath.Join(dir, "ffmpeg"), "in.mp4", dir, DefaultRenditions)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,113 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// 客户端配置
+type Config struct {
+	// 认证服务地址，例如 https://keycloak.example.com/realms/school，需要与 ID token 中的 iss 完全一致
+	Issuer       string
+	ClientId     string   // 在认证服务中登记的客户端 ID
+	ClientSecret string   // 公开客户端为空，只使用 PKCE
+	RedirectUrl  string   // 回调地址，需要在认证服务中登记
+	Scopes       []string // 为空时使用 openid profile email
+
+	HttpClient *http.Client // 为空时使用超时 10 秒的默认客户端
+}
+
+// 授权码换取的 token
+type Token struct {
+	*oauth2.Token
+	IdToken string
+}
+
+// 使用授权码 + PKCE 方式登录的客户端，可以在多个 goroutine 中同时使用
+// 元数据在第一次使用时获取，认证服务暂时不可用时不影响启动
+func New(config Config) *Client {
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{gooidc.ScopeOpenID, "profile", "email"}
+	}
+	if config.HttpClient == nil {
+		config.HttpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Client{config: config}
+}
+
+type Client struct {
+	config Config
+
+	mu       sync.Mutex
+	provider *gooidc.Provider
+	oauth2   *oauth2.Config
+	verifier *gooidc.IDTokenVerifier
+}
+
+// 跳转到认证服务的授权地址，state 用于校验回调，nonce 会原样出现在 ID token 中，codeVerifier 由 oauth2.GenerateVerifier 生成
+func (c *Client) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	err := c.init(ctx)
+	if err != nil {
+		return "", err
+	}
+	return c.oauth2.AuthCodeURL(state, gooidc.Nonce(nonce), oauth2.S256ChallengeOption(codeVerifier)), nil
+}
+
+// 使用回调中的授权码换取 token，返回的 ID token 还需要用 VerifyIdToken 校验
+func (c *Client) Exchange(ctx context.Context, code, codeVerifier string) (*Token, error) {
+	err := c.init(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := c.oauth2.Exchange(c.context(ctx), code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("oidc: 换取 token 失败：%w", err)
+	}
+	idToken, _ := token.Extra("id_token").(string)
+	if idToken == "" {
+		return nil, errors.New("oidc: 认证服务没有返回 ID token，scope 中需要包含 openid")
+	}
+	return &Token{Token: token, IdToken: idToken}, nil
+}
+
+// 获取认证服务的元数据，成功后缓存，要求元数据中的 issuer 与配置完全一致
+func (c *Client) init(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.provider != nil {
+		return nil
+	}
+
+	provider, err := gooidc.NewProvider(c.context(ctx), c.config.Issuer)
+	if err != nil {
+		return fmt.Errorf("oidc: 获取认证服务的元数据失败：%w", err)
+	}
+	endpoint := provider.Endpoint()
+	// 配置了 client secret 时使用 HTTP Basic 认证，否则只在表单中带上 client_id
+	endpoint.AuthStyle = oauth2.AuthStyleInParams
+	if c.config.ClientSecret != "" {
+		endpoint.AuthStyle = oauth2.AuthStyleInHeader
+	}
+	c.oauth2 = &oauth2.Config{
+		ClientID:     c.config.ClientId,
+		ClientSecret: c.config.ClientSecret,
+		Endpoint:     endpoint,
+		RedirectURL:  c.config.RedirectUrl,
+		Scopes:       c.config.Scopes,
+	}
+	c.verifier = provider.Verifier(&gooidc.Config{ClientID: c.config.ClientId})
+	c.provider = provider
+	return nil
+}
+
+// 请求认证服务时使用配置的 HttpClient
+func (c *Client) context(ctx context.Context) context.Context {
+	return gooidc.ClientContext(ctx, c.config.HttpClient)
+}
@@ -0,0 +1,144 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/oidc"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/oidc/oidctest"
+	"golang.org/x/oauth2"
+)
+
+const testRedirectUrl = "http://localhost:8080/api/v1/oidc/callback"
+
+func TestClient(t *testing.T) {
+	at := assert.New(t)
+	ctx := context.Background()
+	s := oidctest.NewServer("time-frequency", "secret")
+	defer s.Close()
+	s.Claims["sub"] = "10001"
+	s.Claims["email"] = "zhangsan@example.com"
+	s.Claims["realm_access"] = map[string]interface{}{"roles": []string{"teacher", "offline_access"}}
+
+	c := oidc.New(s.Config(testRedirectUrl))
+	verifier := oauth2.GenerateVerifier()
+
+	authUrl, err := c.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+	at.Nil(err)
+	u, err := url.Parse(authUrl)
+	at.Nil(err)
+	at.Equal(oauth2.S256ChallengeFromVerifier(verifier), u.Query().Get("code_challenge"))
+	at.Equal("openid profile email", u.Query().Get("scope"))
+
+	code, state, err := s.Authorize(authUrl)
+	at.Nil(err)
+	at.Equal("state-1", state)
+
+	// 错误的 code_verifier
+	_, err = c.Exchange(ctx, code, "wrong")
+	at.NotNil(err)
+
+	code, _, err = s.Authorize(authUrl)
+	at.Nil(err)
+	token, err := c.Exchange(ctx, code, verifier)
+	at.Nil(err)
+
+	// 授权码只能使用一次
+	_, err = c.Exchange(ctx, code, verifier)
+	at.NotNil(err)
+
+	// nonce 不一致
+	_, err = c.VerifyIdToken(ctx, token.IdToken, "nonce-2")
+	at.True(errors.Is(err, oidc.ErrInvalidIdToken))
+
+	claims, err := c.VerifyIdToken(ctx, token.IdToken, "nonce-1")
+	at.Nil(err)
+	at.Equal("10001", claims.String("sub"))
+	at.Equal("zhangsan@example.com", claims.String("email"))
+	at.Equal([]string{"teacher", "offline_access"}, claims.Strings("realm_access.roles"))
+	at.Equal("", claims.String("realm_access.roles.name"))
+}
+
+func TestClient_VerifyIdToken(t *testing.T) {
+	at := assert.New(t)
+	ctx := context.Background()
+	s := oidctest.NewServer("time-frequency", "")
+	defer s.Close()
+	c := oidc.New(s.Config(testRedirectUrl))
+
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   s.Issuer,
+			"aud":   "time-frequency",
+			"sub":   "10001",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"iat":   time.Now().Unix(),
+			"nonce": "nonce",
+		}
+	}
+	_, err := c.VerifyIdToken(ctx, s.Sign(valid()), "nonce")
+	at.Nil(err)
+
+	tests := []struct {
+		name   string
+		modify func(claims map[string]interface{})
+	}{
+		{"签发方错误", func(claims map[string]interface{}) { claims["iss"] = "https://evil.example.com" }},
+		{"接收方错误", func(claims map[string]interface{}) { claims["aud"] = "other" }},
+		{"多个接收方没有 azp", func(claims map[string]interface{}) { claims["aud"] = []string{"time-frequency", "other"} }},
+		{"azp 错误", func(claims map[string]interface{}) { claims["azp"] = "other" }},
+		{"已过期", func(claims map[string]interface{}) { claims["exp"] = time.Now().Add(-2 * time.Minute).Unix() }},
+		{"缺少过期时间", func(claims map[string]interface{}) { delete(claims, "exp") }},
+		{"还未生效", func(claims map[string]interface{}) { claims["nbf"] = time.Now().Add(time.Hour).Unix() }},
+		{"缺少 sub", func(claims map[string]interface{}) { delete(claims, "sub") }},
+		{"缺少 nonce", func(claims map[string]interface{}) { delete(claims, "nonce") }},
+	}
+	for _, tt := range tests {
+		claims := valid()
+		tt.modify(claims)
+		_, err := c.VerifyIdToken(ctx, s.Sign(claims), "nonce")
+		at.True(errors.Is(err, oidc.ErrInvalidIdToken), tt.name)
+	}
+
+	// 多个接收方时 azp 需要是当前客户端
+	claims := valid()
+	claims["aud"] = []string{"time-frequency", "other"}
+	claims["azp"] = "time-frequency"
+	_, err = c.VerifyIdToken(ctx, s.Sign(claims), "nonce")
+	at.Nil(err)
+
+	// 篡改内容后签名不一致
+	raw := s.Sign(valid())
+	other := s.Sign(claims)
+	_, err = c.VerifyIdToken(ctx, other[:strings.LastIndex(other, ".")]+raw[strings.LastIndex(raw, "."):], "nonce")
+	at.True(errors.Is(err, oidc.ErrInvalidIdToken))
+
+	// 不支持 none 算法
+	_, err = c.VerifyIdToken(ctx, "eyJhbGciOiJub25lIn0.eyJzdWIiOiIxMDAwMSJ9.", "nonce")
+	at.True(errors.Is(err, oidc.ErrInvalidIdToken))
+
+	_, err = c.VerifyIdToken(ctx, "not-a-jwt", "nonce")
+	at.True(errors.Is(err, oidc.ErrInvalidIdToken))
+}
+
+func TestClient_Issuer(t *testing.T) {
+	at := assert.New(t)
+	ctx := context.Background()
+	s := oidctest.NewServer("time-frequency", "")
+	defer s.Close()
+
+	// issuer 需要与元数据中的完全一致
+	config := s.Config(testRedirectUrl)
+	config.Issuer += "/"
+	_, err := oidc.New(config).AuthCodeURL(ctx, "state", "nonce", oauth2.GenerateVerifier())
+	at.NotNil(err)
+
+	authUrl, err := oidc.New(s.Config(testRedirectUrl)).AuthCodeURL(ctx, "state", "nonce", oauth2.GenerateVerifier())
+	at.Nil(err)
+	at.True(strings.HasPrefix(authUrl, s.Issuer+"/authorize?"))
+}
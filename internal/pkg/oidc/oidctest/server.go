@@ -0,0 +1,231 @@
+// 用于测试的 OpenID Connect 认证服务，自动同意所有授权请求
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/kataras/iris/v12/middleware/jwt"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/oidc"
+	"golang.org/x/oauth2"
+)
+
+// 签名公钥的 kid
+const KeyId = "test"
+
+// 启动测试用的认证服务，使用完后需要调用 Close
+func NewServer(clientId, clientSecret string) *Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	s := &Server{
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		Claims:       map[string]interface{}{},
+		Key:          key,
+		codes:        map[string]authorization{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.metadata)
+	mux.HandleFunc("/jwks", s.jwks)
+	mux.HandleFunc("/authorize", s.authorize)
+	mux.HandleFunc("/token", s.token)
+	s.Server = httptest.NewServer(mux)
+	s.Issuer = s.Server.URL
+	return s
+}
+
+type Server struct {
+	*httptest.Server
+
+	Issuer       string
+	ClientId     string
+	ClientSecret string // 为空时不校验
+
+	// 授权时放入 ID token 的声明，例如 sub、email、name，可以在两次登录之间修改
+	Claims map[string]interface{}
+	// 签名私钥
+	Key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+// 授权码对应的授权请求
+type authorization struct {
+	clientId      string
+	redirectUri   string
+	nonce         string
+	codeChallenge string
+	claims        map[string]interface{}
+}
+
+// 客户端配置
+func (s *Server) Config(redirectUrl string) oidc.Config {
+	return oidc.Config{
+		Issuer:       s.Issuer,
+		ClientId:     s.ClientId,
+		ClientSecret: s.ClientSecret,
+		RedirectUrl:  redirectUrl,
+	}
+}
+
+// 使用服务的私钥签名任意声明，用于构造异常的 ID token
+func (s *Server) Sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": KeyId})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		panic(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature, err := jwt.RS256.Sign(s.Key, []byte(signed))
+	if err != nil {
+		panic(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// 模拟用户在认证服务登录并同意授权：访问授权地址，返回回调地址中的 code 和 state
+func (s *Server) Authorize(authUrl string) (code, state string, err error) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authUrl)
+	if err != nil {
+		return "", "", err
+	}
+	_ = resp.Body.Close()
+	u, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return "", "", err
+	}
+	return u.Query().Get("code"), u.Query().Get("state"), nil
+}
+
+func (s *Server) metadata(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.Issuer,
+		"authorization_endpoint":                s.Issuer + "/authorize",
+		"token_endpoint":                        s.Issuer + "/token",
+		"jwks_uri":                              s.Issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, _ *http.Request) {
+	pub := s.Key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": KeyId,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("response_type") != "code" || q.Get("client_id") != s.ClientId || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirect.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code := oauth2.GenerateVerifier()
+	s.mu.Lock()
+	claims := map[string]interface{}{}
+	for k, v := range s.Claims {
+		claims[k] = v
+	}
+	s.codes[code] = authorization{
+		clientId:      q.Get("client_id"),
+		redirectUri:   q.Get("redirect_uri"),
+		nonce:         q.Get("nonce"),
+		codeChallenge: q.Get("code_challenge"),
+		claims:        claims,
+	}
+	s.mu.Unlock()
+
+	rq := redirect.Query()
+	rq.Set("code", code)
+	rq.Set("state", q.Get("state"))
+	redirect.RawQuery = rq.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// 使用 HTTP Basic 认证的客户端可以不在表单中带上 client_id
+	clientId := r.PostFormValue("client_id")
+	if s.ClientSecret != "" {
+		id, secret, ok := r.BasicAuth()
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+		if !ok || id != s.ClientId || secret != s.ClientSecret {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+			return
+		}
+		clientId = id
+	}
+	code := r.PostFormValue("code")
+	s.mu.Lock()
+	a, ok := s.codes[code]
+	// 授权码只能使用一次
+	delete(s.codes, code)
+	s.mu.Unlock()
+
+	switch {
+	case r.PostFormValue("grant_type") != "authorization_code":
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+	case !ok || a.clientId != clientId || a.redirectUri != r.PostFormValue("redirect_uri"):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+	case oauth2.S256ChallengeFromVerifier(r.PostFormValue("code_verifier")) != a.codeChallenge:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+	default:
+		now := time.Now()
+		claims := map[string]interface{}{
+			"iss":   s.Issuer,
+			"aud":   s.ClientId,
+			"iat":   now.Unix(),
+			"exp":   now.Add(5 * time.Minute).Unix(),
+			"nonce": a.nonce,
+		}
+		for k, v := range a.claims {
+			claims[k] = v
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"access_token": code,
+			"token_type":   "Bearer",
+			"expires_in":   300,
+			"id_token":     s.Sign(claims),
+		})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
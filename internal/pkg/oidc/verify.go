@@ -0,0 +1,98 @@
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ID token 校验失败
+var ErrInvalidIdToken = errors.New("oidc: ID token 无效")
+
+// ID token 中的声明
+type Claims map[string]interface{}
+
+// 字符串类型的声明，path 可以用 . 访问嵌套的字段，例如 realm_access.roles
+func (c Claims) String(path string) string {
+	s, _ := c.get(path).(string)
+	return s
+}
+
+// 字符串数组类型的声明，值为单个字符串时返回只有一个元素的数组
+func (c Claims) Strings(path string) []string {
+	switch v := c.get(path).(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var ss []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				ss = append(ss, s)
+			}
+		}
+		return ss
+	}
+	return nil
+}
+
+// 布尔类型的声明，部分认证服务会返回字符串形式的 "true"
+func (c Claims) Bool(path string) bool {
+	switch v := c.get(path).(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+func (c Claims) get(path string) interface{} {
+	var cur interface{} = map[string]interface{}(c)
+	for _, key := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = m[key]
+	}
+	return cur
+}
+
+// 校验 ID token 的签名、签发方、接收方、有效期和 nonce，返回其中的所有声明
+// 签名、签发方、接收方和有效期由 go-oidc 校验，签名公钥按 kid 缓存，遇到未知的 kid 时重新获取
+func (c *Client) VerifyIdToken(ctx context.Context, raw, nonce string) (Claims, error) {
+	err := c.init(ctx)
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := c.verifier.Verify(c.context(ctx), raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w：%v", ErrInvalidIdToken, err)
+	}
+	claims := Claims{}
+	err = idToken.Claims(&claims)
+	if err != nil {
+		return nil, fmt.Errorf("%w：%v", ErrInvalidIdToken, err)
+	}
+	err = c.validate(claims, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// go-oidc 没有校验的声明（OpenID Connect Core 1.0 3.1.3.7）
+func (c *Client) validate(claims Claims, nonce string) error {
+	if claims.String("sub") == "" {
+		return fmt.Errorf("%w：缺少 sub", ErrInvalidIdToken)
+	}
+	if azp := claims.String("azp"); (len(claims.Strings("aud")) > 1 || azp != "") && azp != c.config.ClientId {
+		return fmt.Errorf("%w：azp 不是当前客户端", ErrInvalidIdToken)
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.String("nonce")), []byte(nonce)) != 1 {
+		return fmt.Errorf("%w：nonce 不一致", ErrInvalidIdToken)
+	}
+	return nil
+}
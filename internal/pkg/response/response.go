@@ -4,6 +4,8 @@ import (
 	"github.com/kataras/iris/v12"
 	"github.com/xuxusheng/time-frequency-be/internal/model"
 	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"math"
+	"strconv"
 )
 
 type Response struct {
@@ -38,5 +40,9 @@ func (r *Response) SuccessList(list interface{}, p *model.Page) {
 }
 
 func (r *Response) Error(err cerror.IError) {
+	// 不足一秒的按一秒算，避免客户端立即重试
+	if d := err.RetryAfter(); d > 0 {
+		r.ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+	}
 	r.ctx.StopWithJSON(err.StatusCode(), err.ToResponse())
 }
@@ -0,0 +1,51 @@
+package segment
+
+import (
+	"github.com/go-ego/gse"
+	"strings"
+	"unicode"
+)
+
+type Segmenter struct {
+	seg gse.Segmenter
+}
+
+// dictPath 为词典文件路径，多个文件用逗号分隔，为空时使用 gse 自带的中文词典
+// 注意 gse 自带词典是通过源码路径查找的，编译后的程序需要指定 dictPath
+func New(dictPath string) (*Segmenter, error) {
+	s := &Segmenter{}
+	s.seg.SkipLog = true
+	if dictPath == "" {
+		dictPath = "zh"
+	}
+	err := s.seg.LoadDict(dictPath)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// 以搜索引擎模式分词，长词会额外切出其中的短词，例如 原子钟 会切成 原子、原子钟
+// 返回的词都转为小写，空白和标点会被去掉
+func (s *Segmenter) Cut(text string) []string {
+	words := s.seg.CutSearch(text, true)
+	r := make([]string, 0, len(words))
+	for _, word := range words {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if word == "" || !isWord(word) {
+			continue
+		}
+		r = append(r, word)
+	}
+	return r
+}
+
+// 至少包含一个字母或数字才算作词
+func isWord(s string) bool {
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package segment
+
+import (
+	"log"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var seg *Segmenter
+
+func TestMain(m *testing.M) {
+	var err error
+	seg, err = New("")
+	if err != nil {
+		log.Fatalf("加载词典失败：%v", err)
+	}
+	os.Exit(m.Run())
+}
+
+func TestSegmenter_Cut(t *testing.T) {
+	t.Run("搜索模式切出短词", func(t *testing.T) {
+		assert.Equal(t, []string{"原子", "原子钟"}, seg.Cut("原子钟"))
+		assert.Equal(t, []string{"阿伦", "方差"}, seg.Cut("阿伦方差"))
+	})
+	t.Run("去掉空白和标点并转为小写", func(t *testing.T) {
+		assert.Equal(t, []string{"gps", "授时", "allan", "variance"}, seg.Cut("GPS授时， Allan Variance！"))
+	})
+}
+
+func TestSegmenter_TSVector(t *testing.T) {
+	v := seg.TSVector(Field{Text: "原子钟", Weight: WeightA}, Field{Text: "原子钟的阿伦方差", Weight: WeightB})
+	assert.Equal(t, `'原子':1A,3B '原子钟':2A,4B '的':5B '阿伦':6B '方差':7B`, v)
+
+	t.Run("转义单引号和反斜杠", func(t *testing.T) {
+		assert.Equal(t, `'it''s'`, quote("it's"))
+		assert.Equal(t, `'a\\b'`, quote(`a\b`))
+	})
+	t.Run("空文本", func(t *testing.T) {
+		assert.Equal(t, "", seg.TSVector(Field{Text: "", Weight: WeightA}))
+	})
+}
+
+func TestSegmenter_TSQuery(t *testing.T) {
+	assert.Equal(t, `'原子':* & '原子钟':*`, seg.TSQuery("原子钟 原子钟"))
+	assert.Equal(t, "", seg.TSQuery("，。！ "))
+}
@@ -0,0 +1,78 @@
+package segment
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tsvector 中单个词的位置上限，以及单个词最多记录的位置数量，超出的部分数据库也会丢弃
+const (
+	maxPosition  = 16383
+	maxPositions = 256
+)
+
+// 权重，A 最高，D 最低
+const (
+	WeightA = 'A'
+	WeightB = 'B'
+	WeightC = 'C'
+	WeightD = 'D'
+)
+
+// 参与全文检索的字段
+type Field struct {
+	Text   string
+	Weight byte
+}
+
+// 对多个字段分词，生成带权重和位置信息的 tsvector 字面量，可以直接写入 tsvector 类型的列
+// 例如 '原子':1A '原子钟':2A
+func (s *Segmenter) TSVector(fields ...Field) string {
+	// 同一个词在多个位置出现时合并到一起
+	positions := map[string][]string{}
+	var words []string
+	pos := 0
+	for _, f := range fields {
+		for _, word := range s.Cut(f.Text) {
+			if pos < maxPosition {
+				pos++
+			}
+			if _, ok := positions[word]; !ok {
+				words = append(words, word)
+			}
+			if len(positions[word]) >= maxPositions {
+				continue
+			}
+			positions[word] = append(positions[word], fmt.Sprintf("%d%c", pos, f.Weight))
+		}
+	}
+
+	lexemes := make([]string, 0, len(words))
+	for _, word := range words {
+		lexemes = append(lexemes, quote(word)+":"+strings.Join(positions[word], ","))
+	}
+	return strings.Join(lexemes, " ")
+}
+
+// 对搜索词分词，生成 tsquery 字面量，所有词都需要匹配，每个词都按前缀匹配
+// 例如 '原子':* & '原子钟':*，搜索词中没有有效的词时返回空字符串
+func (s *Segmenter) TSQuery(text string) string {
+	words := s.Cut(text)
+	seen := map[string]struct{}{}
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		if _, ok := seen[word]; ok {
+			continue
+		}
+		seen[word] = struct{}{}
+		terms = append(terms, quote(word)+":*")
+	}
+	return strings.Join(terms, " & ")
+}
+
+// 词中的单引号和反斜杠需要转义
+func quote(word string) string {
+	word = strings.ReplaceAll(word, `\`, `\\`)
+	word = strings.ReplaceAll(word, `'`, `''`)
+	return "'" + word + "'"
+}
@@ -0,0 +1,75 @@
+package sheet
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+func readCSV(r io.ReaderAt, size int64, maxRows int) ([][]string, error) {
+	br := bufio.NewReader(io.NewSectionReader(r, 0, size))
+	// Excel 保存的 UTF-8 CSV 带有 BOM
+	if b, err := br.Peek(len(utf8BOM)); err == nil && bytes.Equal(b, utf8BOM) {
+		_, _ = br.Discard(len(utf8BOM))
+	}
+
+	cr := csv.NewReader(br)
+	cr.FieldsPerRecord = -1
+	var rows [][]string
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) >= maxRows {
+			return nil, ErrTooManyRows
+		}
+		for _, cell := range row {
+			if !utf8.ValidString(cell) {
+				return nil, errors.New("CSV 文件不是 UTF-8 编码，请另存为 UTF-8 格式后重试")
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	_, err := w.Write(utf8BOM)
+	if err != nil {
+		return nil, err
+	}
+	// Excel 默认按 \r\n 换行
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = true
+	return &csvWriter{w: cw}, nil
+}
+
+// 以 = + - @、制表符和回车开头的单元格在 Excel 中可能被当作公式执行，前面加上 ' 作为文本
+func (c *csvWriter) Write(row []string) error {
+	escaped := make([]string, len(row))
+	for i, v := range row {
+		if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			v = "'" + v
+		}
+		escaped[i] = v
+	}
+	return c.w.Write(escaped)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,68 @@
+package sheet
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// 单个表格最多的行数，读取时超出返回 ErrTooManyRows
+const MaxRows = 100000
+
+var (
+	ErrUnsupported = errors.New("只支持 CSV 和 XLSX 格式的表格")
+	ErrTooManyRows = errors.New("表格的行数过多")
+)
+
+type reader func(r io.ReaderAt, size int64, maxRows int) ([][]string, error)
+
+var readers = map[string]reader{
+	".csv":  readCSV,
+	".xlsx": readXLSX,
+}
+
+var contentTypes = map[string]string{
+	".csv":  "text/csv; charset=utf-8",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// 是否支持该扩展名的表格，扩展名需要带上 .
+func Supported(ext string) bool {
+	_, ok := readers[strings.ToLower(ext)]
+	return ok
+}
+
+// 扩展名对应的 Content-Type，不支持的扩展名返回空字符串
+func ContentType(ext string) string {
+	return contentTypes[strings.ToLower(ext)]
+}
+
+// 按扩展名读取表格中的所有行，maxRows 为 0 时使用 MaxRows
+// 每行的单元格数量可能不同。XLSX 中间的空行也会返回，行号与文件中一致；CSV 中的空行会被跳过
+func Read(r io.ReaderAt, size int64, ext string, maxRows int) ([][]string, error) {
+	fn, ok := readers[strings.ToLower(ext)]
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	if maxRows <= 0 || maxRows > MaxRows {
+		maxRows = MaxRows
+	}
+	return fn(r, size, maxRows)
+}
+
+// 按行写入表格，写完后需要调用 Close，否则文件不完整
+type Writer interface {
+	Write(row []string) error
+	Close() error
+}
+
+// 按扩展名创建 Writer，Close 时不会关闭 w
+func NewWriter(w io.Writer, ext string) (Writer, error) {
+	switch strings.ToLower(ext) {
+	case ".csv":
+		return newCSVWriter(w)
+	case ".xlsx":
+		return newXLSXWriter(w)
+	}
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,147 @@
+package sheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuri/excelize/v2"
+	"testing"
+)
+
+// 生成只包含指定文件的 zip 压缩包
+func zipFile(t *testing.T, files map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func write(t *testing.T, ext string, rows [][]string) []byte {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, ext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadWrite(t *testing.T) {
+	rows := [][]string{
+		{"用户名", "手机号", "备注"},
+		{"zhangsan", "13800000000", `带 "引号", 逗号和 <尖括号> & 换行` + "\n第二行"},
+		{"lisi", "", "  前后空格  "},
+	}
+	for _, ext := range []string{".csv", ".xlsx"} {
+		b := write(t, ext, rows)
+		got, err := Read(bytes.NewReader(b), int64(len(b)), ext, 0)
+		if assert.Nil(t, err, ext) {
+			assert.Equal(t, rows, got, ext)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	t.Run("CSV 带 BOM", func(t *testing.T) {
+		b := []byte("\xEF\xBB\xBFname,phone\r\nzhangsan,1\r\n")
+		rows, err := Read(bytes.NewReader(b), int64(len(b)), ".CSV", 0)
+		if assert.Nil(t, err) {
+			assert.Equal(t, [][]string{{"name", "phone"}, {"zhangsan", "1"}}, rows)
+		}
+	})
+
+	t.Run("CSV 不是 UTF-8 编码", func(t *testing.T) {
+		// GBK 编码的「张三」
+		b := []byte("\xd5\xc5\xc8\xfd,1\n")
+		_, err := Read(bytes.NewReader(b), int64(len(b)), ".csv", 0)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("行数过多", func(t *testing.T) {
+		for _, ext := range []string{".csv", ".xlsx"} {
+			b := write(t, ext, [][]string{{"1"}, {"2"}, {"3"}})
+			_, err := Read(bytes.NewReader(b), int64(len(b)), ext, 2)
+			assert.Equal(t, ErrTooManyRows, err, ext)
+		}
+	})
+
+	t.Run("XLSX 共享字符串和空行", func(t *testing.T) {
+		// 非流式写入时字符串保存在共享字符串中
+		f := excelize.NewFile()
+		defer f.Close()
+		_, err := f.NewSheet("其他")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 只读取第一个工作表
+		if err := f.SetCellValue("其他", "A1", "其他"); err != nil {
+			t.Fatal(err)
+		}
+		for cell, v := range map[string]interface{}{"A1": "用户名", "C1": true, "B3": "张三", "C3": 13800000000} {
+			if err := f.SetCellValue("Sheet1", cell, v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		buf, err := f.WriteToBuffer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := buf.Bytes()
+
+		rows, err := Read(bytes.NewReader(b), int64(len(b)), ".xlsx", 0)
+		if assert.Nil(t, err) {
+			assert.Equal(t, [][]string{
+				{"用户名", "", "1"},
+				nil,
+				{"", "张三", "13800000000"},
+			}, rows)
+		}
+	})
+
+	t.Run("不是有效的 XLSX 文件", func(t *testing.T) {
+		b := zipFile(t, map[string]string{"word/document.xml": "<document/>"})
+		_, err := Read(bytes.NewReader(b), int64(len(b)), ".xlsx", 0)
+		assert.Equal(t, errInvalidXLSX, err)
+
+		_, err = Read(bytes.NewReader([]byte("name,phone")), 10, ".xlsx", 0)
+		assert.Equal(t, errInvalidXLSX, err)
+	})
+
+	t.Run("不支持的格式", func(t *testing.T) {
+		_, err := Read(bytes.NewReader(nil), 0, ".xls", 0)
+		assert.Equal(t, ErrUnsupported, err)
+		assert.False(t, Supported(".xls"))
+		assert.True(t, Supported(".XLSX"))
+	})
+}
+
+func TestCSVFormula(t *testing.T) {
+	b := write(t, ".csv", [][]string{{"=1+1", "+86 13800000000", "-1", "@SUM(A1)", "a=b", ""}})
+	rows, err := Read(bytes.NewReader(b), int64(len(b)), ".csv", 0)
+	if assert.Nil(t, err) {
+		assert.Equal(t, [][]string{{"'=1+1", "'+86 13800000000", "'-1", "'@SUM(A1)", "a=b", ""}}, rows)
+	}
+
+	// XLSX 不处理
+	b = write(t, ".xlsx", [][]string{{"=1+1"}})
+	rows, err = Read(bytes.NewReader(b), int64(len(b)), ".xlsx", 0)
+	if assert.Nil(t, err) {
+		assert.Equal(t, [][]string{{"=1+1"}}, rows)
+	}
+}
@@ -0,0 +1,96 @@
+package sheet
+
+import (
+	"errors"
+	"github.com/xuri/excelize/v2"
+	"io"
+)
+
+const (
+	// 解压后的总大小上限，防止压缩炸弹
+	maxUnzipSize = 256 << 20
+	// 工作表解压后超过这个大小时写入临时文件，不全部放在内存中
+	maxXMLSize = 16 << 20
+)
+
+var errInvalidXLSX = errors.New("不是有效的 XLSX 文件")
+
+// 只读取第一个工作表，单元格返回文件中保存的原始值，不应用数字格式
+func readXLSX(r io.ReaderAt, size int64, maxRows int) ([][]string, error) {
+	f, err := excelize.OpenReader(io.NewSectionReader(r, 0, size), excelize.Options{
+		RawCellValue:      true,
+		UnzipSizeLimit:    maxUnzipSize,
+		UnzipXMLSizeLimit: maxXMLSize,
+	})
+	if err != nil {
+		return nil, errInvalidXLSX
+	}
+	defer f.Close()
+
+	sheets := f.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, errInvalidXLSX
+	}
+	it, err := f.Rows(sheets[0])
+	if err != nil {
+		return nil, errInvalidXLSX
+	}
+	defer it.Close()
+
+	var rows [][]string
+	for it.Next() {
+		if len(rows) >= maxRows {
+			return nil, ErrTooManyRows
+		}
+		row, err := it.Columns()
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// 使用 excelize 的 StreamWriter 按行写入，所有单元格都写成文本
+type xlsxWriter struct {
+	w    io.Writer
+	f    *excelize.File
+	sw   *excelize.StreamWriter
+	rows int
+}
+
+func newXLSXWriter(w io.Writer) (*xlsxWriter, error) {
+	f := excelize.NewFile()
+	sw, err := f.NewStreamWriter(f.GetSheetName(0))
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &xlsxWriter{w: w, f: f, sw: sw}, nil
+}
+
+func (x *xlsxWriter) Write(row []string) error {
+	x.rows++
+	cell, err := excelize.CoordinatesToCellName(1, x.rows)
+	if err != nil {
+		return err
+	}
+	values := make([]interface{}, len(row))
+	for i, v := range row {
+		values[i] = v
+	}
+	return x.sw.SetRow(cell, values)
+}
+
+func (x *xlsxWriter) Close() error {
+	defer x.f.Close()
+	err := x.sw.Flush()
+	if err != nil {
+		return err
+	}
+	_, err = x.f.WriteTo(x.w)
+	return err
+}
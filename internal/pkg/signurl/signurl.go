@@ -0,0 +1,31 @@
+package signurl
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// 对资源和过期时间进行签名，resource 用来区分不同的资源，例如 learning-material:1
+func Sign(secret, resource string, expires time.Time) string {
+	return sign(secret, resource, expires.Unix())
+}
+
+// 校验签名，签名不匹配或者已过期都返回 false
+func Verify(secret, resource string, expires int64, signature string) bool {
+	if time.Now().Unix() > expires {
+		return false
+	}
+	expected := sign(secret, resource, expires)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+func sign(secret, resource string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(resource))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
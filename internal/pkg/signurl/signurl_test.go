@@ -0,0 +1,31 @@
+package signurl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	secret := "secret"
+	expires := time.Now().Add(time.Minute)
+	sig := Sign(secret, "learning-material:1", expires)
+
+	t.Run("正常校验", func(t *testing.T) {
+		assert.True(t, Verify(secret, "learning-material:1", expires.Unix(), sig))
+	})
+	t.Run("资源不一致", func(t *testing.T) {
+		assert.False(t, Verify(secret, "learning-material:2", expires.Unix(), sig))
+	})
+	t.Run("过期时间被篡改", func(t *testing.T) {
+		assert.False(t, Verify(secret, "learning-material:1", expires.Unix()+3600, sig))
+	})
+	t.Run("密钥不一致", func(t *testing.T) {
+		assert.False(t, Verify("other", "learning-material:1", expires.Unix(), sig))
+	})
+	t.Run("已过期", func(t *testing.T) {
+		past := time.Now().Add(-time.Minute)
+		assert.False(t, Verify(secret, "learning-material:1", past.Unix(), Sign(secret, "learning-material:1", past)))
+	})
+}
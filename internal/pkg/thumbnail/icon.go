@@ -0,0 +1,30 @@
+package thumbnail
+
+import "fmt"
+
+// 通用图标的颜色和文字
+var icons = map[string]struct {
+	color string
+	label string
+}{
+	KindImage:    {color: "#2e9e5b", label: "IMG"},
+	KindPDF:      {color: "#d93025", label: "PDF"},
+	KindVideo:    {color: "#7b4dd6", label: "VIDEO"},
+	KindDocument: {color: "#1a73e8", label: "DOC"},
+	KindFile:     {color: "#80868b", label: "FILE"},
+}
+
+const iconTemplate = `<svg xmlns="http://www.w3.org/2000/svg" width="240" height="320" viewBox="0 0 240 320">` +
+	`<path d="M20 0h150l70 70v230a20 20 0 0 1-20 20H20A20 20 0 0 1 0 300V20A20 20 0 0 1 20 0z" fill="%[1]s"/>` +
+	`<path d="M170 0l70 70h-50a20 20 0 0 1-20-20z" fill="#fff" fill-opacity=".4"/>` +
+	`<text x="120" y="220" fill="#fff" font-family="Arial,Helvetica,sans-serif" font-size="48" font-weight="bold" text-anchor="middle">%[2]s</text>` +
+	`</svg>`
+
+// 没有预览图时使用的通用图标，SVG 格式
+func Icon(kind string) []byte {
+	icon, ok := icons[kind]
+	if !ok {
+		icon = icons[KindFile]
+	}
+	return []byte(fmt.Sprintf(iconTemplate, icon.color, icon.label))
+}
@@ -0,0 +1,206 @@
+package thumbnail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"golang.org/x/image/draw"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 资料类型，决定预览图的生成方式和通用图标
+const (
+	KindImage    = "image"
+	KindPDF      = "pdf"
+	KindVideo    = "video"
+	KindDocument = "document"
+	KindFile     = "file"
+)
+
+var kinds = map[string]string{
+	".jpg":  KindImage,
+	".jpeg": KindImage,
+	".png":  KindImage,
+	".gif":  KindImage,
+	".pdf":  KindPDF,
+	".mp4":  KindVideo,
+	".webm": KindVideo,
+	".mov":  KindVideo,
+	".mkv":  KindVideo,
+	".avi":  KindVideo,
+	".doc":  KindDocument,
+	".docx": KindDocument,
+	".ppt":  KindDocument,
+	".pptx": KindDocument,
+	".xls":  KindDocument,
+	".xlsx": KindDocument,
+	".txt":  KindDocument,
+}
+
+// 图片解码的像素上限，防止超大图片占满内存
+const maxPixels = 50 * 1000 * 1000
+
+// 没有指定宽度时预览图的宽度
+const DefaultWidth = 320
+
+var ErrUnsupported = errors.New("不支持生成该类型文件的预览图")
+
+// 生成预览图使用的外部程序，路径为空表示没有安装
+type Options struct {
+	Width        int    // 预览图宽度，高度按比例缩放，为 0 时使用 DefaultWidth
+	FfmpegPath   string // ffmpeg 路径，用于视频封面
+	PdftoppmPath string // pdftoppm 路径，用于 PDF 首页
+}
+
+// 某种类型的所有扩展名
+func Exts(kind string) []string {
+	var exts []string
+	for ext, k := range kinds {
+		if k == kind {
+			exts = append(exts, ext)
+		}
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+// 根据扩展名判断资料类型，扩展名需要带上 .
+func Kind(ext string) string {
+	if kind, ok := kinds[strings.ToLower(ext)]; ok {
+		return kind
+	}
+	return KindFile
+}
+
+// 为本地文件生成 JPEG 预览图，缺少对应的外部程序或者类型不支持时返回 ErrUnsupported
+func Generate(ctx context.Context, o Options, file, ext string) ([]byte, error) {
+	if o.Width <= 0 {
+		o.Width = DefaultWidth
+	}
+	switch Kind(ext) {
+	case KindImage:
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return Image(f, o.Width)
+	case KindPDF:
+		if o.PdftoppmPath == "" {
+			return nil, ErrUnsupported
+		}
+		return PDF(ctx, o.PdftoppmPath, file, o.Width)
+	case KindVideo:
+		if o.FfmpegPath == "" {
+			return nil, ErrUnsupported
+		}
+		return Video(ctx, o.FfmpegPath, file, o.Width)
+	default:
+		return nil, ErrUnsupported
+	}
+}
+
+// 缩放图片，比预览图小的图片不放大
+func Image(r io.ReadSeeker, width int) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, errors.New("图片尺寸过大")
+	}
+	_, err = r.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > width {
+		w, h = width, h*width/w
+		if h < 1 {
+			h = 1
+		}
+	}
+	// JPEG 没有透明通道，先铺一层白色背景
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Over, nil)
+
+	buf := &bytes.Buffer{}
+	err = jpeg.Encode(buf, dst, &jpeg.Options{Quality: 80})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// 渲染 PDF 首页
+func PDF(ctx context.Context, pdftoppm, file string, width int) ([]byte, error) {
+	dir, err := ioutil.TempDir("", "thumbnail-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "page")
+	cmd := exec.CommandContext(ctx, pdftoppm, "-jpeg", "-f", "1", "-l", "1", "-singlefile",
+		"-scale-to-x", strconv.Itoa(width), "-scale-to-y", "-1", file, out)
+	err = run(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(out + ".jpg")
+}
+
+// 截取视频第 1 秒的画面作为封面，视频不足 1 秒时截取第一帧
+func Video(ctx context.Context, ffmpeg, file string, width int) ([]byte, error) {
+	var lastErr error
+	for _, ss := range []string{"1", "0"} {
+		cmd := exec.CommandContext(ctx, ffmpeg, "-v", "error", "-ss", ss, "-i", file,
+			"-frames:v", "1", "-vf", "scale="+strconv.Itoa(width)+":-2", "-f", "image2", "-c:v", "mjpeg", "pipe:1")
+		stdout := &bytes.Buffer{}
+		cmd.Stdout = stdout
+		lastErr = run(cmd)
+		if lastErr == nil && stdout.Len() > 0 {
+			return stdout.Bytes(), nil
+		}
+	}
+	if lastErr == nil {
+		lastErr = errors.New("没有截取到视频画面")
+	}
+	return nil, lastErr
+}
+
+// 执行外部程序，失败时把 stderr 带到错误信息中
+func run(cmd *exec.Cmd) error {
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > 200 {
+			msg = msg[:200]
+		}
+		if msg != "" {
+			return errors.New(err.Error() + "：" + msg)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package thumbnail
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func pngFile(t *testing.T, w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestKind(t *testing.T) {
+	at := assert.New(t)
+	at.Equal(KindImage, Kind(".JPG"))
+	at.Equal(KindPDF, Kind(".pdf"))
+	at.Equal(KindVideo, Kind(".mp4"))
+	at.Equal(KindDocument, Kind(".docx"))
+	at.Equal(KindFile, Kind(".zip"))
+	at.Equal(KindFile, Kind(""))
+}
+
+func TestImage(t *testing.T) {
+	t.Run("按宽度缩放", func(t *testing.T) {
+		b, err := Image(bytes.NewReader(pngFile(t, 400, 200)), 100)
+		if !assert.Nil(t, err) {
+			return
+		}
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(b))
+		assert.Nil(t, err)
+		assert.Equal(t, 100, cfg.Width)
+		assert.Equal(t, 50, cfg.Height)
+	})
+
+	t.Run("小图不放大", func(t *testing.T) {
+		b, err := Image(bytes.NewReader(pngFile(t, 40, 30)), 100)
+		if !assert.Nil(t, err) {
+			return
+		}
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(b))
+		assert.Nil(t, err)
+		assert.Equal(t, 40, cfg.Width)
+		assert.Equal(t, 30, cfg.Height)
+	})
+
+	t.Run("不是图片", func(t *testing.T) {
+		_, err := Image(bytes.NewReader([]byte("not an image")), 100)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestGenerate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "thumbnail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "a.png")
+	if err = ioutil.WriteFile(file, pngFile(t, 20, 20), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	o := Options{Width: 10}
+	b, err := Generate(context.Background(), o, file, ".png")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, b)
+
+	// 没有配置外部程序
+	_, err = Generate(context.Background(), o, file, ".pdf")
+	assert.Equal(t, ErrUnsupported, err)
+	_, err = Generate(context.Background(), o, file, ".mp4")
+	assert.Equal(t, ErrUnsupported, err)
+	_, err = Generate(context.Background(), o, file, ".zip")
+	assert.Equal(t, ErrUnsupported, err)
+
+	// 外部程序不存在
+	o.FfmpegPath = filepath.Join(dir, "ffmpeg")
+	_, err = Generate(context.Background(), o, file, ".mp4")
+	assert.NotNil(t, err)
+	assert.NotEqual(t, ErrUnsupported, err)
+}
+
+func TestIcon(t *testing.T) {
+	assert.Contains(t, string(Icon(KindPDF)), "PDF")
+	assert.Contains(t, string(Icon("unknown")), "FILE")
+}
+
+func TestExts(t *testing.T) {
+	assert.Equal(t, []string{".avi", ".mkv", ".mov", ".mp4", ".webm"}, Exts(KindVideo))
+	assert.Empty(t, Exts(KindFile))
+}
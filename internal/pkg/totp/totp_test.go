@@ -0,0 +1,58 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// RFC 6238 附录 B 中 SHA1 的测试数据，取后 6 位
+func TestCode(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	cases := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, expected := range cases {
+		code, err := Code(secret, Step(time.Unix(unix, 0)))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, code)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	code, err := Code(secret, Step(now)-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("允许偏差一个周期", func(t *testing.T) {
+		step, ok := Validate(secret, code, now, 1)
+		assert.True(t, ok)
+		assert.Equal(t, Step(now)-1, step)
+	})
+	t.Run("超出偏差", func(t *testing.T) {
+		_, ok := Validate(secret, code, now, 0)
+		assert.False(t, ok)
+	})
+	t.Run("格式不对", func(t *testing.T) {
+		_, ok := Validate(secret, "12345", now, 1)
+		assert.False(t, ok)
+	})
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("时频学习平台", "admin", "JBSWY3DPEHPK3PXP")
+	assert.Contains(t, uri, "otpauth://totp/")
+	assert.Contains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+}
@@ -0,0 +1,48 @@
+package useragent
+
+import "strings"
+
+// 按顺序匹配，先匹配到的优先，例如 Edge 和 Chrome 的 User-Agent 中都包含 Chrome
+var systems = []struct {
+	keyword string
+	name    string
+}{
+	{keyword: "iPhone", name: "iPhone"},
+	{keyword: "iPad", name: "iPad"},
+	{keyword: "Android", name: "Android"},
+	{keyword: "Windows", name: "Windows"},
+	{keyword: "Mac OS X", name: "macOS"},
+	{keyword: "CrOS", name: "ChromeOS"},
+	{keyword: "Linux", name: "Linux"},
+}
+
+var browsers = []struct {
+	keyword string
+	name    string
+}{
+	{keyword: "MicroMessenger", name: "微信"},
+	{keyword: "Edg/", name: "Edge"},
+	{keyword: "OPR/", name: "Opera"},
+	{keyword: "Firefox/", name: "Firefox"},
+	{keyword: "Chrome/", name: "Chrome"},
+	{keyword: "Safari/", name: "Safari"},
+	{keyword: "curl/", name: "curl"},
+}
+
+// 返回 User-Agent 对应的操作系统和浏览器，例如 Windows · Chrome
+func Describe(ua string) string {
+	var parts []string
+	for _, s := range systems {
+		if strings.Contains(ua, s.keyword) {
+			parts = append(parts, s.name)
+			break
+		}
+	}
+	for _, b := range browsers {
+		if strings.Contains(ua, b.keyword) {
+			parts = append(parts, b.name)
+			break
+		}
+	}
+	return strings.Join(parts, " · ")
+}
@@ -0,0 +1,25 @@
+package useragent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribe(t *testing.T) {
+	cases := []struct {
+		ua       string
+		expected string
+	}{
+		{ua: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/90.0.4430.93 Safari/537.36", expected: "Windows · Chrome"},
+		{ua: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/90.0.4430.93 Safari/537.36 Edg/90.0.818.51", expected: "Windows · Edge"},
+		{ua: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/14.1 Safari/605.1.15", expected: "macOS · Safari"},
+		{ua: "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:88.0) Gecko/20100101 Firefox/88.0", expected: "Linux · Firefox"},
+		{ua: "Mozilla/5.0 (iPhone; CPU iPhone OS 14_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 MicroMessenger/8.0.5", expected: "iPhone · 微信"},
+		{ua: "curl/7.68.0", expected: "curl"},
+		{ua: "", expected: ""},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expected, Describe(c.ua), c.ua)
+	}
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+)
+
+// 学习资料的访问控制，资料按科目划分权限
+// 拥有 material.read_all 权限的用户不受限制，其他用户可以访问自己所教的科目和所在班级已选的科目
+type IAccess interface {
+	// 用户有权访问的科目 ID，返回 nil 表示不限制
+	SubjectIds(ctx context.Context, uid int) ([]int, error)
+	CanAccessSubject(ctx context.Context, uid, subjectId int) (bool, error)
+}
+
+func NewAccess(userDao dao.IUser, subjectDao dao.ISubject) *Access {
+	return &Access{UserDao: userDao, SubjectDao: subjectDao}
+}
+
+type Access struct {
+	UserDao    dao.IUser
+	SubjectDao dao.ISubject
+}
+
+func (a Access) SubjectIds(ctx context.Context, uid int) ([]int, error) {
+	user, err := a.UserDao.Get(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if user.Can(model.PermissionMaterialReadAll) {
+		return nil, nil
+	}
+	ids, err := a.SubjectDao.ListIdsTaughtBy(ctx, user.Id)
+	if err != nil {
+		return nil, err
+	}
+	if user.ClassId != 0 {
+		classIds, err := a.SubjectDao.ListIdsByClass(ctx, user.ClassId)
+		if err != nil {
+			return nil, err
+		}
+		ids = appendMissing(ids, classIds)
+	}
+	// 没有任何可访问的科目时也要返回空切片，nil 表示不限制
+	if ids == nil {
+		ids = []int{}
+	}
+	return ids, nil
+}
+
+func (a Access) CanAccessSubject(ctx context.Context, uid, subjectId int) (bool, error) {
+	ids, err := a.SubjectIds(ctx, uid)
+	if err != nil {
+		return false, err
+	}
+	if ids == nil {
+		return true, nil
+	}
+	for _, id := range ids {
+		if id == subjectId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// 把 ids 中还没有的 adds 追加进去
+func appendMissing(ids, adds []int) []int {
+	exists := map[int]bool{}
+	for _, id := range ids {
+		exists[id] = true
+	}
+	for _, id := range adds {
+		if !exists[id] {
+			exists[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"testing"
+)
+
+func TestAccessSvc_SubjectIds(t *testing.T) {
+	users, err := testdb.SeedUser(db)
+	if err != nil {
+		t.Fatalf("准备用户数据失败：%v", err)
+	}
+	subjects, err := testdb.SeedSubject(db, users)
+	if err != nil {
+		t.Fatalf("准备科目数据失败：%v", err)
+	}
+	classes, err := testdb.SeedClass(db, users)
+	if err != nil {
+		t.Fatalf("准备班级数据失败：%v", err)
+	}
+	ctx := context.Background()
+
+	// users[0] 管理员，users[1] 老师，users[2] 二班学生，users[3] 没有班级的学生
+	admin, teacher, student, noClass := users[0], users[1], users[2], users[3]
+	assert.Nil(t, userDao.SetRoles(ctx, admin.Id, []string{model.RoleAdmin}))
+	assert.Nil(t, userDao.SetRoles(ctx, teacher.Id, []string{model.RoleTeacher}))
+
+	// 老师创建了科目一，是一班的班主任，一班选了科目二，二班选了科目三
+	_, err = db.Model((*model.Subject)(nil)).Set("created_by_id = ?", admin.Id).Where("true").Update()
+	assert.Nil(t, err)
+	_, err = db.Model((*model.Subject)(nil)).Set("created_by_id = ?", teacher.Id).Where("id = ?", subjects[0].Id).Update()
+	assert.Nil(t, err)
+	assert.Nil(t, classDao.SetTeacher(ctx, classes[0].Id, teacher.Id, model.ClassTeacherHead))
+
+	classSvc := NewClass(classDao, userDao)
+	assert.Nil(t, classSvc.AddSubjects(ctx, admin.Id, classes[0].Id, []int{subjects[1].Id}))
+	assert.Nil(t, classSvc.AddSubjects(ctx, admin.Id, classes[1].Id, []int{subjects[2].Id, subjects[2].Id}))
+	assert.Nil(t, classSvc.AddMembers(ctx, admin.Id, classes[1].Id, []int{student.Id}))
+
+	svc := NewAccess(userDao, dao.NewSubject(db))
+
+	t.Run("管理员不受限制", func(t *testing.T) {
+		ids, err := svc.SubjectIds(ctx, admin.Id)
+		assert.Nil(t, err)
+		assert.Nil(t, ids)
+	})
+
+	t.Run("老师可以访问所教的科目", func(t *testing.T) {
+		ids, err := svc.SubjectIds(ctx, teacher.Id)
+		if assert.Nil(t, err) {
+			assert.ElementsMatch(t, []int{subjects[0].Id, subjects[1].Id}, ids)
+		}
+	})
+
+	t.Run("学生只能访问班级已选的科目", func(t *testing.T) {
+		ids, err := svc.SubjectIds(ctx, student.Id)
+		if assert.Nil(t, err) {
+			assert.Equal(t, []int{subjects[2].Id}, ids)
+		}
+		ok, err := svc.CanAccessSubject(ctx, student.Id, subjects[0].Id)
+		assert.Nil(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("没有班级的学生不能访问任何科目", func(t *testing.T) {
+		ids, err := svc.SubjectIds(ctx, noClass.Id)
+		if assert.Nil(t, err) {
+			assert.NotNil(t, ids)
+			assert.Empty(t, ids)
+		}
+	})
+
+	t.Run("移除科目后不能再访问", func(t *testing.T) {
+		assert.Nil(t, classSvc.RemoveSubjects(ctx, admin.Id, classes[1].Id, []int{subjects[2].Id}))
+		ok, err := svc.CanAccessSubject(ctx, student.Id, subjects[2].Id)
+		assert.Nil(t, err)
+		assert.False(t, ok)
+	})
+
+	// 清空数据
+	_ = testdb.Truncate(db)
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/go-pg/pg/v10"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
+)
+
+// 用户名或密码错误，包括用户不存在、不由这种方式认证的情况
+var ErrBadCredentials = errors.New("用户名或密码错误")
+
+// 一种登录认证方式
+type IAuthProvider interface {
+	// 校验用户名和密码，成功时返回对应的用户，失败时返回 ErrBadCredentials
+	Authenticate(ctx context.Context, name, password string) (*model.User, error)
+}
+
+// 登录认证，依次尝试各个认证方式，任意一个成功即可
+type IAuth interface {
+	// 全部失败时返回 ErrBadCredentials，其他错误直接返回，不再尝试后面的方式
+	Authenticate(ctx context.Context, name, password string) (*model.User, error)
+}
+
+func NewAuth(providers ...IAuthProvider) *Auth {
+	return &Auth{Providers: providers}
+}
+
+type Auth struct {
+	Providers []IAuthProvider
+}
+
+func (a Auth) Authenticate(ctx context.Context, name, password string) (*model.User, error) {
+	for _, p := range a.Providers {
+		user, err := p.Authenticate(ctx, name, password)
+		if errors.Is(err, ErrBadCredentials) {
+			continue
+		}
+		return user, err
+	}
+	return nil, ErrBadCredentials
+}
+
+// 本地账号，对比数据库中保存的密码 hash
+func NewLocalAuth(dao dao.IUser) *LocalAuth {
+	return &LocalAuth{Dao: dao}
+}
+
+type LocalAuth struct {
+	Dao dao.IUser
+}
+
+func (l LocalAuth) Authenticate(ctx context.Context, name, password string) (*model.User, error) {
+	user, err := l.Dao.GetByName(ctx, name)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			return nil, ErrBadCredentials
+		}
+		return nil, err
+	}
+	// 其他方式认证的用户，本地密码是随机值
+	if user.AuthSource != model.UserAuthSourceLocal {
+		return nil, ErrBadCredentials
+	}
+	if utils.ComparePwd(user.Password, password) != nil {
+		return nil, ErrBadCredentials
+	}
+	return user, nil
+}
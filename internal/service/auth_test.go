@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
+	"testing"
+)
+
+// 固定返回结果的认证方式
+type fakeAuth struct {
+	user  *model.User
+	err   error
+	calls int
+}
+
+func (f *fakeAuth) Authenticate(ctx context.Context, name, password string) (*model.User, error) {
+	f.calls++
+	return f.user, f.err
+}
+
+func TestAuthSvc(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("依次尝试", func(t *testing.T) {
+		at := assert.New(t)
+		user := &model.User{Id: 1}
+		first := &fakeAuth{err: ErrBadCredentials}
+		second := &fakeAuth{user: user}
+		third := &fakeAuth{}
+		got, err := NewAuth(first, second, third).Authenticate(ctx, "a", "b")
+		at.Nil(err)
+		at.Equal(user, got)
+		at.Equal(0, third.calls)
+
+		_, err = NewAuth(first).Authenticate(ctx, "a", "b")
+		at.Equal(ErrBadCredentials, err)
+		_, err = NewAuth().Authenticate(ctx, "a", "b")
+		at.Equal(ErrBadCredentials, err)
+	})
+
+	t.Run("其他错误不再尝试后面的方式", func(t *testing.T) {
+		at := assert.New(t)
+		e := errors.New("LDAP 服务器连接失败")
+		next := &fakeAuth{user: &model.User{}}
+		_, err := NewAuth(&fakeAuth{err: e}, next).Authenticate(ctx, "a", "b")
+		at.Equal(e, err)
+		at.Equal(0, next.calls)
+	})
+}
+
+func TestLocalAuthSvc(t *testing.T) {
+	pUsers, err := testdb.SeedUser(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userSvc := NewUser(userDao, utils.PwdPolicy{})
+	svc := NewLocalAuth(userDao)
+	ctx := context.Background()
+
+	user := model.User{Name: "local", NickName: "local", Phone: "local", Email: "local", Password: "local-password", CreatedById: pUsers[0].Id}
+	if err := userSvc.Create(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+
+	at := assert.New(t)
+	got, err := svc.Authenticate(ctx, "local", "local-password")
+	if at.Nil(err) {
+		at.Equal(user.Id, got.Id)
+	}
+	_, err = svc.Authenticate(ctx, "local", "wrong")
+	at.Equal(ErrBadCredentials, err)
+	_, err = svc.Authenticate(ctx, "nobody", "local-password")
+	at.Equal(ErrBadCredentials, err)
+
+	// LDAP 账号不能使用本地密码登录
+	at.Nil(userDao.Update(ctx, &model.User{Id: user.Id, AuthSource: model.UserAuthSourceLdap}, []string{"auth_source"}))
+	_, err = svc.Authenticate(ctx, "local", "local-password")
+	at.Equal(ErrBadCredentials, err)
+	_, err = userSvc.UpdatePassword(ctx, user.Id, "local-password", "new-password")
+	at.Equal(cerror.BadRequest.WithMsg("账号使用 LDAP 登录，请在 LDAP 中修改密码"), err)
+
+	_ = testdb.Truncate(db)
+}
@@ -2,26 +2,47 @@ package service
 
 import (
 	"context"
+	"github.com/go-pg/pg/v10"
 	"github.com/pkg/errors"
 	"github.com/xuxusheng/time-frequency-be/internal/dao"
 	"github.com/xuxusheng/time-frequency-be/internal/model"
 	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
 )
 
+var errClassNotTaught = cerror.Forbidden.WithMsg("只能管理自己任教的班级")
+
+// 班级管理，老师只能修改自己任教（班主任或任课老师）的班级、管理其中的成员和科目
+// 拥有 student.manage_all 权限的用户（例如管理员）不受班级限制，operatorId 为操作人
 type IClass interface {
 	Create(ctx context.Context, createdById int, name, description string) (*model.Class, error)
-	Get(ctx context.Context, id int) (*model.User, error)
-	Update(ctx context.Context, id int, name, description string) (*model.Class, error)
-	Delete(ctx context.Context, id int) error
+	Get(ctx context.Context, id int) (*model.Class, error)
+	ListAndCount(ctx context.Context, p *model.Page, query string) ([]*model.Class, int, error)
+	Update(ctx context.Context, operatorId, id int, name, description string) (*model.Class, error)
+	Delete(ctx context.Context, operatorId, id int) error // 移入回收站
+	Purge(ctx context.Context, id int) error              // 彻底删除回收站中的数据
 	IsNameExist(ctx context.Context, name string, excludeId int) (bool, error)
+
+	ListMembersAndCount(ctx context.Context, operatorId, id int, p *model.Page, query string) ([]*model.User, int, error)
+	// 已经在其他班级中的学生，只有那个班级的老师才能调整到新的班级
+	AddMembers(ctx context.Context, operatorId, id int, userIds []int) error
+	RemoveMembers(ctx context.Context, operatorId, id int, userIds []int) error
+
+	ListSubjectsAndCount(ctx context.Context, operatorId, id int, p *model.Page) ([]*model.Subject, int, error)
+	AddSubjects(ctx context.Context, operatorId, id int, subjectIds []int) error
+	RemoveSubjects(ctx context.Context, operatorId, id int, subjectIds []int) error
+
+	ListTeachers(ctx context.Context, operatorId, id int) ([]*model.ClassTeacher, error)
+	SetTeacher(ctx context.Context, id, userId int, typ string) error // typ 为 head 班主任或 assistant 任课老师
+	RemoveTeachers(ctx context.Context, id int, userIds []int) error
 }
 
-func NewClass(dao dao.IClass) *Class {
-	return &Class{Dao: dao}
+func NewClass(dao dao.IClass, userDao dao.IUser) *Class {
+	return &Class{Dao: dao, UserDao: userDao}
 }
 
 type Class struct {
-	Dao dao.IClass
+	Dao     dao.IClass
+	UserDao dao.IUser
 }
 
 func (c Class) Create(ctx context.Context, createdById int, name, description string) (*model.Class, error) {
@@ -40,6 +61,11 @@ func (c Class) Create(ctx context.Context, createdById int, name, description st
 	if err != nil {
 		return nil, err
 	}
+	// 创建人默认是班主任，之后可以调整
+	err = d.SetTeacher(ctx, class.Id, createdById, model.ClassTeacherHead)
+	if err != nil {
+		return nil, err
+	}
 	return class, nil
 }
 
@@ -47,15 +73,23 @@ func (c Class) Get(ctx context.Context, id int) (*model.Class, error) {
 	return c.Dao.Get(ctx, id)
 }
 
-func (c Class) Update(ctx context.Context, id int, name, description string) (*model.Class, error) {
+func (c Class) ListAndCount(ctx context.Context, p *model.Page, query string) ([]*model.Class, int, error) {
+	return c.Dao.ListAndCount(ctx, p, query)
+}
+
+func (c Class) Update(ctx context.Context, operatorId, id int, name, description string) (*model.Class, error) {
 	d := c.Dao
+	_, err := c.check(ctx, operatorId, id)
+	if err != nil {
+		return nil, err
+	}
 	// 判断班级名称是否已被占用
 	is, err := d.IsNameExist(ctx, name, id)
 	if err != nil {
 		return nil, err
 	}
 	if is {
-		return nil, errors.New("班级名称已存在")
+		return nil, cerror.BadRequest.WithMsg("班级名称已存在")
 	}
 	class, err := d.Update(ctx, id, name, description)
 	if err != nil {
@@ -64,10 +98,207 @@ func (c Class) Update(ctx context.Context, id int, name, description string) (*m
 	return class, nil
 }
 
-func (c Class) Delete(ctx context.Context, id int) error {
+// 移入回收站，成员和已选科目保留，恢复后原样可用
+func (c Class) Delete(ctx context.Context, operatorId, id int) error {
+	_, err := c.check(ctx, operatorId, id)
+	if err != nil {
+		// 已经不存在的班级不需要再删除
+		if errors.Is(err, pg.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
 	return c.Dao.Delete(ctx, id)
 }
 
+// 彻底删除回收站中的班级
+func (c Class) Purge(ctx context.Context, id int) error {
+	d := c.Dao
+	// 先将班级成员移出班级，避免用户表中残留无效的 class_id
+	err := d.ClearMembers(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = d.ClearSubjects(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = d.ClearTeachers(ctx, id)
+	if err != nil {
+		return err
+	}
+	return d.ForceDelete(ctx, id)
+}
+
 func (c Class) IsNameExist(ctx context.Context, name string, excludeId int) (bool, error) {
 	return c.Dao.IsNameExist(ctx, name, excludeId)
 }
+
+func (c Class) ListMembersAndCount(ctx context.Context, operatorId, id int, p *model.Page, query string) ([]*model.User, int, error) {
+	// 班级不存在时直接返回 pg.ErrNoRows
+	_, err := c.check(ctx, operatorId, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	return c.Dao.ListMembersAndCount(ctx, id, p, query)
+}
+
+func (c Class) AddMembers(ctx context.Context, operatorId, id int, userIds []int) error {
+	d := c.Dao
+
+	all, err := c.check(ctx, operatorId, id)
+	if err != nil {
+		return err
+	}
+
+	userIds = uniqueInts(userIds)
+
+	// 只允许将学生加入班级
+	count, err := d.CountStudents(ctx, userIds)
+	if err != nil {
+		return err
+	}
+	if count != len(userIds) {
+		return cerror.BadRequest.WithMsg("部分用户不存在或不是学生")
+	}
+
+	// 不能把其他老师班级中的学生调到自己的班级
+	if !all {
+		count, err = d.CountMembersNotTaughtBy(ctx, userIds, operatorId)
+		if err != nil {
+			return err
+		}
+		if count != 0 {
+			return cerror.Forbidden.WithMsg("部分学生在其他老师的班级中，请联系其班主任或管理员调整")
+		}
+	}
+
+	return d.AddMembers(ctx, id, userIds)
+}
+
+func (c Class) RemoveMembers(ctx context.Context, operatorId, id int, userIds []int) error {
+	d := c.Dao
+
+	_, err := c.check(ctx, operatorId, id)
+	if err != nil {
+		return err
+	}
+	return d.RemoveMembers(ctx, id, uniqueInts(userIds))
+}
+
+func (c Class) ListSubjectsAndCount(ctx context.Context, operatorId, id int, p *model.Page) ([]*model.Subject, int, error) {
+	// 班级不存在时直接返回 pg.ErrNoRows
+	_, err := c.check(ctx, operatorId, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	return c.Dao.ListSubjectsAndCount(ctx, id, p)
+}
+
+func (c Class) AddSubjects(ctx context.Context, operatorId, id int, subjectIds []int) error {
+	d := c.Dao
+
+	_, err := c.check(ctx, operatorId, id)
+	if err != nil {
+		return err
+	}
+
+	subjectIds = uniqueInts(subjectIds)
+
+	count, err := d.CountSubjects(ctx, subjectIds)
+	if err != nil {
+		return err
+	}
+	if count != len(subjectIds) {
+		return cerror.BadRequest.WithMsg("部分科目不存在")
+	}
+
+	return d.AddSubjects(ctx, id, subjectIds)
+}
+
+func (c Class) RemoveSubjects(ctx context.Context, operatorId, id int, subjectIds []int) error {
+	d := c.Dao
+
+	_, err := c.check(ctx, operatorId, id)
+	if err != nil {
+		return err
+	}
+	return d.RemoveSubjects(ctx, id, uniqueInts(subjectIds))
+}
+
+func (c Class) ListTeachers(ctx context.Context, operatorId, id int) ([]*model.ClassTeacher, error) {
+	// 班级不存在时直接返回 pg.ErrNoRows
+	_, err := c.check(ctx, operatorId, id)
+	if err != nil {
+		return nil, err
+	}
+	return c.Dao.ListTeachers(ctx, id)
+}
+
+func (c Class) SetTeacher(ctx context.Context, id, userId int, typ string) error {
+	d := c.Dao
+
+	_, err := d.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if typ != model.ClassTeacherHead && typ != model.ClassTeacherAssistant {
+		return cerror.BadRequest.WithMsg("老师的身份只能是班主任或任课老师")
+	}
+	count, err := d.CountUsers(ctx, []int{userId})
+	if err != nil {
+		return err
+	}
+	if count != 1 {
+		return cerror.BadRequest.WithMsg("用户不存在")
+	}
+	return d.SetTeacher(ctx, id, userId, typ)
+}
+
+func (c Class) RemoveTeachers(ctx context.Context, id int, userIds []int) error {
+	d := c.Dao
+
+	_, err := d.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return d.RemoveTeachers(ctx, id, uniqueInts(userIds))
+}
+
+// 班级存在并且操作人可以管理，返回操作人是否不受班级限制
+// 班级不存在时返回 pg.ErrNoRows，不是班级的老师时返回 errClassNotTaught
+func (c Class) check(ctx context.Context, operatorId, id int) (bool, error) {
+	_, err := c.Dao.Get(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	operator, err := c.UserDao.Get(ctx, operatorId)
+	if err != nil {
+		return false, err
+	}
+	if operator.Can(model.PermissionStudentAll) {
+		return true, nil
+	}
+	is, err := c.Dao.IsTeacher(ctx, id, operatorId)
+	if err != nil {
+		return false, err
+	}
+	if !is {
+		return false, errClassNotTaught
+	}
+	return false, nil
+}
+
+// 对 int 切片去重，保持原有顺序
+func uniqueInts(s []int) []int {
+	m := make(map[int]struct{}, len(s))
+	r := make([]int, 0, len(s))
+	for _, v := range s {
+		if _, ok := m[v]; ok {
+			continue
+		}
+		m[v] = struct{}{}
+		r = append(r, v)
+	}
+	return r
+}
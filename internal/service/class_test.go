@@ -26,7 +26,7 @@ func prepareClass(t *testing.T, db *pg.DB) ([]*model.Class, []*model.User) {
 
 func TestClassSvc_Create(t *testing.T) {
 	pClasses, pUsers := prepareClass(t, db)
-	svc := NewClass(classDao)
+	svc := NewClass(classDao, userDao)
 
 	t.Run("班级名称重复", func(t *testing.T) {
 		for _, pClass := range pClasses {
@@ -79,7 +79,7 @@ func TestClassSvc_Create(t *testing.T) {
 
 func TestClassSvc_Get(t *testing.T) {
 	pClasses, _ := prepareClass(t, db)
-	svc := NewClass(classDao)
+	svc := NewClass(classDao, userDao)
 
 	t.Run("正常获取", func(t *testing.T) {
 		for _, pClass := range pClasses {
@@ -102,22 +102,24 @@ func TestClassSvc_Get(t *testing.T) {
 }
 
 func TestClassSvc_Update(t *testing.T) {
-	pClasses, _ := prepareClass(t, db)
-	svc := NewClass(classDao)
+	pClasses, pUsers := prepareClass(t, db)
+	svc := NewClass(classDao, userDao)
+	admin := pUsers[0]
+	assert.Nil(t, userDao.SetRoles(context.Background(), admin.Id, []string{model.RoleAdmin}))
 
 	t.Run("班级名称重复", func(t *testing.T) {
 		for i := 0; i < len(pClasses)-1; i++ {
 			current := pClasses[i]
 			next := pClasses[i+1]
-			class, err := svc.Update(context.Background(), current.Id, next.Name, time.Now().String())
-			assert.EqualError(t, err, "班级名称已存在")
+			class, err := svc.Update(context.Background(), admin.Id, current.Id, next.Name, time.Now().String())
+			assert.Equal(t, cerror.BadRequest.WithMsg("班级名称已存在"), err)
 			assert.Nil(t, class)
 		}
 	})
 
 	t.Run("班级名称为空", func(t *testing.T) {
 		for _, pClass := range pClasses {
-			class, err := svc.Update(context.Background(), pClass.Id, "", time.Now().String())
+			class, err := svc.Update(context.Background(), admin.Id, pClass.Id, "", time.Now().String())
 			assert.NotNil(t, err)
 			assert.Nil(t, class)
 		}
@@ -126,7 +128,7 @@ func TestClassSvc_Update(t *testing.T) {
 	t.Run("修改一个不存在的班级", func(t *testing.T) {
 		for i := 0; i < 10; i++ {
 			s := time.Now().String()
-			class, err := svc.Update(context.Background(), rand.Intn(100)*10000, s, s)
+			class, err := svc.Update(context.Background(), admin.Id, rand.Intn(100)*10000, s, s)
 			assert.Equal(t, pg.ErrNoRows, err)
 			assert.Nil(t, class)
 		}
@@ -137,7 +139,7 @@ func TestClassSvc_Update(t *testing.T) {
 			s := time.Now().String()
 			name := s + "name"
 			desc := s + "desc"
-			class, err := svc.Update(context.Background(), pClass.Id, name, desc)
+			class, err := svc.Update(context.Background(), admin.Id, pClass.Id, name, desc)
 			if assert.Nil(t, err) {
 				assert.Equal(t, name, class.Name)
 				assert.Equal(t, desc, class.Description)
@@ -150,12 +152,14 @@ func TestClassSvc_Update(t *testing.T) {
 }
 
 func TestClassSvc_Delete(t *testing.T) {
-	pClasses, _ := prepareClass(t, db)
-	svc := NewClass(classDao)
+	pClasses, pUsers := prepareClass(t, db)
+	svc := NewClass(classDao, userDao)
+	admin := pUsers[0]
+	assert.Nil(t, userDao.SetRoles(context.Background(), admin.Id, []string{model.RoleAdmin}))
 
 	t.Run("正常删除", func(t *testing.T) {
 		for _, pClass := range pClasses {
-			err := svc.Delete(context.Background(), pClass.Id)
+			err := svc.Delete(context.Background(), admin.Id, pClass.Id)
 			if assert.Nil(t, err) {
 				var class model.Class
 				err = db.Model(&class).Where("id = ?", pClass.Id).Select()
@@ -167,7 +171,7 @@ func TestClassSvc_Delete(t *testing.T) {
 
 	t.Run("删除一个不存在的班级", func(t *testing.T) {
 		for i := 0; i < 10; i++ {
-			err := svc.Delete(context.Background(), rand.Intn(100)*10000)
+			err := svc.Delete(context.Background(), admin.Id, rand.Intn(100)*10000)
 			assert.Nil(t, err)
 		}
 	})
@@ -177,7 +181,7 @@ func TestClassSvc_Delete(t *testing.T) {
 
 func TestClassSvc_IsNameExist(t *testing.T) {
 	pClasses, _ := prepareClass(t, db)
-	svc := NewClass(classDao)
+	svc := NewClass(classDao, userDao)
 
 	t.Run("排除当前班级后，查找当前班级的名称", func(t *testing.T) {
 		for _, pClass := range pClasses {
@@ -219,3 +223,140 @@ func TestClassSvc_IsNameExist(t *testing.T) {
 
 	_ = testdb.Truncate(db)
 }
+
+func TestClassSvc_Members(t *testing.T) {
+	pClasses, pUsers := prepareClass(t, db)
+	svc := NewClass(classDao, userDao)
+
+	class := pClasses[0]
+	admin := pUsers[3]
+	assert.Nil(t, userDao.SetRoles(context.Background(), admin.Id, []string{model.RoleAdmin}))
+
+	t.Run("班级不存在", func(t *testing.T) {
+		err := svc.AddMembers(context.Background(), admin.Id, rand.Intn(100)*10000, []int{pUsers[0].Id})
+		assert.Equal(t, pg.ErrNoRows, err)
+	})
+
+	t.Run("加入非学生账号", func(t *testing.T) {
+		teacher := pUsers[0]
+		err := userDao.SetRoles(context.Background(), teacher.Id, []string{model.RoleTeacher})
+		if assert.Nil(t, err) {
+			err = svc.AddMembers(context.Background(), admin.Id, class.Id, []int{teacher.Id, pUsers[1].Id})
+			assert.Equal(t, cerror.BadRequest.WithMsg("部分用户不存在或不是学生"), err)
+		}
+	})
+
+	t.Run("加入不存在的用户", func(t *testing.T) {
+		err := svc.AddMembers(context.Background(), admin.Id, class.Id, []int{rand.Intn(100) * 10000})
+		assert.Equal(t, cerror.BadRequest.WithMsg("部分用户不存在或不是学生"), err)
+	})
+
+	t.Run("正常加入，重复的ID会被去重", func(t *testing.T) {
+		err := svc.AddMembers(context.Background(), admin.Id, class.Id, []int{pUsers[1].Id, pUsers[1].Id, pUsers[2].Id})
+		if assert.Nil(t, err) {
+			_, count, err := svc.ListMembersAndCount(context.Background(), admin.Id, class.Id, model.NewPage(1, 100), "")
+			if assert.Nil(t, err) {
+				assert.Equal(t, 2, count)
+			}
+		}
+	})
+
+	t.Run("删除班级后成员保留，彻底删除后成员被移出", func(t *testing.T) {
+		err := svc.Delete(context.Background(), admin.Id, class.Id)
+		if assert.Nil(t, err) {
+			count, err := db.Model((*model.User)(nil)).Where("class_id = ?", class.Id).Count()
+			if assert.Nil(t, err) {
+				assert.Equal(t, 2, count)
+			}
+		}
+		err = svc.Purge(context.Background(), class.Id)
+		if assert.Nil(t, err) {
+			count, err := db.Model((*model.User)(nil)).Where("class_id = ?", class.Id).Count()
+			if assert.Nil(t, err) {
+				assert.Zero(t, count)
+			}
+		}
+	})
+
+	_ = testdb.Truncate(db)
+}
+
+func TestClassSvc_Teacher(t *testing.T) {
+	pClasses, pUsers := prepareClass(t, db)
+	svc := NewClass(classDao, userDao)
+	ctx := context.Background()
+
+	// users[0] 一班的任课老师，users[1] 一班学生，users[2] 二班学生，users[3] 没有班级的学生
+	teacher, student, other, noClass := pUsers[0], pUsers[1], pUsers[2], pUsers[3]
+	taught, notTaught := pClasses[0], pClasses[1]
+	assert.Nil(t, userDao.SetRoles(ctx, teacher.Id, []string{model.RoleTeacher}))
+	assert.Nil(t, classDao.SetTeacher(ctx, taught.Id, teacher.Id, model.ClassTeacherAssistant))
+	assert.Nil(t, classDao.AddMembers(ctx, taught.Id, []int{student.Id}))
+	assert.Nil(t, classDao.AddMembers(ctx, notTaught.Id, []int{other.Id}))
+
+	t.Run("不能管理没有任教的班级", func(t *testing.T) {
+		at := assert.New(t)
+		_, err := svc.Update(ctx, teacher.Id, notTaught.Id, time.Now().String(), "")
+		at.Equal(errClassNotTaught, err)
+		_, _, err = svc.ListMembersAndCount(ctx, teacher.Id, notTaught.Id, model.NewPage(1, 10), "")
+		at.Equal(errClassNotTaught, err)
+		at.Equal(errClassNotTaught, svc.AddMembers(ctx, teacher.Id, notTaught.Id, []int{noClass.Id}))
+		at.Equal(errClassNotTaught, svc.RemoveMembers(ctx, teacher.Id, notTaught.Id, []int{other.Id}))
+		_, _, err = svc.ListSubjectsAndCount(ctx, teacher.Id, notTaught.Id, model.NewPage(1, 10))
+		at.Equal(errClassNotTaught, err)
+		at.Equal(errClassNotTaught, svc.AddSubjects(ctx, teacher.Id, notTaught.Id, []int{}))
+		at.Equal(errClassNotTaught, svc.RemoveSubjects(ctx, teacher.Id, notTaught.Id, []int{}))
+		_, err = svc.ListTeachers(ctx, teacher.Id, notTaught.Id)
+		at.Equal(errClassNotTaught, err)
+		at.Equal(errClassNotTaught, svc.Delete(ctx, teacher.Id, notTaught.Id))
+
+		// 没有被修改
+		count, err := db.Model((*model.User)(nil)).Where("class_id = ?", notTaught.Id).Count()
+		if at.Nil(err) {
+			at.Equal(1, count)
+		}
+		_, err = classDao.Get(ctx, notTaught.Id)
+		at.Nil(err)
+	})
+
+	t.Run("不能把其他班级的学生调到任教的班级", func(t *testing.T) {
+		at := assert.New(t)
+		err := svc.AddMembers(ctx, teacher.Id, taught.Id, []int{noClass.Id, other.Id})
+		at.Equal(cerror.Forbidden.WithMsg("部分学生在其他老师的班级中，请联系其班主任或管理员调整"), err)
+		u, err := userDao.Get(ctx, other.Id)
+		if at.Nil(err) {
+			at.Equal(notTaught.Id, u.ClassId)
+		}
+	})
+
+	t.Run("管理任教的班级", func(t *testing.T) {
+		at := assert.New(t)
+		name := time.Now().String()
+		class, err := svc.Update(ctx, teacher.Id, taught.Id, name, "")
+		if at.Nil(err) {
+			at.Equal(name, class.Name)
+		}
+		// 没有班级的学生和已经在任教班级中的学生可以加入
+		at.Nil(svc.AddMembers(ctx, teacher.Id, taught.Id, []int{noClass.Id, student.Id}))
+		_, count, err := svc.ListMembersAndCount(ctx, teacher.Id, taught.Id, model.NewPage(1, 10), "")
+		if at.Nil(err) {
+			at.Equal(2, count)
+		}
+		at.Nil(svc.RemoveMembers(ctx, teacher.Id, taught.Id, []int{noClass.Id}))
+		_, _, err = svc.ListSubjectsAndCount(ctx, teacher.Id, taught.Id, model.NewPage(1, 10))
+		at.Nil(err)
+		teachers, err := svc.ListTeachers(ctx, teacher.Id, taught.Id)
+		if at.Nil(err) && at.Len(teachers, 1) {
+			at.Equal(teacher.Id, teachers[0].UserId)
+		}
+	})
+
+	t.Run("拥有 student.manage_all 权限时不受限制", func(t *testing.T) {
+		at := assert.New(t)
+		assert.Nil(t, userDao.SetRoles(ctx, teacher.Id, []string{model.RoleAdmin}))
+		at.Nil(svc.AddMembers(ctx, teacher.Id, taught.Id, []int{other.Id}))
+		at.Nil(svc.Delete(ctx, teacher.Id, notTaught.Id))
+	})
+
+	_ = testdb.Truncate(db)
+}
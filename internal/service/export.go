@@ -0,0 +1,413 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/go-pg/pg/v10"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/storage"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/sheet"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// 执行中任务的租约时长，进程退出后最多经过这么久任务会被重新领取
+	exportLease = 2 * time.Minute
+	// 最多执行次数，超过后标记为失败
+	exportMaxAttempts = 3
+	// 每次从数据库读取的用户数量，导出时只有这么多用户在内存中
+	exportBatchSize = 500
+	// 查询任务列表时最多返回的数量
+	exportListLimit = 20
+)
+
+// 可以导出的列
+type ExportColumn struct {
+	Key   string `json:"key"`
+	Title string `json:"title"` // 表头
+
+	value func(u *model.User) string
+}
+
+var exportColumns = []*ExportColumn{
+	{Key: "id", Title: "ID", value: func(u *model.User) string { return strconv.Itoa(u.Id) }},
+	{Key: "name", Title: "用户名", value: func(u *model.User) string { return u.Name }},
+	{Key: "nick_name", Title: "姓名", value: func(u *model.User) string { return u.NickName }},
+	{Key: "phone", Title: "手机号", value: func(u *model.User) string { return u.Phone }},
+	{Key: "email", Title: "邮箱", value: func(u *model.User) string { return u.Email }},
+	{Key: "class", Title: "班级", value: func(u *model.User) string {
+		if u.Class == nil {
+			return ""
+		}
+		return u.Class.Name
+	}},
+	{Key: "roles", Title: "角色", value: func(u *model.User) string {
+		names := make([]string, 0, len(u.Roles))
+		for _, r := range u.Roles {
+			names = append(names, r.NickName)
+		}
+		return strings.Join(names, "、")
+	}},
+	{Key: "auth_source", Title: "登录方式", value: func(u *model.User) string {
+		switch u.AuthSource {
+		case model.UserAuthSourceLdap:
+			return "LDAP"
+		case model.UserAuthSourceOidc:
+			return "单点登录"
+		}
+		return "本地账号"
+	}},
+	{Key: "totp_enabled", Title: "两步验证", value: func(u *model.User) string {
+		if u.TotpEnabled {
+			return "已开启"
+		}
+		return "未开启"
+	}},
+	{Key: "created_at", Title: "创建时间", value: func(u *model.User) string { return u.CreatedAt.Local().Format("2006-01-02 15:04:05") }},
+}
+
+// 没有选择导出的列时使用
+var defaultExportColumns = []string{"name", "nick_name", "phone", "email", "class"}
+
+// 导出用户名单，条件与管理员的用户列表、老师的学生列表相同
+// 数据较多时创建后台任务，在后台生成文件并保存到存储中，完成后通过签名地址下载，文件超过保留时长后删除
+type IExport interface {
+	// 可以导出的列
+	Columns() []*ExportColumn
+	// 校验导出的格式和列，列为空时使用默认的列，导出学生时只导出学生账号
+	Prepare(ctx context.Context, job *model.ExportJob) error
+	// 符合条件的用户数量，用于判断是否需要在后台导出
+	Count(ctx context.Context, job *model.ExportJob) (int, error)
+	// 按照 job 中的条件分批查询用户并写入 w，返回写入的行数
+	Write(ctx context.Context, job *model.ExportJob, w io.Writer) (int, error)
+
+	// 创建后台任务
+	CreateJob(ctx context.Context, job *model.ExportJob) error
+	// 查询用户自己创建的任务，其他人的任务返回 pg.ErrNoRows
+	GetJob(ctx context.Context, userId, id int) (*model.ExportJob, error)
+	// 用户最近创建的任务
+	ListJobs(ctx context.Context, userId int) ([]*model.ExportJob, error)
+	// 打开已完成的任务生成的文件
+	Open(ctx context.Context, id int) (storage.Object, *model.ExportJob, error)
+
+	// 删除过期的任务，并执行一批任务，返回执行的数量
+	RunOnce(ctx context.Context) (int, error)
+	// 按 interval 轮询处理，直到 ctx 结束
+	Run(ctx context.Context, interval time.Duration)
+}
+
+// retention 为导出文件的保留时长，为 0 时保留一天
+func NewExport(dao dao.IExportJob, userDao dao.IUser, storage storage.Storage, tempPath string, retention time.Duration) *Export {
+	if retention <= 0 {
+		retention = 24 * time.Hour
+	}
+	return &Export{Dao: dao, UserDao: userDao, Storage: storage, TempPath: tempPath, Retention: retention}
+}
+
+type Export struct {
+	Dao       dao.IExportJob
+	UserDao   dao.IUser
+	Storage   storage.Storage
+	TempPath  string
+	Retention time.Duration
+}
+
+func (e Export) Columns() []*ExportColumn {
+	return exportColumns
+}
+
+func (e Export) Prepare(ctx context.Context, job *model.ExportJob) error {
+	job.Format = strings.ToLower(job.Format)
+	if !sheet.Supported("." + job.Format) {
+		return cerror.BadRequest.WithMsg("只支持导出 CSV 和 XLSX 格式")
+	}
+	switch job.Type {
+	case model.ExportTypeUser:
+	case model.ExportTypeStudent:
+		job.Role = model.RoleStudent
+	default:
+		return cerror.BadRequest.WithMsg("不支持导出的数据类型")
+	}
+
+	if len(job.Columns) == 0 {
+		job.Columns = defaultExportColumns
+	}
+	var columns []string
+	for _, key := range job.Columns {
+		if exportColumn(key) == nil {
+			return cerror.BadRequest.WithMsg("不支持导出的列：" + key)
+		}
+		if !containsString(columns, key) {
+			columns = append(columns, key)
+		}
+	}
+	job.Columns = columns
+	return nil
+}
+
+func (e Export) Count(ctx context.Context, job *model.ExportJob) (int, error) {
+	teacherId, err := e.scope(ctx, job)
+	if err != nil {
+		return 0, err
+	}
+	return e.UserDao.CountForExport(ctx, job.Query, job.Role, teacherId)
+}
+
+func (e Export) Write(ctx context.Context, job *model.ExportJob, w io.Writer) (int, error) {
+	teacherId, err := e.scope(ctx, job)
+	if err != nil {
+		return 0, err
+	}
+	columns := make([]*ExportColumn, 0, len(job.Columns))
+	header := make([]string, 0, len(job.Columns))
+	for _, key := range job.Columns {
+		c := exportColumn(key)
+		if c == nil {
+			return 0, cerror.BadRequest.WithMsg("不支持导出的列：" + key)
+		}
+		columns = append(columns, c)
+		header = append(header, c.Title)
+	}
+
+	sw, err := sheet.NewWriter(w, "."+job.Format)
+	if err != nil {
+		return 0, err
+	}
+	err = sw.Write(header)
+	if err != nil {
+		return 0, err
+	}
+	n, afterId := 0, 0
+	row := make([]string, len(columns))
+	for {
+		users, err := e.UserDao.ListForExport(ctx, job.Query, job.Role, teacherId, afterId, exportBatchSize)
+		if err != nil {
+			return n, err
+		}
+		for _, u := range users {
+			for i, c := range columns {
+				row[i] = c.value(u)
+			}
+			err = sw.Write(row)
+			if err != nil {
+				return n, err
+			}
+		}
+		n += len(users)
+		if len(users) < exportBatchSize {
+			break
+		}
+		afterId = users[len(users)-1].Id
+	}
+	return n, sw.Close()
+}
+
+func (e Export) CreateJob(ctx context.Context, job *model.ExportJob) error {
+	return e.Dao.Create(ctx, job)
+}
+
+func (e Export) GetJob(ctx context.Context, userId, id int) (*model.ExportJob, error) {
+	job, err := e.Dao.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.CreatedById != userId {
+		return nil, pg.ErrNoRows
+	}
+	return job, nil
+}
+
+func (e Export) ListJobs(ctx context.Context, userId int) ([]*model.ExportJob, error) {
+	return e.Dao.ListByUser(ctx, userId, exportListLimit)
+}
+
+func (e Export) Open(ctx context.Context, id int) (storage.Object, *model.ExportJob, error) {
+	job, err := e.Dao.Get(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if job.Status != model.ExportStatusDone {
+		return nil, nil, cerror.BadRequest.WithMsg("导出任务还没有完成")
+	}
+	obj, err := e.Storage.Get(ctx, job.FileKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return obj, job, nil
+}
+
+func (e Export) RunOnce(ctx context.Context) (int, error) {
+	err := e.cleanup(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for ; n < workerBatchSize; n++ {
+		job, err := e.Dao.Claim(ctx, exportLease)
+		if err != nil {
+			if errors.Is(err, pg.ErrNoRows) {
+				break
+			}
+			return n, err
+		}
+		err = e.run(ctx, job)
+		if err != nil {
+			// 没有权限等业务错误重试也不会成功
+			_, isCerr := err.(cerror.IError)
+			retry := !isCerr && job.Attempts < exportMaxAttempts
+			msg := err.Error()
+			if isCerr {
+				msg = err.(cerror.IError).Msg()
+			}
+			err = e.Dao.Fail(ctx, job.Id, msg, retry, time.Now().Add(e.Retention))
+			if err != nil {
+				return n, err
+			}
+			// 失败的任务等下一轮再重试，不立即重新领取
+			return n + 1, nil
+		}
+	}
+	return n, nil
+}
+
+func (e Export) Run(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, "导出用户名单", interval, e.RunOnce)
+}
+
+// 执行单个任务，先写入本地临时文件，完成后再保存到存储中
+func (e Export) run(ctx context.Context, job *model.ExportJob) error {
+	// 进程中途退出导致的重复执行也计入次数
+	if job.Attempts > exportMaxAttempts {
+		return errors.New("超过最大执行次数")
+	}
+
+	// 执行期间定时续期
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		ticker := time.NewTicker(exportLease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_ = e.Dao.Heartbeat(ctx, job.Id, exportLease)
+			}
+		}
+	}()
+
+	if e.TempPath != "" {
+		err := os.MkdirAll(e.TempPath, os.ModePerm)
+		if err != nil {
+			return err
+		}
+	}
+	f, err := ioutil.TempFile(e.TempPath, "export-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	rows, err := e.Write(ctx, job, f)
+	if err != nil {
+		return err
+	}
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	key := exportKey(job)
+	err = e.Storage.Put(ctx, key, f, size, sheet.ContentType("."+job.Format))
+	if err != nil {
+		return err
+	}
+	return e.Dao.Finish(ctx, job.Id, rows, key, time.Now().Add(e.Retention))
+}
+
+// 删除过期的任务和生成的文件
+func (e Export) cleanup(ctx context.Context) error {
+	jobs, err := e.Dao.ListExpired(ctx, workerBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if job.FileKey != "" {
+			err = e.Storage.Delete(ctx, job.FileKey)
+			if err != nil {
+				return err
+			}
+		}
+		err = e.Dao.Delete(ctx, job.Id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 导出时按照创建人当前的权限确定范围，返回 0 表示不限制班级
+// 后台任务执行时创建人的权限可能已经变化，所以每次都重新判断
+func (e Export) scope(ctx context.Context, job *model.ExportJob) (int, error) {
+	user, err := e.UserDao.Get(ctx, job.CreatedById)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			return 0, cerror.Forbidden.WithMsg("没有导出的权限")
+		}
+		return 0, err
+	}
+	switch job.Type {
+	case model.ExportTypeUser:
+		if user.Can(model.PermissionUserRead) {
+			return 0, nil
+		}
+	case model.ExportTypeStudent:
+		if user.Can(model.PermissionStudentAll) {
+			return 0, nil
+		}
+		if user.Can(model.PermissionStudentManage) {
+			return user.Id, nil
+		}
+	}
+	return 0, cerror.Forbidden.WithMsg("没有导出的权限")
+}
+
+// 导出文件的名称，例如 学生名单-20210101-120000.xlsx
+func ExportFileName(job *model.ExportJob) string {
+	name := "用户名单"
+	if job.Type == model.ExportTypeStudent {
+		name = "学生名单"
+	}
+	t := job.CreatedAt
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return name + "-" + t.Local().Format("20060102-150405") + "." + job.Format
+}
+
+// 导出文件在存储中的 key
+func exportKey(job *model.ExportJob) string {
+	return "exports/" + strconv.Itoa(job.Id) + "." + job.Format
+}
+
+func exportColumn(key string) *ExportColumn {
+	for _, c := range exportColumns {
+		if c.Key == key {
+			return c
+		}
+	}
+	return nil
+}
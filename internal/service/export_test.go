@@ -0,0 +1,128 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/sheet"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestExportSvc(t *testing.T) {
+	classes, users := prepareClass(t, db)
+	ctx := context.Background()
+
+	// users[0] 管理员，users[1] 一班的任课老师，users[2] 一班学生，users[3] 二班学生
+	admin, teacher, student := users[0], users[1], users[2]
+	assert.Nil(t, userDao.SetRoles(ctx, admin.Id, []string{model.RoleAdmin}))
+	assert.Nil(t, userDao.SetRoles(ctx, teacher.Id, []string{model.RoleTeacher}))
+	assert.Nil(t, classDao.SetTeacher(ctx, classes[0].Id, teacher.Id, model.ClassTeacherAssistant))
+	classSvc := NewClass(classDao, userDao)
+	assert.Nil(t, classSvc.AddMembers(ctx, admin.Id, classes[0].Id, []int{student.Id}))
+	assert.Nil(t, classSvc.AddMembers(ctx, admin.Id, classes[1].Id, []int{users[3].Id}))
+
+	svc := NewExport(dao.NewExportJob(db), userDao, lmStorage, "", time.Hour)
+
+	// 导出 CSV 后读取回来
+	export := func(job *model.ExportJob) ([][]string, error) {
+		err := svc.Prepare(ctx, job)
+		if err != nil {
+			return nil, err
+		}
+		buf := bytes.Buffer{}
+		_, err = svc.Write(ctx, job, &buf)
+		if err != nil {
+			return nil, err
+		}
+		return sheet.Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()), ".csv", 0)
+	}
+
+	t.Run("校验格式和列", func(t *testing.T) {
+		at := assert.New(t)
+		job := &model.ExportJob{Type: model.ExportTypeUser, Format: "XLSX", CreatedById: admin.Id}
+		at.Nil(svc.Prepare(ctx, job))
+		at.Equal("xlsx", job.Format)
+		at.Equal(defaultExportColumns, job.Columns)
+
+		job = &model.ExportJob{Type: model.ExportTypeUser, Format: "pdf"}
+		at.Equal(cerror.BadRequest.WithMsg("只支持导出 CSV 和 XLSX 格式"), svc.Prepare(ctx, job))
+		job = &model.ExportJob{Type: model.ExportTypeUser, Format: "csv", Columns: []string{"password"}}
+		at.Equal(cerror.BadRequest.WithMsg("不支持导出的列：password"), svc.Prepare(ctx, job))
+	})
+
+	t.Run("老师只能导出任教班级中的学生", func(t *testing.T) {
+		at := assert.New(t)
+		rows, err := export(&model.ExportJob{Type: model.ExportTypeStudent, Format: "csv", Columns: []string{"name", "class"}, CreatedById: teacher.Id})
+		if at.Nil(err) {
+			at.Equal([][]string{{"用户名", "班级"}, {student.Name, classes[0].Name}}, rows)
+		}
+
+		rows, err = export(&model.ExportJob{Type: model.ExportTypeStudent, Format: "csv", Columns: []string{"name"}, CreatedById: admin.Id})
+		if at.Nil(err) {
+			at.Len(rows, 3)
+		}
+
+		// 老师没有查看所有用户的权限
+		_, err = export(&model.ExportJob{Type: model.ExportTypeUser, Format: "csv", CreatedById: teacher.Id})
+		at.Equal(cerror.Forbidden.WithMsg("没有导出的权限"), err)
+	})
+
+	t.Run("后台导出", func(t *testing.T) {
+		at := assert.New(t)
+		job := &model.ExportJob{Type: model.ExportTypeUser, Format: "xlsx", Columns: []string{"id", "roles"}, CreatedById: admin.Id}
+		at.Nil(svc.Prepare(ctx, job))
+		at.Nil(svc.CreateJob(ctx, job))
+
+		n, err := svc.RunOnce(ctx)
+		at.Nil(err)
+		at.Equal(1, n)
+
+		job, err = svc.GetJob(ctx, admin.Id, job.Id)
+		if !at.Nil(err) {
+			return
+		}
+		at.Equal(model.ExportStatusDone, job.Status)
+		at.Equal(len(users), job.Rows)
+		at.NotEmpty(job.DownloadUrl)
+
+		// 其他人看不到
+		_, err = svc.GetJob(ctx, teacher.Id, job.Id)
+		at.Equal(pg.ErrNoRows, err)
+
+		obj, _, err := svc.Open(ctx, job.Id)
+		if !at.Nil(err) {
+			return
+		}
+		content, err := ioutil.ReadAll(obj)
+		_ = obj.Close()
+		at.Nil(err)
+		rows, err := sheet.Read(bytes.NewReader(content), int64(len(content)), ".xlsx", 0)
+		if at.Nil(err) {
+			at.Equal([]string{"ID", "角色"}, rows[0])
+			at.Len(rows, len(users)+1)
+		}
+	})
+
+	t.Run("没有权限时不重试", func(t *testing.T) {
+		at := assert.New(t)
+		job := &model.ExportJob{Type: model.ExportTypeUser, Format: "csv", CreatedById: teacher.Id}
+		at.Nil(svc.Prepare(ctx, job))
+		at.Nil(svc.CreateJob(ctx, job))
+		_, err := svc.RunOnce(ctx)
+		at.Nil(err)
+		job, err = svc.GetJob(ctx, teacher.Id, job.Id)
+		if at.Nil(err) {
+			at.Equal(model.ExportStatusFailed, job.Status)
+			at.Equal("没有导出的权限", job.Error)
+		}
+	})
+
+	_ = testdb.Truncate(db)
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/storage"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/extract"
+	"os"
+	"time"
+)
+
+// 后台提取学习资料文件中的正文，写入资料后参与全文检索
+// 待处理的资料记录在数据库中（extract_status 为 pending），服务重启后会继续处理
+type IExtract interface {
+	// 处理一批等待提取的资料，返回处理的数量
+	RunOnce(ctx context.Context) (int, error)
+	// 按 interval 轮询处理，直到 ctx 结束
+	Run(ctx context.Context, interval time.Duration)
+}
+
+// maxSize 为提取正文的文件大小上限，单位字节，为 0 时不限制
+func NewExtract(dao dao.ILearningMaterial, storage storage.Storage, tempPath string, maxSize int64) *Extract {
+	return &Extract{Dao: dao, Storage: storage, TempPath: tempPath, MaxSize: maxSize}
+}
+
+type Extract struct {
+	Dao      dao.ILearningMaterial
+	Storage  storage.Storage
+	TempPath string
+	MaxSize  int64
+}
+
+func (e Extract) RunOnce(ctx context.Context) (int, error) {
+	lms, err := e.Dao.ListExtractPending(ctx, workerBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	for _, lm := range lms {
+		status, content, extractErr := e.extract(ctx, lm)
+		// 提取期间资料切换了版本时结果会被丢弃，新版本仍是 pending，下一轮会重新处理
+		_, err = e.Dao.SetExtractResult(ctx, lm.Id, lm.Md5, status, content, extractErr)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(lms), nil
+}
+
+func (e Extract) Run(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, "提取学习资料正文", interval, e.RunOnce)
+}
+
+// 提取单个资料的正文，返回提取状态、正文和失败原因
+func (e Extract) extract(ctx context.Context, lm *model.LearningMaterial) (string, string, string) {
+	ext := fileExt(lm.FilePath)
+	if !extract.Supported(ext) {
+		return model.ExtractStatusUnsupported, "", ""
+	}
+
+	info, err := e.Storage.Stat(ctx, lm.FilePath)
+	if err != nil {
+		return model.ExtractStatusFailed, "", err.Error()
+	}
+	if e.MaxSize > 0 && info.Size > e.MaxSize {
+		return model.ExtractStatusFailed, "", fmt.Sprintf("文件超过 %d MB，不提取正文", e.MaxSize>>20)
+	}
+
+	// 解析文件需要随机读取，先复制到本地临时文件
+	f, err := copyToTemp(ctx, e.Storage, e.TempPath, lm.FilePath)
+	if err != nil {
+		return model.ExtractStatusFailed, "", err.Error()
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+	stat, err := f.Stat()
+	if err != nil {
+		return model.ExtractStatusFailed, "", err.Error()
+	}
+
+	content, err := extract.Text(f, stat.Size(), ext)
+	if err != nil {
+		return model.ExtractStatusFailed, "", err.Error()
+	}
+	return model.ExtractStatusDone, content, ""
+}
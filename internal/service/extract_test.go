@@ -0,0 +1,118 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"testing"
+	"time"
+)
+
+// 生成只有一段文字的 DOCX
+func docxFile(t *testing.T, text string) []byte {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	w, err := zw.Create("word/document.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.Write([]byte(`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body><w:p><w:r><w:t>` + text + `</w:t></w:r></w:p></w:body></w:document>`))
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// 一直处理到没有等待提取的资料
+func runExtract(t *testing.T, svc *Extract) {
+	for {
+		n, err := svc.RunOnce(context.Background())
+		if !assert.Nil(t, err) || n == 0 {
+			return
+		}
+	}
+}
+
+func TestExtractSvc_RunOnce(t *testing.T) {
+	_, pSubjects, pUsers := prepareLearningMaterial(t, db)
+	lmSvc := NewLearningMaterial(lmDao, lmVersionDao, lmStorage, "")
+	svc := NewExtract(lmDao, lmStorage, "", 1<<20)
+	searchDao := dao.NewSearch(db)
+	ctx := context.Background()
+
+	createdById := pUsers[0].Id
+	subjectId := pSubjects[0].Id
+
+	t.Run("提取正文并参与检索", func(t *testing.T) {
+		at := assert.New(t)
+		lm, err := lmSvc.Upload(ctx, createdById, subjectId, time.Now().String(), "", "讲义.docx", bytes.NewReader(docxFile(t, "氢原子钟的频率稳定度")))
+		if !at.Nil(err) {
+			return
+		}
+		at.Equal(model.ExtractStatusPending, lm.ExtractStatus)
+
+		runExtract(t, svc)
+		lm, err = lmSvc.Get(ctx, lm.Id)
+		at.Nil(err)
+		at.Equal(model.ExtractStatusDone, lm.ExtractStatus)
+		at.Equal("氢原子钟的频率稳定度", lm.Content)
+
+		results, _, err := searchDao.SearchAndCount(ctx, model.NewPage(1, 10), &model.SearchFilter{
+			Query: "氢原子钟",
+			Types: []string{model.SearchTypeLearningMaterial},
+		})
+		at.Nil(err)
+		if at.Len(results, 1) {
+			at.Equal(lm.Id, results[0].Id)
+		}
+
+		// 上传新版本后旧正文失效，重新提取
+		lm, err = lmSvc.UploadVersion(ctx, lm.Id, createdById, "", "讲义.docx", bytes.NewReader(docxFile(t, "铯原子喷泉钟")))
+		at.Nil(err)
+		at.Equal(model.ExtractStatusPending, lm.ExtractStatus)
+		runExtract(t, svc)
+		lm, err = lmSvc.Get(ctx, lm.Id)
+		at.Nil(err)
+		at.Equal(model.ExtractStatusDone, lm.ExtractStatus)
+		at.Equal("铯原子喷泉钟", lm.Content)
+	})
+
+	t.Run("不支持的类型", func(t *testing.T) {
+		at := assert.New(t)
+		lm, err := lmSvc.Upload(ctx, createdById, subjectId, time.Now().String(), "", "video.mp4", bytes.NewReader([]byte(time.Now().String())))
+		if !at.Nil(err) {
+			return
+		}
+		runExtract(t, svc)
+		lm, err = lmSvc.Get(ctx, lm.Id)
+		at.Nil(err)
+		at.Equal(model.ExtractStatusUnsupported, lm.ExtractStatus)
+
+		_, err = lmSvc.Reextract(ctx, lm.Id)
+		at.NotNil(err)
+	})
+
+	t.Run("提取失败后重新提取", func(t *testing.T) {
+		at := assert.New(t)
+		lm, err := lmSvc.Upload(ctx, createdById, subjectId, time.Now().String(), "", "broken.pdf", bytes.NewReader([]byte(time.Now().String())))
+		if !at.Nil(err) {
+			return
+		}
+		runExtract(t, svc)
+		lm, err = lmSvc.Get(ctx, lm.Id)
+		at.Nil(err)
+		at.Equal(model.ExtractStatusFailed, lm.ExtractStatus)
+		at.NotEmpty(lm.ExtractError)
+
+		lm, err = lmSvc.Reextract(ctx, lm.Id)
+		at.Nil(err)
+		at.Equal(model.ExtractStatusPending, lm.ExtractStatus)
+		at.Empty(lm.ExtractError)
+	})
+
+	_ = testdb.Truncate(db)
+}
@@ -0,0 +1,308 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/go-pg/pg/v10"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// LDAP 登录的配置，对应 setting.Ldap
+type LdapOptions struct {
+	Url                string
+	StartTLS           bool
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+	BindDN             string
+	BindPassword       string
+	BaseDN             string
+	UserFilter         string
+
+	NameAttribute     string
+	NickNameAttribute string
+	EmailAttribute    string
+	PhoneAttribute    string
+
+	GroupAttribute string
+	GroupBaseDN    string
+	GroupFilter    string
+	AdminGroups    []string
+	TeacherGroups  []string
+
+	LinkExisting bool
+}
+
+// LDAP 账号，使用用户的 DN 和密码登录 LDAP 服务器
+// 第一次登录时自动创建本地用户，之后每次登录都按照 LDAP 中的信息同步显示名称、联系方式和内置角色
+func NewLdapAuth(userDao dao.IUser, userSvc IUser, options LdapOptions) *LdapAuth {
+	return &LdapAuth{UserDao: userDao, UserSvc: userSvc, Options: options}
+}
+
+type LdapAuth struct {
+	UserDao dao.IUser
+	UserSvc IUser
+	Options LdapOptions
+}
+
+func (l LdapAuth) Authenticate(ctx context.Context, name, password string) (*model.User, error) {
+	if password == "" {
+		return nil, ErrBadCredentials
+	}
+	conn, err := l.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if l.Options.BindDN != "" {
+		err = conn.Bind(l.Options.BindDN, l.Options.BindPassword)
+		if err != nil {
+			return nil, fmt.Errorf("LDAP 服务账号登录失败：%w", err)
+		}
+	}
+	res, err := conn.Search(ldap.NewSearchRequest(
+		l.Options.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(l.Options.UserFilter, ldap.EscapeFilter(name)), l.attributes(), nil,
+	))
+	// 超出条数限制说明匹配到了多个用户，按下面的条数判断处理
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, err
+	}
+	// 查询条件不够精确，匹配到多个用户时不能确定是哪一个
+	if err != nil || len(res.Entries) != 1 {
+		return nil, ErrBadCredentials
+	}
+	entry := res.Entries[0]
+
+	// 用户自己可能没有查询组的权限，用服务账号先查好
+	groups, err := l.groups(conn, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.Bind(entry.DN, password)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrBadCredentials
+		}
+		return nil, err
+	}
+	return l.sync(ctx, name, entry, groups)
+}
+
+func (l LdapAuth) dial() (*ldap.Conn, error) {
+	u, err := url.Parse(l.Options.Url)
+	if err != nil {
+		return nil, err
+	}
+	// StartTLS 时需要用主机名校验证书
+	tlsConfig := &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: l.Options.InsecureSkipVerify}
+	conn, err := ldap.DialURL(l.Options.Url, ldap.DialWithTLSDialer(tlsConfig, &net.Dialer{Timeout: l.Options.Timeout}))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(l.Options.Timeout)
+	if l.Options.StartTLS {
+		err = conn.StartTLS(tlsConfig)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// 需要读取的用户属性
+func (l LdapAuth) attributes() []string {
+	var attrs []string
+	for _, a := range []string{
+		l.Options.NameAttribute,
+		l.Options.NickNameAttribute,
+		l.Options.EmailAttribute,
+		l.Options.PhoneAttribute,
+		l.Options.GroupAttribute,
+	} {
+		if a != "" {
+			attrs = append(attrs, a)
+		}
+	}
+	// 都没有配置时只返回 DN
+	if len(attrs) == 0 {
+		attrs = []string{"1.1"}
+	}
+	return attrs
+}
+
+// 用户所属的组的 DN
+func (l LdapAuth) groups(conn *ldap.Conn, entry *ldap.Entry) ([]string, error) {
+	var groups []string
+	if l.Options.GroupAttribute != "" {
+		groups = append(groups, entry.GetEqualFoldAttributeValues(l.Options.GroupAttribute)...)
+	}
+	if l.Options.GroupBaseDN == "" || l.Options.GroupFilter == "" {
+		return groups, nil
+	}
+	res, err := conn.Search(ldap.NewSearchRequest(
+		l.Options.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf(l.Options.GroupFilter, ldap.EscapeFilter(entry.DN)), []string{"1.1"}, nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range res.Entries {
+		groups = append(groups, e.DN)
+	}
+	return groups, nil
+}
+
+// 按照所属的组确定内置角色，没有配置任何组时返回 false，不同步
+func (l LdapAuth) role(groups []string) (role string, ok bool) {
+	if len(l.Options.AdminGroups) == 0 && len(l.Options.TeacherGroups) == 0 {
+		return "", false
+	}
+	if containsDN(l.Options.AdminGroups, groups) {
+		return model.RoleAdmin, true
+	}
+	if containsDN(l.Options.TeacherGroups, groups) {
+		return model.RoleTeacher, true
+	}
+	return model.RoleStudent, true
+}
+
+// 创建或者关联本地用户，并同步 LDAP 中的信息
+func (l LdapAuth) sync(ctx context.Context, name string, entry *ldap.Entry, groups []string) (*model.User, error) {
+	// LDAP 查询不区分大小写，以 LDAP 中保存的用户名为准，避免大小写不同时创建出多个用户
+	if l.Options.NameAttribute != "" && entry.GetEqualFoldAttributeValue(l.Options.NameAttribute) != "" {
+		name = entry.GetEqualFoldAttributeValue(l.Options.NameAttribute)
+	}
+	role, syncRole := l.role(groups)
+
+	user, err := l.UserDao.GetByName(ctx, name)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			return l.create(ctx, name, entry, role)
+		}
+		return nil, err
+	}
+
+	update := model.User{Id: user.Id, AuthSource: model.UserAuthSourceLdap}
+	var columns []string
+	if user.AuthSource != model.UserAuthSourceLdap {
+		// 本地管理员不关联，避免目录中的同名账号接管管理员
+		if !l.Options.LinkExisting || user.HasRole(model.RoleAdmin) {
+			return nil, cerror.BadRequest.WithMsg("已存在同名的本地账号，请联系管理员处理")
+		}
+		// 关联后只能使用 LDAP 密码登录，也不需要再修改本地密码
+		columns = append(columns, "auth_source", "must_change_password")
+	}
+	if v := entry.GetEqualFoldAttributeValue(l.Options.NickNameAttribute); l.Options.NickNameAttribute != "" && v != "" {
+		update.NickName = v
+		columns = append(columns, "nick_name")
+	}
+	if v := l.email(ctx, entry, user.Id); v != "" && v != user.Email {
+		update.Email = v
+		columns = append(columns, "email")
+	}
+	if v := l.phone(ctx, entry, user.Id); v != "" && v != user.Phone {
+		update.Phone = v
+		columns = append(columns, "phone")
+	}
+	if len(columns) != 0 {
+		err = l.UserSvc.Update(ctx, &update, columns)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if syncRole {
+		// 只同步内置角色，本系统中额外分配的角色保留
+		return l.UserSvc.SetRoles(ctx, user.Id, replaceBuiltinRole(user.RoleNames(), role))
+	}
+	if len(columns) == 0 {
+		return user, nil
+	}
+	return l.UserDao.Get(ctx, user.Id)
+}
+
+func (l LdapAuth) create(ctx context.Context, name string, entry *ldap.Entry, role string) (*model.User, error) {
+	// 本地密码用不到，设置为随机值
+	password, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := utils.EncodePwd(password)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		role = model.RoleStudent
+	}
+	user := model.User{
+		Name:       name,
+		NickName:   entry.GetEqualFoldAttributeValue(l.Options.NickNameAttribute),
+		Email:      l.email(ctx, entry, 0),
+		Phone:      l.phone(ctx, entry, 0),
+		Roles:      []*model.Role{{Name: role}},
+		Password:   hash,
+		AuthSource: model.UserAuthSourceLdap,
+	}
+	if l.Options.NickNameAttribute == "" || user.NickName == "" {
+		user.NickName = name
+	}
+	err = l.UserDao.Create(ctx, &user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// LDAP 中的邮箱，已经被其他用户使用时不同步
+func (l LdapAuth) email(ctx context.Context, entry *ldap.Entry, excludeId int) string {
+	if l.Options.EmailAttribute == "" {
+		return ""
+	}
+	v := entry.GetEqualFoldAttributeValue(l.Options.EmailAttribute)
+	if v == "" {
+		return ""
+	}
+	if is, err := l.UserDao.IsEmailExist(ctx, v, excludeId); err != nil || is {
+		return ""
+	}
+	return v
+}
+
+// LDAP 中的手机号，已经被其他用户使用时不同步
+func (l LdapAuth) phone(ctx context.Context, entry *ldap.Entry, excludeId int) string {
+	if l.Options.PhoneAttribute == "" {
+		return ""
+	}
+	v := entry.GetEqualFoldAttributeValue(l.Options.PhoneAttribute)
+	if v == "" {
+		return ""
+	}
+	if is, err := l.UserDao.IsPhoneExist(ctx, v, excludeId); err != nil || is {
+		return ""
+	}
+	return v
+}
+
+// groups 中是否有 dns 中的任意一个，DN 不区分大小写
+func containsDN(dns, groups []string) bool {
+	for _, dn := range dns {
+		for _, g := range groups {
+			if strings.EqualFold(strings.TrimSpace(dn), strings.TrimSpace(g)) {
+				return true
+			}
+		}
+	}
+	return false
+}
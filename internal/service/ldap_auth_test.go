@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLdapRole(t *testing.T) {
+	at := assert.New(t)
+	svc := NewLdapAuth(userDao, nil, LdapOptions{
+		AdminGroups:   []string{"cn=admins,ou=groups,dc=example,dc=org"},
+		TeacherGroups: []string{"cn=teachers,ou=groups,dc=example,dc=org"},
+	})
+
+	role, ok := svc.role([]string{"CN=Admins, OU=Groups, DC=Example, DC=Org"})
+	at.True(ok)
+	at.Equal(model.RoleAdmin, role)
+
+	role, ok = svc.role([]string{"cn=teachers,ou=groups,dc=example,dc=org"})
+	at.True(ok)
+	at.Equal(model.RoleTeacher, role)
+
+	role, ok = svc.role(nil)
+	at.True(ok)
+	at.Equal(model.RoleStudent, role)
+
+	// 没有配置组时不同步
+	_, ok = NewLdapAuth(userDao, nil, LdapOptions{}).role(nil)
+	at.False(ok)
+}
+
+// 需要一个 LDAP 服务，可以使用 docker-compose.yml 中的 openldap，测试数据在 testdata/ldap 中：
+// LDAP_TEST_URL=ldap://localhost:389 go test ./internal/service/ -run TestLdapAuthSvc
+func TestLdapAuthSvc(t *testing.T) {
+	url := os.Getenv("LDAP_TEST_URL")
+	if url == "" {
+		t.Skip("未设置 LDAP_TEST_URL，跳过 LDAP 登录测试")
+	}
+
+	pUsers, err := testdb.SeedUser(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userSvc := NewUser(userDao, utils.PwdPolicy{})
+	options := LdapOptions{
+		Url:               url,
+		Timeout:           5 * time.Second,
+		BindDN:            "cn=admin,dc=example,dc=org",
+		BindPassword:      "admin",
+		BaseDN:            "ou=people,dc=example,dc=org",
+		UserFilter:        "(&(objectClass=inetOrgPerson)(uid=%s))",
+		NameAttribute:     "uid",
+		NickNameAttribute: "cn",
+		EmailAttribute:    "mail",
+		PhoneAttribute:    "mobile",
+		GroupBaseDN:       "ou=groups,dc=example,dc=org",
+		GroupFilter:       "(&(objectClass=groupOfNames)(member=%s))",
+		AdminGroups:       []string{"cn=admins,ou=groups,dc=example,dc=org"},
+		TeacherGroups:     []string{"cn=teachers,ou=groups,dc=example,dc=org"},
+		LinkExisting:      true,
+	}
+	svc := NewLdapAuth(userDao, userSvc, options)
+	ctx := context.Background()
+
+	t.Run("第一次登录时创建用户", func(t *testing.T) {
+		at := assert.New(t)
+		user, err := svc.Authenticate(ctx, "ldap-teacher", "teacher-password")
+		if !at.Nil(err) {
+			return
+		}
+		at.NotZero(user.Id)
+		at.Equal("ldap-teacher", user.Name)
+		at.Equal("LDAP 老师", user.NickName)
+		at.Equal("ldap-teacher@example.org", user.Email)
+		at.Equal("13800000001", user.Phone)
+		at.Equal([]string{model.RoleTeacher}, user.RoleNames())
+		at.Equal(model.UserAuthSourceLdap, user.AuthSource)
+
+		// 再次登录时使用同一个用户，用户名大小写不同也一样
+		again, err := svc.Authenticate(ctx, "LDAP-Teacher", "teacher-password")
+		if at.Nil(err) {
+			at.Equal(user.Id, again.Id)
+		}
+
+		// 只能用 LDAP 密码登录，不能修改和重置本地密码
+		_, err = NewLocalAuth(userDao).Authenticate(ctx, "ldap-teacher", "teacher-password")
+		at.Equal(ErrBadCredentials, err)
+		_, err = userSvc.UpdatePassword(ctx, user.Id, "teacher-password", "new-password")
+		at.Equal(cerror.BadRequest.WithMsg("账号使用 LDAP 登录，请在 LDAP 中修改密码"), err)
+	})
+
+	t.Run("按照组同步角色", func(t *testing.T) {
+		at := assert.New(t)
+		admin, err := svc.Authenticate(ctx, "ldap-admin", "admin-password")
+		if at.Nil(err) {
+			at.Equal([]string{model.RoleAdmin}, admin.RoleNames())
+		}
+		// 没有手机号和邮箱的用户可以有多个
+		student, err := svc.Authenticate(ctx, "ldap-student", "student-password")
+		if at.Nil(err) {
+			at.Equal([]string{model.RoleStudent}, student.RoleNames())
+			at.Empty(student.Phone)
+		}
+
+		// 管理员在本地被改成学生，下次登录时恢复，之前的 token 失效；本地额外分配的角色保留
+		assistant := model.Role{Name: "ldap_assistant", NickName: "助教", Permissions: []string{model.PermissionMaterialUpload}}
+		at.Nil(dao.NewRole(db).Create(ctx, &assistant))
+		changed, err := userSvc.SetRoles(ctx, admin.Id, []string{model.RoleStudent, assistant.Name})
+		at.Nil(err)
+		again, err := svc.Authenticate(ctx, "ldap-admin", "admin-password")
+		if at.Nil(err) {
+			at.ElementsMatch([]string{model.RoleAdmin, assistant.Name}, again.RoleNames())
+			at.Equal(changed.TokenVersion+1, again.TokenVersion)
+		}
+	})
+
+	t.Run("密码错误或者用户不存在", func(t *testing.T) {
+		at := assert.New(t)
+		_, err := svc.Authenticate(ctx, "ldap-teacher", "wrong")
+		at.Equal(ErrBadCredentials, err)
+		_, err = svc.Authenticate(ctx, "ldap-teacher", "")
+		at.Equal(ErrBadCredentials, err)
+		_, err = svc.Authenticate(ctx, "nobody", "teacher-password")
+		at.Equal(ErrBadCredentials, err)
+		// 通配符被转义，不能匹配到其他用户
+		_, err = svc.Authenticate(ctx, "ldap-*", "teacher-password")
+		at.Equal(ErrBadCredentials, err)
+	})
+
+	t.Run("关联同名的本地账号", func(t *testing.T) {
+		at := assert.New(t)
+		local := model.User{Name: "ldap-local", NickName: "本地", Phone: "local", Email: "local", Password: "local-password", MustChangePassword: true, CreatedById: pUsers[0].Id}
+		if !at.Nil(userSvc.Create(ctx, &local)) {
+			return
+		}
+
+		// 不关联时不能登录
+		_, err := NewLdapAuth(userDao, userSvc, LdapOptions{}).sync(ctx, "ldap-local", &ldap.Entry{}, nil)
+		at.Equal(cerror.BadRequest.WithMsg("已存在同名的本地账号，请联系管理员处理"), err)
+
+		user, err := svc.Authenticate(ctx, "ldap-local", "local-password")
+		if at.Nil(err) {
+			at.Equal(local.Id, user.Id)
+			at.Equal(model.UserAuthSourceLdap, user.AuthSource)
+			at.Equal("同名本地账号", user.NickName)
+			at.False(user.MustChangePassword)
+		}
+	})
+
+	t.Run("本地管理员不关联", func(t *testing.T) {
+		at := assert.New(t)
+		admin := model.User{Name: "ldap-admin-local", NickName: "本地管理员", Phone: "admin", Email: "admin", Password: "x", Roles: []*model.Role{{Name: model.RoleAdmin}}}
+		at.Nil(userDao.Create(ctx, &admin))
+		_, err := svc.sync(ctx, "ldap-admin-local", &ldap.Entry{}, nil)
+		at.Equal(cerror.BadRequest.WithMsg("已存在同名的本地账号，请联系管理员处理"), err)
+	})
+
+	_ = testdb.Truncate(db)
+}
@@ -2,26 +2,55 @@ package service
 
 import (
 	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-pg/pg/v10"
 	"github.com/pkg/errors"
 	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/storage"
 	"github.com/xuxusheng/time-frequency-be/internal/model"
 	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path"
+	"regexp"
+	"strings"
 )
 
 type ILearningMaterial interface {
 	Create(ctx context.Context, createdById, subjectId int, name, description, md5, filePath string) (*model.LearningMaterial, error)
+	Upload(ctx context.Context, createdById, subjectId int, name, description, fileName string, file io.Reader) (*model.LearningMaterial, error)
 	Get(ctx context.Context, id int) (*model.LearningMaterial, error)
+	Open(ctx context.Context, id int) (*model.LearningMaterial, storage.Object, error)
+	// 打开资料的预览图，还没有预览图时返回的 Object 为 nil
+	OpenPreview(ctx context.Context, id int) (*model.LearningMaterial, storage.Object, error)
+	ListAndCount(ctx context.Context, p *model.Page, f *model.LearningMaterialFilter) ([]*model.LearningMaterial, int, error)
 	Update(ctx context.Context, id, updatedById int, name, description string) (*model.LearningMaterial, error)
-	Delete(ctx context.Context, id int) error
+	// 重新上传文件，生成一个新版本
+	UploadVersion(ctx context.Context, id, updatedById int, note, fileName string, file io.Reader) (*model.LearningMaterial, error)
+	ListVersionsAndCount(ctx context.Context, id int, p *model.Page) ([]*model.LearningMaterialVersion, int, error)
+	// 回滚到某个历史版本，回滚本身也会生成一个新版本，历史记录不会丢失
+	Rollback(ctx context.Context, id, updatedById, versionId int) (*model.LearningMaterial, error)
+	// 将资料重新置为等待提取正文，由后台任务处理，正在等待或不支持提取的资料不允许操作
+	Reextract(ctx context.Context, id int) (*model.LearningMaterial, error)
+	Delete(ctx context.Context, id int) error // 移入回收站
+	Purge(ctx context.Context, id int) error  // 彻底删除回收站中的数据
 	IsNameExist(ctx context.Context, name string, excludeId int) (bool, error)
 }
 
-func NewLearningMaterial(dao dao.ILearningMaterial) *LearningMaterial {
-	return &LearningMaterial{Dao: dao}
+// 资料中的 FilePath 为文件在 storage 中的 key，tempPath 为上传时临时文件的存放目录，为空时使用系统临时目录
+func NewLearningMaterial(dao dao.ILearningMaterial, versionDao dao.ILearningMaterialVersion, storage storage.Storage, tempPath string) *LearningMaterial {
+	return &LearningMaterial{Dao: dao, VersionDao: versionDao, Storage: storage, TempPath: tempPath}
 }
 
 type LearningMaterial struct {
-	Dao dao.ILearningMaterial
+	Dao        dao.ILearningMaterial
+	VersionDao dao.ILearningMaterialVersion
+	Storage    storage.Storage
+	TempPath   string
 }
 
 func (l LearningMaterial) Create(ctx context.Context, createdById, subjectId int, name, description, md5, filePath string) (*model.LearningMaterial, error) {
@@ -34,10 +63,33 @@ func (l LearningMaterial) Create(ctx context.Context, createdById, subjectId int
 	if is {
 		return nil, cerror.BadRequest.WithMsg("资料名称已存在")
 	}
-	lm, err := d.Create(ctx, createdById, subjectId, name, description, md5, filePath)
+	// 同时创建第一个版本
+	return d.Create(ctx, createdById, subjectId, name, description, md5, filePath)
+}
+
+// 保存上传的文件并创建资料
+// 文件按内容的 md5 存放，内容相同的文件只会保存一份
+func (l LearningMaterial) Upload(ctx context.Context, createdById, subjectId int, name, description, fileName string, file io.Reader) (*model.LearningMaterial, error) {
+	// 先判断资料名称，避免无意义的文件写入
+	is, err := l.Dao.IsNameExist(ctx, name, 0)
+	if err != nil {
+		return nil, err
+	}
+	if is {
+		return nil, cerror.BadRequest.WithMsg("资料名称已存在")
+	}
+
+	sum, filePath, err := l.saveFile(ctx, fileName, file)
 	if err != nil {
 		return nil, err
 	}
+
+	lm, err := l.Create(ctx, createdById, subjectId, name, description, sum, filePath)
+	if err != nil {
+		// 创建失败时清理掉没有被引用的文件
+		_ = l.removeFileIfUnused(ctx, filePath, 0)
+		return nil, err
+	}
 	return lm, nil
 }
 
@@ -45,6 +97,42 @@ func (l LearningMaterial) Get(ctx context.Context, id int) (*model.LearningMater
 	return l.Dao.Get(ctx, id)
 }
 
+// 打开资料对应的文件，调用方负责关闭
+func (l LearningMaterial) Open(ctx context.Context, id int) (*model.LearningMaterial, storage.Object, error) {
+	lm, err := l.Dao.Get(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	obj, err := l.Storage.Get(ctx, lm.FilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return lm, obj, nil
+}
+
+func (l LearningMaterial) OpenPreview(ctx context.Context, id int) (*model.LearningMaterial, storage.Object, error) {
+	lm, err := l.Dao.Get(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if lm.PreviewPath == "" {
+		return lm, nil, nil
+	}
+	obj, err := l.Storage.Get(ctx, lm.PreviewPath)
+	if err != nil {
+		// 预览图丢失时退化为通用图标
+		if errors.Is(err, storage.ErrNotExist) {
+			return lm, nil, nil
+		}
+		return nil, nil, err
+	}
+	return lm, obj, nil
+}
+
+func (l LearningMaterial) ListAndCount(ctx context.Context, p *model.Page, f *model.LearningMaterialFilter) ([]*model.LearningMaterial, int, error) {
+	return l.Dao.ListAndCount(ctx, p, f)
+}
+
 func (l LearningMaterial) Update(ctx context.Context, id, updatedById int, name, description string) (*model.LearningMaterial, error) {
 	d := l.Dao
 	// 判断资料名称是否存在
@@ -53,7 +141,7 @@ func (l LearningMaterial) Update(ctx context.Context, id, updatedById int, name,
 		return nil, err
 	}
 	if is {
-		return nil, errors.New("资料名称已存在")
+		return nil, cerror.BadRequest.WithMsg("资料名称已存在")
 	}
 	lm, err := d.Update(ctx, id, updatedById, name, description)
 	if err != nil {
@@ -62,10 +150,199 @@ func (l LearningMaterial) Update(ctx context.Context, id, updatedById int, name,
 	return lm, nil
 }
 
+func (l LearningMaterial) UploadVersion(ctx context.Context, id, updatedById int, note, fileName string, file io.Reader) (*model.LearningMaterial, error) {
+	lm, err := l.Dao.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	sum, filePath, err := l.saveFile(ctx, fileName, file)
+	if err != nil {
+		return nil, err
+	}
+	if sum == lm.Md5 {
+		return nil, cerror.BadRequest.WithMsg("文件内容与当前版本相同")
+	}
+
+	lm, err = l.newVersion(ctx, lm, updatedById, note, sum, filePath)
+	if err != nil {
+		_ = l.removeFileIfUnused(ctx, filePath, 0)
+		return nil, err
+	}
+	return lm, nil
+}
+
+func (l LearningMaterial) ListVersionsAndCount(ctx context.Context, id int, p *model.Page) ([]*model.LearningMaterialVersion, int, error) {
+	// 确认资料存在
+	_, err := l.Dao.Get(ctx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	return l.VersionDao.ListAndCount(ctx, p, id)
+}
+
+func (l LearningMaterial) Rollback(ctx context.Context, id, updatedById, versionId int) (*model.LearningMaterial, error) {
+	lm, err := l.Dao.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	v, err := l.VersionDao.Get(ctx, versionId)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			return nil, cerror.BadRequest.WithMsg("版本不存在")
+		}
+		return nil, err
+	}
+	if v.LearningMaterialId != lm.Id {
+		return nil, cerror.BadRequest.WithMsg("版本不属于该资料")
+	}
+	if v.Version == lm.Version {
+		return nil, cerror.BadRequest.WithMsg("已经是当前版本")
+	}
+	return l.newVersion(ctx, lm, updatedById, fmt.Sprintf("回滚到版本 %d", v.Version), v.Md5, v.FilePath)
+}
+
+func (l LearningMaterial) Reextract(ctx context.Context, id int) (*model.LearningMaterial, error) {
+	lm, err := l.Dao.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	switch lm.ExtractStatus {
+	case model.ExtractStatusPending:
+		return nil, cerror.BadRequest.WithMsg("正在等待提取正文")
+	case model.ExtractStatusUnsupported:
+		return nil, cerror.BadRequest.WithMsg("该类型的文件不支持提取正文")
+	}
+	return l.Dao.ResetExtract(ctx, id)
+}
+
+// 移入回收站，历史版本和文件保留，恢复后原样可用
 func (l LearningMaterial) Delete(ctx context.Context, id int) error {
 	return l.Dao.Delete(ctx, id)
 }
 
+// 彻底删除回收站中的资料，连同所有版本，以及不再被引用的文件
+func (l LearningMaterial) Purge(ctx context.Context, id int) error {
+	d := l.Dao
+	lm, err := d.GetDeleted(ctx, id)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	filePaths, err := l.VersionDao.ListFilePaths(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = l.VersionDao.DeleteByLearningMaterialId(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = d.ForceDelete(ctx, id)
+	if err != nil {
+		return err
+	}
+	// 文件可能被内容相同的其他资料共用，没有引用时才删除
+	if len(filePaths) == 0 {
+		filePaths = []string{lm.FilePath}
+	}
+	for _, filePath := range filePaths {
+		err = l.removeFileIfUnused(ctx, filePath, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (l LearningMaterial) IsNameExist(ctx context.Context, name string, excludeId int) (bool, error) {
 	return l.Dao.IsNameExist(ctx, name, excludeId)
 }
+
+// 将文件写入存储，返回文件的 md5 和在存储中的 key
+func (l LearningMaterial) saveFile(ctx context.Context, fileName string, file io.Reader) (string, string, error) {
+	if l.TempPath != "" {
+		err := os.MkdirAll(l.TempPath, os.ModePerm)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	// 需要先得到 md5 才能确定 key，所以先写入本地临时文件
+	tmp, err := ioutil.TempFile(l.TempPath, "upload-*")
+	if err != nil {
+		return "", "", err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	h := md5.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), file)
+	if err != nil {
+		return "", "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	// 已经有内容相同的文件，直接复用，历史版本中的文件也可以复用
+	exist, err := l.VersionDao.GetByMd5(ctx, sum)
+	if err == nil {
+		return sum, exist.FilePath, nil
+	}
+	if !errors.Is(err, pg.ErrNoRows) {
+		return "", "", err
+	}
+
+	_, err = tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", "", err
+	}
+	ext := fileExt(fileName)
+	key := path.Join(sum[:2], sum+ext)
+	err = l.Storage.Put(ctx, key, tmp, size, mime.TypeByExtension(ext))
+	if err != nil {
+		return "", "", err
+	}
+	return sum, key, nil
+}
+
+// 在资料上追加一个版本，并把资料的当前版本切换过去
+func (l LearningMaterial) newVersion(ctx context.Context, lm *model.LearningMaterial, updatedById int, note, md5, filePath string) (*model.LearningMaterial, error) {
+	return l.Dao.SetVersion(ctx, lm.Id, updatedById, lm.Version+1, note, md5, filePath)
+}
+
+// 文件没有被任何资料或历史版本引用时才删除，预览图一并删除
+func (l LearningMaterial) removeFileIfUnused(ctx context.Context, filePath string, excludeId int) error {
+	is, err := l.Dao.IsFilePathUsed(ctx, filePath, excludeId)
+	if err != nil {
+		return err
+	}
+	if is {
+		return nil
+	}
+	is, err = l.VersionDao.IsFilePathUsed(ctx, filePath)
+	if err != nil {
+		return err
+	}
+	if is {
+		return nil
+	}
+	err = l.Storage.Delete(ctx, previewKey(filePath))
+	if err != nil {
+		return err
+	}
+	return l.Storage.Delete(ctx, filePath)
+}
+
+var extRegexp = regexp.MustCompile(`^\.[a-z0-9]{1,10}$`)
+
+// 取文件扩展名用于保存，不合法的扩展名直接丢弃
+func fileExt(fileName string) string {
+	ext := strings.ToLower(path.Ext(fileName))
+	if !extRegexp.MatchString(ext) {
+		return ""
+	}
+	return ext
+}
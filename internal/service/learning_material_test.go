@@ -2,12 +2,18 @@ package service
 
 import (
 	"context"
+	"crypto/md5"
+	"fmt"
 	"github.com/go-pg/pg/v10"
 	"github.com/stretchr/testify/assert"
 	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
 	"github.com/xuxusheng/time-frequency-be/internal/model"
 	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"io/ioutil"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -30,7 +36,7 @@ func prepareLearningMaterial(t *testing.T, db *pg.DB) ([]*model.LearningMaterial
 
 func TestLearningMaterialSvc_Create(t *testing.T) {
 	pLms, pSubjects, pUsers := prepareLearningMaterial(t, db)
-	svc := NewLearningMaterial(lmDao)
+	svc := NewLearningMaterial(lmDao, lmVersionDao, lmStorage, "")
 
 	t.Run("资料名称重复", func(t *testing.T) {
 		for _, pLm := range pLms {
@@ -119,7 +125,7 @@ func TestLearningMaterialSvc_Create(t *testing.T) {
 
 func TestLearningMaterialSvc_Get(t *testing.T) {
 	pLms, _, _ := prepareLearningMaterial(t, db)
-	svc := NewLearningMaterial(lmDao)
+	svc := NewLearningMaterial(lmDao, lmVersionDao, lmStorage, "")
 
 	t.Run("正常获取", func(t *testing.T) {
 		for _, pLm := range pLms {
@@ -143,7 +149,7 @@ func TestLearningMaterialSvc_Get(t *testing.T) {
 
 func TestLearningMaterialSvc_Update(t *testing.T) {
 	pLms, _, pUsers := prepareLearningMaterial(t, db)
-	svc := NewLearningMaterial(lmDao)
+	svc := NewLearningMaterial(lmDao, lmVersionDao, lmStorage, "")
 
 	t.Run("班级名称重复", func(t *testing.T) {
 		for i := 0; i < len(pLms)-1; i++ {
@@ -151,7 +157,7 @@ func TestLearningMaterialSvc_Update(t *testing.T) {
 			next := pLms[i+1]
 			updatedById := pUsers[rand.Intn(len(pUsers))].Id
 			lm, err := svc.Update(context.Background(), current.Id, updatedById, next.Name, time.Now().String())
-			assert.EqualError(t, err, "资料名称已存在")
+			assert.Equal(t, cerror.BadRequest.WithMsg("资料名称已存在"), err)
 			assert.Nil(t, lm)
 		}
 	})
@@ -195,7 +201,7 @@ func TestLearningMaterialSvc_Update(t *testing.T) {
 
 func TestLearningMaterialSvc_Delete(t *testing.T) {
 	pLms, _, _ := prepareLearningMaterial(t, db)
-	svc := NewLearningMaterial(lmDao)
+	svc := NewLearningMaterial(lmDao, lmVersionDao, lmStorage, "")
 
 	t.Run("正常删除", func(t *testing.T) {
 		for _, pLm := range pLms {
@@ -221,7 +227,7 @@ func TestLearningMaterialSvc_Delete(t *testing.T) {
 
 func TestLearningMaterialSvc_IsNameExist(t *testing.T) {
 	pLms, _, _ := prepareLearningMaterial(t, db)
-	svc := NewLearningMaterial(lmDao)
+	svc := NewLearningMaterial(lmDao, lmVersionDao, lmStorage, "")
 
 	t.Run("排除当前资料后，查找当前资料的名称", func(t *testing.T) {
 		for _, pLm := range pLms {
@@ -263,3 +269,144 @@ func TestLearningMaterialSvc_IsNameExist(t *testing.T) {
 
 	_ = testdb.Truncate(db)
 }
+
+func TestLearningMaterialSvc_Upload(t *testing.T) {
+	_, pSubjects, pUsers := prepareLearningMaterial(t, db)
+	svc := NewLearningMaterial(lmDao, lmVersionDao, lmStorage, "")
+
+	createdById := pUsers[rand.Intn(len(pUsers))].Id
+	subjectId := pSubjects[rand.Intn(len(pSubjects))].Id
+	content := time.Now().String()
+	sum := fmt.Sprintf("%x", md5.Sum([]byte(content)))
+
+	var lms []*model.LearningMaterial
+
+	t.Run("正常上传", func(t *testing.T) {
+		lm, err := svc.Upload(context.Background(), createdById, subjectId, content+"1", "", "讲义.PDF", strings.NewReader(content))
+		if assert.Nil(t, err) {
+			assert.Equal(t, sum, lm.Md5)
+			assert.Equal(t, sum[:2]+"/"+sum+".pdf", lm.FilePath)
+
+			b, err := ioutil.ReadFile(filepath.Join(savePath, lm.FilePath))
+			if assert.Nil(t, err) {
+				assert.Equal(t, content, string(b))
+			}
+			lms = append(lms, lm)
+		}
+	})
+
+	t.Run("内容相同的文件只保存一份", func(t *testing.T) {
+		lm, err := svc.Upload(context.Background(), createdById, subjectId, content+"2", "", "copy.mp4", strings.NewReader(content))
+		if assert.Nil(t, err) {
+			assert.Equal(t, sum, lm.Md5)
+			assert.Equal(t, lms[0].FilePath, lm.FilePath)
+			lms = append(lms, lm)
+		}
+	})
+
+	t.Run("资料名称重复", func(t *testing.T) {
+		lm, err := svc.Upload(context.Background(), createdById, subjectId, content+"1", "", "a.pdf", strings.NewReader("other"))
+		assert.Equal(t, cerror.BadRequest.WithMsg("资料名称已存在"), err)
+		assert.Nil(t, lm)
+	})
+
+	t.Run("文件仍被引用时不删除", func(t *testing.T) {
+		err := svc.Delete(context.Background(), lms[0].Id)
+		if assert.Nil(t, err) {
+			err = svc.Purge(context.Background(), lms[0].Id)
+		}
+		if assert.Nil(t, err) {
+			_, err = os.Stat(filepath.Join(savePath, lms[1].FilePath))
+			assert.Nil(t, err)
+		}
+	})
+
+	t.Run("回收站中的资料仍然引用文件", func(t *testing.T) {
+		err := svc.Delete(context.Background(), lms[1].Id)
+		if assert.Nil(t, err) {
+			_, err = os.Stat(filepath.Join(savePath, lms[1].FilePath))
+			assert.Nil(t, err)
+		}
+	})
+
+	t.Run("没有引用后删除文件", func(t *testing.T) {
+		err := svc.Purge(context.Background(), lms[1].Id)
+		if assert.Nil(t, err) {
+			_, err = os.Stat(filepath.Join(savePath, lms[1].FilePath))
+			assert.True(t, os.IsNotExist(err))
+		}
+	})
+
+	_ = testdb.Truncate(db)
+}
+
+func TestLearningMaterialSvc_Version(t *testing.T) {
+	_, pSubjects, pUsers := prepareLearningMaterial(t, db)
+	svc := NewLearningMaterial(lmDao, lmVersionDao, lmStorage, "")
+	ctx := context.Background()
+
+	createdById := pUsers[rand.Intn(len(pUsers))].Id
+	updatedById := pUsers[rand.Intn(len(pUsers))].Id
+	subjectId := pSubjects[rand.Intn(len(pSubjects))].Id
+	v1 := time.Now().String() + "v1"
+	v2 := time.Now().String() + "v2"
+
+	lm, err := svc.Upload(ctx, createdById, subjectId, v1, "", "讲义.pdf", strings.NewReader(v1))
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, 1, lm.Version)
+
+	t.Run("上传新版本", func(t *testing.T) {
+		nlm, err := svc.UploadVersion(ctx, lm.Id, updatedById, "修改了第二章", "讲义.pdf", strings.NewReader(v2))
+		if assert.Nil(t, err) {
+			assert.Equal(t, 2, nlm.Version)
+			assert.Equal(t, fmt.Sprintf("%x", md5.Sum([]byte(v2))), nlm.Md5)
+			assert.Equal(t, updatedById, nlm.UpdatedById)
+			assert.Equal(t, lm.Name, nlm.Name)
+		}
+	})
+
+	t.Run("内容没有变化", func(t *testing.T) {
+		_, err := svc.UploadVersion(ctx, lm.Id, updatedById, "", "讲义.pdf", strings.NewReader(v2))
+		assert.Equal(t, cerror.BadRequest.WithMsg("文件内容与当前版本相同"), err)
+	})
+
+	var versions []*model.LearningMaterialVersion
+	t.Run("查询历史版本", func(t *testing.T) {
+		versions, _, err = svc.ListVersionsAndCount(ctx, lm.Id, model.NewPage(1, 10))
+		if assert.Nil(t, err) && assert.Len(t, versions, 2) {
+			assert.Equal(t, 2, versions[0].Version)
+			assert.Equal(t, "修改了第二章", versions[0].Note)
+			assert.Equal(t, updatedById, versions[0].CreatedBy.Id)
+			assert.Equal(t, 1, versions[1].Version)
+		}
+	})
+
+	t.Run("回滚", func(t *testing.T) {
+		nlm, err := svc.Rollback(ctx, lm.Id, updatedById, versions[1].Id)
+		if assert.Nil(t, err) {
+			assert.Equal(t, 3, nlm.Version)
+			assert.Equal(t, versions[1].Md5, nlm.Md5)
+			assert.Equal(t, versions[1].FilePath, nlm.FilePath)
+		}
+		// 回滚到当前版本
+		_, err = svc.Rollback(ctx, lm.Id, updatedById, versions[1].Id)
+		assert.Equal(t, cerror.BadRequest.WithMsg("已经是当前版本"), err)
+	})
+
+	t.Run("彻底删除资料时删除所有版本的文件", func(t *testing.T) {
+		err := svc.Delete(ctx, lm.Id)
+		if assert.Nil(t, err) {
+			err = svc.Purge(ctx, lm.Id)
+		}
+		if assert.Nil(t, err) {
+			for _, v := range versions {
+				_, err = os.Stat(filepath.Join(savePath, v.FilePath))
+				assert.True(t, os.IsNotExist(err))
+			}
+		}
+	})
+
+	_ = testdb.Truncate(db)
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-pg/pg/v10"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"math"
+	"strings"
+	"time"
+)
+
+// 登录失败保护，防止暴力破解密码
+// 账号和 IP 分别记录连续失败的次数，账号每次失败后需要等待的时长逐次翻倍，任意一个达到上限后锁定一段时间
+type ILoginGuard interface {
+	// 登录前检查，处于锁定或等待中时返回 cerror.TooManyRequest，并带上需要等待的时长
+	Check(ctx context.Context, name, ip string) error
+	// 记录一次失败，用户名不存在时也要记录，避免通过是否被锁定判断出用户名是否存在
+	Fail(ctx context.Context, name, ip string) error
+	// 登录成功后账号重新计数，IP 的计数不清零，避免攻击者用自己的账号登录来清零
+	Succeed(ctx context.Context, name string) error
+	// 管理员解锁账号
+	Unlock(ctx context.Context, name string) error
+	// 管理员解锁 IP
+	UnlockIp(ctx context.Context, ip string) error
+	// 删除已经不再生效的失败记录，返回删除的数量
+	RunOnce(ctx context.Context) (int, error)
+	// 按 interval 轮询处理，直到 ctx 结束
+	Run(ctx context.Context, interval time.Duration)
+}
+
+// 登录失败保护的阈值，对应 setting.App 中 Login 开头的配置
+type LoginGuardOptions struct {
+	MaxFailures   int
+	IpMaxFailures int
+	LockDuration  time.Duration
+	Window        time.Duration
+	Delay         time.Duration
+}
+
+func NewLoginGuard(dao dao.ILoginFailure, options LoginGuardOptions) *LoginGuard {
+	return &LoginGuard{Dao: dao, Options: options}
+}
+
+type LoginGuard struct {
+	Dao     dao.ILoginFailure
+	Options LoginGuardOptions
+}
+
+func (l LoginGuard) Check(ctx context.Context, name, ip string) error {
+	now := time.Now()
+	for _, key := range []string{accountKey(name), ipKey(ip)} {
+		f, err := l.Dao.Get(ctx, key)
+		if err != nil {
+			if errors.Is(err, pg.ErrNoRows) {
+				continue
+			}
+			return err
+		}
+		wait := l.retryAfter(f, now)
+		if wait > 0 {
+			msg := fmt.Sprintf("登录失败次数过多，请%s后再试", formatWait(wait))
+			return cerror.TooManyRequest.WithMsg(msg).WithRetryAfter(wait)
+		}
+	}
+	return nil
+}
+
+func (l LoginGuard) Fail(ctx context.Context, name, ip string) error {
+	err := l.fail(ctx, accountKey(name), l.Options.MaxFailures)
+	if err != nil {
+		return err
+	}
+	return l.fail(ctx, ipKey(ip), l.Options.IpMaxFailures)
+}
+
+func (l LoginGuard) Succeed(ctx context.Context, name string) error {
+	return l.Dao.Delete(ctx, accountKey(name))
+}
+
+func (l LoginGuard) Unlock(ctx context.Context, name string) error {
+	return l.Dao.Delete(ctx, accountKey(name))
+}
+
+func (l LoginGuard) UnlockIp(ctx context.Context, ip string) error {
+	return l.Dao.Delete(ctx, ipKey(ip))
+}
+
+func (l LoginGuard) RunOnce(ctx context.Context) (int, error) {
+	// 超过统计窗口后会重新计数，等待的时长也不会超过统计窗口，这些记录已经没有作用
+	return l.Dao.DeleteStale(ctx, time.Now().Add(-l.Options.Window))
+}
+
+// 每次都会删除所有过期的数据，不需要连续执行
+func (l LoginGuard) Run(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, "清理登录失败记录", interval, func(ctx context.Context) (int, error) {
+		_, err := l.RunOnce(ctx)
+		return 0, err
+	})
+}
+
+// 记录失败，达到上限时锁定
+func (l LoginGuard) fail(ctx context.Context, key string, max int) error {
+	f, err := l.Dao.Incr(ctx, key, l.Options.Window)
+	if err != nil {
+		return err
+	}
+	if max <= 0 || f.Count < max || l.Options.LockDuration <= 0 {
+		return nil
+	}
+	return l.Dao.Lock(ctx, key, time.Now().Add(l.Options.LockDuration))
+}
+
+// 还需要等待多久才能再次尝试登录
+func (l LoginGuard) retryAfter(f *model.LoginFailure, now time.Time) time.Duration {
+	if f.LockedUntil.After(now) {
+		return f.LockedUntil.Sub(now)
+	}
+	// 只有账号需要逐次等待，机房共用 IP 时，一个学生输错密码不应该影响其他人
+	if !strings.HasPrefix(f.Key, accountPrefix) || l.Options.Delay <= 0 {
+		return 0
+	}
+	if now.Sub(f.LastFailedAt) > l.Options.Window {
+		return 0
+	}
+	// 第 n 次失败后等待 Delay * 2^(n-1)，最多等待一个统计窗口
+	delay := l.Options.Delay
+	for i := 1; i < f.Count && delay < l.Options.Window; i++ {
+		delay *= 2
+	}
+	if delay > l.Options.Window {
+		delay = l.Options.Window
+	}
+	return f.LastFailedAt.Add(delay).Sub(now)
+}
+
+const (
+	accountPrefix = "account:"
+	ipPrefix      = "ip:"
+)
+
+func accountKey(name string) string {
+	return accountPrefix + name
+}
+
+func ipKey(ip string) string {
+	return ipPrefix + ip
+}
+
+// 转换成用户能看懂的等待时长，不足一秒的按一秒算
+func formatWait(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf(" %d 秒", int(math.Ceil(d.Seconds())))
+	}
+	return fmt.Sprintf(" %d 分钟", int(math.Ceil(d.Minutes())))
+}
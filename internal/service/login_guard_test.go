@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"testing"
+	"time"
+)
+
+func TestLoginGuardSvc(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("失败后逐次等待", func(t *testing.T) {
+		at := assert.New(t)
+		svc := NewLoginGuard(dao.NewLoginFailure(db), LoginGuardOptions{Window: time.Hour, Delay: time.Minute})
+		at.Nil(svc.Check(ctx, "张三", "127.0.0.1"))
+		at.Nil(svc.Fail(ctx, "张三", "127.0.0.1"))
+
+		err := svc.Check(ctx, "张三", "127.0.0.1")
+		if cerr, ok := err.(cerror.IError); at.True(ok) {
+			at.Equal(cerror.TooManyRequest.Code(), cerr.Code())
+			at.InDelta(time.Minute, cerr.RetryAfter(), float64(time.Second))
+		}
+		// IP 不需要等待，其他账号不受影响
+		at.Nil(svc.Check(ctx, "李四", "127.0.0.1"))
+
+		// 第二次失败后等待翻倍
+		at.Nil(svc.Fail(ctx, "张三", "127.0.0.1"))
+		err = svc.Check(ctx, "张三", "127.0.0.1")
+		if cerr, ok := err.(cerror.IError); at.True(ok) {
+			at.InDelta(2*time.Minute, cerr.RetryAfter(), float64(time.Second))
+		}
+
+		at.Nil(svc.Succeed(ctx, "张三"))
+		at.Nil(svc.Check(ctx, "张三", "127.0.0.1"))
+	})
+
+	t.Run("达到上限后锁定", func(t *testing.T) {
+		at := assert.New(t)
+		svc := NewLoginGuard(dao.NewLoginFailure(db), LoginGuardOptions{
+			MaxFailures:   2,
+			IpMaxFailures: 3,
+			LockDuration:  time.Hour,
+			Window:        time.Hour,
+		})
+		at.Nil(svc.Fail(ctx, "王五", "10.0.0.1"))
+		at.Nil(svc.Check(ctx, "王五", "10.0.0.1"))
+		at.Nil(svc.Fail(ctx, "王五", "10.0.0.1"))
+		err := svc.Check(ctx, "王五", "10.0.0.1")
+		if cerr, ok := err.(cerror.IError); at.True(ok) {
+			at.Equal("登录失败次数过多，请 60 分钟后再试", cerr.Msg())
+		}
+		at.Nil(svc.Unlock(ctx, "王五"))
+		at.Nil(svc.Check(ctx, "王五", "10.0.0.1"))
+
+		// 同一 IP 下不同账号的失败累计
+		at.Nil(svc.Fail(ctx, "胡六", "10.0.0.1"))
+		err = svc.Check(ctx, "赵七", "10.0.0.1")
+		_, ok := err.(cerror.IError)
+		at.True(ok)
+		at.Nil(svc.UnlockIp(ctx, "10.0.0.1"))
+		at.Nil(svc.Check(ctx, "赵七", "10.0.0.1"))
+	})
+
+	_ = testdb.Truncate(db)
+}
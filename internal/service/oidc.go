@@ -0,0 +1,338 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/go-pg/pg/v10"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/oidc"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
+	"golang.org/x/oauth2"
+	"time"
+)
+
+// 单点登录的配置，对应 setting.Oidc
+type OidcOptions struct {
+	// ID token 中的声明名称，可以用 . 访问嵌套的字段
+	NameClaim     string
+	NickNameClaim string
+	EmailClaim    string
+	PhoneClaim    string
+	RoleClaim     string
+
+	AdminRoles   []string
+	TeacherRoles []string
+
+	// 找不到对应的用户时自动创建，关闭时只能使用管理员事先创建、邮箱一致的账号
+	AutoCreate bool
+}
+
+// 跳转到认证服务登录后回到本系统的这段时间
+const oidcStateExpire = 10 * time.Minute
+
+// 回调成功后前端用 ticket 换取登录 token 的时间，只需要覆盖一次页面跳转
+const oidcTicketExpire = time.Minute
+
+var (
+	errOidcStateInvalid  = cerror.BadRequest.WithMsg("登录请求无效或已过期，请重新登录")
+	errOidcTicketInvalid = cerror.BadRequest.WithMsg("登录凭证无效或已过期，请重新登录")
+)
+
+// OpenID Connect 单点登录，使用授权码 + PKCE 方式
+// 浏览器跳转到认证服务登录，回调时校验 ID token 并找到对应的用户，再通过一次性的 ticket 交给前端换取登录 token
+type IOidc interface {
+	// 生成认证服务的登录地址，返回的 state 需要保存在浏览器中，回调时与认证服务返回的对比
+	Start(ctx context.Context) (authUrl, state string, err error)
+	// 处理认证服务的回调，找到、关联或者创建对应的用户，返回一次性的 ticket
+	Callback(ctx context.Context, state, code string) (string, error)
+	// 使用 ticket 换取对应的用户，ticket 只能使用一次
+	Redeem(ctx context.Context, ticket string) (*model.User, error)
+	// 删除已经过期的 state 和 ticket，返回删除的数量
+	RunOnce(ctx context.Context) (int, error)
+	// 按 interval 轮询处理，直到 ctx 结束
+	Run(ctx context.Context, interval time.Duration)
+}
+
+func NewOidc(dao dao.IOidcLogin, userDao dao.IUser, userSvc IUser, client *oidc.Client, options OidcOptions) *Oidc {
+	return &Oidc{Dao: dao, UserDao: userDao, UserSvc: userSvc, Client: client, Options: options}
+}
+
+type Oidc struct {
+	Dao     dao.IOidcLogin
+	UserDao dao.IUser
+	UserSvc IUser
+	Client  *oidc.Client
+	Options OidcOptions
+}
+
+func (o Oidc) Start(ctx context.Context) (string, string, error) {
+	state, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+	authUrl, err := o.Client.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		return "", "", err
+	}
+	err = o.Dao.Create(ctx, &model.OidcLogin{
+		Type:         model.OidcLoginTypeState,
+		TokenHash:    hashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oidcStateExpire),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return authUrl, state, nil
+}
+
+func (o Oidc) Callback(ctx context.Context, state, code string) (string, error) {
+	l, err := o.Dao.Consume(ctx, model.OidcLoginTypeState, hashToken(state))
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			return "", errOidcStateInvalid
+		}
+		return "", err
+	}
+	token, err := o.Client.Exchange(ctx, code, l.CodeVerifier)
+	if err != nil {
+		return "", err
+	}
+	claims, err := o.Client.VerifyIdToken(ctx, token.IdToken, l.Nonce)
+	if err != nil {
+		return "", err
+	}
+	user, err := o.sync(ctx, claims)
+	if err != nil {
+		return "", err
+	}
+
+	ticket, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	err = o.Dao.Create(ctx, &model.OidcLogin{
+		Type:      model.OidcLoginTypeTicket,
+		TokenHash: hashToken(ticket),
+		ExpiresAt: time.Now().Add(oidcTicketExpire),
+		UserId:    user.Id,
+	})
+	if err != nil {
+		return "", err
+	}
+	return ticket, nil
+}
+
+func (o Oidc) Redeem(ctx context.Context, ticket string) (*model.User, error) {
+	l, err := o.Dao.Consume(ctx, model.OidcLoginTypeTicket, hashToken(ticket))
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			return nil, errOidcTicketInvalid
+		}
+		return nil, err
+	}
+	user, err := o.UserDao.Get(ctx, l.UserId)
+	if err != nil {
+		// 换取之前用户被删除
+		if errors.Is(err, pg.ErrNoRows) {
+			return nil, errOidcTicketInvalid
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+func (o Oidc) RunOnce(ctx context.Context) (int, error) {
+	return o.Dao.DeleteExpired(ctx, time.Now())
+}
+
+// 每次都会删除所有过期的数据，不需要连续执行
+func (o Oidc) Run(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, "清理过期的单点登录数据", interval, func(ctx context.Context) (int, error) {
+		_, err := o.RunOnce(ctx)
+		return 0, err
+	})
+}
+
+// 按照 sub 找到已经关联的用户，没有时按照已验证的邮箱关联本地用户，都没有时创建新用户
+func (o Oidc) sync(ctx context.Context, claims oidc.Claims) (*model.User, error) {
+	subject := claims.String("sub")
+	user, err := o.UserDao.GetByOidcSubject(ctx, subject)
+	if err == nil {
+		return o.update(ctx, user, claims)
+	}
+	if !errors.Is(err, pg.ErrNoRows) {
+		return nil, err
+	}
+
+	// 认证服务没有验证过的邮箱可能是用户随便填写的，不能用来关联
+	if email := o.email(claims); email != "" && claims.Bool("email_verified") {
+		user, err = o.UserDao.GetByEmail(ctx, email)
+		if err == nil {
+			// 管理员不关联，避免认证服务中邮箱相同的账号接管管理员
+			if user.HasRole(model.RoleAdmin) {
+				return nil, cerror.Forbidden.WithMsg("管理员账号不能通过单点登录关联，请联系管理员处理")
+			}
+			if user.OidcSubject != "" {
+				return nil, cerror.Conflict.WithMsg("邮箱对应的账号已经关联了其他单点登录账号，请联系管理员处理")
+			}
+			// 关联后仍然可以使用原来的方式登录，信息和角色由本系统管理，不再同步
+			err = o.UserSvc.Update(ctx, &model.User{Id: user.Id, OidcSubject: subject}, []string{"oidc_subject"})
+			if err != nil {
+				return nil, err
+			}
+			user.OidcSubject = subject
+			return user, nil
+		}
+		if !errors.Is(err, pg.ErrNoRows) {
+			return nil, err
+		}
+	}
+
+	if !o.Options.AutoCreate {
+		return nil, cerror.Forbidden.WithMsg("没有找到对应的账号，请联系管理员开通")
+	}
+	return o.create(ctx, claims)
+}
+
+// 同步单点登录创建的用户的显示名称、联系方式和内置角色，关联的本地用户不同步
+func (o Oidc) update(ctx context.Context, user *model.User, claims oidc.Claims) (*model.User, error) {
+	if user.AuthSource != model.UserAuthSourceOidc {
+		return user, nil
+	}
+	update := model.User{Id: user.Id}
+	var columns []string
+	if v := o.claim(claims, o.Options.NickNameClaim); v != "" && v != user.NickName {
+		update.NickName = v
+		columns = append(columns, "nick_name")
+	}
+	if v := o.email(claims); v != "" && v != user.Email && !o.emailExists(ctx, v, user.Id) {
+		update.Email = v
+		columns = append(columns, "email")
+	}
+	if v := o.claim(claims, o.Options.PhoneClaim); v != "" && v != user.Phone && !o.phoneExists(ctx, v, user.Id) {
+		update.Phone = v
+		columns = append(columns, "phone")
+	}
+	if len(columns) != 0 {
+		err := o.UserSvc.Update(ctx, &update, columns)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if role, ok := o.role(claims); ok {
+		// 只同步内置角色，本系统中额外分配的角色保留
+		return o.UserSvc.SetRoles(ctx, user.Id, replaceBuiltinRole(user.RoleNames(), role))
+	}
+	if len(columns) == 0 {
+		return user, nil
+	}
+	return o.UserDao.Get(ctx, user.Id)
+}
+
+func (o Oidc) create(ctx context.Context, claims oidc.Claims) (*model.User, error) {
+	name := o.claim(claims, o.Options.NameClaim)
+	if name == "" {
+		name = claims.String("sub")
+	}
+	is, err := o.UserDao.IsNameExist(ctx, name, 0)
+	if err != nil {
+		return nil, err
+	}
+	if is {
+		return nil, cerror.Conflict.WithMsg("已存在同名的账号，请联系管理员处理")
+	}
+
+	// 本地密码用不到，设置为随机值
+	password, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := utils.EncodePwd(password)
+	if err != nil {
+		return nil, err
+	}
+	role, _ := o.role(claims)
+	if role == "" {
+		role = model.RoleStudent
+	}
+	user := model.User{
+		Name:        name,
+		NickName:    o.claim(claims, o.Options.NickNameClaim),
+		Roles:       []*model.Role{{Name: role}},
+		Password:    hash,
+		AuthSource:  model.UserAuthSourceOidc,
+		OidcSubject: claims.String("sub"),
+	}
+	if user.NickName == "" {
+		user.NickName = name
+	}
+	if v := o.email(claims); v != "" && !o.emailExists(ctx, v, 0) {
+		user.Email = v
+	}
+	if v := o.claim(claims, o.Options.PhoneClaim); v != "" && !o.phoneExists(ctx, v, 0) {
+		user.Phone = v
+	}
+	err = o.UserDao.Create(ctx, &user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// 按照角色声明确定内置角色，没有配置任何角色时返回 false，不同步
+func (o Oidc) role(claims oidc.Claims) (role string, ok bool) {
+	if o.Options.RoleClaim == "" || (len(o.Options.AdminRoles) == 0 && len(o.Options.TeacherRoles) == 0) {
+		return "", false
+	}
+	roles := claims.Strings(o.Options.RoleClaim)
+	if containsAny(o.Options.AdminRoles, roles) {
+		return model.RoleAdmin, true
+	}
+	if containsAny(o.Options.TeacherRoles, roles) {
+		return model.RoleTeacher, true
+	}
+	return model.RoleStudent, true
+}
+
+func (o Oidc) claim(claims oidc.Claims, name string) string {
+	if name == "" {
+		return ""
+	}
+	return claims.String(name)
+}
+
+func (o Oidc) email(claims oidc.Claims) string {
+	return o.claim(claims, o.Options.EmailClaim)
+}
+
+// 邮箱已经被其他用户使用时不同步，查询出错时同样不同步
+func (o Oidc) emailExists(ctx context.Context, email string, excludeId int) bool {
+	is, err := o.UserDao.IsEmailExist(ctx, email, excludeId)
+	return err != nil || is
+}
+
+func (o Oidc) phoneExists(ctx context.Context, phone string, excludeId int) bool {
+	is, err := o.UserDao.IsPhoneExist(ctx, phone, excludeId)
+	return err != nil || is
+}
+
+// values 中是否有 wants 中的任意一个
+func containsAny(wants, values []string) bool {
+	for _, w := range wants {
+		for _, v := range values {
+			if w == v {
+				return true
+			}
+		}
+	}
+	return false
+}
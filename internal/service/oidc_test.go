@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/oidc"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/oidc/oidctest"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
+	"testing"
+)
+
+var testOidcOptions = OidcOptions{
+	NameClaim:     "preferred_username",
+	NickNameClaim: "name",
+	EmailClaim:    "email",
+	PhoneClaim:    "phone_number",
+	RoleClaim:     "realm_access.roles",
+	AdminRoles:    []string{"admin"},
+	TeacherRoles:  []string{"teacher"},
+	AutoCreate:    true,
+}
+
+func TestOidcRole(t *testing.T) {
+	at := assert.New(t)
+	svc := NewOidc(nil, userDao, nil, nil, testOidcOptions)
+	roles := func(roles ...string) oidc.Claims {
+		return oidc.Claims{"realm_access": map[string]interface{}{"roles": toInterfaces(roles)}}
+	}
+
+	role, ok := svc.role(roles("offline_access", "admin"))
+	at.True(ok)
+	at.Equal(model.RoleAdmin, role)
+
+	role, ok = svc.role(roles("teacher"))
+	at.True(ok)
+	at.Equal(model.RoleTeacher, role)
+
+	role, ok = svc.role(oidc.Claims{})
+	at.True(ok)
+	at.Equal(model.RoleStudent, role)
+
+	// 没有配置角色时不同步
+	_, ok = NewOidc(nil, userDao, nil, nil, OidcOptions{RoleClaim: "roles"}).role(roles("admin"))
+	at.False(ok)
+}
+
+func TestOidcSvc(t *testing.T) {
+	pUsers, err := testdb.SeedUser(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := oidctest.NewServer("time-frequency", "secret")
+	defer idp.Close()
+	svc := NewOidc(dao.NewOidcLogin(db), userDao, NewUser(userDao, utils.PwdPolicy{}), oidc.New(idp.Config("http://localhost/api/v1/oidc/callback")), testOidcOptions)
+	ctx := context.Background()
+
+	// 模拟浏览器完成一次登录，返回 ticket
+	login := func(claims map[string]interface{}) (string, error) {
+		idp.Claims = claims
+		authUrl, state, err := svc.Start(ctx)
+		if err != nil {
+			return "", err
+		}
+		code, returnedState, err := idp.Authorize(authUrl)
+		if err != nil {
+			return "", err
+		}
+		if returnedState != state {
+			t.Fatal("认证服务返回的 state 不一致")
+		}
+		return svc.Callback(ctx, state, code)
+	}
+
+	t.Run("第一次登录时创建用户", func(t *testing.T) {
+		at := assert.New(t)
+		ticket, err := login(map[string]interface{}{
+			"sub":                "10001",
+			"preferred_username": "sso-teacher",
+			"name":               "单点登录老师",
+			"email":              "sso-teacher@example.com",
+			"email_verified":     true,
+			"realm_access":       map[string]interface{}{"roles": []string{"teacher"}},
+		})
+		if !at.Nil(err) {
+			return
+		}
+		user, err := svc.Redeem(ctx, ticket)
+		if !at.Nil(err) {
+			return
+		}
+		at.Equal("sso-teacher", user.Name)
+		at.Equal("单点登录老师", user.NickName)
+		at.Equal("sso-teacher@example.com", user.Email)
+		at.Equal([]string{model.RoleTeacher}, user.RoleNames())
+		at.Equal(model.UserAuthSourceOidc, user.AuthSource)
+
+		// ticket 只能使用一次
+		_, err = svc.Redeem(ctx, ticket)
+		at.Equal(errOidcTicketInvalid, err)
+	})
+
+	t.Run("再次登录时同步信息和角色", func(t *testing.T) {
+		at := assert.New(t)
+		ticket, err := login(map[string]interface{}{
+			"sub":                "10001",
+			"preferred_username": "renamed",
+			"name":               "改名的老师",
+			"realm_access":       map[string]interface{}{"roles": []string{"admin"}},
+		})
+		if !at.Nil(err) {
+			return
+		}
+		user, err := svc.Redeem(ctx, ticket)
+		if !at.Nil(err) {
+			return
+		}
+		// 用户名不随认证服务变化
+		at.Equal("sso-teacher", user.Name)
+		at.Equal("改名的老师", user.NickName)
+		at.Equal([]string{model.RoleAdmin}, user.RoleNames())
+
+		_, err = NewUser(userDao, utils.PwdPolicy{}).UpdatePassword(ctx, user.Id, "", "new-password")
+		at.Equal(cerror.BadRequest.WithMsg("账号使用单点登录，请在认证服务中修改密码"), err)
+	})
+
+	t.Run("按照已验证的邮箱关联本地用户", func(t *testing.T) {
+		at := assert.New(t)
+		claims := map[string]interface{}{
+			"sub":                "10002",
+			"preferred_username": "zhangsan",
+			"email":              pUsers[0].Email,
+		}
+		// 邮箱没有验证过时不关联，用户名不同会创建新用户
+		ticket, err := login(claims)
+		if !at.Nil(err) {
+			return
+		}
+		user, err := svc.Redeem(ctx, ticket)
+		if !at.Nil(err) {
+			return
+		}
+		at.NotEqual(pUsers[0].Id, user.Id)
+		// 邮箱已经被占用，不同步
+		at.Equal("", user.Email)
+
+		claims["sub"] = "10003"
+		claims["email_verified"] = true
+		ticket, err = login(claims)
+		if !at.Nil(err) {
+			return
+		}
+		user, err = svc.Redeem(ctx, ticket)
+		if !at.Nil(err) {
+			return
+		}
+		at.Equal(pUsers[0].Id, user.Id)
+		at.Equal(model.UserAuthSourceLocal, user.AuthSource)
+	})
+
+	t.Run("不关联管理员", func(t *testing.T) {
+		at := assert.New(t)
+		err := userDao.SetRoles(ctx, pUsers[1].Id, []string{model.RoleAdmin})
+		if !at.Nil(err) {
+			return
+		}
+		_, err = login(map[string]interface{}{"sub": "10004", "email": pUsers[1].Email, "email_verified": "true"})
+		at.Equal(cerror.Forbidden.WithMsg("管理员账号不能通过单点登录关联，请联系管理员处理"), err)
+	})
+
+	t.Run("不自动创建用户", func(t *testing.T) {
+		at := assert.New(t)
+		options := testOidcOptions
+		options.AutoCreate = false
+		svc := NewOidc(dao.NewOidcLogin(db), userDao, NewUser(userDao, utils.PwdPolicy{}), oidc.New(idp.Config("http://localhost/api/v1/oidc/callback")), options)
+		idp.Claims = map[string]interface{}{"sub": "10005"}
+		authUrl, state, err := svc.Start(ctx)
+		if !at.Nil(err) {
+			return
+		}
+		code, _, err := idp.Authorize(authUrl)
+		if !at.Nil(err) {
+			return
+		}
+		_, err = svc.Callback(ctx, state, code)
+		at.Equal(cerror.Forbidden.WithMsg("没有找到对应的账号，请联系管理员开通"), err)
+	})
+
+	t.Run("state 无效", func(t *testing.T) {
+		at := assert.New(t)
+		_, err := svc.Callback(ctx, "unknown", "code")
+		at.Equal(errOidcStateInvalid, err)
+	})
+
+	_ = testdb.Truncate(db)
+}
+
+func toInterfaces(ss []string) []interface{} {
+	var is []interface{}
+	for _, s := range ss {
+		is = append(is, s)
+	}
+	return is
+}
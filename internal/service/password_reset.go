@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-pg/pg/v10"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/mailer"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 找回密码，向用户邮箱发送一次性的重置链接，打开链接后设置新密码
+type IPasswordReset interface {
+	// 向邮箱发送重置链接，邮箱不存在或者不是本地账号时同样返回成功，避免泄露哪些邮箱已经注册
+	Request(ctx context.Context, email string) error
+	// 使用重置链接中的 token 设置新密码，修改后所有设备需要重新登录
+	Reset(ctx context.Context, token, newPassword string) error
+	// 删除已经过期的 token，返回删除的数量
+	RunOnce(ctx context.Context) (int, error)
+	// 按 interval 轮询处理，直到 ctx 结束
+	Run(ctx context.Context, interval time.Duration)
+}
+
+// resetUrl 为前端重置密码页面的地址，expire 为重置链接的有效期
+func NewPasswordReset(dao dao.IPasswordReset, userDao dao.IUser, userSvc IUser, mailer mailer.Mailer, resetUrl string, expire time.Duration) *PasswordReset {
+	return &PasswordReset{Dao: dao, UserDao: userDao, UserSvc: userSvc, Mailer: mailer, ResetUrl: resetUrl, Expire: expire}
+}
+
+type PasswordReset struct {
+	Dao      dao.IPasswordReset
+	UserDao  dao.IUser
+	UserSvc  IUser
+	Mailer   mailer.Mailer
+	ResetUrl string
+	Expire   time.Duration
+}
+
+// 同一个用户两次申请的最小间隔，避免被用来向别人的邮箱发送大量邮件
+const passwordResetInterval = time.Minute
+
+var errPasswordResetInvalid = cerror.BadRequest.WithMsg("重置链接无效或已过期，请重新申请")
+
+func (p PasswordReset) Request(ctx context.Context, email string) error {
+	user, err := p.UserDao.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	// LDAP 和单点登录账号的密码不由本系统管理
+	if user.AuthSource != model.UserAuthSourceLocal {
+		return nil
+	}
+
+	latest, err := p.Dao.GetLatest(ctx, user.Id)
+	if err != nil && !errors.Is(err, pg.ErrNoRows) {
+		return err
+	}
+	if err == nil && latest.UsedAt.IsZero() && time.Since(latest.CreatedAt) < passwordResetInterval {
+		return nil
+	}
+
+	// 只有最新的链接有效
+	err = p.Dao.UseByUser(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	err = p.Dao.Create(ctx, &model.PasswordReset{
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(p.Expire),
+		UserId:    user.Id,
+	})
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("%s，你好：\n\n"+
+		"我们收到了重置你的账号（%s）密码的申请，请在 %d 分钟内打开下面的链接设置新密码：\n\n"+
+		"%s\n\n"+
+		"链接只能使用一次。如果不是你本人操作，请忽略这封邮件，你的密码不会改变。\n",
+		user.NickName, user.Name, int(p.Expire/time.Minute), p.resetLink(token))
+	return p.Mailer.Send(ctx, &mailer.Message{To: user.Email, Subject: "重置密码", Body: body})
+}
+
+func (p PasswordReset) Reset(ctx context.Context, token, newPassword string) error {
+	pr, err := p.Dao.GetByHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			return errPasswordResetInvalid
+		}
+		return err
+	}
+	if !pr.UsedAt.IsZero() || time.Now().After(pr.ExpiresAt) {
+		return errPasswordResetInvalid
+	}
+	user, err := p.UserDao.Get(ctx, pr.UserId)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			return errPasswordResetInvalid
+		}
+		return err
+	}
+
+	// 先标记 token 已使用再修改密码，同一个链接并发使用时只有一个请求能拿到
+	ok, err := p.Dao.Use(ctx, pr.Id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errPasswordResetInvalid
+	}
+	err = p.UserSvc.Update(ctx, &model.User{
+		Id:       user.Id,
+		Name:     user.Name,
+		Password: newPassword,
+		// 密码是用户自己设置的，不需要再修改
+		MustChangePassword: false,
+	}, []string{"password", "must_change_password"})
+	if err != nil {
+		// 新密码不符合要求等情况下恢复链接，用户可以换一个再试
+		if rerr := p.Dao.Release(ctx, pr.Id); rerr != nil {
+			return rerr
+		}
+		return err
+	}
+	return nil
+}
+
+func (p PasswordReset) RunOnce(ctx context.Context) (int, error) {
+	return p.Dao.DeleteExpired(ctx, time.Now())
+}
+
+// 每次都会删除所有过期的数据，不需要连续执行
+func (p PasswordReset) Run(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, "清理过期的重置密码链接", interval, func(ctx context.Context) (int, error) {
+		_, err := p.RunOnce(ctx)
+		return 0, err
+	})
+}
+
+// 重置链接，token 作为查询参数拼接在前端页面地址后面
+func (p PasswordReset) resetLink(token string) string {
+	sep := "?"
+	if strings.Contains(p.ResetUrl, "?") {
+		sep = "&"
+	}
+	return p.ResetUrl + sep + "token=" + url.QueryEscape(token)
+}
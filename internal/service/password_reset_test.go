@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/mailer"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// 记录发送的邮件，不真正发送
+type mailBox struct {
+	msgs []*mailer.Message
+}
+
+func (m *mailBox) Send(ctx context.Context, msg *mailer.Message) error {
+	m.msgs = append(m.msgs, msg)
+	return nil
+}
+
+var resetLinkReg = regexp.MustCompile(`http://\S+`)
+
+// 从最后一封邮件中取出重置链接中的 token
+func (m *mailBox) lastToken(t *testing.T) string {
+	if len(m.msgs) == 0 {
+		t.Fatal("没有发送邮件")
+	}
+	link, err := url.Parse(resetLinkReg.FindString(m.msgs[len(m.msgs)-1].Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return link.Query().Get("token")
+}
+
+func TestPasswordResetSvc(t *testing.T) {
+	pUsers, err := testdb.SeedUser(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	box := &mailBox{}
+	resetDao := dao.NewPasswordReset(db)
+	svc := NewPasswordReset(resetDao, userDao, NewUser(userDao, utils.PwdPolicy{MinLength: 8}), box, "http://localhost/reset-password", 30*time.Minute)
+	ctx := context.Background()
+	user := pUsers[0]
+
+	t.Run("邮箱不存在时不发送", func(t *testing.T) {
+		at := assert.New(t)
+		at.Nil(svc.Request(ctx, "nobody@example.com"))
+		at.Len(box.msgs, 0)
+	})
+
+	t.Run("使用链接重置密码", func(t *testing.T) {
+		at := assert.New(t)
+		if !at.Nil(svc.Request(ctx, user.Email)) || !at.Len(box.msgs, 1) {
+			return
+		}
+		at.Equal(user.Email, box.msgs[0].To)
+		token := box.lastToken(t)
+
+		// 一分钟内重复申请不再发送
+		at.Nil(svc.Request(ctx, user.Email))
+		at.Len(box.msgs, 1)
+
+		// 密码不符合要求时链接仍然可以使用
+		err := svc.Reset(ctx, token, "short")
+		at.NotNil(err)
+		at.NotEqual(errPasswordResetInvalid, err)
+
+		at.Nil(svc.Reset(ctx, token, "new-password"))
+		u, err := userDao.Get(ctx, user.Id)
+		if at.Nil(err) {
+			at.Nil(utils.ComparePwd(u.Password, "new-password"))
+			at.False(u.MustChangePassword)
+			at.Equal(user.TokenVersion+1, u.TokenVersion)
+		}
+
+		// 只能使用一次
+		at.Equal(errPasswordResetInvalid, svc.Reset(ctx, token, "other-password"))
+	})
+
+	t.Run("新的链接发出后旧的失效", func(t *testing.T) {
+		at := assert.New(t)
+		user := pUsers[1]
+		at.Nil(svc.Request(ctx, user.Email))
+		first := box.lastToken(t)
+
+		// 跳过申请间隔
+		_, err := db.Exec("UPDATE password_reset SET created_at = ? WHERE user_id = ?", time.Now().Add(-time.Hour), user.Id)
+		at.Nil(err)
+		at.Nil(svc.Request(ctx, user.Email))
+		second := box.lastToken(t)
+		at.NotEqual(first, second)
+
+		at.Equal(errPasswordResetInvalid, svc.Reset(ctx, first, "new-password"))
+		at.Nil(svc.Reset(ctx, second, "new-password"))
+	})
+
+	t.Run("过期后不能使用并被清理", func(t *testing.T) {
+		at := assert.New(t)
+		user := pUsers[2]
+		at.Nil(svc.Request(ctx, user.Email))
+		token := box.lastToken(t)
+
+		_, err := db.Exec("UPDATE password_reset SET expires_at = ? WHERE user_id = ?", time.Now().Add(-time.Minute), user.Id)
+		at.Nil(err)
+		at.Equal(errPasswordResetInvalid, svc.Reset(ctx, token, "new-password"))
+
+		n, err := svc.RunOnce(ctx)
+		at.Nil(err)
+		at.Equal(1, n)
+	})
+
+	t.Run("同一个链接并发使用时只有一个成功", func(t *testing.T) {
+		at := assert.New(t)
+		user := pUsers[3]
+		at.Nil(svc.Request(ctx, user.Email))
+		token := box.lastToken(t)
+
+		errs := make(chan error, 2)
+		for _, pwd := range []string{"first-password", "second-password"} {
+			go func(pwd string) {
+				errs <- svc.Reset(ctx, token, pwd)
+			}(pwd)
+		}
+		var success, invalid int
+		for i := 0; i < 2; i++ {
+			switch err := <-errs; err {
+			case nil:
+				success++
+			case errPasswordResetInvalid:
+				invalid++
+			}
+		}
+		at.Equal(1, success)
+		at.Equal(1, invalid)
+	})
+
+	at := assert.New(t)
+	at.Equal(errPasswordResetInvalid, svc.Reset(ctx, "not-exist", "new-password"))
+
+	_ = testdb.Truncate(db)
+}
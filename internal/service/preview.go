@@ -0,0 +1,123 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"github.com/pkg/errors"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/storage"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/thumbnail"
+	"log"
+	"os"
+	"time"
+)
+
+// 生成单个预览图的超时时间，防止外部程序卡住
+const previewTimeout = 2 * time.Minute
+
+// 后台为学习资料生成预览图，图片和 PDF 为缩略图，视频为封面
+// 待处理的资料记录在数据库中（preview_status 为 pending），服务重启后会继续处理
+// 缺少外部程序或者生成失败都不影响资料本身，只是前端显示通用图标
+type IPreview interface {
+	// 处理一批等待生成预览图的资料，返回处理的数量
+	RunOnce(ctx context.Context) (int, error)
+	// 按 interval 轮询处理，直到 ctx 结束
+	Run(ctx context.Context, interval time.Duration)
+}
+
+func NewPreview(dao dao.ILearningMaterial, storage storage.Storage, tempPath string, options thumbnail.Options) *Preview {
+	return &Preview{Dao: dao, Storage: storage, TempPath: tempPath, Options: options}
+}
+
+type Preview struct {
+	Dao      dao.ILearningMaterial
+	Storage  storage.Storage
+	TempPath string
+	Options  thumbnail.Options
+}
+
+func (p Preview) RunOnce(ctx context.Context) (int, error) {
+	lms, err := p.Dao.ListPreviewPending(ctx, workerBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	for _, lm := range lms {
+		status, previewPath, err := p.generate(ctx, lm)
+		if err != nil {
+			log.Printf("生成学习资料【%d】的预览图失败：%v", lm.Id, err)
+		}
+		// 生成期间资料切换了版本时结果会被丢弃，新版本仍是 pending，下一轮会重新处理
+		_, err = p.Dao.SetPreviewResult(ctx, lm.Id, lm.Md5, status, previewPath)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(lms), nil
+}
+
+func (p Preview) Run(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, "生成学习资料预览图", interval, p.RunOnce)
+}
+
+// 生成单个资料的预览图并写入存储，返回生成状态和预览图的 key
+func (p Preview) generate(ctx context.Context, lm *model.LearningMaterial) (string, string, error) {
+	ext := fileExt(lm.FilePath)
+	if !p.supported(ext) {
+		return model.PreviewStatusUnsupported, "", nil
+	}
+
+	// 内容相同的文件共用预览图
+	key := previewKey(lm.FilePath)
+	_, err := p.Storage.Stat(ctx, key)
+	if err == nil {
+		return model.PreviewStatusDone, key, nil
+	}
+	if !errors.Is(err, storage.ErrNotExist) {
+		return model.PreviewStatusFailed, "", err
+	}
+
+	f, err := copyToTemp(ctx, p.Storage, p.TempPath, lm.FilePath)
+	if err != nil {
+		return model.PreviewStatusFailed, "", err
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, previewTimeout)
+	defer cancel()
+	b, err := thumbnail.Generate(ctx, p.Options, f.Name(), ext)
+	if err != nil {
+		if errors.Is(err, thumbnail.ErrUnsupported) {
+			return model.PreviewStatusUnsupported, "", nil
+		}
+		return model.PreviewStatusFailed, "", err
+	}
+
+	err = p.Storage.Put(ctx, key, bytes.NewReader(b), int64(len(b)), "image/jpeg")
+	if err != nil {
+		return model.PreviewStatusFailed, "", err
+	}
+	return model.PreviewStatusDone, key, nil
+}
+
+// 是否可以为该类型的文件生成预览图，PDF 和视频需要配置对应的外部程序
+func (p Preview) supported(ext string) bool {
+	switch thumbnail.Kind(ext) {
+	case thumbnail.KindImage:
+		return true
+	case thumbnail.KindPDF:
+		return p.Options.PdftoppmPath != ""
+	case thumbnail.KindVideo:
+		return p.Options.FfmpegPath != ""
+	default:
+		return false
+	}
+}
+
+// 预览图在存储中的 key，由资料文件的 key 决定，文件删除时一并删除
+func previewKey(filePath string) string {
+	return "previews/" + filePath + ".jpg"
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/storage"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/thumbnail"
+	"image"
+	"image/png"
+	"testing"
+	"time"
+)
+
+func pngFile(t *testing.T, w, h int) []byte {
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// 一直处理到没有等待生成预览图的资料
+func runPreview(t *testing.T, svc *Preview) {
+	for {
+		n, err := svc.RunOnce(context.Background())
+		if !assert.Nil(t, err) || n == 0 {
+			return
+		}
+	}
+}
+
+func TestPreviewSvc_RunOnce(t *testing.T) {
+	_, pSubjects, pUsers := prepareLearningMaterial(t, db)
+	lmSvc := NewLearningMaterial(lmDao, lmVersionDao, lmStorage, "")
+	svc := NewPreview(lmDao, lmStorage, "", thumbnail.Options{Width: 32})
+	ctx := context.Background()
+
+	createdById := pUsers[0].Id
+	subjectId := pSubjects[0].Id
+
+	t.Run("图片生成缩略图", func(t *testing.T) {
+		at := assert.New(t)
+		lm, err := lmSvc.Upload(ctx, createdById, subjectId, time.Now().String(), "", "图.png", bytes.NewReader(pngFile(t, 64, 64)))
+		if !at.Nil(err) {
+			return
+		}
+		at.Equal(model.PreviewStatusPending, lm.PreviewStatus)
+
+		runPreview(t, svc)
+		lm, obj, err := lmSvc.OpenPreview(ctx, lm.Id)
+		if !at.Nil(err) || !at.NotNil(obj) {
+			return
+		}
+		_ = obj.Close()
+		at.Equal(model.PreviewStatusDone, lm.PreviewStatus)
+
+		// 彻底删除资料后预览图一并删除
+		previewPath := lm.PreviewPath
+		at.Nil(lmSvc.Delete(ctx, lm.Id))
+		at.Nil(lmSvc.Purge(ctx, lm.Id))
+		_, err = lmStorage.Stat(ctx, previewPath)
+		at.Equal(storage.ErrNotExist, err)
+	})
+
+	t.Run("没有配置外部程序时使用通用图标", func(t *testing.T) {
+		at := assert.New(t)
+		for _, fileName := range []string{"讲义.pdf", "video.mp4", "data.zip"} {
+			lm, err := lmSvc.Upload(ctx, createdById, subjectId, time.Now().String(), "", fileName, bytes.NewReader([]byte(time.Now().String())))
+			if !at.Nil(err) {
+				return
+			}
+			runPreview(t, svc)
+			lm, obj, err := lmSvc.OpenPreview(ctx, lm.Id)
+			at.Nil(err)
+			at.Nil(obj)
+			at.Equal(model.PreviewStatusUnsupported, lm.PreviewStatus)
+		}
+	})
+
+	t.Run("生成失败不影响资料", func(t *testing.T) {
+		at := assert.New(t)
+		lm, err := lmSvc.Upload(ctx, createdById, subjectId, time.Now().String(), "", "broken.png", bytes.NewReader([]byte(time.Now().String())))
+		if !at.Nil(err) {
+			return
+		}
+		runPreview(t, svc)
+		lm, obj, err := lmSvc.OpenPreview(ctx, lm.Id)
+		at.Nil(err)
+		at.Nil(obj)
+		at.Equal(model.PreviewStatusFailed, lm.PreviewStatus)
+	})
+
+	_ = testdb.Truncate(db)
+}
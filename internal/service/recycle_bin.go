@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/go-pg/pg/v10"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"time"
+)
+
+// 回收站，用户、班级、科目和学习资料删除后先进入回收站，可以恢复
+// 超过保留时长后由后台任务彻底删除，管理员也可以手动彻底删除
+type IRecycleBin interface {
+	ListAndCount(ctx context.Context, p *model.Page, typ string) ([]*model.RecycleBinItem, int, error)
+	Restore(ctx context.Context, typ string, id int) error
+	Purge(ctx context.Context, typ string, id int) error
+	// 彻底删除所有超过保留时长的数据，返回删除的数量
+	RunOnce(ctx context.Context) (int, error)
+	// 按 interval 轮询处理，直到 ctx 结束
+	Run(ctx context.Context, interval time.Duration)
+}
+
+// retention 为回收站中数据的保留时长，为 0 时不自动彻底删除
+func NewRecycleBin(dao dao.IRecycleBin, lmDao dao.ILearningMaterial, userSvc IUser, classSvc IClass, subjectSvc ISubject, lmSvc ILearningMaterial, retention time.Duration) *RecycleBin {
+	return &RecycleBin{
+		Dao:        dao,
+		LmDao:      lmDao,
+		UserSvc:    userSvc,
+		ClassSvc:   classSvc,
+		SubjectSvc: subjectSvc,
+		LmSvc:      lmSvc,
+		Retention:  retention,
+	}
+}
+
+type RecycleBin struct {
+	Dao        dao.IRecycleBin
+	LmDao      dao.ILearningMaterial
+	UserSvc    IUser
+	ClassSvc   IClass
+	SubjectSvc ISubject
+	LmSvc      ILearningMaterial
+	Retention  time.Duration
+}
+
+// 资料引用科目和用户，科目和班级引用用户，按这个顺序彻底删除，被引用的数据才能在同一轮中删掉
+var purgeOrder = []string{
+	model.RecycleBinTypeLearningMaterial,
+	model.RecycleBinTypeSubject,
+	model.RecycleBinTypeClass,
+	model.RecycleBinTypeUser,
+}
+
+func (r RecycleBin) ListAndCount(ctx context.Context, p *model.Page, typ string) ([]*model.RecycleBinItem, int, error) {
+	items, count, err := r.Dao.ListAndCount(ctx, p, typ)
+	if err != nil {
+		return nil, 0, err
+	}
+	if r.Retention > 0 {
+		for _, item := range items {
+			item.PurgeAt = item.DeletedAt.Add(r.Retention)
+		}
+	}
+	return items, count, nil
+}
+
+func (r RecycleBin) Restore(ctx context.Context, typ string, id int) error {
+	if typ == model.RecycleBinTypeLearningMaterial {
+		// 所属科目也在回收站中时，恢复出来的资料无法访问
+		lm, err := r.LmDao.GetDeleted(ctx, id)
+		if err != nil {
+			return err
+		}
+		_, err = r.Dao.Get(ctx, model.RecycleBinTypeSubject, lm.SubjectId)
+		if err == nil {
+			return cerror.BadRequest.WithMsg("资料所属的科目在回收站中，请先恢复科目")
+		}
+		if !errors.Is(err, pg.ErrNoRows) {
+			return err
+		}
+	}
+
+	err := r.Dao.Restore(ctx, typ, id)
+	if err != nil {
+		// 删除后又创建了同名的数据，违反唯一索引
+		var pgErr pg.Error
+		if errors.As(err, &pgErr) && pgErr.Field('C') == "23505" {
+			return cerror.BadRequest.WithMsg("已存在名称、手机号或邮箱相同的数据，无法恢复")
+		}
+		return err
+	}
+	return nil
+}
+
+func (r RecycleBin) Purge(ctx context.Context, typ string, id int) error {
+	// 只能彻底删除回收站中的数据
+	_, err := r.Dao.Get(ctx, typ, id)
+	if err != nil {
+		return err
+	}
+	switch typ {
+	case model.RecycleBinTypeUser:
+		return r.UserSvc.Purge(ctx, id)
+	case model.RecycleBinTypeClass:
+		return r.ClassSvc.Purge(ctx, id)
+	case model.RecycleBinTypeSubject:
+		return r.SubjectSvc.Purge(ctx, id)
+	case model.RecycleBinTypeLearningMaterial:
+		return r.LmSvc.Purge(ctx, id)
+	}
+	return pg.ErrNoRows
+}
+
+func (r RecycleBin) RunOnce(ctx context.Context) (int, error) {
+	if r.Retention <= 0 {
+		return 0, nil
+	}
+	before := time.Now().Add(-r.Retention)
+	n := 0
+	for _, typ := range purgeOrder {
+		// 仍被引用而无法删除的数据会留在回收站中，按 ID 翻页跳过它们
+		afterId := 0
+		for {
+			items, err := r.Dao.ListDeletedBefore(ctx, typ, before, afterId, workerBatchSize)
+			if err != nil {
+				return n, err
+			}
+			for _, item := range items {
+				afterId = item.Id
+				err = r.Purge(ctx, item.Type, item.Id)
+				if err != nil {
+					if _, ok := err.(cerror.IError); ok {
+						continue
+					}
+					return n, err
+				}
+				n++
+			}
+			if len(items) < workerBatchSize {
+				break
+			}
+		}
+	}
+	return n, nil
+}
+
+// 每次都会处理完所有到期的数据，不需要像其他后台任务那样连续执行
+func (r RecycleBin) Run(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, "清理回收站", interval, func(ctx context.Context) (int, error) {
+		_, err := r.RunOnce(ctx)
+		return 0, err
+	})
+}
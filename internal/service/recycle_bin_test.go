@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecycleBinSvc(t *testing.T) {
+	_, _, pUsers := prepareLearningMaterial(t, db)
+	userSvc := NewUser(userDao, utils.PwdPolicy{})
+	subjectSvc := NewSubject(subjectDao)
+	lmSvc := NewLearningMaterial(lmDao, lmVersionDao, lmStorage, "")
+	svc := NewRecycleBin(dao.NewRecycleBin(db), lmDao, userSvc, NewClass(classDao, userDao), subjectSvc, lmSvc, 24*time.Hour)
+	ctx := context.Background()
+
+	createdById := pUsers[0].Id
+	subject, err := subjectSvc.Create(ctx, createdById, time.Now().String(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := time.Now().String()
+	lm, err := lmSvc.Upload(ctx, createdById, subject.Id, content, "", "讲义.pdf", strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := model.User{Name: content, NickName: content, Phone: content, Email: content, Password: content, CreatedById: createdById}
+	err = userSvc.Create(ctx, &user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("不在回收站中的数据不能彻底删除", func(t *testing.T) {
+		at := assert.New(t)
+		at.Equal(pg.ErrNoRows, svc.Purge(ctx, model.RecycleBinTypeLearningMaterial, lm.Id))
+		at.Equal(pg.ErrNoRows, svc.Purge(ctx, model.RecycleBinTypeUser, user.Id))
+	})
+
+	t.Run("科目在回收站中时不能恢复资料", func(t *testing.T) {
+		at := assert.New(t)
+		at.Nil(lmSvc.Delete(ctx, lm.Id))
+		at.Nil(subjectSvc.Delete(ctx, subject.Id))
+		err := svc.Restore(ctx, model.RecycleBinTypeLearningMaterial, lm.Id)
+		at.Equal(cerror.BadRequest.WithMsg("资料所属的科目在回收站中，请先恢复科目"), err)
+
+		at.Nil(svc.Restore(ctx, model.RecycleBinTypeSubject, subject.Id))
+		at.Nil(svc.Restore(ctx, model.RecycleBinTypeLearningMaterial, lm.Id))
+		_, err = lmSvc.Get(ctx, lm.Id)
+		at.Nil(err)
+	})
+
+	t.Run("删除期间创建了同名数据时不能恢复", func(t *testing.T) {
+		at := assert.New(t)
+		at.Nil(userSvc.Delete(ctx, user.Id))
+		other := model.User{Name: user.Name, NickName: content, Phone: content + "1", Email: content + "1", Password: content, CreatedById: createdById}
+		if !at.Nil(userSvc.Create(ctx, &other)) {
+			return
+		}
+		err := svc.Restore(ctx, model.RecycleBinTypeUser, user.Id)
+		at.Equal(cerror.BadRequest.WithMsg("已存在名称、手机号或邮箱相同的数据，无法恢复"), err)
+		at.Nil(userSvc.Delete(ctx, other.Id))
+		at.Nil(svc.Purge(ctx, model.RecycleBinTypeUser, other.Id))
+	})
+
+	t.Run("仍被引用的用户不能彻底删除", func(t *testing.T) {
+		at := assert.New(t)
+		at.Nil(userSvc.Delete(ctx, createdById))
+		err := svc.Purge(ctx, model.RecycleBinTypeUser, createdById)
+		at.Equal(cerror.BadRequest.WithMsg("用户仍是其他数据的创建人或更新人，无法彻底删除"), err)
+		at.Nil(svc.Restore(ctx, model.RecycleBinTypeUser, createdById))
+	})
+
+	t.Run("超过保留时长后彻底删除", func(t *testing.T) {
+		at := assert.New(t)
+		at.Nil(lmSvc.Delete(ctx, lm.Id))
+		at.Nil(subjectSvc.Delete(ctx, subject.Id))
+
+		// 还没到期
+		n, err := svc.RunOnce(ctx)
+		at.Nil(err)
+		at.Zero(n)
+
+		items, _, err := svc.ListAndCount(ctx, model.NewPage(1, 10), "")
+		if at.Nil(err) && at.Len(items, 3) {
+			for _, item := range items {
+				at.Equal(item.DeletedAt.Add(24*time.Hour), item.PurgeAt)
+			}
+		}
+
+		// 把删除时间改到保留时长之前
+		expired := time.Now().Add(-25 * time.Hour)
+		for _, table := range []string{`"user"`, "subject", "learning_material"} {
+			_, err = db.Exec("UPDATE "+table+" SET deleted_at = ? WHERE deleted_at IS NOT NULL", expired)
+			at.Nil(err)
+		}
+		n, err = svc.RunOnce(ctx)
+		at.Nil(err)
+		at.Equal(3, n)
+
+		_, count, err := svc.ListAndCount(ctx, model.NewPage(1, 10), "")
+		at.Nil(err)
+		at.Zero(count)
+		_, err = os.Stat(filepath.Join(savePath, lm.FilePath))
+		at.True(os.IsNotExist(err))
+	})
+
+	_ = testdb.Truncate(db)
+}
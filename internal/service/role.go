@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"regexp"
+)
+
+// 角色标识，例如 teaching_assistant
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+// 角色管理和角色分配
+// 为了避免越权，操作人只能创建、修改、分配或者收回自己拥有全部权限的角色，拥有所有权限的管理员不受限制
+type IRole interface {
+	List(ctx context.Context) ([]*model.Role, error)
+	Create(ctx context.Context, operatorId int, role *model.Role) error
+	// 修改显示名称、说明和权限，角色标识不能修改，内置的管理员角色不能修改权限
+	Update(ctx context.Context, operatorId int, role *model.Role) (*model.Role, error)
+	// 删除角色，同时移除所有用户的这个角色，内置角色不能删除
+	Delete(ctx context.Context, operatorId, id int) error
+
+	// 检查角色都存在，并且操作人可以分配
+	CheckAssignable(ctx context.Context, operatorId int, names []string) error
+	// 设置用户的角色，不能修改自己的角色
+	SetUserRoles(ctx context.Context, operatorId, userId int, names []string) (*model.User, error)
+	// 检查操作人拥有用户所有角色的全部权限，修改密码、删除等操作不能用在权限比自己高的用户上
+	CheckManageable(ctx context.Context, operatorId, userId int) error
+}
+
+func NewRole(dao dao.IRole, userSvc IUser) *Role {
+	return &Role{Dao: dao, UserSvc: userSvc}
+}
+
+type Role struct {
+	Dao     dao.IRole
+	UserSvc IUser
+}
+
+func (r Role) List(ctx context.Context) ([]*model.Role, error) {
+	return r.Dao.List(ctx)
+}
+
+func (r Role) Create(ctx context.Context, operatorId int, role *model.Role) error {
+	if !roleNamePattern.MatchString(role.Name) {
+		return cerror.BadRequest.WithMsg("角色标识只能包含小写字母、数字和下划线，以字母开头，不超过 50 个字符")
+	}
+	permissions, err := r.checkPermissions(ctx, operatorId, role.Permissions)
+	if err != nil {
+		return err
+	}
+	is, err := r.Dao.IsNameExist(ctx, role.Name)
+	if err != nil {
+		return err
+	}
+	if is {
+		return cerror.BadRequest.WithMsg("角色标识已存在")
+	}
+	role.Permissions = permissions
+	role.Builtin = false
+	return r.Dao.Create(ctx, role)
+}
+
+func (r Role) Update(ctx context.Context, operatorId int, role *model.Role) (*model.Role, error) {
+	old, err := r.Dao.Get(ctx, role.Id)
+	if err != nil {
+		return nil, err
+	}
+	if old.Name == model.RoleAdmin && !sameStrings(old.Permissions, role.Permissions) {
+		return nil, cerror.BadRequest.WithMsg("管理员角色的权限不能修改")
+	}
+	// 修改前后的权限都需要是操作人拥有的，不能借修改降低或提升比自己权限更高的角色
+	if old.Name != model.RoleAdmin {
+		err = r.checkRoles(ctx, operatorId, []*model.Role{old})
+		if err != nil {
+			return nil, err
+		}
+		role.Permissions, err = r.checkPermissions(ctx, operatorId, role.Permissions)
+		if err != nil {
+			return nil, err
+		}
+	}
+	update := model.Role{
+		Id:          role.Id,
+		NickName:    role.NickName,
+		Description: role.Description,
+		Permissions: role.Permissions,
+	}
+	err = r.Dao.Update(ctx, &update, []string{"nick_name", "description", "permissions"})
+	if err != nil {
+		return nil, err
+	}
+	return &update, nil
+}
+
+func (r Role) Delete(ctx context.Context, operatorId, id int) error {
+	role, err := r.Dao.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if role.Builtin {
+		return cerror.BadRequest.WithMsg("内置角色不能删除")
+	}
+	err = r.checkRoles(ctx, operatorId, []*model.Role{role})
+	if err != nil {
+		return err
+	}
+	return r.Dao.Delete(ctx, id)
+}
+
+func (r Role) CheckAssignable(ctx context.Context, operatorId int, names []string) error {
+	roles, err := r.Dao.ListByNames(ctx, names)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if !containsRole(roles, name) {
+			return cerror.BadRequest.WithMsg("角色 " + name + " 不存在")
+		}
+	}
+	return r.checkRoles(ctx, operatorId, roles)
+}
+
+func (r Role) SetUserRoles(ctx context.Context, operatorId, userId int, names []string) (*model.User, error) {
+	// 避免管理员误操作收回自己的权限后无法恢复
+	if operatorId == userId {
+		return nil, cerror.BadRequest.WithMsg("不能修改自己的角色")
+	}
+	user, err := r.UserSvc.Get(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	err = r.CheckAssignable(ctx, operatorId, names)
+	if err != nil {
+		return nil, err
+	}
+	// 收回的角色同样需要是操作人可以分配的
+	var removed []*model.Role
+	for _, role := range user.Roles {
+		if !containsString(names, role.Name) {
+			removed = append(removed, role)
+		}
+	}
+	err = r.checkRoles(ctx, operatorId, removed)
+	if err != nil {
+		return nil, err
+	}
+	return r.UserSvc.SetRoles(ctx, userId, names)
+}
+
+func (r Role) CheckManageable(ctx context.Context, operatorId, userId int) error {
+	user, err := r.UserSvc.Get(ctx, userId)
+	if err != nil {
+		return err
+	}
+	return r.checkRoles(ctx, operatorId, user.Roles)
+}
+
+// 检查操作人是否拥有这些角色的全部权限
+func (r Role) checkRoles(ctx context.Context, operatorId int, roles []*model.Role) error {
+	if len(roles) == 0 {
+		return nil
+	}
+	owned, err := r.Dao.ListPermissionsByUser(ctx, operatorId)
+	if err != nil {
+		return err
+	}
+	for _, role := range roles {
+		for _, p := range role.Permissions {
+			if !containsString(owned, model.PermissionAll) && !containsString(owned, p) {
+				return cerror.Forbidden.WithMsg("没有角色 " + role.Name + " 的全部权限，无法操作")
+			}
+		}
+	}
+	return nil
+}
+
+// 检查权限都是有效的，并且操作人都拥有，返回去重后的权限
+func (r Role) checkPermissions(ctx context.Context, operatorId int, permissions []string) ([]string, error) {
+	owned, err := r.Dao.ListPermissionsByUser(ctx, operatorId)
+	if err != nil {
+		return nil, err
+	}
+	checked := []string{}
+	for _, p := range permissions {
+		if containsString(checked, p) {
+			continue
+		}
+		if p == model.PermissionAll {
+			return nil, cerror.BadRequest.WithMsg("所有权限只能属于内置的管理员角色")
+		}
+		if !model.IsPermission(p) {
+			return nil, cerror.BadRequest.WithMsg("权限 " + p + " 不存在")
+		}
+		if !containsString(owned, model.PermissionAll) && !containsString(owned, p) {
+			return nil, cerror.Forbidden.WithMsg("没有权限 " + p + "，不能授予或收回")
+		}
+		checked = append(checked, p)
+	}
+	return checked, nil
+}
+
+func containsRole(roles []*model.Role, name string) bool {
+	for _, role := range roles {
+		if role.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	return containsAny([]string{value}, values)
+}
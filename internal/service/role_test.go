@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
+	"testing"
+)
+
+func TestRoleSvc(t *testing.T) {
+	pUsers, err := testdb.SeedUser(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := NewRole(dao.NewRole(db), NewUser(userDao, utils.PwdPolicy{}))
+	ctx := context.Background()
+
+	// pUsers[0] 管理员，pUsers[1] 课程负责人，可以管理角色但没有用户管理权限
+	admin, coordinator, student := pUsers[0], pUsers[1], pUsers[2]
+	if err := userDao.SetRoles(ctx, admin.Id, []string{model.RoleAdmin}); err != nil {
+		t.Fatal(err)
+	}
+	coordinatorRole := model.Role{
+		Name:     "course_coordinator",
+		NickName: "课程负责人",
+		Permissions: []string{
+			model.PermissionSubjectManage,
+			model.PermissionMaterialUpload,
+			model.PermissionMaterialManage,
+			model.PermissionMaterialReadAll,
+			model.PermissionRoleManage,
+			model.PermissionRoleAssign,
+		},
+	}
+	if err := svc.Create(ctx, admin.Id, &coordinatorRole); err != nil {
+		t.Fatal(err)
+	}
+	if err := userDao.SetRoles(ctx, coordinator.Id, []string{coordinatorRole.Name}); err != nil {
+		t.Fatal(err)
+	}
+
+	assistant := model.Role{
+		Name:        "teaching_assistant",
+		NickName:    "助教",
+		Permissions: []string{model.PermissionMaterialUpload, model.PermissionMaterialUpload},
+	}
+
+	t.Run("创建角色", func(t *testing.T) {
+		at := assert.New(t)
+		at.Equal(cerror.BadRequest.WithMsg("角色标识只能包含小写字母、数字和下划线，以字母开头，不超过 50 个字符"),
+			svc.Create(ctx, admin.Id, &model.Role{Name: "Teaching Assistant", NickName: "助教"}))
+		at.Equal(cerror.BadRequest.WithMsg("权限 material.unknown 不存在"),
+			svc.Create(ctx, admin.Id, &model.Role{Name: "unknown", NickName: "未知", Permissions: []string{"material.unknown"}}))
+		at.Equal(cerror.BadRequest.WithMsg("所有权限只能属于内置的管理员角色"),
+			svc.Create(ctx, admin.Id, &model.Role{Name: "root", NickName: "超级管理员", Permissions: []string{model.PermissionAll}}))
+		// 不能授予自己没有的权限
+		at.Equal(cerror.Forbidden.WithMsg("没有权限 user.delete，不能授予或收回"),
+			svc.Create(ctx, coordinator.Id, &model.Role{Name: "deleter", NickName: "删除用户", Permissions: []string{model.PermissionUserDelete}}))
+
+		if at.Nil(svc.Create(ctx, coordinator.Id, &assistant)) {
+			at.NotZero(assistant.Id)
+			// 重复的权限只保留一个
+			at.Equal([]string{model.PermissionMaterialUpload}, assistant.Permissions)
+		}
+		at.Equal(cerror.BadRequest.WithMsg("角色标识已存在"), svc.Create(ctx, admin.Id, &model.Role{Name: assistant.Name, NickName: "助教"}))
+	})
+
+	t.Run("修改角色", func(t *testing.T) {
+		at := assert.New(t)
+		adminRole, err := dao.NewRole(db).GetByName(ctx, model.RoleAdmin)
+		if !at.Nil(err) {
+			return
+		}
+		_, err = svc.Update(ctx, admin.Id, &model.Role{Id: adminRole.Id, NickName: "管理员", Permissions: []string{model.PermissionUserRead}})
+		at.Equal(cerror.BadRequest.WithMsg("管理员角色的权限不能修改"), err)
+
+		role, err := svc.Update(ctx, coordinator.Id, &model.Role{Id: assistant.Id, NickName: "助教", Permissions: []string{model.PermissionMaterialUpload, model.PermissionSubjectManage}})
+		if at.Nil(err) {
+			at.Equal(assistant.Name, role.Name)
+			at.Equal([]string{model.PermissionMaterialUpload, model.PermissionSubjectManage}, role.Permissions)
+		}
+		// 内置的老师角色有课程负责人没有的权限
+		teacherRole, err := dao.NewRole(db).GetByName(ctx, model.RoleTeacher)
+		if at.Nil(err) {
+			_, err = svc.Update(ctx, coordinator.Id, &model.Role{Id: teacherRole.Id, NickName: "老师", Permissions: []string{}})
+			at.Equal(cerror.Forbidden.WithMsg("没有角色 teacher 的全部权限，无法操作"), err)
+		}
+	})
+
+	t.Run("分配角色", func(t *testing.T) {
+		at := assert.New(t)
+		_, err := svc.SetUserRoles(ctx, coordinator.Id, coordinator.Id, []string{})
+		at.Equal(cerror.BadRequest.WithMsg("不能修改自己的角色"), err)
+		_, err = svc.SetUserRoles(ctx, coordinator.Id, student.Id, []string{"unknown"})
+		at.Equal(cerror.BadRequest.WithMsg("角色 unknown 不存在"), err)
+		_, err = svc.SetUserRoles(ctx, coordinator.Id, student.Id, []string{model.RoleAdmin})
+		at.Equal(cerror.Forbidden.WithMsg("没有角色 admin 的全部权限，无法操作"), err)
+
+		user, err := svc.SetUserRoles(ctx, coordinator.Id, student.Id, []string{model.RoleStudent, assistant.Name})
+		if at.Nil(err) {
+			at.ElementsMatch([]string{model.RoleStudent, assistant.Name}, user.RoleNames())
+			at.True(user.Can(model.PermissionSubjectManage))
+			// 角色变化后之前的 token 失效
+			at.Equal(student.TokenVersion+1, user.TokenVersion)
+		}
+
+		// 不能管理权限比自己高的用户
+		at.Equal(cerror.Forbidden.WithMsg("没有角色 admin 的全部权限，无法操作"), svc.CheckManageable(ctx, coordinator.Id, admin.Id))
+		at.Nil(svc.CheckManageable(ctx, coordinator.Id, student.Id))
+		at.Nil(svc.CheckManageable(ctx, admin.Id, coordinator.Id))
+	})
+
+	t.Run("删除角色", func(t *testing.T) {
+		at := assert.New(t)
+		teacherRole, err := dao.NewRole(db).GetByName(ctx, model.RoleTeacher)
+		if at.Nil(err) {
+			at.Equal(cerror.BadRequest.WithMsg("内置角色不能删除"), svc.Delete(ctx, admin.Id, teacherRole.Id))
+		}
+		if at.Nil(svc.Delete(ctx, coordinator.Id, assistant.Id)) {
+			user, err := userDao.Get(ctx, student.Id)
+			if at.Nil(err) {
+				at.Equal([]string{model.RoleStudent}, user.RoleNames())
+			}
+		}
+	})
+
+	_ = testdb.Truncate(db)
+}
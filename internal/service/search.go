@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+)
+
+type ISearch interface {
+	// 全文检索学习资料、科目和用户，学习资料只返回用户有权访问的，学生搜索不到用户
+	Search(ctx context.Context, uid int, p *model.Page, query string, types []string) ([]*model.SearchResult, int, error)
+}
+
+func NewSearch(dao dao.ISearch, userDao dao.IUser, accessSvc IAccess) *Search {
+	return &Search{Dao: dao, UserDao: userDao, AccessSvc: accessSvc}
+}
+
+type Search struct {
+	Dao       dao.ISearch
+	UserDao   dao.IUser
+	AccessSvc IAccess
+}
+
+func (s Search) Search(ctx context.Context, uid int, p *model.Page, query string, types []string) ([]*model.SearchResult, int, error) {
+	user, err := s.UserDao.Get(ctx, uid)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(types) == 0 {
+		types = []string{model.SearchTypeLearningMaterial, model.SearchTypeSubject, model.SearchTypeUser}
+	}
+	// 没有 user.search 权限时不允许搜索其他用户，例如学生
+	if !user.Can(model.PermissionUserSearch) {
+		filtered := make([]string, 0, len(types))
+		for _, t := range types {
+			if t != model.SearchTypeUser {
+				filtered = append(filtered, t)
+			}
+		}
+		if len(filtered) == 0 {
+			return []*model.SearchResult{}, 0, nil
+		}
+		types = filtered
+	}
+
+	subjectIds, err := s.AccessSvc.SubjectIds(ctx, uid)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return s.Dao.SearchAndCount(ctx, p, &model.SearchFilter{
+		Query:      query,
+		Types:      types,
+		SubjectIds: subjectIds,
+	})
+}
@@ -3,7 +3,9 @@ package service
 import (
 	"github.com/go-pg/pg/v10"
 	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/storage"
 	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"io/ioutil"
 	"log"
 	"os"
 	"testing"
@@ -14,12 +16,19 @@ var userDao *dao.User
 var subjectDao *dao.Subject
 var classDao *dao.Class
 var lmDao *dao.LearningMaterial
+var lmVersionDao *dao.LearningMaterialVersion
+
+// 学习资料文件的保存目录
+var savePath string
+var lmStorage storage.Storage
 
 func TestMain(m *testing.M) {
 	setup()
 
 	code := m.Run()
 
+	_ = os.RemoveAll(savePath)
+
 	err := testdb.Drop(db)
 	if err != nil {
 		log.Fatalf("测试完成后删除数据表失败：%v", err)
@@ -38,4 +47,14 @@ func setup() {
 	subjectDao = dao.NewSubject(db)
 	classDao = dao.NewClass(db)
 	lmDao = dao.NewLearningMaterial(db)
+	lmVersionDao = dao.NewLearningMaterialVersion(db)
+
+	savePath, err = ioutil.TempDir("", "learning-material")
+	if err != nil {
+		log.Fatalf("创建文件保存目录失败：%v", err)
+	}
+	lmStorage, err = storage.NewLocal(savePath)
+	if err != nil {
+		log.Fatalf("初始化文件存储失败：%v", err)
+	}
 }
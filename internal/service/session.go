@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+)
+
+// 登录会话的查询和下线，会话的创建和续期见 Token
+type ISession interface {
+	// 用户所有有效的会话，currentId 为当前请求所属的会话
+	List(ctx context.Context, userId, currentId int) ([]*model.Session, error)
+	// 下线用户自己的某个会话
+	Revoke(ctx context.Context, userId, id int) error
+	// 强制下线用户所有的会话，返回下线的数量
+	RevokeAll(ctx context.Context, userId int) (int, error)
+}
+
+func NewSession(dao dao.ISession) *Session {
+	return &Session{Dao: dao}
+}
+
+type Session struct {
+	Dao dao.ISession
+}
+
+func (s Session) List(ctx context.Context, userId, currentId int) ([]*model.Session, error) {
+	sessions, err := s.Dao.ListActive(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		session.Current = session.Id == currentId
+	}
+	return sessions, nil
+}
+
+func (s Session) Revoke(ctx context.Context, userId, id int) error {
+	session, err := s.Dao.GetActive(ctx, id)
+	if err != nil {
+		return err
+	}
+	// 不能下线其他人的会话，和不存在一样处理
+	if session.UserId != userId {
+		return pg.ErrNoRows
+	}
+	return s.Dao.Revoke(ctx, id)
+}
+
+func (s Session) RevokeAll(ctx context.Context, userId int) (int, error) {
+	return s.Dao.RevokeByUser(ctx, userId)
+}
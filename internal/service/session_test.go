@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"testing"
+	"time"
+)
+
+func TestSessionSvc(t *testing.T) {
+	pUsers, err := testdb.SeedUser(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenSvc := NewToken(dao.NewRefreshToken(db), dao.NewSession(db), userDao, "secret", time.Minute, time.Hour)
+	svc := NewSession(dao.NewSession(db))
+	ctx := context.Background()
+	user, other := pUsers[0], pUsers[1]
+
+	ua := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	pair, err := tokenSvc.Issue(ctx, user, "", "10.0.0.1", ua)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tokenSvc.Issue(ctx, user, "机房 01", "10.0.0.2", ua)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("查询会话", func(t *testing.T) {
+		at := assert.New(t)
+		sessions, err := svc.List(ctx, user.Id, 0)
+		if !at.Nil(err) || !at.Len(sessions, 2) {
+			return
+		}
+		devices := []string{sessions[0].Device, sessions[1].Device}
+		at.ElementsMatch([]string{"Windows · Chrome", "机房 01"}, devices)
+
+		sessions, err = svc.List(ctx, user.Id, sessions[1].Id)
+		if at.Nil(err) {
+			at.False(sessions[0].Current)
+			at.True(sessions[1].Current)
+		}
+	})
+
+	t.Run("不能下线其他人的会话", func(t *testing.T) {
+		at := assert.New(t)
+		sessions, err := svc.List(ctx, user.Id, 0)
+		if !at.Nil(err) || !at.NotEmpty(sessions) {
+			return
+		}
+		at.Equal(pg.ErrNoRows, svc.Revoke(ctx, other.Id, sessions[0].Id))
+	})
+
+	t.Run("下线", func(t *testing.T) {
+		at := assert.New(t)
+		sessions, err := svc.List(ctx, user.Id, 0)
+		if !at.Nil(err) || !at.NotEmpty(sessions) {
+			return
+		}
+		at.Nil(svc.Revoke(ctx, user.Id, sessions[0].Id))
+		// 重复下线
+		at.Equal(pg.ErrNoRows, svc.Revoke(ctx, user.Id, sessions[0].Id))
+
+		n, err := svc.RevokeAll(ctx, user.Id)
+		at.Nil(err)
+		at.Equal(1, n)
+		sessions, err = svc.List(ctx, user.Id, 0)
+		at.Nil(err)
+		at.Empty(sessions)
+
+		_, err = tokenSvc.Refresh(ctx, pair.RefreshToken)
+		at.Equal(cerror.TokenInvalid, err)
+	})
+
+	_ = testdb.Truncate(db)
+}
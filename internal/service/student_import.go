@@ -0,0 +1,296 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-pg/pg/v10"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
+	"strings"
+)
+
+// 一次最多导入的学生数量，每个学生都要计算一次密码 hash，太多时请求会很慢
+const StudentImportMaxRows = 500
+
+// 表头中各列可以使用的名称，不区分大小写，忽略空格
+var studentImportColumns = []struct {
+	key      string
+	title    string
+	names    []string
+	required bool
+}{
+	{key: "name", title: "用户名", names: []string{"用户名", "账号", "name", "username"}, required: true},
+	{key: "nick_name", title: "姓名", names: []string{"姓名", "昵称", "nick_name", "nickname"}, required: true},
+	{key: "phone", title: "手机号", names: []string{"手机号", "手机", "phone"}, required: true},
+	{key: "email", title: "邮箱", names: []string{"邮箱", "email"}, required: true},
+	{key: "class", title: "班级", names: []string{"班级", "class"}},
+}
+
+// 导入表格中的一行学生数据
+type StudentImportRow struct {
+	Row      int    `json:"row"` // 在表格中的行号，从 1 开始，表头也算一行
+	Name     string `json:"name"`
+	NickName string `json:"nick_name"`
+	Phone    string `json:"phone"`
+	Email    string `json:"email"`
+	Class    string `json:"class"`
+	// 导入成功后生成的初始密码，只在导入的结果中返回一次，不保存
+	Password string   `json:"password,omitempty"`
+	Errors   []string `json:"errors"`
+
+	classId int
+}
+
+// 校验的结果
+type StudentImportReport struct {
+	Total   int                 `json:"total"`   // 数据的行数，不包含表头和空行
+	Invalid int                 `json:"invalid"` // 有错误的行数
+	Rows    []*StudentImportRow `json:"rows"`
+}
+
+// 从表格批量导入学生，与老师逐个创建学生的限制相同：只能导入到自己任教的班级中
+// 第一个不为空的行是表头，列的顺序不限，需要有用户名、姓名、手机号、邮箱，班级可选
+type IStudentImport interface {
+	// 逐行校验，不写入数据库，用于导入前预览
+	Check(ctx context.Context, teacherId int, rows [][]string) (*StudentImportReport, error)
+	// 校验通过后在一个事务中创建所有学生，并为每个学生生成初始密码，有任意一行不通过时都不创建
+	Import(ctx context.Context, teacherId int, rows [][]string) (*StudentImportReport, error)
+}
+
+func NewStudentImport(db *pg.DB, userDao dao.IUser, classDao dao.IClass, pwdPolicy utils.PwdPolicy) *StudentImport {
+	return &StudentImport{DB: db, UserDao: userDao, ClassDao: classDao, PwdPolicy: pwdPolicy}
+}
+
+type StudentImport struct {
+	DB        *pg.DB
+	UserDao   dao.IUser
+	ClassDao  dao.IClass
+	PwdPolicy utils.PwdPolicy
+}
+
+func (s StudentImport) Check(ctx context.Context, teacherId int, rows [][]string) (*StudentImportReport, error) {
+	report, err := s.parse(rows)
+	if err != nil {
+		return nil, err
+	}
+	err = s.check(ctx, teacherId, report)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (s StudentImport) Import(ctx context.Context, teacherId int, rows [][]string) (*StudentImportReport, error) {
+	report, err := s.Check(ctx, teacherId, rows)
+	if err != nil {
+		return nil, err
+	}
+	if report.Invalid > 0 {
+		var details []string
+		for _, r := range report.Rows {
+			if len(r.Errors) > 0 {
+				details = append(details, fmt.Sprintf("第 %d 行：%s", r.Row, strings.Join(r.Errors, "，")))
+			}
+		}
+		return nil, cerror.BadRequest.WithMsg(fmt.Sprintf("有 %d 行数据有误，请修正后重新导入", report.Invalid)).WithDetails(details...)
+	}
+
+	for _, r := range report.Rows {
+		r.Password, err = utils.GeneratePwd(s.PwdPolicy)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// 校验之后其他人可能创建了同名的用户，事务中创建时会再检查一次，失败时全部回滚
+	err = s.DB.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		userSvc := NewUser(dao.NewUser(tx), s.PwdPolicy)
+		for _, r := range report.Rows {
+			err := userSvc.Create(ctx, &model.User{
+				CreatedById: teacherId,
+				Name:        r.Name,
+				NickName:    r.NickName,
+				Phone:       r.Phone,
+				Email:       r.Email,
+				Password:    r.Password,
+				ClassId:     r.classId,
+				Roles:       []*model.Role{{Name: model.RoleStudent}},
+				// 密码由系统生成，学生首次登录后需要修改
+				MustChangePassword: true,
+			})
+			if err != nil {
+				if cerr, ok := err.(cerror.IError); ok {
+					return cerr.WithMsg(fmt.Sprintf("第 %d 行：%s", r.Row, cerr.Msg()))
+				}
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// 按表头找到各列的位置，跳过空行
+func (s StudentImport) parse(rows [][]string) (*StudentImportReport, error) {
+	header := -1
+	for i, row := range rows {
+		if !isBlankRow(row) {
+			header = i
+			break
+		}
+	}
+	if header == -1 {
+		return nil, cerror.BadRequest.WithMsg("表格中没有数据")
+	}
+
+	columns := map[string]int{}
+	for i, cell := range rows[header] {
+		name := strings.ToLower(strings.Join(strings.Fields(cell), ""))
+		for _, c := range studentImportColumns {
+			if _, ok := columns[c.key]; !ok && containsString(c.names, name) {
+				columns[c.key] = i
+			}
+		}
+	}
+	var missing []string
+	for _, c := range studentImportColumns {
+		if _, ok := columns[c.key]; !ok && c.required {
+			missing = append(missing, c.title)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, cerror.BadRequest.WithMsg("表头中缺少" + strings.Join(missing, "、") + "列")
+	}
+
+	cell := func(row []string, key string) string {
+		i, ok := columns[key]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+	report := &StudentImportReport{Rows: []*StudentImportRow{}}
+	for i := header + 1; i < len(rows); i++ {
+		row := rows[i]
+		if isBlankRow(row) {
+			continue
+		}
+		report.Rows = append(report.Rows, &StudentImportRow{
+			Row:      i + 1,
+			Name:     cell(row, "name"),
+			NickName: cell(row, "nick_name"),
+			Phone:    cell(row, "phone"),
+			Email:    cell(row, "email"),
+			Class:    cell(row, "class"),
+			Errors:   []string{},
+		})
+	}
+	report.Total = len(report.Rows)
+	if report.Total == 0 {
+		return nil, cerror.BadRequest.WithMsg("表格中没有学生数据")
+	}
+	if report.Total > StudentImportMaxRows {
+		return nil, cerror.BadRequest.WithMsg(fmt.Sprintf("一次最多导入 %d 名学生", StudentImportMaxRows))
+	}
+	return report, nil
+}
+
+// 逐行检查必填项、表格中的重复、与已有用户的重复（与 User.Create 相同）以及班级
+func (s StudentImport) check(ctx context.Context, teacherId int, report *StudentImportReport) error {
+	teacher, err := s.UserDao.Get(ctx, teacherId)
+	if err != nil {
+		return err
+	}
+	manageAll := teacher.Can(model.PermissionStudentAll)
+
+	// 同一个班级只查询一次，值为 0 表示班级不存在
+	classIds := map[string]int{}
+	taught := map[int]bool{}
+	// 表格中每个值第一次出现的行号
+	seen := map[string]map[string]int{"name": {}, "phone": {}, "email": {}}
+
+	for _, r := range report.Rows {
+		unique := []struct {
+			key, title, value string
+			exist             func(ctx context.Context, v string, excludeId int) (bool, error)
+		}{
+			{"name", "用户名", r.Name, s.UserDao.IsNameExist},
+			{"phone", "手机号", r.Phone, s.UserDao.IsPhoneExist},
+			{"email", "邮箱", r.Email, s.UserDao.IsEmailExist},
+		}
+		for _, u := range unique {
+			if u.value == "" {
+				r.Errors = append(r.Errors, u.title+"不能为空")
+				continue
+			}
+			if row, ok := seen[u.key][u.value]; ok {
+				r.Errors = append(r.Errors, fmt.Sprintf("%s与第 %d 行重复", u.title, row))
+				continue
+			}
+			seen[u.key][u.value] = r.Row
+			is, err := u.exist(ctx, u.value, 0)
+			if err != nil {
+				return err
+			}
+			if is {
+				r.Errors = append(r.Errors, u.title+"已存在")
+			}
+		}
+		if r.NickName == "" {
+			r.Errors = append(r.Errors, "姓名不能为空")
+		}
+
+		if r.Class == "" {
+			if !manageAll {
+				r.Errors = append(r.Errors, "请填写学生所在的班级")
+			}
+		} else {
+			id, ok := classIds[r.Class]
+			if !ok {
+				class, err := s.ClassDao.GetByName(ctx, r.Class)
+				if err != nil && !errors.Is(err, pg.ErrNoRows) {
+					return err
+				}
+				if class != nil {
+					id = class.Id
+				}
+				classIds[r.Class] = id
+			}
+			if id == 0 {
+				r.Errors = append(r.Errors, "班级不存在")
+			} else if !manageAll {
+				is, ok := taught[id]
+				if !ok {
+					is, err = s.ClassDao.IsTeacher(ctx, id, teacherId)
+					if err != nil {
+						return err
+					}
+					taught[id] = is
+				}
+				if !is {
+					r.Errors = append(r.Errors, "只能导入到自己任教的班级中")
+				}
+			}
+			r.classId = id
+		}
+
+		if len(r.Errors) > 0 {
+			report.Invalid++
+		}
+	}
+	return nil
+}
+
+func isBlankRow(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
+	"testing"
+)
+
+func TestStudentImportSvc(t *testing.T) {
+	classes, users := prepareClass(t, db)
+	ctx := context.Background()
+
+	// users[0] 管理员，users[1] 一班的班主任
+	admin, teacher := users[0], users[1]
+	assert.Nil(t, userDao.SetRoles(ctx, admin.Id, []string{model.RoleAdmin}))
+	assert.Nil(t, userDao.SetRoles(ctx, teacher.Id, []string{model.RoleTeacher}))
+	assert.Nil(t, classDao.SetTeacher(ctx, classes[0].Id, teacher.Id, model.ClassTeacherHead))
+
+	policy := utils.PwdPolicy{MinLength: 8, MinClasses: 3}
+	svc := NewStudentImport(db, userDao, classDao, policy)
+
+	t.Run("表头缺少列", func(t *testing.T) {
+		_, err := svc.Check(ctx, teacher.Id, [][]string{{}, {"用户名", "姓名", "班级"}, {"a", "b", "c"}})
+		assert.Equal(t, cerror.BadRequest.WithMsg("表头中缺少手机号、邮箱列"), err)
+
+		_, err = svc.Check(ctx, teacher.Id, [][]string{{"用户名", "姓名", "手机号", "邮箱"}, {" "}})
+		assert.Equal(t, cerror.BadRequest.WithMsg("表格中没有学生数据"), err)
+	})
+
+	t.Run("逐行校验", func(t *testing.T) {
+		at := assert.New(t)
+		rows := [][]string{
+			{"班级", " Email ", "用户名", "姓 名", "手机号"},
+			{classes[0].Name, "s1@example.com", "s1", "学生一", "13900000001"},
+			{},
+			{classes[0].Name, "s1@example.com", users[2].Name, "", "13900000002"},
+			{classes[1].Name, "s3@example.com", "s3", "学生三", users[3].Phone},
+			{"不存在的班级", "s4@example.com", "s4", "学生四"},
+		}
+		report, err := svc.Check(ctx, teacher.Id, rows)
+		if !at.Nil(err) {
+			return
+		}
+		at.Equal(4, report.Total)
+		at.Equal(3, report.Invalid)
+		at.Empty(report.Rows[0].Errors)
+		at.Equal(4, report.Rows[1].Row)
+		at.Equal([]string{"用户名已存在", "邮箱与第 2 行重复", "姓名不能为空"}, report.Rows[1].Errors)
+		at.Equal([]string{"手机号已存在", "只能导入到自己任教的班级中"}, report.Rows[2].Errors)
+		at.Equal([]string{"手机号不能为空", "班级不存在"}, report.Rows[3].Errors)
+
+		// 管理员不受班级限制，可以不填班级
+		report, err = svc.Check(ctx, admin.Id, [][]string{
+			{"用户名", "姓名", "手机号", "邮箱", "班级"},
+			{"s5", "学生五", "13900000005", "s5@example.com", classes[1].Name},
+			{"s6", "学生六", "13900000006", "s6@example.com"},
+		})
+		if at.Nil(err) {
+			at.Zero(report.Invalid)
+		}
+
+		// 有错误时不导入
+		_, err = svc.Import(ctx, teacher.Id, rows)
+		if cerr, ok := err.(cerror.IError); at.True(ok) {
+			at.Equal("有 3 行数据有误，请修正后重新导入", cerr.Msg())
+			at.Len(cerr.Details(), 3)
+		}
+		is, err := userDao.IsNameExist(ctx, "s1", 0)
+		at.Nil(err)
+		at.False(is)
+	})
+
+	t.Run("导入成功", func(t *testing.T) {
+		at := assert.New(t)
+		report, err := svc.Import(ctx, teacher.Id, [][]string{
+			{"用户名", "姓名", "手机号", "邮箱", "班级"},
+			{"s1", "学生一", "13900000001", "s1@example.com", classes[0].Name},
+			{"s2", "学生二", "13900000002", "s2@example.com", classes[0].Name},
+		})
+		if !at.Nil(err) {
+			return
+		}
+		for _, r := range report.Rows {
+			at.Nil(utils.CheckPwd(r.Password, r.Name, policy))
+			user, err := userDao.GetByName(ctx, r.Name)
+			if at.Nil(err) {
+				at.Equal(classes[0].Id, user.ClassId)
+				at.Equal(teacher.Id, user.CreatedById)
+				at.True(user.MustChangePassword)
+				at.Equal([]string{model.RoleStudent}, user.RoleNames())
+				at.Nil(utils.ComparePwd(user.Password, r.Password))
+			}
+		}
+	})
+
+	_ = testdb.Truncate(db)
+}
@@ -2,7 +2,6 @@ package service
 
 import (
 	"context"
-	"github.com/pkg/errors"
 	"github.com/xuxusheng/time-frequency-be/internal/dao"
 	"github.com/xuxusheng/time-frequency-be/internal/model"
 	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
@@ -11,8 +10,10 @@ import (
 type ISubject interface {
 	Create(ctx context.Context, createById int, name, description string) (*model.Subject, error)
 	Get(ctx context.Context, id int) (*model.Subject, error)
+	ListAndCount(ctx context.Context, p *model.Page, query string) ([]*model.Subject, int, error)
 	Update(ctx context.Context, id int, name, description string) (*model.Subject, error)
-	Delete(ctx context.Context, id int) error
+	Delete(ctx context.Context, id int) error // 移入回收站
+	Purge(ctx context.Context, id int) error  // 彻底删除回收站中的数据
 	IsNameExist(ctx context.Context, name string, excludeId int) (bool, error)
 }
 
@@ -42,7 +43,39 @@ func (s Subject) Create(ctx context.Context, createById int, name, description s
 }
 
 func (s Subject) Get(ctx context.Context, id int) (*model.Subject, error) {
-	return s.Dao.Get(ctx, id)
+	d := s.Dao
+	subject, err := d.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := d.CountLearningMaterials(ctx, []int{id})
+	if err != nil {
+		return nil, err
+	}
+	subject.LearningMaterialCount = counts[id]
+	return subject, nil
+}
+
+func (s Subject) ListAndCount(ctx context.Context, p *model.Page, query string) ([]*model.Subject, int, error) {
+	d := s.Dao
+	subjects, count, err := d.ListAndCount(ctx, p, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// 补充每个科目下的学习资料数量
+	ids := make([]int, 0, len(subjects))
+	for _, subject := range subjects {
+		ids = append(ids, subject.Id)
+	}
+	counts, err := d.CountLearningMaterials(ctx, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, subject := range subjects {
+		subject.LearningMaterialCount = counts[subject.Id]
+	}
+	return subjects, count, nil
 }
 
 func (s Subject) Update(ctx context.Context, id int, name, description string) (*model.Subject, error) {
@@ -53,7 +86,7 @@ func (s Subject) Update(ctx context.Context, id int, name, description string) (
 		return nil, err
 	}
 	if is {
-		return nil, errors.New("科目名称已存在")
+		return nil, cerror.BadRequest.WithMsg("科目名称已存在")
 	}
 	subject, err := d.Update(ctx, id, name, description)
 	if err != nil {
@@ -63,7 +96,35 @@ func (s Subject) Update(ctx context.Context, id int, name, description string) (
 }
 
 func (s Subject) Delete(ctx context.Context, id int) error {
-	return s.Dao.Delete(ctx, id)
+	d := s.Dao
+	// 科目下还有学习资料时不允许删除，避免学习资料的 subject_id 指向不存在的科目
+	counts, err := d.CountLearningMaterials(ctx, []int{id})
+	if err != nil {
+		return err
+	}
+	if counts[id] > 0 {
+		return cerror.BadRequest.WithMsg("科目下还有学习资料，请先删除或转移学习资料")
+	}
+	// 与班级的关联保留，恢复后原样可用
+	return d.Delete(ctx, id)
+}
+
+// 彻底删除回收站中的科目
+func (s Subject) Purge(ctx context.Context, id int) error {
+	d := s.Dao
+	// 回收站中的资料还可能被恢复，同样不允许
+	is, err := d.HasLearningMaterials(ctx, id)
+	if err != nil {
+		return err
+	}
+	if is {
+		return cerror.BadRequest.WithMsg("科目下还有学习资料（包括回收站中的），无法彻底删除")
+	}
+	err = d.ClearClasses(ctx, id)
+	if err != nil {
+		return err
+	}
+	return d.ForceDelete(ctx, id)
 }
 
 func (s Subject) IsNameExist(ctx context.Context, name string, excludeId int) (bool, error) {
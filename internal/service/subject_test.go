@@ -108,7 +108,7 @@ func TestSubjectSvc_Update(t *testing.T) {
 			current := pSubjects[i]
 			next := pSubjects[i+1]
 			subject, err := svc.Update(context.Background(), current.Id, next.Name, time.Now().String())
-			assert.EqualError(t, err, "科目名称已存在")
+			assert.Equal(t, cerror.BadRequest.WithMsg("科目名称已存在"), err)
 			assert.Nil(t, subject)
 		}
 	})
@@ -218,3 +218,44 @@ func TestSubjectSvc_IsNameExist(t *testing.T) {
 
 	_ = testdb.Truncate(db)
 }
+
+func TestSubjectSvc_ListAndCount(t *testing.T) {
+	pls, pSubjects, _ := prepareLearningMaterial(t, db)
+	svc := NewSubject(subjectDao)
+
+	expected := map[int]int{}
+	for _, pl := range pls {
+		expected[pl.SubjectId]++
+	}
+
+	t.Run("返回学习资料数量", func(t *testing.T) {
+		subjects, count, err := svc.ListAndCount(context.Background(), model.NewPage(1, 100), "")
+		if assert.Nil(t, err) {
+			assert.Equal(t, len(pSubjects), count)
+			for _, subject := range subjects {
+				assert.Equal(t, expected[subject.Id], subject.LearningMaterialCount)
+			}
+		}
+	})
+
+	_ = testdb.Truncate(db)
+}
+
+func TestSubjectSvc_DeleteWithLearningMaterials(t *testing.T) {
+	pls, _, _ := prepareLearningMaterial(t, db)
+	svc := NewSubject(subjectDao)
+
+	t.Run("科目下还有学习资料", func(t *testing.T) {
+		for _, pl := range pls {
+			err := svc.Delete(context.Background(), pl.SubjectId)
+			assert.Equal(t, cerror.BadRequest.WithMsg("科目下还有学习资料，请先删除或转移学习资料"), err)
+
+			exist, err := db.Model((*model.Subject)(nil)).Where("id = ?", pl.SubjectId).Exists()
+			if assert.Nil(t, err) {
+				assert.True(t, exist)
+			}
+		}
+	})
+
+	_ = testdb.Truncate(db)
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+)
+
+var (
+	errNotStudent       = cerror.Forbidden.WithMsg("无权操作非学生账号，请联系管理员")
+	errStudentNotTaught = cerror.Forbidden.WithMsg("只能管理自己任教班级中的学生")
+)
+
+// 老师管理学生，只能管理自己任教班级（班主任或任课老师）中的学生
+// 拥有 student.manage_all 权限的用户（例如管理员）不受班级限制
+type ITeacher interface {
+	// 查询可以管理的学生
+	ListStudentsAndCount(ctx context.Context, teacherId int, p *model.Page, query string) ([]*model.User, int, error)
+	// 创建学生并加入班级，不受班级限制时 classId 可以为 0
+	CreateStudent(ctx context.Context, teacherId, classId int, user *model.User) error
+	// 查询可以管理的学生，用户不是学生或者不在任教的班级中时返回错误
+	GetStudent(ctx context.Context, teacherId, studentId int) (*model.User, error)
+}
+
+func NewTeacher(userDao dao.IUser, classDao dao.IClass, userSvc IUser) *Teacher {
+	return &Teacher{UserDao: userDao, ClassDao: classDao, UserSvc: userSvc}
+}
+
+type Teacher struct {
+	UserDao  dao.IUser
+	ClassDao dao.IClass
+	UserSvc  IUser
+}
+
+func (t Teacher) ListStudentsAndCount(ctx context.Context, teacherId int, p *model.Page, query string) ([]*model.User, int, error) {
+	all, err := t.manageAll(ctx, teacherId)
+	if err != nil {
+		return nil, 0, err
+	}
+	if all {
+		return t.UserDao.ListAndCount(ctx, p, query, model.RoleStudent)
+	}
+	return t.UserDao.ListAndCountByTeacher(ctx, p, query, model.RoleStudent, teacherId)
+}
+
+func (t Teacher) CreateStudent(ctx context.Context, teacherId, classId int, user *model.User) error {
+	all, err := t.manageAll(ctx, teacherId)
+	if err != nil {
+		return err
+	}
+	if classId == 0 && !all {
+		return cerror.BadRequest.WithMsg("请选择学生所在的班级")
+	}
+	if classId != 0 {
+		_, err = t.ClassDao.Get(ctx, classId)
+		if err != nil {
+			return err
+		}
+		if !all {
+			is, err := t.ClassDao.IsTeacher(ctx, classId, teacherId)
+			if err != nil {
+				return err
+			}
+			if !is {
+				return cerror.Forbidden.WithMsg("只能在自己任教的班级中创建学生")
+			}
+		}
+	}
+	user.ClassId = classId
+	user.Roles = []*model.Role{{Name: model.RoleStudent}}
+	return t.UserSvc.Create(ctx, user)
+}
+
+func (t Teacher) GetStudent(ctx context.Context, teacherId, studentId int) (*model.User, error) {
+	user, err := t.UserDao.Get(ctx, studentId)
+	if err != nil {
+		return nil, err
+	}
+	// 同时有其他角色的（例如担任助教）需要联系管理员
+	if !user.HasRole(model.RoleStudent) || len(user.Roles) != 1 {
+		return nil, errNotStudent
+	}
+	all, err := t.manageAll(ctx, teacherId)
+	if err != nil {
+		return nil, err
+	}
+	if all {
+		return user, nil
+	}
+	if user.ClassId == 0 {
+		return nil, errStudentNotTaught
+	}
+	is, err := t.ClassDao.IsTeacher(ctx, user.ClassId, teacherId)
+	if err != nil {
+		return nil, err
+	}
+	if !is {
+		return nil, errStudentNotTaught
+	}
+	return user, nil
+}
+
+// 是否不受班级限制
+func (t Teacher) manageAll(ctx context.Context, teacherId int) (bool, error) {
+	teacher, err := t.UserDao.Get(ctx, teacherId)
+	if err != nil {
+		return false, err
+	}
+	return teacher.Can(model.PermissionStudentAll), nil
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
+	"testing"
+)
+
+func TestTeacherSvc(t *testing.T) {
+	classes, users := prepareClass(t, db)
+	ctx := context.Background()
+
+	// users[0] 管理员，users[1] 一班的任课老师，users[2] 一班学生，users[3] 二班学生
+	admin, teacher, student, other := users[0], users[1], users[2], users[3]
+	assert.Nil(t, userDao.SetRoles(ctx, admin.Id, []string{model.RoleAdmin}))
+	assert.Nil(t, userDao.SetRoles(ctx, teacher.Id, []string{model.RoleTeacher}))
+	assert.Nil(t, classDao.SetTeacher(ctx, classes[0].Id, teacher.Id, model.ClassTeacherAssistant))
+
+	classSvc := NewClass(classDao, userDao)
+	assert.Nil(t, classSvc.AddMembers(ctx, admin.Id, classes[0].Id, []int{student.Id}))
+	assert.Nil(t, classSvc.AddMembers(ctx, admin.Id, classes[1].Id, []int{other.Id}))
+
+	svc := NewTeacher(userDao, classDao, NewUser(userDao, utils.PwdPolicy{}))
+
+	t.Run("老师只能查询任教班级中的学生", func(t *testing.T) {
+		at := assert.New(t)
+		list, count, err := svc.ListStudentsAndCount(ctx, teacher.Id, model.NewPage(1, 10), "")
+		if at.Nil(err) {
+			at.Equal(1, count)
+			at.Len(list, 1)
+			at.Equal(student.Id, list[0].Id)
+		}
+
+		_, err = svc.GetStudent(ctx, teacher.Id, student.Id)
+		at.Nil(err)
+		_, err = svc.GetStudent(ctx, teacher.Id, other.Id)
+		at.Equal(errStudentNotTaught, err)
+		_, err = svc.GetStudent(ctx, teacher.Id, admin.Id)
+		at.Equal(errNotStudent, err)
+	})
+
+	t.Run("管理员不受班级限制", func(t *testing.T) {
+		at := assert.New(t)
+		_, count, err := svc.ListStudentsAndCount(ctx, admin.Id, model.NewPage(1, 10), "")
+		if at.Nil(err) {
+			at.Equal(2, count)
+		}
+		_, err = svc.GetStudent(ctx, admin.Id, other.Id)
+		at.Nil(err)
+	})
+
+	t.Run("老师只能在任教的班级中创建学生", func(t *testing.T) {
+		at := assert.New(t)
+		err := svc.CreateStudent(ctx, teacher.Id, 0, &model.User{Name: "no-class", Password: "123456"})
+		at.Equal(cerror.BadRequest.WithMsg("请选择学生所在的班级"), err)
+
+		err = svc.CreateStudent(ctx, teacher.Id, classes[1].Id, &model.User{Name: "other-class", Password: "123456"})
+		at.Equal(cerror.Forbidden.WithMsg("只能在自己任教的班级中创建学生"), err)
+
+		user := &model.User{Name: "new-student", Password: "123456"}
+		err = svc.CreateStudent(ctx, teacher.Id, classes[0].Id, user)
+		if at.Nil(err) {
+			at.Equal(classes[0].Id, user.ClassId)
+			at.Equal([]string{model.RoleStudent}, user.RoleNames())
+		}
+	})
+
+	t.Run("移除老师后不能再管理班级中的学生", func(t *testing.T) {
+		at := assert.New(t)
+		at.Nil(classSvc.RemoveTeachers(ctx, classes[0].Id, []int{teacher.Id}))
+		_, err := svc.GetStudent(ctx, teacher.Id, student.Id)
+		at.Equal(errStudentNotTaught, err)
+	})
+
+	_ = testdb.Truncate(db)
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/go-pg/pg/v10"
+	"github.com/kataras/iris/v12/middleware/jwt"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/useragent"
+	"time"
+)
+
+// 登录 token 的签发、刷新和作废
+// 访问接口使用有效期较短的 JWT，过期后通过刷新 token 换取新的，刷新 token 保存在数据库中，可以随时作废
+type IToken interface {
+	// 登录成功后创建会话并签发 token，device 为空时根据 userAgent 生成
+	Issue(ctx context.Context, user *model.User, device, ip, userAgent string) (*model.TokenPair, error)
+	// 使用刷新 token 换取新的 token，旧的刷新 token 随即作废
+	Refresh(ctx context.Context, refreshToken string) (*model.TokenPair, error)
+	// 作废刷新 token 所属的会话，用于退出登录，token 不存在时忽略
+	Revoke(ctx context.Context, refreshToken string) error
+	// 删除已经过期的刷新 token 和会话，返回删除的数量
+	RunOnce(ctx context.Context) (int, error)
+	// 按 interval 轮询处理，直到 ctx 结束
+	Run(ctx context.Context, interval time.Duration)
+}
+
+// expire 为 JWT 的有效期，refreshExpire 为刷新 token 的有效期
+func NewToken(dao dao.IRefreshToken, sessionDao dao.ISession, userDao dao.IUser, secret string, expire, refreshExpire time.Duration) *Token {
+	return &Token{Dao: dao, SessionDao: sessionDao, UserDao: userDao, Secret: secret, Expire: expire, RefreshExpire: refreshExpire}
+}
+
+type Token struct {
+	Dao           dao.IRefreshToken
+	SessionDao    dao.ISession
+	UserDao       dao.IUser
+	Secret        string
+	Expire        time.Duration
+	RefreshExpire time.Duration
+}
+
+func (t Token) Issue(ctx context.Context, user *model.User, device, ip, userAgent string) (*model.TokenPair, error) {
+	if device == "" {
+		device = useragent.Describe(userAgent)
+	}
+	session := model.Session{
+		Device:    device,
+		Ip:        ip,
+		UserAgent: userAgent,
+		ExpiresAt: time.Now().Add(t.RefreshExpire),
+		UserId:    user.Id,
+	}
+	err := t.SessionDao.Create(ctx, &session)
+	if err != nil {
+		return nil, err
+	}
+	return t.issue(ctx, user, session.Id)
+}
+
+func (t Token) Refresh(ctx context.Context, refreshToken string) (*model.TokenPair, error) {
+	rt, err := t.Dao.GetByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			return nil, cerror.TokenInvalid
+		}
+		return nil, err
+	}
+	// 已经作废的 token 再次被使用，可能已经泄露，所属的会话作废
+	if !rt.RevokedAt.IsZero() {
+		return nil, t.revokeSession(ctx, rt.SessionId)
+	}
+	if time.Now().After(rt.ExpiresAt) {
+		return nil, cerror.TokenExpired
+	}
+	// 会话已经退出登录或者被强制下线
+	_, err = t.SessionDao.GetActive(ctx, rt.SessionId)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			return nil, cerror.TokenInvalid
+		}
+		return nil, err
+	}
+
+	// 用户被删除，或者修改了密码、角色之后，不允许继续刷新
+	user, err := t.UserDao.Get(ctx, rt.UserId)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			return nil, t.revokeSession(ctx, rt.SessionId)
+		}
+		return nil, err
+	}
+	if user.TokenVersion != rt.TokenVersion {
+		return nil, t.revokeSession(ctx, rt.SessionId)
+	}
+
+	// 同一个 token 并发刷新时只有一个请求能成功
+	ok, err := t.Dao.Revoke(ctx, rt.Id)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, t.revokeSession(ctx, rt.SessionId)
+	}
+	pair, err := t.issue(ctx, user, rt.SessionId)
+	if err != nil {
+		return nil, err
+	}
+	err = t.SessionDao.Renew(ctx, rt.SessionId, time.Now().Add(t.RefreshExpire))
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+func (t Token) Revoke(ctx context.Context, refreshToken string) error {
+	rt, err := t.Dao.GetByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	return t.SessionDao.Revoke(ctx, rt.SessionId)
+}
+
+func (t Token) RunOnce(ctx context.Context) (int, error) {
+	n, err := t.Dao.DeleteExpired(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	m, err := t.SessionDao.DeleteExpired(ctx, time.Now())
+	if err != nil {
+		return n, err
+	}
+	return n + m, nil
+}
+
+// 每次都会删除所有过期的数据，不需要连续执行
+func (t Token) Run(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, "清理过期的登录会话", interval, func(ctx context.Context) (int, error) {
+		_, err := t.RunOnce(ctx)
+		return 0, err
+	})
+}
+
+// 为会话签发 JWT 和刷新 token
+func (t Token) issue(ctx context.Context, user *model.User, sessionId int) (*model.TokenPair, error) {
+	token, err := jwt.Sign(
+		jwt.HS256,
+		[]byte(t.Secret),
+		model.JWTClaims{Uid: user.Id, Ver: user.TokenVersion, Sid: sessionId},
+		jwt.MaxAge(t.Expire),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	err = t.Dao.Create(ctx, &model.RefreshToken{
+		TokenHash:    hashToken(refreshToken),
+		TokenVersion: user.TokenVersion,
+		ExpiresAt:    time.Now().Add(t.RefreshExpire),
+		UserId:       user.Id,
+		SessionId:    sessionId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &model.TokenPair{
+		Token:        string(token),
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(t.Expire / time.Second),
+	}, nil
+}
+
+// 作废会话，并返回 token 不合法的错误
+func (t Token) revokeSession(ctx context.Context, sessionId int) error {
+	err := t.SessionDao.Revoke(ctx, sessionId)
+	if err != nil {
+		return err
+	}
+	return cerror.TokenInvalid
+}
+
+// 生成随机 token，256 位
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// 数据库中只保存 token 的 hash，数据泄露时也无法直接使用
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
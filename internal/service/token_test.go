@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
+	"testing"
+	"time"
+)
+
+func TestTokenSvc(t *testing.T) {
+	pUsers, err := testdb.SeedUser(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userSvc := NewUser(userDao, utils.PwdPolicy{})
+	svc := NewToken(dao.NewRefreshToken(db), dao.NewSession(db), userDao, "secret", time.Minute, time.Hour)
+	ctx := context.Background()
+	user := pUsers[0]
+
+	pair, err := svc.Issue(ctx, user, "", "127.0.0.1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("刷新后旧的刷新 token 作废", func(t *testing.T) {
+		at := assert.New(t)
+		at.NotEmpty(pair.Token)
+		at.Equal(60, pair.ExpiresIn)
+
+		next, err := svc.Refresh(ctx, pair.RefreshToken)
+		if !at.Nil(err) {
+			return
+		}
+		at.NotEqual(pair.RefreshToken, next.RefreshToken)
+
+		// 旧的被再次使用，所属的会话作废
+		_, err = svc.Refresh(ctx, pair.RefreshToken)
+		at.Equal(cerror.TokenInvalid, err)
+		_, err = svc.Refresh(ctx, next.RefreshToken)
+		at.Equal(cerror.TokenInvalid, err)
+	})
+
+	t.Run("会话被下线后不能再刷新", func(t *testing.T) {
+		at := assert.New(t)
+		pair, err := svc.Issue(ctx, user, "机房 01", "127.0.0.1", "")
+		if !at.Nil(err) {
+			return
+		}
+		n, err := NewSession(dao.NewSession(db)).RevokeAll(ctx, user.Id)
+		at.Nil(err)
+		at.NotZero(n)
+		_, err = svc.Refresh(ctx, pair.RefreshToken)
+		at.Equal(cerror.TokenInvalid, err)
+	})
+
+	t.Run("不存在的刷新 token", func(t *testing.T) {
+		_, err := svc.Refresh(ctx, "not exist")
+		assert.Equal(t, cerror.TokenInvalid, err)
+	})
+
+	t.Run("退出登录", func(t *testing.T) {
+		at := assert.New(t)
+		pair, err := svc.Issue(ctx, user, "", "127.0.0.1", "")
+		if !at.Nil(err) {
+			return
+		}
+		at.Nil(svc.Revoke(ctx, pair.RefreshToken))
+		_, err = svc.Refresh(ctx, pair.RefreshToken)
+		at.Equal(cerror.TokenInvalid, err)
+		// 重复退出
+		at.Nil(svc.Revoke(ctx, pair.RefreshToken))
+	})
+
+	t.Run("修改角色后不能再刷新", func(t *testing.T) {
+		at := assert.New(t)
+		pair, err := svc.Issue(ctx, user, "", "127.0.0.1", "")
+		if !at.Nil(err) {
+			return
+		}
+		// 角色没有变化时不影响
+		_, err = userSvc.SetRoles(ctx, user.Id, user.RoleNames())
+		at.Nil(err)
+		pair, err = svc.Refresh(ctx, pair.RefreshToken)
+		if !at.Nil(err) {
+			return
+		}
+
+		_, err = userSvc.SetRoles(ctx, user.Id, append(user.RoleNames(), model.RoleTeacher))
+		at.Nil(err)
+		_, err = svc.Refresh(ctx, pair.RefreshToken)
+		at.Equal(cerror.TokenInvalid, err)
+	})
+
+	t.Run("过期", func(t *testing.T) {
+		at := assert.New(t)
+		svc := NewToken(dao.NewRefreshToken(db), dao.NewSession(db), userDao, "secret", time.Minute, -time.Minute)
+		pair, err := svc.Issue(ctx, user, "", "127.0.0.1", "")
+		if !at.Nil(err) {
+			return
+		}
+		_, err = svc.Refresh(ctx, pair.RefreshToken)
+		at.Equal(cerror.TokenExpired, err)
+
+		// 刷新 token 和会话各一条
+		n, err := svc.RunOnce(ctx)
+		at.Nil(err)
+		at.Equal(2, n)
+	})
+
+	_ = testdb.Truncate(db)
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"github.com/kataras/iris/v12/middleware/jwt"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/totp"
+	"strings"
+	"time"
+)
+
+// 两步验证，密码之外还需要输入验证器 App 中的动态验证码，手机丢失时可以使用恢复码
+type ITotp interface {
+	// 生成新的密钥，还需要调用 Enable 确认后才会开启
+	Setup(ctx context.Context, userId int) (*model.TotpSetup, error)
+	// 校验验证码后开启两步验证，返回恢复码，恢复码只在这时返回一次
+	Enable(ctx context.Context, userId int, code string) ([]string, error)
+	// 校验验证码或恢复码后关闭两步验证，策略要求必须开启时不允许关闭
+	Disable(ctx context.Context, userId int, code string) error
+	// 校验验证码或恢复码
+	Verify(ctx context.Context, user *model.User, code string) error
+	// 校验验证码后重新生成恢复码，原有的全部失效
+	RegenerateRecoveryCodes(ctx context.Context, userId int, code string) ([]string, error)
+	// 管理员重置，用户丢失手机又没有恢复码时使用，策略要求开启的用户下次登录时需要重新设置
+	Reset(ctx context.Context, userId int) error
+	// 按照策略，用户是否必须开启两步验证
+	Required(user *model.User) bool
+	// 密码校验通过后签发临时凭证，用于完成登录的第二步
+	Challenge(user *model.User, device string) (string, error)
+	// 解析临时凭证，不合法或已过期时返回 cerror.TokenInvalid
+	ParseChallenge(token string) (*model.MfaClaims, error)
+}
+
+// 哪些用户必须开启两步验证，对应 setting.App 中 Totp 开头的配置
+type TotpPolicy struct {
+	RequireAdmin   bool
+	RequireTeacher bool
+}
+
+// issuer 为验证器 App 中显示的名称，secret 用于签发登录第二步使用的临时凭证
+func NewTotp(userDao dao.IUser, recoveryCodeDao dao.IRecoveryCode, issuer, secret string, policy TotpPolicy) *Totp {
+	return &Totp{UserDao: userDao, RecoveryCodeDao: recoveryCodeDao, Issuer: issuer, Secret: secret, Policy: policy}
+}
+
+type Totp struct {
+	UserDao         dao.IUser
+	RecoveryCodeDao dao.IRecoveryCode
+	Issuer          string
+	Secret          string
+	Policy          TotpPolicy
+}
+
+const (
+	totpSkew           = 1               // 允许手机时间前后偏差一个周期
+	recoveryCodeCount  = 10              // 每次生成的恢复码数量
+	mfaChallengeExpire = 5 * time.Minute // 登录第二步临时凭证的有效期
+)
+
+func (t Totp) Setup(ctx context.Context, userId int) (*model.TotpSetup, error) {
+	user, err := t.UserDao.Get(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if user.TotpEnabled {
+		return nil, cerror.BadRequest.WithMsg("已开启两步验证，请先关闭")
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	err = t.UserDao.Update(ctx, &model.User{Id: userId, TotpSecret: secret}, []string{"totp_secret"})
+	if err != nil {
+		return nil, err
+	}
+	return &model.TotpSetup{Secret: secret, Uri: totp.URI(t.Issuer, user.Name, secret)}, nil
+}
+
+func (t Totp) Enable(ctx context.Context, userId int, code string) ([]string, error) {
+	user, err := t.UserDao.Get(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if user.TotpEnabled {
+		return nil, cerror.BadRequest.WithMsg("已开启两步验证")
+	}
+	if user.TotpSecret == "" {
+		return nil, cerror.BadRequest.WithMsg("请先获取两步验证密钥")
+	}
+	// 开启时只接受验证码，确认验证器 App 已经添加成功
+	err = t.verifyCode(ctx, user, code)
+	if err != nil {
+		return nil, err
+	}
+	err = t.UserDao.Update(ctx, &model.User{Id: userId, TotpEnabled: true}, []string{"totp_enabled"})
+	if err != nil {
+		return nil, err
+	}
+	return t.generateRecoveryCodes(ctx, userId)
+}
+
+func (t Totp) Disable(ctx context.Context, userId int, code string) error {
+	user, err := t.UserDao.Get(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if !user.TotpEnabled {
+		return cerror.BadRequest.WithMsg("未开启两步验证")
+	}
+	if t.Required(user) {
+		return cerror.BadRequest.WithMsg("管理员要求开启两步验证，无法关闭")
+	}
+	err = t.Verify(ctx, user, code)
+	if err != nil {
+		return err
+	}
+	return t.Reset(ctx, userId)
+}
+
+func (t Totp) Verify(ctx context.Context, user *model.User, code string) error {
+	if !user.TotpEnabled {
+		return cerror.BadRequest.WithMsg("未开启两步验证")
+	}
+	// 验证码是 6 位数字，其他格式的按恢复码处理
+	if len(strings.TrimSpace(code)) == totp.Digits {
+		return t.verifyCode(ctx, user, code)
+	}
+	ok, err := t.RecoveryCodeDao.Use(ctx, user.Id, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return cerror.BadRequest.WithMsg("恢复码错误或已使用")
+	}
+	return nil
+}
+
+func (t Totp) RegenerateRecoveryCodes(ctx context.Context, userId int, code string) ([]string, error) {
+	user, err := t.UserDao.Get(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TotpEnabled {
+		return nil, cerror.BadRequest.WithMsg("未开启两步验证")
+	}
+	err = t.verifyCode(ctx, user, code)
+	if err != nil {
+		return nil, err
+	}
+	return t.generateRecoveryCodes(ctx, userId)
+}
+
+func (t Totp) Reset(ctx context.Context, userId int) error {
+	err := t.UserDao.Update(ctx, &model.User{Id: userId}, []string{"totp_secret", "totp_enabled"})
+	if err != nil {
+		return err
+	}
+	return t.RecoveryCodeDao.DeleteByUser(ctx, userId)
+}
+
+func (t Totp) Required(user *model.User) bool {
+	if t.Policy.RequireAdmin && user.HasRole(model.RoleAdmin) {
+		return true
+	}
+	return t.Policy.RequireTeacher && user.HasRole(model.RoleTeacher)
+}
+
+func (t Totp) Challenge(user *model.User, device string) (string, error) {
+	token, err := jwt.Sign(jwt.HS256, t.challengeKey(), model.MfaClaims{Uid: user.Id, Device: device}, jwt.MaxAge(mfaChallengeExpire))
+	if err != nil {
+		return "", err
+	}
+	return string(token), nil
+}
+
+func (t Totp) ParseChallenge(token string) (*model.MfaClaims, error) {
+	verified, err := jwt.NewVerifier(jwt.HS256, t.challengeKey()).VerifyToken([]byte(token))
+	if err != nil {
+		return nil, cerror.TokenInvalid.WithMsg("登录已过期，请重新输入密码")
+	}
+	claims := model.MfaClaims{}
+	err = verified.Claims(&claims)
+	if err != nil {
+		return nil, cerror.TokenInvalid.WithMsg("登录已过期，请重新输入密码")
+	}
+	return &claims, nil
+}
+
+// 和登录 token 使用不同的密钥，临时凭证不能当作登录 token 使用
+func (t Totp) challengeKey() []byte {
+	return []byte(t.Secret + ":mfa")
+}
+
+// 校验验证码，同一个验证码只能使用一次
+func (t Totp) verifyCode(ctx context.Context, user *model.User, code string) error {
+	step, ok := totp.Validate(user.TotpSecret, code, time.Now(), totpSkew)
+	if !ok {
+		return cerror.BadRequest.WithMsg("验证码错误")
+	}
+	ok, err := t.UserDao.UseTotpStep(ctx, user.Id, step)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return cerror.BadRequest.WithMsg("验证码已使用，请等待下一个验证码")
+	}
+	return nil
+}
+
+// 生成新的恢复码，原有的全部失效
+func (t Totp) generateRecoveryCodes(ctx context.Context, userId int) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, err
+		}
+		// 8 位 base32 字符，中间用横线分隔，方便抄写
+		s := base32.StdEncoding.EncodeToString(b)
+		codes = append(codes, s[:4]+"-"+s[4:])
+		hashes = append(hashes, hashToken(s))
+	}
+	err := t.RecoveryCodeDao.Replace(ctx, userId, hashes)
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// 用户输入时可能带有空格、横线或者小写字母
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/totp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTotpSvc(t *testing.T) {
+	pUsers, err := testdb.SeedUser(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := NewTotp(userDao, dao.NewRecoveryCode(db), "时频学习平台", "secret", TotpPolicy{RequireAdmin: true})
+	ctx := context.Background()
+	user := pUsers[0]
+
+	// 当前周期往后第 offset 个周期的验证码，同一个周期的验证码只能用一次
+	code := func(secret string, offset int64) string {
+		c, err := totp.Code(secret, totp.Step(time.Now())+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	setup, err := svc.Setup(ctx, user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var recoveryCodes []string
+	t.Run("开启", func(t *testing.T) {
+		at := assert.New(t)
+		at.Contains(setup.Uri, "secret="+setup.Secret)
+
+		_, err := svc.Enable(ctx, user.Id, "000000")
+		at.Equal(cerror.BadRequest.WithMsg("验证码错误"), err)
+
+		recoveryCodes, err = svc.Enable(ctx, user.Id, code(setup.Secret, -1))
+		if at.Nil(err) {
+			at.Len(recoveryCodes, 10)
+		}
+		_, err = svc.Setup(ctx, user.Id)
+		at.Equal(cerror.BadRequest.WithMsg("已开启两步验证，请先关闭"), err)
+	})
+
+	t.Run("校验", func(t *testing.T) {
+		at := assert.New(t)
+		u, err := userDao.Get(ctx, user.Id)
+		if !at.Nil(err) || !at.True(u.TotpEnabled) {
+			return
+		}
+		// 开启时用过的验证码不能再用
+		at.Equal(cerror.BadRequest.WithMsg("验证码已使用，请等待下一个验证码"), svc.Verify(ctx, u, code(setup.Secret, -1)))
+		at.Nil(svc.Verify(ctx, u, code(setup.Secret, 0)))
+
+		// 恢复码不区分大小写，只能用一次
+		at.Nil(svc.Verify(ctx, u, strings.ToLower(recoveryCodes[0])))
+		at.Equal(cerror.BadRequest.WithMsg("恢复码错误或已使用"), svc.Verify(ctx, u, recoveryCodes[0]))
+		n, err := dao.NewRecoveryCode(db).CountUnused(ctx, user.Id)
+		at.Nil(err)
+		at.Equal(9, n)
+	})
+
+	t.Run("登录临时凭证", func(t *testing.T) {
+		at := assert.New(t)
+		token, err := svc.Challenge(user, "机房 01")
+		if !at.Nil(err) {
+			return
+		}
+		claims, err := svc.ParseChallenge(token)
+		if at.Nil(err) {
+			at.Equal(user.Id, claims.Uid)
+			at.Equal("机房 01", claims.Device)
+		}
+		// 其他密钥签发的不接受
+		other := NewTotp(userDao, dao.NewRecoveryCode(db), "", "other", TotpPolicy{})
+		_, err = other.ParseChallenge(token)
+		at.NotNil(err)
+	})
+
+	t.Run("策略", func(t *testing.T) {
+		at := assert.New(t)
+		at.True(svc.Required(&model.User{Roles: []*model.Role{{Name: model.RoleAdmin}}}))
+		at.False(svc.Required(&model.User{Roles: []*model.Role{{Name: model.RoleTeacher}}}))
+	})
+
+	t.Run("关闭", func(t *testing.T) {
+		at := assert.New(t)
+		at.Nil(svc.Disable(ctx, user.Id, recoveryCodes[1]))
+		u, err := userDao.Get(ctx, user.Id)
+		if at.Nil(err) {
+			at.False(u.TotpEnabled)
+			at.Empty(u.TotpSecret)
+		}
+		n, err := dao.NewRecoveryCode(db).CountUnused(ctx, user.Id)
+		at.Nil(err)
+		at.Zero(n)
+	})
+
+	_ = testdb.Truncate(db)
+}
@@ -0,0 +1,266 @@
+package service
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10"
+	"github.com/pkg/errors"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/storage"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/hls"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/thumbnail"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// 执行中任务的租约时长，进程退出后最多经过这么久任务会被重新领取
+	transcodeLease = 2 * time.Minute
+	// 最多执行次数，超过后标记为失败，需要老师手动重试
+	transcodeMaxAttempts = 3
+)
+
+// 视频转码，将视频资料转码为多码率的 HLS
+// 任务保存在数据库中，进程重启后未完成的任务会被重新领取执行
+type ITranscode interface {
+	// 资料当前版本的转码任务，不是视频或者还没有创建任务时返回 pg.ErrNoRows
+	GetJob(ctx context.Context, learningMaterialId int) (*model.TranscodeJob, error)
+	// 重新执行失败的转码任务
+	Retry(ctx context.Context, learningMaterialId int) (*model.TranscodeJob, error)
+	// 打开资料当前版本转码后的文件，name 为相对主播放列表的路径，例如 master.m3u8、720p/seg_000.ts
+	Open(ctx context.Context, learningMaterialId int, name string) (storage.Object, error)
+
+	// 为新的视频资料创建任务，并执行一批任务，返回执行的数量
+	RunOnce(ctx context.Context) (int, error)
+	// 按 interval 轮询处理，直到 ctx 结束
+	Run(ctx context.Context, interval time.Duration)
+}
+
+// ffmpegPath 为空时只提供查询，不会创建和执行任务
+func NewTranscode(dao dao.ITranscodeJob, lmDao dao.ILearningMaterial, versionDao dao.ILearningMaterialVersion, storage storage.Storage, tempPath, ffmpegPath string, renditions []hls.Rendition) *Transcode {
+	if len(renditions) == 0 {
+		renditions = hls.DefaultRenditions
+	}
+	return &Transcode{
+		Dao:        dao,
+		LmDao:      lmDao,
+		VersionDao: versionDao,
+		Storage:    storage,
+		TempPath:   tempPath,
+		FfmpegPath: ffmpegPath,
+		Renditions: renditions,
+	}
+}
+
+type Transcode struct {
+	Dao        dao.ITranscodeJob
+	LmDao      dao.ILearningMaterial
+	VersionDao dao.ILearningMaterialVersion
+	Storage    storage.Storage
+	TempPath   string
+	FfmpegPath string
+	Renditions []hls.Rendition
+}
+
+func (t Transcode) GetJob(ctx context.Context, learningMaterialId int) (*model.TranscodeJob, error) {
+	lm, err := t.LmDao.Get(ctx, learningMaterialId)
+	if err != nil {
+		return nil, err
+	}
+	return t.Dao.GetByLearningMaterial(ctx, lm.Id, lm.Md5)
+}
+
+func (t Transcode) Retry(ctx context.Context, learningMaterialId int) (*model.TranscodeJob, error) {
+	job, err := t.GetJob(ctx, learningMaterialId)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != model.TranscodeStatusFailed {
+		return nil, cerror.BadRequest.WithMsg("只有失败的转码任务可以重试")
+	}
+	return t.Dao.Reset(ctx, job.Id)
+}
+
+func (t Transcode) Open(ctx context.Context, learningMaterialId int, name string) (storage.Object, error) {
+	job, err := t.GetJob(ctx, learningMaterialId)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != model.TranscodeStatusDone {
+		return nil, cerror.BadRequest.WithMsg("视频还没有转码完成")
+	}
+	// 只允许访问任务生成的文件
+	key := hlsKey(job.Md5, name)
+	for _, file := range job.Files {
+		if file == key {
+			return t.Storage.Get(ctx, key)
+		}
+	}
+	return nil, storage.ErrNotExist
+}
+
+func (t Transcode) RunOnce(ctx context.Context) (int, error) {
+	err := t.cleanup(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if t.FfmpegPath == "" {
+		return 0, nil
+	}
+
+	_, err = t.Dao.CreateMissing(ctx, thumbnail.Exts(thumbnail.KindVideo))
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for ; n < workerBatchSize; n++ {
+		job, err := t.Dao.Claim(ctx, transcodeLease)
+		if err != nil {
+			if errors.Is(err, pg.ErrNoRows) {
+				break
+			}
+			return n, err
+		}
+		err = t.run(ctx, job)
+		if err != nil {
+			retry := job.Attempts < transcodeMaxAttempts
+			err = t.Dao.Fail(ctx, job.Id, err.Error(), retry)
+			if err != nil {
+				return n, err
+			}
+			// 失败的任务等下一轮再重试，不立即重新领取
+			return n + 1, nil
+		}
+	}
+	return n, nil
+}
+
+func (t Transcode) Run(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, "视频转码", interval, t.RunOnce)
+}
+
+// 执行单个任务
+func (t Transcode) run(ctx context.Context, job *model.TranscodeJob) error {
+	// 进程中途退出导致的重复执行也计入次数，避免一个会让进程崩溃的视频反复执行
+	if job.Attempts > transcodeMaxAttempts {
+		return errors.New("超过最大执行次数")
+	}
+
+	// 内容相同的视频已经转码过，直接复用
+	done, err := t.Dao.GetDoneByMd5(ctx, job.Md5)
+	if err == nil {
+		return t.Dao.Finish(ctx, job.Id, done.Renditions, done.Files)
+	}
+	if !errors.Is(err, pg.ErrNoRows) {
+		return err
+	}
+
+	// 任务对应的可能是历史版本，从版本中找到源文件
+	version, err := t.VersionDao.GetByMd5(ctx, job.Md5)
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			return errors.New("源文件不存在")
+		}
+		return err
+	}
+
+	// 转码期间定时续期
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		ticker := time.NewTicker(transcodeLease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_ = t.Dao.Heartbeat(ctx, job.Id, transcodeLease)
+			}
+		}
+	}()
+
+	f, err := copyToTemp(ctx, t.Storage, t.TempPath, version.FilePath)
+	if err != nil {
+		return err
+	}
+	_ = f.Close()
+	defer os.Remove(f.Name())
+
+	outDir, err := ioutil.TempDir(t.TempPath, "hls-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(outDir)
+
+	names, err := hls.Transcode(ctx, t.FfmpegPath, f.Name(), outDir, t.Renditions)
+	if err != nil {
+		return err
+	}
+
+	files := make([]string, 0, len(names))
+	for _, name := range names {
+		key := hlsKey(job.Md5, name)
+		err = t.put(ctx, key, filepath.Join(outDir, filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+		files = append(files, key)
+	}
+
+	renditions := make([]string, 0, len(t.Renditions))
+	for _, r := range t.Renditions {
+		renditions = append(renditions, r.Name)
+	}
+	return t.Dao.Finish(ctx, job.Id, renditions, files)
+}
+
+func (t Transcode) put(ctx context.Context, key, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return t.Storage.Put(ctx, key, f, info.Size(), hls.ContentType(file))
+}
+
+// 清理资料已经被删除的任务，转码结果没有被其他任务使用时一并删除
+func (t Transcode) cleanup(ctx context.Context) error {
+	jobs, err := t.Dao.ListOrphaned(ctx, workerBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		used, err := t.Dao.IsMd5Used(ctx, job.Md5, job.Id)
+		if err != nil {
+			return err
+		}
+		if !used {
+			for _, file := range job.Files {
+				err = t.Storage.Delete(ctx, file)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		err = t.Dao.Delete(ctx, job.Id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 转码结果在存储中的 key，按源文件 md5 存放
+func hlsKey(md5, name string) string {
+	return path.Join("hls", md5, path.Clean("/" + name)[1:])
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/storage"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestTranscodeSvc(t *testing.T) {
+	_, pSubjects, pUsers := prepareLearningMaterial(t, db)
+	lmSvc := NewLearningMaterial(lmDao, lmVersionDao, lmStorage, "")
+	jobDao := dao.NewTranscodeJob(db)
+	// ffmpeg 路径指向不存在的文件，转码一定失败
+	svc := NewTranscode(jobDao, lmDao, lmVersionDao, lmStorage, "", "/nonexistent/ffmpeg", nil)
+	ctx := context.Background()
+
+	createdById := pUsers[0].Id
+	subjectId := pSubjects[0].Id
+	content := []byte(time.Now().String())
+
+	lm, err := lmSvc.Upload(ctx, createdById, subjectId, time.Now().String(), "", "lab.mp4", bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("失败后重试，超过次数后停止", func(t *testing.T) {
+		at := assert.New(t)
+		for i := 0; i < transcodeMaxAttempts; i++ {
+			_, err := svc.RunOnce(ctx)
+			at.Nil(err)
+		}
+		job, err := svc.GetJob(ctx, lm.Id)
+		if !at.Nil(err) {
+			return
+		}
+		at.Equal(model.TranscodeStatusFailed, job.Status)
+		at.Equal(transcodeMaxAttempts, job.Attempts)
+		at.NotEmpty(job.Error)
+
+		_, err = svc.Open(ctx, lm.Id, "master.m3u8")
+		at.NotNil(err)
+
+		job, err = svc.Retry(ctx, lm.Id)
+		at.Nil(err)
+		at.Equal(model.TranscodeStatusPending, job.Status)
+		_, err = svc.Retry(ctx, lm.Id)
+		at.NotNil(err)
+	})
+
+	t.Run("复用内容相同的转码结果", func(t *testing.T) {
+		at := assert.New(t)
+		job, err := svc.GetJob(ctx, lm.Id)
+		if !at.Nil(err) {
+			return
+		}
+		key := hlsKey(job.Md5, "master.m3u8")
+		at.Nil(lmStorage.Put(ctx, key, bytes.NewReader([]byte("#EXTM3U\n")), 8, ""))
+		at.Nil(jobDao.Finish(ctx, job.Id, []string{"360p"}, []string{key}))
+
+		// 另一个资料上传了内容相同的视频
+		other, err := lmSvc.Upload(ctx, createdById, subjectId, time.Now().String(), "", "copy.mp4", bytes.NewReader(content))
+		if !at.Nil(err) {
+			return
+		}
+		_, err = svc.RunOnce(ctx)
+		at.Nil(err)
+		otherJob, err := svc.GetJob(ctx, other.Id)
+		at.Nil(err)
+		at.Equal(model.TranscodeStatusDone, otherJob.Status)
+
+		obj, err := svc.Open(ctx, other.Id, "master.m3u8")
+		if at.Nil(err) {
+			b, _ := ioutil.ReadAll(obj)
+			_ = obj.Close()
+			at.Equal("#EXTM3U\n", string(b))
+		}
+		// 不是任务生成的文件不允许访问
+		_, err = svc.Open(ctx, other.Id, "../../"+other.FilePath)
+		at.Equal(storage.ErrNotExist, err)
+
+		// 彻底删除其中一个资料，转码结果还在被使用
+		at.Nil(lmSvc.Delete(ctx, lm.Id))
+		at.Nil(lmSvc.Purge(ctx, lm.Id))
+		_, err = svc.RunOnce(ctx)
+		at.Nil(err)
+		_, err = lmStorage.Stat(ctx, key)
+		at.Nil(err)
+
+		// 都彻底删除后转码结果一并删除
+		at.Nil(lmSvc.Delete(ctx, other.Id))
+		at.Nil(lmSvc.Purge(ctx, other.Id))
+		_, err = svc.RunOnce(ctx)
+		at.Nil(err)
+		_, err = lmStorage.Stat(ctx, key)
+		at.Equal(storage.ErrNotExist, err)
+		_, err = jobDao.Get(ctx, otherJob.Id)
+		at.Equal(pg.ErrNoRows, err)
+	})
+
+	_ = testdb.Truncate(db)
+}
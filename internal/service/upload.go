@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-pg/pg/v10"
+	"github.com/pkg/errors"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/storage"
+	"github.com/xuxusheng/time-frequency-be/internal/model"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// 未完成的上传保留的时长，超过后会被清理
+const uploadExpire = 24 * time.Hour
+
+// 分片上传，分片写入 storage 而不是本地磁盘，多个副本部署时可以在任意副本上续传
+type IUpload interface {
+	Create(ctx context.Context, createdById, subjectId int, length int64, fileName, name, description, md5 string) (*model.Upload, error)
+	Get(ctx context.Context, createdById int, id string) (*model.Upload, error)
+	// 从 offset 处写入一个分片，分片写满后自动合并文件并创建学习资料
+	WriteChunk(ctx context.Context, upload *model.Upload, offset int64, chunk io.Reader) (*model.Upload, error)
+	Delete(ctx context.Context, upload *model.Upload) error
+	PurgeExpired(ctx context.Context) error
+}
+
+func NewUpload(dao dao.IUpload, lmSvc ILearningMaterial, storage storage.Storage, tempPath string) *Upload {
+	return &Upload{Dao: dao, LmSvc: lmSvc, Storage: storage, TempPath: tempPath}
+}
+
+type Upload struct {
+	Dao      dao.IUpload
+	LmSvc    ILearningMaterial
+	Storage  storage.Storage
+	TempPath string
+}
+
+func (u Upload) Create(ctx context.Context, createdById, subjectId int, length int64, fileName, name, description, md5 string) (*model.Upload, error) {
+	// 顺带清理过期的上传，失败不影响本次创建
+	_ = u.PurgeExpired(ctx)
+
+	if length <= 0 {
+		return nil, cerror.BadRequest.WithMsg("文件大小必须大于 0")
+	}
+	// 提前判断资料名称，避免传完了才发现无法创建
+	is, err := u.LmSvc.IsNameExist(ctx, name, 0)
+	if err != nil {
+		return nil, err
+	}
+	if is {
+		return nil, cerror.BadRequest.WithMsg("资料名称已存在")
+	}
+
+	id, err := randomId()
+	if err != nil {
+		return nil, err
+	}
+	upload := &model.Upload{
+		Id:          id,
+		Length:      length,
+		Parts:       []string{},
+		FileName:    fileName,
+		Name:        name,
+		Description: description,
+		Md5:         strings.ToLower(md5),
+		ExpiresAt:   time.Now().Add(uploadExpire),
+		SubjectId:   subjectId,
+		CreatedById: createdById,
+	}
+	err = u.Dao.Create(ctx, upload)
+	if err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// 只能查询到自己创建的上传，其他人的上传当作不存在处理
+func (u Upload) Get(ctx context.Context, createdById int, id string) (*model.Upload, error) {
+	upload, err := u.Dao.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if upload.CreatedById != createdById {
+		return nil, pg.ErrNoRows
+	}
+	if upload.LearningMaterialId == 0 && upload.ExpiresAt.Before(time.Now()) {
+		return nil, pg.ErrNoRows
+	}
+	return upload, nil
+}
+
+func (u Upload) WriteChunk(ctx context.Context, upload *model.Upload, offset int64, chunk io.Reader) (*model.Upload, error) {
+	if upload.LearningMaterialId != 0 {
+		return nil, cerror.BadRequest.WithMsg("上传已完成")
+	}
+	if offset != upload.Offset {
+		return nil, cerror.Conflict.WithMsg(fmt.Sprintf("上传位置不一致，当前已上传 %d 字节", upload.Offset))
+	}
+
+	// 所有分片都已经收到，但上次合并文件失败了，直接重试合并
+	if upload.Offset == upload.Length {
+		return u.finish(ctx, upload)
+	}
+
+	n, copyErr := u.savePart(ctx, upload, offset, chunk)
+	if n > 0 {
+		upload.Offset += n
+	}
+	if copyErr != nil {
+		return upload, copyErr
+	}
+	if upload.Offset < upload.Length {
+		return upload, nil
+	}
+	return u.finish(ctx, upload)
+}
+
+func (u Upload) Delete(ctx context.Context, upload *model.Upload) error {
+	err := u.Dao.Delete(ctx, upload.Id)
+	if err != nil {
+		return err
+	}
+	u.removeParts(ctx, upload)
+	return nil
+}
+
+func (u Upload) PurgeExpired(ctx context.Context) error {
+	uploads, err := u.Dao.ListExpired(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	for _, upload := range uploads {
+		err = u.Delete(ctx, upload)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 保存一个分片，返回实际写入的字节数
+// 连接中途断开时，已经收到的部分依然会保存下来，客户端可以从新的 offset 继续上传
+func (u Upload) savePart(ctx context.Context, upload *model.Upload, offset int64, chunk io.Reader) (int64, error) {
+	tmp, err := u.tempFile()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	n, copyErr := io.Copy(tmp, io.LimitReader(chunk, upload.Length-offset))
+	if n == 0 {
+		return 0, copyErr
+	}
+
+	_, err = tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	// key 中带上随机串，并发写入同一个 offset 时不会互相覆盖
+	suffix, err := randomId()
+	if err != nil {
+		return 0, err
+	}
+	key := path.Join("uploads", upload.Id, fmt.Sprintf("%020d-%s", offset, suffix))
+	err = u.Storage.Put(ctx, key, tmp, n, "application/octet-stream")
+	if err != nil {
+		return 0, err
+	}
+
+	ok, err := u.Dao.AppendPart(ctx, upload.Id, offset, n, key)
+	if err != nil || !ok {
+		_ = u.Storage.Delete(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		return 0, cerror.Conflict.WithMsg("上传位置不一致，可能有其他请求在同时上传")
+	}
+	upload.Parts = append(upload.Parts, key)
+	return n, copyErr
+}
+
+// 合并所有分片，校验 md5 后创建学习资料
+func (u Upload) finish(ctx context.Context, upload *model.Upload) (*model.Upload, error) {
+	tmp, err := u.tempFile()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	h := md5.New()
+	for _, key := range upload.Parts {
+		err = u.copyPart(ctx, io.MultiWriter(tmp, h), key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	if upload.Md5 != "" && upload.Md5 != sum {
+		// 文件内容已经损坏，只能重新上传
+		_ = u.Delete(ctx, upload)
+		return nil, cerror.BadRequest.WithMsg("文件 md5 校验失败，请重新上传")
+	}
+
+	_, err = tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	lm, err := u.LmSvc.Upload(ctx, upload.CreatedById, upload.SubjectId, upload.Name, upload.Description, upload.FileName, tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	err = u.Dao.SetLearningMaterialId(ctx, upload.Id, lm.Id)
+	if err != nil {
+		return nil, err
+	}
+	upload.LearningMaterialId = lm.Id
+	// 资料已经创建，分片没用了，上传记录保留到过期，方便客户端查询结果
+	u.removeParts(ctx, upload)
+	return upload, nil
+}
+
+func (u Upload) copyPart(ctx context.Context, w io.Writer, key string) error {
+	obj, err := u.Storage.Get(ctx, key)
+	if err != nil {
+		return errors.Wrapf(err, "读取分片 %s 失败", key)
+	}
+	defer obj.Close()
+	_, err = io.Copy(w, obj)
+	return err
+}
+
+func (u Upload) removeParts(ctx context.Context, upload *model.Upload) {
+	for _, key := range upload.Parts {
+		_ = u.Storage.Delete(ctx, key)
+	}
+}
+
+func (u Upload) tempFile() (*os.File, error) {
+	if u.TempPath != "" {
+		err := os.MkdirAll(u.TempPath, os.ModePerm)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ioutil.TempFile(u.TempPath, "chunk-*")
+}
+
+func randomId() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+// 模拟上传到一半连接断开
+type brokenReader struct {
+	data []byte
+}
+
+func (b *brokenReader) Read(p []byte) (int, error) {
+	if len(b.data) == 0 {
+		return 0, errors.New("connection reset")
+	}
+	n := copy(p, b.data)
+	b.data = b.data[n:]
+	return n, nil
+}
+
+func TestUploadSvc_WriteChunk(t *testing.T) {
+	_, pSubjects, pUsers := prepareLearningMaterial(t, db)
+	lmSvc := NewLearningMaterial(lmDao, lmVersionDao, lmStorage, "")
+	svc := NewUpload(dao.NewUpload(db), lmSvc, lmStorage, "")
+	ctx := context.Background()
+
+	createdById := pUsers[0].Id
+	subjectId := pSubjects[0].Id
+	content := bytes.Repeat([]byte(time.Now().String()), 100)
+	sum := fmt.Sprintf("%x", md5.Sum(content))
+
+	t.Run("分片上传并断点续传", func(t *testing.T) {
+		name := time.Now().String() + "name"
+		upload, err := svc.Create(ctx, createdById, subjectId, int64(len(content)), "video.mp4", name, "desc", sum)
+		if !assert.Nil(t, err) {
+			return
+		}
+
+		// 第一个分片中途断开，已收到的数据需要保留
+		upload, err = svc.WriteChunk(ctx, upload, 0, &brokenReader{data: content[:100]})
+		assert.NotNil(t, err)
+		upload, err = svc.Get(ctx, createdById, upload.Id)
+		if !assert.Nil(t, err) {
+			return
+		}
+		assert.EqualValues(t, 100, upload.Offset)
+
+		// offset 不一致
+		_, err = svc.WriteChunk(ctx, upload, 0, bytes.NewReader(content))
+		assert.Equal(t, cerror.Conflict.StatusCode(), err.(cerror.IError).StatusCode())
+
+		upload, err = svc.WriteChunk(ctx, upload, 100, bytes.NewReader(content[100:500]))
+		if assert.Nil(t, err) {
+			assert.EqualValues(t, 500, upload.Offset)
+			assert.Zero(t, upload.LearningMaterialId)
+		}
+		upload, err = svc.WriteChunk(ctx, upload, 500, bytes.NewReader(content[500:]))
+		if !assert.Nil(t, err) {
+			return
+		}
+		assert.EqualValues(t, len(content), upload.Offset)
+		assert.NotZero(t, upload.LearningMaterialId)
+
+		lm, err := lmSvc.Get(ctx, upload.LearningMaterialId)
+		if assert.Nil(t, err) {
+			assert.Equal(t, name, lm.Name)
+			assert.Equal(t, sum, lm.Md5)
+			obj, err := lmStorage.Get(ctx, lm.FilePath)
+			if assert.Nil(t, err) {
+				b, _ := ioutil.ReadAll(obj)
+				_ = obj.Close()
+				assert.Equal(t, content, b)
+			}
+		}
+
+		// 上传完成后分片已经清理
+		for _, key := range upload.Parts {
+			_, err := lmStorage.Stat(ctx, key)
+			assert.NotNil(t, err)
+		}
+	})
+
+	t.Run("md5 校验失败", func(t *testing.T) {
+		name := time.Now().String() + "name"
+		upload, err := svc.Create(ctx, createdById, subjectId, int64(len(content)), "video.mp4", name, "desc", "00000000000000000000000000000000")
+		if !assert.Nil(t, err) {
+			return
+		}
+		_, err = svc.WriteChunk(ctx, upload, 0, bytes.NewReader(content))
+		assert.NotNil(t, err)
+
+		// 校验失败后上传记录被删除，需要重新上传
+		_, err = svc.Get(ctx, createdById, upload.Id)
+		assert.True(t, errors.Is(err, pg.ErrNoRows))
+	})
+
+	t.Run("只能查询自己的上传", func(t *testing.T) {
+		upload, err := svc.Create(ctx, createdById, subjectId, 10, "", time.Now().String()+"name", "", "")
+		if !assert.Nil(t, err) {
+			return
+		}
+		_, err = svc.Get(ctx, createdById+1, upload.Id)
+		assert.True(t, errors.Is(err, pg.ErrNoRows))
+	})
+
+	// 清空数据
+	_ = testdb.Truncate(db)
+}
@@ -21,15 +21,21 @@ type IUser interface {
 	Update(ctx context.Context, user *model.User, columns []string) error
 	UpdatePassword(ctx context.Context, id int, oldPassword, newPassword string) (*model.User, error)
 
-	Delete(ctx context.Context, id int) error
+	// 设置用户的角色，角色发生变化时之前签发的 token 全部失效
+	SetRoles(ctx context.Context, id int, names []string) (*model.User, error)
+
+	Delete(ctx context.Context, id int) error // 移入回收站
+	Purge(ctx context.Context, id int) error  // 彻底删除回收站中的数据
 }
 
-func NewUser(dao dao.IUser) *User {
-	return &User{Dao: dao}
+// pwdPolicy 为设置密码时的强度要求
+func NewUser(dao dao.IUser, pwdPolicy utils.PwdPolicy) *User {
+	return &User{Dao: dao, PwdPolicy: pwdPolicy}
 }
 
 type User struct {
-	Dao dao.IUser
+	Dao       dao.IUser
+	PwdPolicy utils.PwdPolicy
 }
 
 func (u *User) Create(ctx context.Context, user *model.User) error {
@@ -62,6 +68,10 @@ func (u *User) Create(ctx context.Context, user *model.User) error {
 	}
 
 	// 计算密码 hash
+	err = utils.CheckPwd(user.Password, user.Name, u.PwdPolicy)
+	if err != nil {
+		return err
+	}
 	hash, err := utils.EncodePwd(user.Password)
 	if err != nil {
 		return err
@@ -148,6 +158,10 @@ func (u *User) Update(ctx context.Context, user *model.User, columns []string) e
 
 	// 计算密码 Hash 值
 	if user.Password != "" {
+		err := utils.CheckPwd(user.Password, user.Name, u.PwdPolicy)
+		if err != nil {
+			return err
+		}
 		// 计算新密码 Hash
 		hash, err := utils.EncodePwd(user.Password)
 		if err != nil {
@@ -155,7 +169,19 @@ func (u *User) Update(ctx context.Context, user *model.User, columns []string) e
 		}
 		user.Password = hash
 	}
-	return u.Dao.Update(ctx, user, columns)
+
+	// 修改密码后，之前签发的 token 需要失效
+	err := u.Dao.Update(ctx, user, columns)
+	if err != nil {
+		return err
+	}
+	if u.isPrivilegeChanged(columns) {
+		user.TokenVersion, err = u.Dao.IncrTokenVersion(ctx, user.Id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (u *User) UpdatePassword(ctx context.Context, id int, oldPassword, newPassword string) (*model.User, error) {
@@ -166,31 +192,83 @@ func (u *User) UpdatePassword(ctx context.Context, id int, oldPassword, newPassw
 	if err != nil {
 		return nil, err
 	}
+	switch user.AuthSource {
+	case model.UserAuthSourceLdap:
+		return nil, cerror.BadRequest.WithMsg("账号使用 LDAP 登录，请在 LDAP 中修改密码")
+	case model.UserAuthSourceOidc:
+		return nil, cerror.BadRequest.WithMsg("账号使用单点登录，请在认证服务中修改密码")
+	}
 
 	err = utils.ComparePwd(user.Password, oldPassword)
 	if err != nil {
 		return nil, cerror.BadRequest.WithMsg("旧密码错误")
 	}
 
+	err = utils.CheckPwd(newPassword, user.Name, u.PwdPolicy)
+	if err != nil {
+		return nil, err
+	}
+	if utils.ComparePwd(user.Password, newPassword) == nil {
+		return nil, cerror.BadRequest.WithMsg("新密码不能与旧密码相同")
+	}
+
 	// 计算新密码 Hash
 	hash, err := utils.EncodePwd(newPassword)
 	if err != nil {
 		return nil, err
 	}
 
-	// 更新密码
+	// 更新密码，之前签发的 token 全部失效，需要修改密码的标记同时清除
 	user.Password = hash
-	err = d.Update(ctx, user, []string{"password"})
+	user.MustChangePassword = false
+	err = d.Update(ctx, user, []string{"password", "must_change_password"})
+	if err != nil {
+		return nil, err
+	}
+	user.TokenVersion, err = d.IncrTokenVersion(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 	return user, nil
 }
 
+func (u *User) SetRoles(ctx context.Context, id int, names []string) (*model.User, error) {
+	user, err := u.Dao.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if sameStrings(user.RoleNames(), names) {
+		return user, nil
+	}
+	err = u.Dao.SetRoles(ctx, id, names)
+	if err != nil {
+		return nil, err
+	}
+	// 权限在每次请求时实时查询，token 失效是为了让已登录的客户端重新获取用户信息
+	_, err = u.Dao.IncrTokenVersion(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return u.Dao.Get(ctx, id)
+}
+
+// 移入回收站，用户无法再登录
 func (u *User) Delete(ctx context.Context, id int) error {
 	return u.Dao.Delete(ctx, id)
 }
 
+// 彻底删除回收站中的用户，仍被其他数据引用时不允许，避免留下无效的创建人
+func (u *User) Purge(ctx context.Context, id int) error {
+	is, err := u.Dao.IsReferenced(ctx, id)
+	if err != nil {
+		return err
+	}
+	if is {
+		return cerror.BadRequest.WithMsg("用户仍是其他数据的创建人或更新人，无法彻底删除")
+	}
+	return u.Dao.ForceDelete(ctx, id)
+}
+
 func (u *User) IsNameExist(ctx context.Context, name string, excludeId int) (bool, error) {
 	return u.Dao.IsNameExist(ctx, name, excludeId)
 }
@@ -202,3 +280,39 @@ func (u *User) IsPhoneExist(ctx context.Context, phone string, excludeId int) (b
 func (u *User) IsEmailExist(ctx context.Context, email string, excludeId int) (bool, error) {
 	return u.Dao.IsEmailExist(ctx, email, excludeId)
 }
+
+// 是否修改了密码
+func (u *User) isPrivilegeChanged(columns []string) bool {
+	for _, column := range columns {
+		if column == "password" {
+			return true
+		}
+	}
+	return false
+}
+
+// 两组字符串是否相同，不考虑顺序和重复
+func sameStrings(a, b []string) bool {
+	set := map[string]bool{}
+	for _, v := range a {
+		set[v] = true
+	}
+	for _, v := range b {
+		if !set[v] {
+			return false
+		}
+		delete(set, v)
+	}
+	return len(set) == 0
+}
+
+// 把 names 中的内置角色替换为 role，其他角色保持不变，用于从外部账号同步角色
+func replaceBuiltinRole(names []string, role string) []string {
+	replaced := []string{role}
+	for _, name := range names {
+		if !model.IsBuiltinRole(name) {
+			replaced = append(replaced, name)
+		}
+	}
+	return replaced
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/testdb"
 	"github.com/xuxusheng/time-frequency-be/internal/model"
 	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
 	"math/rand"
 	"testing"
 	"time"
@@ -23,7 +24,11 @@ func prepareUser(t *testing.T, db *pg.DB) []*model.User {
 func TestUserSvc_Create(t *testing.T) {
 
 	pUsers := prepareUser(t, db)
-	svc := NewUser(userDao)
+	svc := NewUser(userDao, utils.PwdPolicy{MinLength: 6})
+	ctx := context.Background()
+	newUser := func(name, phone, email, pwd string) *model.User {
+		return &model.User{CreatedById: pUsers[0].Id, Name: name, NickName: name, Phone: phone, Email: email, Password: pwd}
+	}
 
 	t.Run("用户名、手机号或邮箱重复", func(t *testing.T) {
 		for _, pUser := range pUsers {
@@ -33,15 +38,15 @@ func TestUserSvc_Create(t *testing.T) {
 			email := s + "email"
 			pwd := s + "password"
 			t.Run("用户名重复", func(t *testing.T) {
-				_, err := svc.Create(context.Background(), 1, pUser.Name, phone, email, pwd)
+				err := svc.Create(ctx, newUser(pUser.Name, phone, email, pwd))
 				assert.Equal(t, cerror.BadRequest.WithMsg("用户名已存在"), err)
 			})
 			t.Run("手机号重复", func(t *testing.T) {
-				_, err := svc.Create(context.Background(), 1, name, pUser.Phone, email, pwd)
+				err := svc.Create(ctx, newUser(name, pUser.Phone, email, pwd))
 				assert.Equal(t, cerror.BadRequest.WithMsg("手机号已存在"), err)
 			})
 			t.Run("邮箱重复", func(t *testing.T) {
-				_, err := svc.Create(context.Background(), 1, name, phone, pUser.Email, pwd)
+				err := svc.Create(ctx, newUser(name, phone, pUser.Email, pwd))
 				assert.Equal(t, cerror.BadRequest.WithMsg("邮箱已存在"), err)
 			})
 		}
@@ -55,20 +60,20 @@ func TestUserSvc_Create(t *testing.T) {
 			email := s + "email"
 			pwd := s + "password"
 			t.Run("用户名为空", func(t *testing.T) {
-				_, err := svc.Create(context.Background(), 1, "", phone, email, pwd)
+				err := svc.Create(ctx, newUser("", phone, email, pwd))
 				assert.NotNil(t, err)
 			})
 			t.Run("手机号为空", func(t *testing.T) {
-				_, err := svc.Create(context.Background(), 1, name, "", email, pwd)
+				err := svc.Create(ctx, newUser(name, "", email, pwd))
 				assert.NotNil(t, err)
 			})
 			t.Run("邮箱为空", func(t *testing.T) {
-				_, err := svc.Create(context.Background(), 1, name, phone, "", pwd)
+				err := svc.Create(ctx, newUser(name, phone, "", pwd))
 				assert.NotNil(t, err)
 			})
 			t.Run("密码为空", func(t *testing.T) {
-				_, err := svc.Create(context.Background(), 1, name, phone, email, "")
-				assert.NotNil(t, err)
+				err := svc.Create(ctx, newUser(name, phone, email, ""))
+				assert.Equal(t, cerror.BadRequest.WithMsg("密码长度不能少于 6 位"), err)
 			})
 		}
 	})
@@ -80,12 +85,17 @@ func TestUserSvc_Create(t *testing.T) {
 			phone := s + "phone"
 			email := s + "email"
 			pwd := s + "password"
-			user, err := svc.Create(context.Background(), 1, name, phone, email, pwd)
+			user := newUser(name, phone, email, pwd)
+			user.Roles = []*model.Role{{Name: model.RoleTeacher}}
+			err := svc.Create(ctx, user)
 			if assert.Nil(t, err) {
+				assert.NotZero(t, user.Id)
 				assert.Equal(t, name, user.Name)
 				assert.Equal(t, phone, user.Phone)
 				assert.Equal(t, email, user.Email)
-				assert.Equal(t, pwd, user.Password)
+				// 保存的是密码的 hash
+				assert.Nil(t, utils.ComparePwd(user.Password, pwd))
+				assert.Equal(t, []string{model.RoleTeacher}, user.RoleNames())
 			}
 		}
 	})
@@ -96,7 +106,7 @@ func TestUserSvc_Create(t *testing.T) {
 func TestUserSvc_Get(t *testing.T) {
 
 	pUsers := prepareUser(t, db)
-	svc := NewUser(userDao)
+	svc := NewUser(userDao, utils.PwdPolicy{})
 
 	t.Run("正常获取", func(t *testing.T) {
 		for _, pUser := range pUsers {
@@ -120,7 +130,16 @@ func TestUserSvc_Get(t *testing.T) {
 
 func TestUserSvc_Update(t *testing.T) {
 	pUsers := prepareUser(t, db)
-	svc := NewUser(userDao)
+	svc := NewUser(userDao, utils.PwdPolicy{})
+	update := func(id int, name, phone, email string) (*model.User, error) {
+		user := &model.User{Id: id, Name: name, Phone: phone, Email: email}
+		err := svc.Update(context.Background(), user, []string{"name", "phone", "email"})
+		if err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+
 	t.Run("用户名、手机号或邮箱重复", func(t *testing.T) {
 		for i, pUser := range pUsers {
 			if i == len(pUsers)-1 {
@@ -132,18 +151,18 @@ func TestUserSvc_Update(t *testing.T) {
 			phone := s + "phone"
 			email := s + "email"
 			t.Run("用户名重复", func(t *testing.T) {
-				user, err := svc.Update(context.Background(), pUser.Id, next.Name, phone, email)
-				assert.EqualError(t, err, "用户名已存在")
+				user, err := update(pUser.Id, next.Name, phone, email)
+				assert.Equal(t, cerror.BadRequest.WithMsg("用户名已被占用"), err)
 				assert.Nil(t, user)
 			})
 			t.Run("手机号重复", func(t *testing.T) {
-				user, err := svc.Update(context.Background(), pUser.Id, name, next.Phone, email)
-				assert.EqualError(t, err, "手机号已存在")
+				user, err := update(pUser.Id, name, next.Phone, email)
+				assert.Equal(t, cerror.BadRequest.WithMsg("手机号已被占用"), err)
 				assert.Nil(t, user)
 			})
 			t.Run("邮箱重复", func(t *testing.T) {
-				user, err := svc.Update(context.Background(), pUser.Id, name, phone, next.Email)
-				assert.EqualError(t, err, "邮箱已存在")
+				user, err := update(pUser.Id, name, phone, next.Email)
+				assert.Equal(t, cerror.BadRequest.WithMsg("邮箱已被占用"), err)
 				assert.Nil(t, user)
 			})
 		}
@@ -157,17 +176,17 @@ func TestUserSvc_Update(t *testing.T) {
 			phone := s + "phone"
 			email := s + "email"
 			t.Run("用户名为空", func(t *testing.T) {
-				user, err := svc.Update(context.Background(), id, "", phone, email)
+				user, err := update(id, "", phone, email)
 				assert.NotNil(t, err)
 				assert.Nil(t, user)
 			})
 			t.Run("手机号为空", func(t *testing.T) {
-				user, err := svc.Update(context.Background(), id, name, "", email)
+				user, err := update(id, name, "", email)
 				assert.NotNil(t, err)
 				assert.Nil(t, user)
 			})
 			t.Run("邮箱为空", func(t *testing.T) {
-				user, err := svc.Update(context.Background(), id, name, phone, "")
+				user, err := update(id, name, phone, "")
 				assert.NotNil(t, err)
 				assert.Nil(t, user)
 			})
@@ -177,7 +196,7 @@ func TestUserSvc_Update(t *testing.T) {
 	t.Run("修改一个不存在的用户", func(t *testing.T) {
 		for i := 0; i < 10; i++ {
 			s := time.Now().String()
-			user, err := svc.Update(context.Background(), rand.Intn(100)*10000, s, s, s)
+			user, err := update(rand.Intn(100)*10000, s, s, s)
 			assert.Equal(t, pg.ErrNoRows, err)
 			assert.Nil(t, user)
 		}
@@ -189,7 +208,7 @@ func TestUserSvc_Update(t *testing.T) {
 			name := s + "name"
 			phone := s + "phone"
 			email := s + "email"
-			user, err := svc.Update(context.Background(), pUser.Id, name, phone, email)
+			user, err := update(pUser.Id, name, phone, email)
 			if assert.Nil(t, err) {
 				assert.Equal(t, name, user.Name)
 				assert.Equal(t, phone, user.Phone)
@@ -204,7 +223,7 @@ func TestUserSvc_Update(t *testing.T) {
 
 func TestUserSvc_Delete(t *testing.T) {
 	pUsers := prepareUser(t, db)
-	svc := NewUser(userDao)
+	svc := NewUser(userDao, utils.PwdPolicy{})
 
 	t.Run("正常删除", func(t *testing.T) {
 		for _, pUser := range pUsers {
@@ -228,7 +247,7 @@ func TestUserSvc_Delete(t *testing.T) {
 
 func TestUserSvc_IsNameExist(t *testing.T) {
 	pUsers := prepareUser(t, db)
-	svc := NewUser(userDao)
+	svc := NewUser(userDao, utils.PwdPolicy{})
 
 	t.Run("排除当前用户之后，查找当前用户的用户名", func(t *testing.T) {
 		for _, pUser := range pUsers {
@@ -273,7 +292,7 @@ func TestUserSvc_IsNameExist(t *testing.T) {
 
 func TestUserSvc_IsPhoneExist(t *testing.T) {
 	pUsers := prepareUser(t, db)
-	svc := NewUser(userDao)
+	svc := NewUser(userDao, utils.PwdPolicy{})
 
 	t.Run("排除当前用户之后，查找当前用户的手机号", func(t *testing.T) {
 		for _, pUser := range pUsers {
@@ -318,7 +337,7 @@ func TestUserSvc_IsPhoneExist(t *testing.T) {
 
 func TestUserSvc_IsEmailExist(t *testing.T) {
 	pUsers := prepareUser(t, db)
-	svc := NewUser(userDao)
+	svc := NewUser(userDao, utils.PwdPolicy{})
 
 	t.Run("排除当前用户之后，查找当前用户的邮箱", func(t *testing.T) {
 		for _, pUser := range pUsers {
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/storage"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+)
+
+// 后台任务每轮最多处理的资料数量
+const workerBatchSize = 10
+
+// 按 interval 轮询执行 runOnce，直到 ctx 结束，runOnce 返回本轮处理的数量
+// 一轮处理满 workerBatchSize 说明还有积压，不等待直接进入下一轮
+func runPeriodically(ctx context.Context, name string, interval time.Duration, runOnce func(ctx context.Context) (int, error)) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	for {
+		n, err := runOnce(ctx)
+		if err != nil {
+			log.Printf("%s失败：%v", name, err)
+		}
+		if err == nil && n == workerBatchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// 将存储中的文件复制到本地临时文件，用于需要随机读取或者交给外部程序处理的场景，调用方负责关闭和删除
+func copyToTemp(ctx context.Context, s storage.Storage, tempPath, key string) (*os.File, error) {
+	if tempPath != "" {
+		err := os.MkdirAll(tempPath, os.ModePerm)
+		if err != nil {
+			return nil, err
+		}
+	}
+	obj, err := s.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	f, err := ioutil.TempFile(tempPath, "worker-*")
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(f, obj)
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
@@ -1,6 +1,14 @@
 package utils
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+	"golang.org/x/crypto/bcrypt"
+	"math/big"
+	"strings"
+	"unicode"
+)
 
 func EncodePwd(password string) (string, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -13,3 +21,94 @@ func EncodePwd(password string) (string, error) {
 func ComparePwd(hash, password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 }
+
+// 密码强度要求，对应 setting.App 中 Password 开头的配置，为 0 时不限制
+type PwdPolicy struct {
+	MinLength  int // 最短长度
+	MinClasses int // 至少包含几类字符，大写字母、小写字母、数字和其他符号各算一类
+}
+
+// 校验密码强度，调用 EncodePwd 保存用户输入的密码之前都要先校验，不符合时返回 cerror.BadRequest
+// name 为用户名，密码不能与用户名相同
+func CheckPwd(password, name string, policy PwdPolicy) error {
+	if len([]rune(password)) < policy.MinLength {
+		return cerror.BadRequest.WithMsg(fmt.Sprintf("密码长度不能少于 %d 位", policy.MinLength))
+	}
+	if classes := pwdClasses(password); classes < policy.MinClasses {
+		return cerror.BadRequest.WithMsg(fmt.Sprintf("密码需要包含大写字母、小写字母、数字和符号中的至少 %d 种", policy.MinClasses))
+	}
+	if name != "" && strings.EqualFold(password, name) {
+		return cerror.BadRequest.WithMsg("密码不能与用户名相同")
+	}
+	return nil
+}
+
+// 密码中包含几类字符
+func pwdClasses(password string) int {
+	var upper, lower, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	n := 0
+	for _, b := range []bool{upper, lower, digit, other} {
+		if b {
+			n++
+		}
+	}
+	return n
+}
+
+// 生成初始密码使用的字符，去掉了 0、O、1、l、I 等容易看错的字符
+// 符号中去掉了 = + - @，密码会写入 CSV 交给老师，以这些字符开头时会被当作公式
+var pwdCharsets = []string{
+	"ABCDEFGHJKLMNPQRSTUVWXYZ",
+	"abcdefghijkmnpqrstuvwxyz",
+	"23456789",
+	"!#$%&*?",
+}
+
+// 生成符合密码强度要求的随机密码，用于批量创建账号时的初始密码
+// 至少 10 位，包含大写字母、小写字母和数字，要求 4 类字符时再加上符号
+func GeneratePwd(policy PwdPolicy) (string, error) {
+	length := 10
+	if policy.MinLength > length {
+		length = policy.MinLength
+	}
+	charsets := pwdCharsets[:3]
+	if policy.MinClasses > 3 {
+		charsets = pwdCharsets
+	}
+
+	// 先从每类字符中各取一个，剩下的从所有字符中取，最后打乱顺序
+	all := strings.Join(charsets, "")
+	pwd := make([]byte, 0, length)
+	for i := 0; i < length; i++ {
+		chars := all
+		if i < len(charsets) {
+			chars = charsets[i]
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+		if err != nil {
+			return "", err
+		}
+		pwd = append(pwd, chars[n.Int64()])
+	}
+	for i := len(pwd) - 1; i > 0; i-- {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		j := n.Int64()
+		pwd[i], pwd[j] = pwd[j], pwd[i]
+	}
+	return string(pwd), nil
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/cerror"
+)
+
+func TestCheckPwd(t *testing.T) {
+	policy := PwdPolicy{MinLength: 8, MinClasses: 2}
+
+	t.Run("符合要求", func(t *testing.T) {
+		assert.Nil(t, CheckPwd("abcd1234", "zhangsan", policy))
+		assert.Nil(t, CheckPwd("密码密码密码abcd", "zhangsan", policy))
+	})
+	t.Run("长度不够", func(t *testing.T) {
+		assert.Equal(t, cerror.BadRequest.WithMsg("密码长度不能少于 8 位"), CheckPwd("abc123", "zhangsan", policy))
+	})
+	t.Run("字符种类不够", func(t *testing.T) {
+		assert.Equal(t, cerror.BadRequest.WithMsg("密码需要包含大写字母、小写字母、数字和符号中的至少 2 种"), CheckPwd("12345678", "zhangsan", policy))
+	})
+	t.Run("与用户名相同", func(t *testing.T) {
+		assert.Equal(t, cerror.BadRequest.WithMsg("密码不能与用户名相同"), CheckPwd("Zhangsan1", "zhangsan1", policy))
+	})
+	t.Run("不限制", func(t *testing.T) {
+		assert.Nil(t, CheckPwd("1", "", PwdPolicy{}))
+	})
+}
+
+func TestGeneratePwd(t *testing.T) {
+	for _, policy := range []PwdPolicy{{}, {MinLength: 16, MinClasses: 3}, {MinLength: 8, MinClasses: 4}} {
+		pwd, err := GeneratePwd(policy)
+		if assert.Nil(t, err) {
+			assert.Nil(t, CheckPwd(pwd, "", policy))
+			assert.GreaterOrEqual(t, len(pwd), 10)
+		}
+	}
+
+	// 每次生成的都不一样
+	a, _ := GeneratePwd(PwdPolicy{})
+	b, _ := GeneratePwd(PwdPolicy{})
+	assert.NotEqual(t, a, b)
+}
@@ -1,14 +1,24 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/go-pg/pg/v10"
 	"github.com/kataras/iris/v12"
 	"github.com/xuxusheng/time-frequency-be/global"
 	"github.com/xuxusheng/time-frequency-be/internal/app"
+	"github.com/xuxusheng/time-frequency-be/internal/dao"
 	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/database"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/mailer"
 	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/setting"
+	"github.com/xuxusheng/time-frequency-be/internal/infrastructure/storage"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/hls"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/segment"
+	"github.com/xuxusheng/time-frequency-be/internal/pkg/thumbnail"
+	"github.com/xuxusheng/time-frequency-be/internal/service"
+	"github.com/xuxusheng/time-frequency-be/internal/utils"
 	"log"
+	"time"
 )
 
 // @title 时频培训系统 API 接口文档
@@ -24,11 +34,85 @@ func main() {
 		log.Fatalf("初始化全局配置项失败：%v", err)
 	}
 
+	// 数据库初始化时需要为已有数据生成全文检索字段，分词要先准备好
+	global.Segmenter, err = segment.New(global.Setting.Search.DictPath)
+	if err != nil {
+		log.Fatalf("加载分词词典失败：%v", err)
+	}
+
 	global.DB, err = setupDB(global.Setting)
 	if err != nil {
 		log.Fatalf("初始化数据库连接失败：%v", err)
 	}
 
+	global.Storage, err = storage.New(global.Setting.Storage)
+	if err != nil {
+		log.Fatalf("初始化文件存储失败：%v", err)
+	}
+
+	global.Mailer, err = mailer.New(global.Setting.Mail)
+	if err != nil {
+		log.Fatalf("初始化邮件发送失败：%v", err)
+	}
+
+	// 后台提取学习资料文件的正文
+	extractSvc := service.NewExtract(dao.NewLearningMaterial(global.DB), global.Storage, global.Setting.Storage.TempPath, global.Setting.Search.ExtractMaxSize<<20)
+	go extractSvc.Run(context.Background(), global.Setting.Search.ExtractInterval)
+
+	// 后台生成学习资料的预览图
+	previewSvc := service.NewPreview(dao.NewLearningMaterial(global.DB), global.Storage, global.Setting.Storage.TempPath, thumbnail.Options{
+		Width:        global.Setting.Preview.Width,
+		FfmpegPath:   global.Setting.Preview.FfmpegPath,
+		PdftoppmPath: global.Setting.Preview.PdftoppmPath,
+	})
+	go previewSvc.Run(context.Background(), global.Setting.Preview.Interval)
+
+	// 后台将视频转码为 HLS，没有配置 ffmpeg 时只清理已删除资料的转码结果
+	var renditions []hls.Rendition
+	for _, r := range global.Setting.Transcode.Renditions {
+		renditions = append(renditions, hls.Rendition{Name: r.Name, Height: r.Height, VideoBitrate: r.VideoBitrate, AudioBitrate: r.AudioBitrate})
+	}
+	transcodeSvc := service.NewTranscode(dao.NewTranscodeJob(global.DB), dao.NewLearningMaterial(global.DB), dao.NewLearningMaterialVersion(global.DB),
+		global.Storage, global.Setting.Storage.TempPath, global.Setting.Transcode.FfmpegPath, renditions)
+	go transcodeSvc.Run(context.Background(), global.Setting.Transcode.Interval)
+
+	// 后台彻底删除回收站中超过保留时长的数据，没有配置保留时长时不处理
+	lmSvc := service.NewLearningMaterial(dao.NewLearningMaterial(global.DB), dao.NewLearningMaterialVersion(global.DB), global.Storage, global.Setting.Storage.TempPath)
+	userSvc := service.NewUser(dao.NewUser(global.DB), utils.PwdPolicy{
+		MinLength:  global.Setting.App.PasswordMinLength,
+		MinClasses: global.Setting.App.PasswordMinClasses,
+	})
+	recycleBinSvc := service.NewRecycleBin(dao.NewRecycleBin(global.DB), dao.NewLearningMaterial(global.DB), userSvc,
+		service.NewClass(dao.NewClass(global.DB), dao.NewUser(global.DB)), service.NewSubject(dao.NewSubject(global.DB)), lmSvc, global.Setting.App.RecycleBinRetention)
+	go recycleBinSvc.Run(context.Background(), time.Hour)
+
+	// 后台删除过期的刷新 token
+	tokenSvc := service.NewToken(dao.NewRefreshToken(global.DB), dao.NewSession(global.DB), dao.NewUser(global.DB), global.Setting.JWT.Secret, global.Setting.JWT.Expire, global.Setting.JWT.RefreshExpire)
+	go tokenSvc.Run(context.Background(), time.Hour)
+
+	// 后台删除已经不再生效的登录失败记录
+	loginGuardSvc := service.NewLoginGuard(dao.NewLoginFailure(global.DB), service.LoginGuardOptions{
+		MaxFailures:   global.Setting.App.LoginMaxFailures,
+		IpMaxFailures: global.Setting.App.LoginIpMaxFailures,
+		LockDuration:  global.Setting.App.LoginLockDuration,
+		Window:        global.Setting.App.LoginFailureWindow,
+		Delay:         global.Setting.App.LoginDelay,
+	})
+	go loginGuardSvc.Run(context.Background(), time.Hour)
+
+	// 后台删除过期的重置密码链接
+	passwordResetSvc := service.NewPasswordReset(dao.NewPasswordReset(global.DB), dao.NewUser(global.DB), userSvc, global.Mailer,
+		global.Setting.App.PasswordResetUrl, global.Setting.App.PasswordResetExpire)
+	go passwordResetSvc.Run(context.Background(), time.Hour)
+
+	// 后台删除过期的单点登录 state 和 ticket，清理只用到数据表
+	oidcSvc := service.NewOidc(dao.NewOidcLogin(global.DB), nil, nil, nil, service.OidcOptions{})
+	go oidcSvc.Run(context.Background(), time.Hour)
+
+	// 后台导出数据较多的用户名单，并删除超过保留时长的导出文件
+	exportSvc := service.NewExport(dao.NewExportJob(global.DB), dao.NewUser(global.DB), global.Storage, global.Setting.Storage.TempPath, global.Setting.Export.Retention)
+	go exportSvc.Run(context.Background(), global.Setting.Export.Interval)
+
 	a := app.New()
 
 	a.Run(